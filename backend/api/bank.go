@@ -0,0 +1,265 @@
+package api
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/reconciliation"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxStatementSize is the max size of an uploaded bank statement in bytes
+const maxStatementSize = 20 * 1024 * 1024
+
+// bankTransactionPage is the response body of GetBankTransactionsHandler
+type bankTransactionPage struct {
+	Transactions []*model.BankTransaction `json:"transactions"`
+	Total        int64                    `json:"total"`
+	Offset       int                      `json:"offset"`
+	Limit        int                      `json:"limit"`
+	Next         *string                  `json:"next"`
+	Previous     *string                  `json:"previous"`
+}
+
+// proposalPage is the response body of GetProposalsHandler
+type proposalPage struct {
+	Proposals []*model.MatchProposal `json:"proposals"`
+	Total     int64                  `json:"total"`
+	Offset    int                    `json:"offset"`
+	Limit     int                    `json:"limit"`
+	Next      *string                `json:"next"`
+	Previous  *string                `json:"previous"`
+}
+
+// reconcileReport is the response body of ReconcileHandler
+type reconcileReport struct {
+	Proposals int `json:"proposals"`
+}
+
+// ImportBankStatementHandler takes a CAMT.053, MT940 or CSV bank statement in the "statement" form field. Its new
+// transactions are stored and matched to the unpaid invoices, the response reports how many
+func (s *Server) ImportBankStatementHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxStatementSize)
+	file, header, err := r.FormFile("statement")
+	if err != nil {
+		s.logger.Warn("Failed to read uploaded bank statement", zap.Error(err))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, errFileTooLarge.WithDetails(err.Error()))
+		} else {
+			s.writeError(w, errValidationFailed.WithDetails("a bank statement is required in the statement form field"))
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		s.logger.Warn("Failed to read uploaded bank statement", zap.String("filename", header.Filename), zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	bankImport, err := s.reconciler.Import(header.Filename, content)
+	if errors.Is(err, reconciliation.ErrInvalidStatement) {
+		s.writeError(w, errInvalidFileType.WithDetails(err.Error()))
+		return
+	}
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, bankImport)
+}
+
+// GetBankTransactionsHandler lists the imported transactions with their proposals, optionally only those in the
+// status query parameter
+func (s *Server) GetBankTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, limit, err := parsePagination(query)
+	if err != nil {
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+	status := query.Get("status")
+	if status != "" && !model.ValidTransactionStatus(status) {
+		s.writeError(w, errValidationFailed.WithDetails("status must be one of unmatched, proposed and reconciled"))
+		return
+	}
+
+	transactions, total, err := s.storageManager.GetBankTransactions(status, offset, limit)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	page := bankTransactionPage{
+		Transactions: transactions,
+		Total:        total,
+		Offset:       offset,
+		Limit:        limit,
+		Next:         pageLink(r.URL, offset+limit, total),
+	}
+	if offset > 0 {
+		page.Previous = pageLink(r.URL, max(offset-limit, 0), total)
+	}
+
+	s.writeJSON(w, http.StatusOK, page)
+}
+
+// ReconcileHandler matches the unmatched transactions again, e.g. after the invoices they paid were uploaded
+func (s *Server) ReconcileHandler(w http.ResponseWriter, r *http.Request) {
+	proposals, err := s.reconciler.Reconcile()
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, reconcileReport{Proposals: proposals})
+}
+
+// GetProposalsHandler lists the match proposals best first with their transaction and invoice, optionally only those
+// in the status query parameter
+func (s *Server) GetProposalsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, limit, err := parsePagination(query)
+	if err != nil {
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+	status := query.Get("status")
+	if status != "" && !model.ValidProposalStatus(status) {
+		s.writeError(w, errValidationFailed.WithDetails("status must be one of open, confirmed and rejected"))
+		return
+	}
+
+	proposals, total, err := s.storageManager.GetProposals(status, offset, limit)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	for _, proposal := range proposals {
+		if proposal.Invoice != nil {
+			setPaymentStatus(proposal.Invoice)
+		}
+	}
+	page := proposalPage{
+		Proposals: proposals,
+		Total:     total,
+		Offset:    offset,
+		Limit:     limit,
+		Next:      pageLink(r.URL, offset+limit, total),
+	}
+	if offset > 0 {
+		page.Previous = pageLink(r.URL, max(offset-limit, 0), total)
+	}
+
+	s.writeJSON(w, http.StatusOK, page)
+}
+
+// proposal returns the open proposal of the id path parameter, writing the error response if it does not exist or
+// is not open anymore
+func (s *Server) proposal(w http.ResponseWriter, r *http.Request) (*model.MatchProposal, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id == 0 {
+		s.logger.Warn("Invalid proposal id", zap.String("id", mux.Vars(r)["id"]))
+		s.writeError(w, errValidationFailed.WithDetails("proposal id must be a positive integer"))
+		return nil, false
+	}
+
+	proposal, err := s.storageManager.GetProposal(uint(id))
+	if err != nil {
+		s.writeError(w, errServerError)
+		return nil, false
+	}
+	if proposal == nil || proposal.Transaction == nil || proposal.Invoice == nil {
+		s.writeError(w, errNotFound.WithDetails("proposal "+strconv.FormatUint(id, 10)+" does not exist"))
+		return nil, false
+	}
+	if proposal.Status != model.ProposalOpen {
+		s.writeError(w, errProposalNotOpen.WithDetails("proposal is "+proposal.Status))
+		return nil, false
+	}
+
+	return proposal, true
+}
+
+// ConfirmProposalHandler confirms that the transaction paid the invoice, the transaction is recorded as a payment of
+// the invoice. The other proposals of the transaction are rejected
+func (s *Server) ConfirmProposalHandler(w http.ResponseWriter, r *http.Request) {
+	proposal, ok := s.proposal(w, r)
+	if !ok {
+		return
+	}
+
+	invoice, err := s.storageManager.GetInvoiceByHash(proposal.InvoiceHash)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if invoice == nil {
+		s.writeError(w, errNotFound.WithDetails("invoice "+proposal.InvoiceHash+" does not exist"))
+		return
+	}
+
+	transaction := proposal.Transaction
+	payment := &model.Payment{
+		InvoiceHash: invoice.FileHash,
+		Date:        transaction.BookingDate,
+		Amount:      transaction.PaymentAmount(),
+		Method:      "bankTransfer",
+		Reference:   strings.TrimSpace(transaction.RemittanceInfo),
+		Note:        "Bank transaction " + strconv.FormatUint(uint64(transaction.ID), 10),
+	}
+	if payment.Reference == "" {
+		payment.Reference = transaction.Reference
+	}
+	// CSV statements do not always state their currency
+	if invoice.Amount != nil {
+		payment.Amount = payment.Amount.InCurrency(invoice.Amount.Currency)
+	}
+	if problem := validatePayment(payment, invoice); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
+		return
+	}
+
+	err = s.storageManager.ConfirmProposal(proposal, payment)
+	if errors.Is(err, db.ErrProposalNotOpen) {
+		s.writeError(w, errProposalNotOpen)
+		return
+	}
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, payment)
+}
+
+// RejectProposalHandler rejects a proposal, it is not made again
+func (s *Server) RejectProposalHandler(w http.ResponseWriter, r *http.Request) {
+	proposal, ok := s.proposal(w, r)
+	if !ok {
+		return
+	}
+
+	err := s.storageManager.RejectProposal(proposal)
+	if errors.Is(err, db.ErrProposalNotOpen) {
+		s.writeError(w, errProposalNotOpen)
+		return
+	}
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
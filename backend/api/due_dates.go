@@ -0,0 +1,55 @@
+package api
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"net/http"
+)
+
+// maxTermDays bounds the days of payment terms, anything longer is a misreading
+const maxTermDays = 366
+
+// validatePaymentTerms returns a description of what is wrong with the terms, or an empty string
+func validatePaymentTerms(terms *model.PaymentTerms) string {
+	switch {
+	case terms == nil:
+		return ""
+	case terms.NetDays < 0 || terms.NetDays > maxTermDays:
+		return "paymentTerms: netDays must be between 0 and 366"
+	case terms.DiscountPercent < 0 || terms.DiscountPercent >= 100:
+		return "paymentTerms: discountPercent must be a percentage below 100"
+	case terms.DiscountDays < 0 || terms.DiscountDays > terms.NetDays:
+		return "paymentTerms: discountDays must be between 0 and netDays"
+	default:
+		return ""
+	}
+}
+
+// setPaymentStatus fills in the payment status of the invoices for the current day
+func setPaymentStatus(invoices ...*model.Invoice) {
+	today := model.Today()
+	for _, invoice := range invoices {
+		invoice.SetPaymentStatus(today)
+	}
+}
+
+// GetAgingReportHandler sums up the unpaid invoices by days past their due date, as of the date query parameter.
+// Defaults to today
+func (s *Server) GetAgingReportHandler(w http.ResponseWriter, r *http.Request) {
+	date, err := parseOptionalDate(r.URL.Query(), "date")
+	if err != nil {
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+	if date == nil {
+		today := model.Today()
+		date = &today
+	}
+
+	invoices, err := s.storageManager.GetUnpaidInvoices()
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, model.AgeInvoices(invoices, *date))
+}
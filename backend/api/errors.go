@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// ErrorCode identifies the kind of error in API responses. The codes are part of the API, clients switch on them,
+// so existing codes must not be renamed
+type ErrorCode string
+
+const (
+	ErrorInvoiceAlreadyExists ErrorCode = "INVOICE_ALREADY_EXISTS"
+	ErrorInvalidFileType      ErrorCode = "INVALID_FILE_TYPE"
+	ErrorFileTooLarge         ErrorCode = "FILE_TOO_LARGE"
+	ErrorEncryptedPDF         ErrorCode = "ENCRYPTED_PDF"
+	ErrorPDFJavaScript        ErrorCode = "PDF_JAVASCRIPT"
+	ErrorTooManyPages         ErrorCode = "TOO_MANY_PAGES"
+	ErrorNotFound             ErrorCode = "NOT_FOUND"
+	ErrorForbidden            ErrorCode = "FORBIDDEN"
+	ErrorValidationFailed     ErrorCode = "VALIDATION_FAILED"
+	ErrorStorageUnavailable   ErrorCode = "STORAGE_UNAVAILABLE"
+	ErrorLLMFailure           ErrorCode = "LLM_FAILURE"
+	ErrorServiceUnavailable   ErrorCode = "SERVICE_UNAVAILABLE"
+	ErrorProposalNotOpen      ErrorCode = "PROPOSAL_NOT_OPEN"
+	ErrorPaymentScheduled     ErrorCode = "PAYMENT_SCHEDULED"
+	ErrorServerError          ErrorCode = "SERVER_ERROR"
+)
+
+// APIError is the error returned by all handlers, wrapped in the {"error": ...} envelope
+type APIError struct {
+	Status  int       `json:"-"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details string    `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if e.Details == "" {
+		return string(e.Code) + ": " + e.Message
+	}
+	return string(e.Code) + ": " + e.Message + ": " + e.Details
+}
+
+// WithDetails returns a copy of the error with details, e.g. which field failed validation
+func (e *APIError) WithDetails(details string) *APIError {
+	withDetails := *e
+	withDetails.Details = details
+	return &withDetails
+}
+
+var (
+	errInvoiceAlreadyExists = &APIError{http.StatusConflict, ErrorInvoiceAlreadyExists, "Invoice already exists", ""}
+	errInvalidFileType      = &APIError{http.StatusBadRequest, ErrorInvalidFileType, "Invalid file type", ""}
+	errFileTooLarge         = &APIError{http.StatusRequestEntityTooLarge, ErrorFileTooLarge, "File is too large", ""}
+	errEncryptedPDF         = &APIError{http.StatusBadRequest, ErrorEncryptedPDF, "PDF is encrypted or password protected", ""}
+	errPDFJavaScript        = &APIError{http.StatusBadRequest, ErrorPDFJavaScript, "PDF contains JavaScript", ""}
+	errTooManyPages         = &APIError{http.StatusBadRequest, ErrorTooManyPages, "PDF has too many pages", ""}
+	errNotFound             = &APIError{http.StatusNotFound, ErrorNotFound, "Not found", ""}
+	errForbidden            = &APIError{http.StatusForbidden, ErrorForbidden, "Forbidden", ""}
+	errValidationFailed     = &APIError{http.StatusBadRequest, ErrorValidationFailed, "Validation failed", ""}
+	errStorageUnavailable   = &APIError{http.StatusServiceUnavailable, ErrorStorageUnavailable, "File storage is unavailable", ""}
+	errLLMFailure           = &APIError{http.StatusBadGateway, ErrorLLMFailure, "Invoice field extraction with LLM failed", ""}
+	errServiceUnavailable   = &APIError{http.StatusServiceUnavailable, ErrorServiceUnavailable, "Service unavailable", ""}
+	errProposalNotOpen      = &APIError{http.StatusConflict, ErrorProposalNotOpen, "Proposal was confirmed or rejected already", ""}
+	errPaymentScheduled     = &APIError{http.StatusConflict, ErrorPaymentScheduled, "Transfer is scheduled already", ""}
+	errServerError          = &APIError{http.StatusInternalServerError, ErrorServerError, "Internal server error", ""}
+)
+
+type errorResponse struct {
+	Error *APIError `json:"error"`
+}
+
+// writeJSON writes the body as a JSON response with the given status
+func (s *Server) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		s.logger.Error("Failed to marshal response to JSON", zap.Error(err))
+		s.writeError(w, errServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonBody)
+}
+
+// writeError writes the error envelope with the status of the error
+func (s *Server) writeError(w http.ResponseWriter, apiErr *APIError) {
+	jsonBody, err := json.Marshal(errorResponse{apiErr})
+	if err != nil {
+		// cannot happen, the envelope only holds strings
+		s.logger.Error("Failed to marshal error to JSON", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(apiErr.Status)
+	w.Write(jsonBody)
+}
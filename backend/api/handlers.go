@@ -1,49 +1,127 @@
 package api
 
 import (
-	"crypto/sha256"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/email"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/ingest"
 	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
-	"github.com/gen2brain/go-fitz"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/preview"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
 	"github.com/gorilla/mux"
-	"github.com/tmc/langchaingo/llms"
 	"go.uber.org/zap"
 	"io"
+	"mime/multipart"
 	"net/http"
-	"path/filepath"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
 )
 
 const (
-	// Max file size in bytes
-	maxFileSize       = 10 * 1024 * 1024
-	llmPromptTemplate = `Extract the invoice number (aliased as "id"), date (formatted YYYY-MM-DD), and total amount from the following text. Fields are optional, set to null if not found in text. Your answer MUST contain ONLY a JSON response of a following format:
-	{
-		"id": "123456",
-		"date": "2021-01-01",
-		"amount": 123.45
-	}
-	
-	Text: %s`
+	// Max size of an upload request in bytes, several files or an archive may be uploaded at once
+	maxUploadSize = 200 * 1024 * 1024
+	// Max size of uploaded files kept in memory while parsing the form, the rest is buffered on disk
+	maxUploadMemory = 32 * 1024 * 1024
 )
 
-func (s *Server) GetAllInvoicesHandler(w http.ResponseWriter, _ *http.Request) {
-	invoices, err := s.storageManager.GetAllInvoices()
+// invoicePage is the response body of GetAllInvoicesHandler
+type invoicePage struct {
+	Invoices []*model.Invoice `json:"invoices"`
+	Total    int64            `json:"total"`
+	Offset   int              `json:"offset"`
+	Limit    int              `json:"limit"`
+	Next     *string          `json:"next"`
+	Previous *string          `json:"previous"`
+}
+
+func (s *Server) GetAllInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseInvoiceFilter(r.URL.Query())
+	if err != nil {
+		s.logger.Warn("Invalid invoice query parameters", zap.String("query", r.URL.RawQuery), zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	invoices, total, err := s.storageManager.QueryInvoices(filter)
+	if err != nil {
+		s.logger.Error("Failed to retrieve invoices from database", zap.Error(err))
+		s.writeError(w, errServerError)
+		return
+	}
+
+	setPaymentStatus(invoices...)
+	page := invoicePage{
+		Invoices: invoices,
+		Total:    total,
+		Offset:   filter.Offset,
+		Limit:    filter.Limit,
+		Next:     pageLink(r.URL, filter.Offset+filter.Limit, total),
+	}
+	if filter.Offset > 0 {
+		page.Previous = pageLink(r.URL, max(filter.Offset-filter.Limit, 0), total)
+	}
+
+	s.writeJSON(w, http.StatusOK, page)
+}
+
+// searchPage is the response body of SearchInvoicesHandler
+type searchPage struct {
+	Results  []*model.InvoiceSearchResult `json:"results"`
+	Total    int64                        `json:"total"`
+	Offset   int                          `json:"offset"`
+	Limit    int                          `json:"limit"`
+	Next     *string                      `json:"next"`
+	Previous *string                      `json:"previous"`
+}
+
+func (s *Server) SearchInvoicesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	offset, limit, err := parsePagination(query)
 	if err != nil {
-		s.logger.Error("Failed to retrieve all invoices from database", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Warn("Invalid search query parameters", zap.String("query", r.URL.RawQuery), zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	q := query.Get("q")
+	if q == "" {
+		s.logger.Warn("Search query is missing")
+		s.writeError(w, errValidationFailed.WithDetails("q is required"))
 		return
 	}
 
-	jsonInvoices, err := json.Marshal(invoices)
+	results, total, err := s.storageManager.SearchInvoices(q, offset, limit)
+	if errors.Is(err, db.ErrSearchUnavailable) {
+		s.writeError(w, errServiceUnavailable.WithDetails(err.Error()))
+		return
+	}
 	if err != nil {
-		s.logger.Error("Failed to marshal invoices to JSON", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Error("Failed to search invoices", zap.String("q", q), zap.Error(err))
+		s.writeError(w, errServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonInvoices)
+	for _, result := range results {
+		setPaymentStatus(&result.Invoice)
+	}
+	page := searchPage{
+		Results: results,
+		Total:   total,
+		Offset:  offset,
+		Limit:   limit,
+		Next:    pageLink(r.URL, offset+limit, total),
+	}
+	if offset > 0 {
+		page.Previous = pageLink(r.URL, max(offset-limit, 0), total)
+	}
+
+	s.writeJSON(w, http.StatusOK, page)
 }
 
 func (s *Server) CheckInvoiceExistsHandler(w http.ResponseWriter, r *http.Request) {
@@ -51,27 +129,21 @@ func (s *Server) CheckInvoiceExistsHandler(w http.ResponseWriter, r *http.Reques
 	hash, present := vars["hash"]
 	if !present {
 		s.logger.Error("Hash path parameter is missing. This handler should not have been called, check the router", zap.String("path", r.URL.Path))
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, errValidationFailed.WithDetails("hash is required"))
+		return
 	}
 
 	invoice, err := s.storageManager.GetInvoiceByHash(hash)
 	if err != nil {
 		s.logger.Error("Failed to retrieve invoice from database", zap.String("hash", hash), zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.writeError(w, errServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	jsonResponse, err := json.Marshal(map[string]interface{}{
+	s.writeJSON(w, http.StatusOK, map[string]interface{}{
 		"invoice":    invoice,
 		"fileExists": invoice != nil && invoice.FileExists,
 	})
-	if err != nil {
-		s.logger.Error("Failed to marshal response to JSON", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	w.Write(jsonResponse)
 }
 
 func (s *Server) GetInvoiceHandler(w http.ResponseWriter, r *http.Request) {
@@ -79,31 +151,24 @@ func (s *Server) GetInvoiceHandler(w http.ResponseWriter, r *http.Request) {
 	hash, present := vars["hash"]
 	if !present {
 		s.logger.Error("Hash path parameter is missing. This handler should not have been called, check the router", zap.String("path", r.URL.Path))
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, errValidationFailed.WithDetails("hash is required"))
 		return
 	}
 
 	invoice, err := s.storageManager.GetInvoiceByHash(hash)
 	if err != nil {
 		s.logger.Error("Failed to retrieve invoice from database", zap.String("hash", hash), zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.writeError(w, errServerError)
 		return
 	}
 
 	if invoice == nil {
-		w.WriteHeader(http.StatusNotFound)
+		s.writeError(w, errNotFound.WithDetails("invoice "+hash+" does not exist"))
 		return
 	}
 
-	jsonInvoice, err := json.Marshal(invoice)
-	if err != nil {
-		s.logger.Error("Failed to marshal invoice to JSON", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.Write(jsonInvoice)
+	setPaymentStatus(invoice)
+	s.writeJSON(w, http.StatusOK, invoice)
 }
 
 func (s *Server) UpdateInvoiceHandler(w http.ResponseWriter, r *http.Request) {
@@ -111,7 +176,7 @@ func (s *Server) UpdateInvoiceHandler(w http.ResponseWriter, r *http.Request) {
 	hash, present := vars["hash"]
 	if !present {
 		s.logger.Error("Hash path parameter is missing. This handler should not have been called, check the router", zap.String("path", r.URL.Path))
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, errValidationFailed.WithDetails("hash is required"))
 		return
 	}
 
@@ -119,28 +184,51 @@ func (s *Server) UpdateInvoiceHandler(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&invoiceUpdate)
 	if err != nil {
 		s.logger.Warn("Failed to decode request body", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
 		return
 	}
 
 	invoiceUpdate.FileHash = hash
-
-	invoice, err := s.storageManager.UpdateInvoice(invoiceUpdate.ToInvoice(), true)
-	if err != nil {
-		s.logger.Error("Failed to update invoice in database", zap.String("hash", hash), zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	if problem := validateTaxBreakdown(invoiceUpdate.TaxBreakdown); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
 		return
 	}
+	if problem := validatePaymentTerms(invoiceUpdate.PaymentTerms); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
+		return
+	}
+	if invoiceUpdate.Amount != nil {
+		invoice, ok := s.invoice(w, r)
+		if !ok {
+			return
+		}
+		if problem := validateAmountCurrency(invoiceUpdate.Amount, invoice.Payments); problem != "" {
+			s.writeError(w, errValidationFailed.WithDetails(problem))
+			return
+		}
+	}
 
-	w.Header().Set("Content-Type", "application/json")
-	jsonInvoice, err := json.Marshal(invoice)
+	if invoiceUpdate.VendorID != nil {
+		vendor, err := s.storageManager.GetVendor(*invoiceUpdate.VendorID)
+		if err != nil {
+			s.writeError(w, errServerError)
+			return
+		}
+		if vendor == nil {
+			s.writeError(w, errValidationFailed.WithDetails("vendor "+strconv.FormatUint(uint64(*invoiceUpdate.VendorID), 10)+" does not exist"))
+			return
+		}
+	}
+
+	invoice, err := s.storageManager.UpdateInvoice(invoiceUpdate.ToInvoice(), true)
 	if err != nil {
-		s.logger.Error("Failed to marshal updated invoice to JSON", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Error("Failed to update invoice in database", zap.String("hash", hash), zap.Error(err))
+		s.writeError(w, errServerError)
 		return
 	}
 
-	w.Write(jsonInvoice)
+	setPaymentStatus(invoice)
+	s.writeJSON(w, http.StatusOK, invoice)
 }
 
 func (s *Server) GetInvoiceFileHandler(w http.ResponseWriter, r *http.Request) {
@@ -148,142 +236,304 @@ func (s *Server) GetInvoiceFileHandler(w http.ResponseWriter, r *http.Request) {
 	hash, present := vars["hash"]
 	if !present {
 		s.logger.Error("Hash path parameter is missing. This handler should not have been called, check the router", zap.String("path", r.URL.Path))
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, errValidationFailed.WithDetails("hash is required"))
+		return
 	}
 
-	fileURL, err := s.filestoreClient.GetFileLink(r.Context(), hash+".pdf")
-	if err != nil {
-		s.logger.Error("Failed to get file link from filestore", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	// the original XML of e-invoices uploaded as XML is stored next to the PDF rendered from it
+	object := hash + ".pdf"
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "pdf":
+	case "xml":
+		object = hash + ".xml"
+		exists, err := filestore.Exists(r.Context(), s.fileStore, object)
+		if err != nil {
+			s.logger.Error("Failed to check if file exists in filestore", zap.String("object", object), zap.Error(err))
+			s.writeError(w, errStorageUnavailable)
+			return
+		}
+		if !exists {
+			s.writeError(w, errNotFound.WithDetails("the invoice was not uploaded as XML"))
+			return
+		}
+	default:
+		s.writeError(w, errValidationFailed.WithDetails("format must be pdf or xml"))
 		return
 	}
 
-	urlBytes, err := json.Marshal(fileURL.String())
+	fileURL, err := s.fileStore.Link(r.Context(), object)
 	if err != nil {
-		s.logger.Error("Failed to marshal file URL", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Error("Failed to get file link from filestore", zap.Error(err))
+		s.writeError(w, errStorageUnavailable)
 		return
 	}
 
-	w.Write(urlBytes)
+	s.writeJSON(w, http.StatusOK, fileURL.String())
 }
 
-func (s *Server) FileUploadHandler(w http.ResponseWriter, r *http.Request) {
-	file, header, err := r.FormFile("invoice")
+// GetPageImageHandler serves a page of the invoice file as a PNG image, rendered at the resolution of the dpi query
+// parameter, preview.DefaultDPI by default. With thumbnail=true the thumbnail of the first page is served instead,
+// which is rendered when the invoice is processed. Images never change for a hash, so clients may cache them for good
+func (s *Server) GetPageImageHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	hash := vars["hash"]
+	page, err := strconv.Atoi(vars["page"])
+	if err != nil || page < 1 {
+		s.writeError(w, errValidationFailed.WithDetails("page must be a positive integer"))
+		return
+	}
+	query := r.URL.Query()
+	thumbnail, err := parseOptionalBool(query, "thumbnail")
 	if err != nil {
-		s.logger.Warn("Failed to get file from form", zap.Error(err))
-		w.WriteHeader(http.StatusBadRequest)
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
 		return
 	}
-	defer file.Close()
-
-	// Validate file type and size
-	if filepath.Ext(header.Filename) != ".pdf" ||
-		header.Size > maxFileSize {
-		s.logger.Warn("Invalid file type or size", zap.String("filename", header.Filename), zap.Int64("size", header.Size))
-		w.WriteHeader(http.StatusBadRequest)
+	dpi, err := parseInt(query, "dpi", preview.DefaultDPI)
+	if err != nil {
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
 		return
 	}
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		s.logger.Warn("Failed to compute file hash", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	var image []byte
+	var etag string
+	if thumbnail != nil && *thumbnail {
+		if page != 1 {
+			s.writeError(w, errValidationFailed.WithDetails("thumbnails are of the first page only"))
+			return
+		}
+		etag = fmt.Sprintf(`"%s-thumbnail"`, hash)
+		image, err = s.renderer.Thumbnail(r.Context(), hash)
+	} else {
+		if dpi < preview.MinDPI || dpi > preview.MaxDPI {
+			s.writeError(w, errValidationFailed.WithDetails(fmt.Sprintf("dpi must be between %d and %d", preview.MinDPI, preview.MaxDPI)))
+			return
+		}
+		etag = fmt.Sprintf(`"%s-%d-%d"`, hash, page, dpi)
+		image, err = s.renderer.Page(r.Context(), hash, page, dpi)
+	}
+	switch {
+	case errors.Is(err, filestore.ErrNotFound):
+		s.writeError(w, errNotFound.WithDetails("invoice file "+hash+" does not exist"))
+		return
+	case errors.Is(err, document.ErrNoSuchPage):
+		s.writeError(w, errNotFound.WithDetails(err.Error()))
+		return
+	case errors.Is(err, preview.ErrStorage):
+		s.logger.Error("Failed to get page image", zap.String("hash", hash), zap.Int("page", page), zap.Error(err))
+		s.writeError(w, errStorageUnavailable)
+		return
+	case err != nil:
+		s.logger.Error("Failed to render page image", zap.String("hash", hash), zap.Int("page", page), zap.Error(err))
+		s.writeError(w, errServerError)
 		return
 	}
 
-	filenames, err := s.filestoreClient.GetBucketFilenames(r.Context())
-	if err != nil {
-		s.logger.Warn("Failed to fetch filenames from filestore", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	// answers If-None-Match with 304 Not Modified
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(image))
+}
+
+// ServeFileHandler serves files of the stores that cannot serve them themselves, see filestore.SignedLinks.
+// Only requests with a valid link from GetInvoiceFileHandler are served
+func (s *Server) ServeFileHandler(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	signedLinks, ok := s.fileStore.(filestore.SignedLinks)
+	if !ok {
+		s.writeError(w, errNotFound)
 		return
 	}
 
-	// Check if the file is not already uploaded, compare hash
-	filename := fmt.Sprintf("%x.pdf", hash.Sum(nil))
-	if _, present := filenames[filename]; present {
-		s.logger.Warn("File already exists", zap.String("filename", filename))
-		w.WriteHeader(http.StatusConflict)
+	if err := signedLinks.VerifyLink(key, r.URL.Query()); err != nil {
+		s.logger.Warn("Rejected file link", zap.String("key", key), zap.Error(err))
+		s.writeError(w, errForbidden.WithDetails(err.Error()))
 		return
 	}
 
-	_, err = file.Seek(0, io.SeekStart)
+	info, err := s.fileStore.Stat(r.Context(), key)
+	if errors.Is(err, filestore.ErrNotFound) {
+		s.writeError(w, errNotFound.WithDetails("file "+key+" does not exist"))
+		return
+	}
 	if err != nil {
-		s.logger.Error("Failed to reset file pointer", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Error("Failed to stat file in filestore", zap.String("key", key), zap.Error(err))
+		s.writeError(w, errStorageUnavailable)
 		return
 	}
 
-	// Upload the file to the filestore
-	err = s.filestoreClient.PutFile(r.Context(), filename, file)
+	file, err := s.fileStore.Get(r.Context(), key)
 	if err != nil {
-		s.logger.Error("Failed to upload file to filestore", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Error("Failed to get file from filestore", zap.String("key", key), zap.Error(err))
+		s.writeError(w, errStorageUnavailable)
 		return
 	}
+	defer file.Close()
 
-	// Reset file pointer for text extraction
-	_, err = file.Seek(0, io.SeekStart)
-	if err != nil {
-		s.logger.Error("Failed to reset file pointer", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+	w.Header().Set("Content-Type", info.ContentType)
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), info.LastModified, seeker)
 		return
 	}
 
-	// Extract text from the PDF
-	doc, err := fitz.NewFromReader(file)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	if _, err = io.Copy(w, file); err != nil {
+		s.logger.Warn("Failed to write file to response", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// fileReport is the outcome of a single uploaded file, with the error in the same format as error responses
+type fileReport struct {
+	ingest.Report
+	Error *APIError `json:"error,omitempty"`
+}
+
+// uploadReport is the response body of FileUploadHandler
+type uploadReport struct {
+	Files []fileReport `json:"files"`
+}
+
+// FileUploadHandler takes one or more files in the "invoice" form field. Every file can be either a PDF, an XML
+// e-invoice, a JPEG, PNG or HEIC image or a ZIP archive of those, or an .eml or .mbox file of emails with PDF and
+// XML attachments. The response reports the outcome for each invoice file.
+// When a single invoice file is uploaded, a failure is reported with the error envelope instead, e.g. 409 for a duplicate
+func (s *Server) FileUploadHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	err := r.ParseMultipartForm(maxUploadMemory)
 	if err != nil {
-		s.logger.Warn("Failed to open PDF file for text extraction", zap.String("filename", header.Filename), zap.Error(err))
+		s.logger.Warn("Failed to parse form data", zap.Error(err))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, errFileTooLarge.WithDetails(err.Error()))
+		} else {
+			s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		}
+		return
 	}
+	defer r.MultipartForm.RemoveAll()
 
-	var text string
-	for i := 0; i < doc.NumPage(); i++ {
-		pageText, err := doc.Text(i)
+	headers := r.MultipartForm.File["invoice"]
+	if len(headers) == 0 {
+		s.logger.Warn("No files in upload form")
+		s.writeError(w, errValidationFailed.WithDetails("no files in the invoice form field"))
+		return
+	}
+
+	// Invoice fields sent along with the file only make sense for a single invoice, rather than an archive or an email
+	single := len(headers) == 1
+	var reports []ingest.Report
+	for _, header := range headers {
+		content, err := readFormFile(header)
 		if err != nil {
-			s.logger.Warn("Failed to extract text from PDF page", zap.Int("page", i), zap.String("filename", header.Filename), zap.Error(err))
+			s.logger.Warn("Failed to read uploaded file", zap.String("filename", header.Filename), zap.Error(err))
+			reports = append(reports, ingest.Report{Filename: header.Filename, Status: ingest.StatusFailed, Err: err})
 			continue
 		}
 
-		text += pageText
+		var form *url.Values
+		single = single && !ingest.IsArchive(content) && !ingest.IsEmail(content)
+		if single {
+			form = &r.Form
+		}
+		reports = append(reports, s.ingester.IngestFile(r.Context(), header.Filename, content, form)...)
 	}
 
-	invoice := &model.Invoice{}
+	if single && reports[0].Status != ingest.StatusCreated {
+		s.writeError(w, uploadError(reports[0]))
+		return
+	}
 
-	if s.llm != nil {
-		ctx := r.Context()
-		prompt := fmt.Sprintf(llmPromptTemplate, text)
-		response, err := s.llm.Call(ctx, prompt, llms.WithJSONMode())
-		if err != nil {
-			s.logger.Warn("Failed to process text with LLM", zap.Error(err))
-		} else {
-			s.logger.Info("LLM response", zap.String("response", response))
-			// try to unmarshal the response into a map
-			err = json.Unmarshal([]byte(response), &invoice)
-			if err != nil {
-				s.logger.Warn("Failed to unmarshal LLM response", zap.Error(err))
-			} else {
-				s.logger.Info("Extracted fields from LLM response", zap.Any("invoice", invoice))
-			}
-		}
+	var response uploadReport
+	created := false
+	for _, report := range reports {
+		created = created || report.Status == ingest.StatusCreated
+		response.Files = append(response.Files, fileReport{Report: report, Error: uploadError(report)})
 	}
 
-	invoice.FileHash = fmt.Sprintf("%x", hash.Sum(nil))
-	invoice.OriginalFileName = header.Filename
-	invoice.RawText = text
-	invoice.FileExists = true
+	// Processing is asynchronous, so anything created is only accepted
+	if created {
+		s.writeJSON(w, http.StatusAccepted, response)
+	} else {
+		s.writeJSON(w, http.StatusOK, response)
+	}
+}
 
-	err = r.ParseMultipartForm(0)
+// uploadError maps the outcome of an uploaded file to an API error, nil if the file was created
+func uploadError(report ingest.Report) *APIError {
+	switch {
+	case report.Status == ingest.StatusCreated:
+		return nil
+	case report.Status == ingest.StatusDuplicate:
+		return errInvoiceAlreadyExists.WithDetails(report.FileHash)
+	case errors.Is(report.Err, ingest.ErrUnsupportedFileType), errors.Is(report.Err, ingest.ErrInvalidEInvoice),
+		errors.Is(report.Err, document.ErrInvalidImage), errors.Is(report.Err, document.ErrInvalidPDF):
+		return errInvalidFileType.WithDetails(report.Err.Error())
+	case errors.Is(report.Err, document.ErrEncryptedPDF):
+		return errEncryptedPDF
+	case errors.Is(report.Err, document.ErrPDFJavaScript):
+		return errPDFJavaScript
+	case errors.Is(report.Err, document.ErrTooManyPages):
+		return errTooManyPages.WithDetails(report.Err.Error())
+	case errors.Is(report.Err, ingest.ErrFileTooLarge):
+		return errFileTooLarge.WithDetails(report.Err.Error())
+	case errors.Is(report.Err, ingest.ErrInvalidArchive), errors.Is(report.Err, email.ErrInvalidMessage),
+		errors.Is(report.Err, ingest.ErrNoAttachments):
+		return errValidationFailed.WithDetails(report.Err.Error())
+	case errors.Is(report.Err, ingest.ErrStorageUnavailable):
+		return errStorageUnavailable
+	case errors.Is(report.Err, ingest.ErrShuttingDown):
+		return errServiceUnavailable.WithDetails(report.Err.Error())
+	default:
+		return errServerError
+	}
+}
+
+func readFormFile(header *multipart.FileHeader) ([]byte, error) {
+	file, err := header.Open()
 	if err != nil {
-		s.logger.Error("Failed to parse form data", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+// jobStatus is the response body of GetJobHandler
+type jobStatus struct {
+	*model.Job
+	Error *APIError `json:"error,omitempty"`
+}
+
+func (s *Server) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		s.logger.Warn("Invalid job id", zap.String("id", vars["id"]))
+		s.writeError(w, errValidationFailed.WithDetails("job id must be a positive integer"))
 		return
 	}
-	invoice.FromFormData(&r.Form)
 
-	err = s.storageManager.UpsertInvoice(invoice)
+	job, err := s.storageManager.GetJob(uint(id))
 	if err != nil {
-		s.logger.Error("Failed to save invoice to database", zap.Error(err))
-		w.WriteHeader(http.StatusInternalServerError)
+		s.logger.Error("Failed to retrieve job from database", zap.Uint64("id", id), zap.Error(err))
+		s.writeError(w, errServerError)
+		return
+	}
+
+	if job == nil {
+		s.writeError(w, errNotFound.WithDetails("job "+vars["id"]+" does not exist"))
 		return
 	}
+
+	status := jobStatus{Job: job}
+	switch job.Failure {
+	case model.JobFailureStorage:
+		status.Error = errStorageUnavailable.WithDetails(job.LastError)
+	case model.JobFailureLLM:
+		status.Error = errLLMFailure.WithDetails(job.LastError)
+	case model.JobFailureInternal:
+		status.Error = errServerError
+	}
+
+	s.writeJSON(w, http.StatusOK, status)
 }
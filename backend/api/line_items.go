@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/extractor"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strings"
+)
+
+// validateLineItems returns a description of the first invalid line item, or an empty string
+func validateLineItems(items []model.LineItem) string {
+	for i, item := range items {
+		if strings.TrimSpace(item.Description) == "" {
+			return fmt.Sprintf("line item %d: description is required", i+1)
+		}
+		if _, ok := item.NetTotal(); !ok {
+			return fmt.Sprintf("line item %d: total or quantity and unit price are required", i+1)
+		}
+		if item.TaxRate != nil && (*item.TaxRate < 0 || *item.TaxRate > 100) {
+			return fmt.Sprintf("line item %d: tax rate must be a percentage", i+1)
+		}
+	}
+
+	return ""
+}
+
+// ReplaceLineItemsHandler replaces all line items of an invoice with the list in the request body, an empty list
+// removes them. Responds with the updated invoice, including the result of the totals check
+func (s *Server) ReplaceLineItemsHandler(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+
+	var items []model.LineItem
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil {
+		s.logger.Warn("Failed to decode request body", zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+	if items == nil {
+		s.writeError(w, errValidationFailed.WithDetails("expected a list of line items"))
+		return
+	}
+	if problem := validateLineItems(items); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
+		return
+	}
+
+	source := extractor.SourceUser
+	if len(items) == 0 {
+		source = ""
+	}
+	found, err := s.storageManager.ReplaceLineItems(hash, items, model.FieldSources{extractor.FieldLineItems: source})
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if !found {
+		s.writeError(w, errNotFound.WithDetails("invoice "+hash+" does not exist"))
+		return
+	}
+
+	invoice, err := s.storageManager.GetInvoiceByHash(hash)
+	if err != nil || invoice == nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	setPaymentStatus(invoice)
+	s.writeJSON(w, http.StatusOK, invoice)
+}
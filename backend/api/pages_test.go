@@ -0,0 +1,116 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/preview"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// downStore fails to stat objects while down is set, like a filestore that cannot be reached
+type downStore struct {
+	filestore.Store
+	down atomic.Bool
+}
+
+func (s *downStore) Stat(ctx context.Context, key string) (*filestore.ObjectInfo, error) {
+	if s.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return s.Store.Stat(ctx, key)
+}
+
+func TestGetPageImageHandler(t *testing.T) {
+	store := &downStore{Store: filestore.NewMemoryStore(nil, zap.NewNop())}
+	server := NewServer(nil, store, nil, preview.NewRenderer(store, zap.NewNop()), nil, ServerConfig{}, zap.NewNop())
+
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := document.ImagePDF(photo.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put(context.Background(), "h1.pdf", bytes.NewReader(pdf), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		path        string
+		ifNoneMatch string
+		wantStatus  int
+		wantETag    string
+	}{
+		{"page", "/api/v1/invoice/h1/pages/1.png", "", http.StatusOK, `"h1-1-96"`},
+		{"resolution", "/api/v1/invoice/h1/pages/1.png?dpi=150", "", http.StatusOK, `"h1-1-150"`},
+		{"thumbnail", "/api/v1/invoice/h1/pages/1.png?thumbnail=true", "", http.StatusOK, `"h1-thumbnail"`},
+		// the image of an ETag never changes
+		{"cached by the client", "/api/v1/invoice/h1/pages/1.png", `"h1-1-96"`, http.StatusNotModified, `"h1-1-96"`},
+		{"cached at another resolution", "/api/v1/invoice/h1/pages/1.png", `"h1-1-150"`, http.StatusOK, `"h1-1-96"`},
+		{"page out of range", "/api/v1/invoice/h1/pages/2.png", "", http.StatusNotFound, ""},
+		{"page 0", "/api/v1/invoice/h1/pages/0.png", "", http.StatusBadRequest, ""},
+		{"page not a number", "/api/v1/invoice/h1/pages/first.png", "", http.StatusNotFound, ""},
+		{"thumbnail of another page", "/api/v1/invoice/h1/pages/2.png?thumbnail=true", "", http.StatusBadRequest, ""},
+		{"resolution too low", "/api/v1/invoice/h1/pages/1.png?dpi=10", "", http.StatusBadRequest, ""},
+		{"resolution too high", "/api/v1/invoice/h1/pages/1.png?dpi=600", "", http.StatusBadRequest, ""},
+		{"resolution not a number", "/api/v1/invoice/h1/pages/1.png?dpi=high", "", http.StatusBadRequest, ""},
+		{"unknown file", "/api/v1/invoice/h2/pages/1.png", "", http.StatusNotFound, ""},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if test.ifNoneMatch != "" {
+			request.Header.Set("If-None-Match", test.ifNoneMatch)
+		}
+		response := httptest.NewRecorder()
+		server.router.ServeHTTP(response, request)
+
+		if response.Code != test.wantStatus {
+			t.Errorf("GET %s (%s) = %d %s, want %d", test.path, test.name, response.Code, response.Body, test.wantStatus)
+			continue
+		}
+		if test.wantETag == "" {
+			if contentType := response.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("GET %s (%s) Content-Type = %s, want an error", test.path, test.name, contentType)
+			}
+			continue
+		}
+
+		header := response.Header()
+		if etag := header.Get("ETag"); etag != test.wantETag {
+			t.Errorf("GET %s (%s) ETag = %s, want %s", test.path, test.name, etag, test.wantETag)
+		}
+		if cacheControl := header.Get("Cache-Control"); cacheControl != "private, max-age=31536000, immutable" {
+			t.Errorf("GET %s (%s) Cache-Control = %s, want the image cached for good", test.path, test.name, cacheControl)
+		}
+		if test.wantStatus == http.StatusNotModified {
+			if response.Body.Len() != 0 {
+				t.Errorf("GET %s (%s) = %d bytes, want none", test.path, test.name, response.Body.Len())
+			}
+			continue
+		}
+		if contentType := header.Get("Content-Type"); contentType != "image/png" {
+			t.Errorf("GET %s (%s) Content-Type = %s, want image/png", test.path, test.name, contentType)
+		}
+		if _, err := png.DecodeConfig(response.Body); err != nil {
+			t.Errorf("GET %s (%s) is not a PNG: %v", test.path, test.name, err)
+		}
+	}
+
+	store.down.Store(true)
+	response := httptest.NewRecorder()
+	server.router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/api/v1/invoice/h1/pages/1.png", nil))
+	if response.Code != errStorageUnavailable.Status {
+		t.Errorf("GET with the filestore down = %d, want %d", response.Code, errStorageUnavailable.Status)
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+)
+
+// decimalNumber is the format of decimal query parameters, big.Rat alone would accept fractions and exponents
+var decimalNumber = regexp.MustCompile(`^-?\d+(?:\.\d+)?$`)
+
+// parseInvoiceFilter builds an invoice filter from the query parameters of GET /invoices:
+//
+//	offset, limit                        pagination, limit defaults to 50 and is capped at 1000
+//	sort                                 date, dueDate, amount or id, prefix with "-" for descending order
+//	isPaid, isReviewed, fileExists,      booleans
+//	totalsMismatch, taxMismatch
+//	dateFrom, dateTo                     YYYY-MM-DD, inclusive
+//	currency                             ISO 4217 code
+//	amountMin, amountMax                 decimals in the major unit of each currency, inclusive
+//	vendorId                             id of the vendor
+//	status                               payment status as of today: paid, scheduled, overdue, dueSoon, upcoming or noDueDate
+func parseInvoiceFilter(query url.Values) (db.InvoiceFilter, error) {
+	var filter db.InvoiceFilter
+	var err error
+
+	if filter.Offset, filter.Limit, err = parsePagination(query); err != nil {
+		return filter, err
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		filter.SortDesc = strings.HasPrefix(sort, "-")
+		filter.SortBy = strings.TrimPrefix(sort, "-")
+		if _, ok := db.InvoiceSortColumns[filter.SortBy]; !ok {
+			return filter, fmt.Errorf("cannot sort by %q", filter.SortBy)
+		}
+	}
+
+	if filter.IsPaid, err = parseOptionalBool(query, "isPaid"); err != nil {
+		return filter, err
+	}
+	if filter.IsReviewed, err = parseOptionalBool(query, "isReviewed"); err != nil {
+		return filter, err
+	}
+	if filter.FileExists, err = parseOptionalBool(query, "fileExists"); err != nil {
+		return filter, err
+	}
+	if filter.TotalsMismatch, err = parseOptionalBool(query, "totalsMismatch"); err != nil {
+		return filter, err
+	}
+	if filter.TaxMismatch, err = parseOptionalBool(query, "taxMismatch"); err != nil {
+		return filter, err
+	}
+	if filter.DateFrom, err = parseOptionalDate(query, "dateFrom"); err != nil {
+		return filter, err
+	}
+	if filter.DateTo, err = parseOptionalDate(query, "dateTo"); err != nil {
+		return filter, err
+	}
+	if filter.Currency, err = parseOptionalCurrency(query, "currency"); err != nil {
+		return filter, err
+	}
+	if filter.AmountMin, err = parseOptionalDecimal(query, "amountMin"); err != nil {
+		return filter, err
+	}
+	if filter.AmountMax, err = parseOptionalDecimal(query, "amountMax"); err != nil {
+		return filter, err
+	}
+	if filter.VendorID, err = parseOptionalID(query, "vendorId"); err != nil {
+		return filter, err
+	}
+	if status := query.Get("status"); status != "" {
+		if !model.ValidStatus(status) {
+			return filter, fmt.Errorf("status must be one of paid, scheduled, overdue, dueSoon, upcoming and noDueDate")
+		}
+		filter.Status = &status
+		filter.Today = model.Today()
+	}
+
+	return filter, nil
+}
+
+// parsePagination reads the offset and limit query parameters.
+// Limit defaults to 50 and is capped at 1000
+func parsePagination(query url.Values) (offset int, limit int, err error) {
+	if offset, err = parseInt(query, "offset", 0); err != nil {
+		return 0, 0, err
+	}
+	if offset < 0 {
+		return 0, 0, fmt.Errorf("offset must not be negative")
+	}
+
+	if limit, err = parseInt(query, "limit", defaultPageLimit); err != nil {
+		return 0, 0, err
+	}
+	if limit <= 0 || limit > maxPageLimit {
+		return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+
+	return offset, limit, nil
+}
+
+// pageLink returns the link to the same listing with a different offset, or nil if the offset is outside the results
+func pageLink(u *url.URL, offset int, total int64) *string {
+	if offset < 0 || int64(offset) >= total {
+		return nil
+	}
+
+	query := u.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	link := u.Path + "?" + query.Encode()
+	return &link
+}
+
+func parseInt(query url.Values, key string, fallback int) (int, error) {
+	value := query.Get(key)
+	if value == "" {
+		return fallback, nil
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s must be an integer", key)
+	}
+
+	return parsed, nil
+}
+
+func parseOptionalBool(query url.Values, key string) (*bool, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a boolean", key)
+	}
+
+	return &parsed, nil
+}
+
+func parseOptionalDate(query url.Values, key string) (*time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a date formatted YYYY-MM-DD", key)
+	}
+
+	return &parsed, nil
+}
+
+// parseOptionalDecimal parses a plain decimal number exactly, such as "-12.345"
+func parseOptionalDecimal(query url.Values, key string) (*big.Rat, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, ok := new(big.Rat).SetString(value)
+	if !ok || !decimalNumber.MatchString(value) {
+		return nil, fmt.Errorf("%s must be a decimal number", key)
+	}
+
+	return parsed, nil
+}
+
+func parseOptionalCurrency(query url.Values, key string) (*string, error) {
+	value := strings.ToUpper(query.Get(key))
+	if value == "" {
+		return nil, nil
+	}
+
+	if !model.ValidCurrency(value) {
+		return nil, fmt.Errorf("%s must be an ISO 4217 currency code", key)
+	}
+
+	return &value, nil
+}
+
+func parseOptionalID(query url.Values, key string) (*uint, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || parsed == 0 {
+		return nil, fmt.Errorf("%s must be a positive integer", key)
+	}
+
+	id := uint(parsed)
+	return &id, nil
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+)
+
+// paymentID reads the id path parameter, writing the error response if it is invalid
+func (s *Server) paymentID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id == 0 {
+		s.logger.Warn("Invalid payment id", zap.String("id", mux.Vars(r)["id"]))
+		s.writeError(w, errValidationFailed.WithDetails("payment id must be a positive integer"))
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// validatePayment checks the payment after an update, returns a description of the problem or an empty string.
+// The payments of an invoice are in the currency of its amount
+func validatePayment(payment *model.Payment, invoice *model.Invoice) string {
+	if payment.Date.IsZero() {
+		return "date is required"
+	}
+	if payment.Amount.Minor == 0 {
+		return "amount is required, negative for refunds"
+	}
+	if !model.ValidPaymentMethod(payment.Method) {
+		return "method must be empty or one of the payment methods"
+	}
+	if invoice.Amount != nil && invoice.Amount.Currency != "" && payment.Amount.Currency != invoice.Amount.Currency {
+		return "amount must be in " + invoice.Amount.Currency + ", the currency of the invoice"
+	}
+	for _, other := range invoice.Payments {
+		if other.ID != payment.ID && other.Amount.Currency != payment.Amount.Currency {
+			return "amount must be in " + other.Amount.Currency + ", the currency of the other payments"
+		}
+	}
+
+	return ""
+}
+
+// validateAmountCurrency checks that a new amount of the invoice is in the currency of its payments, returns a
+// description of the problem or an empty string. Voided payments do not count
+func validateAmountCurrency(amount *model.Money, payments []model.Payment) string {
+	if amount == nil || amount.Currency == "" {
+		return ""
+	}
+	for _, payment := range payments {
+		if payment.VoidedAt == nil && payment.Amount.Currency != "" && payment.Amount.Currency != amount.Currency {
+			return "amount must be in " + payment.Amount.Currency + ", the currency of the payments"
+		}
+	}
+
+	return ""
+}
+
+// invoice returns the invoice of the hash path parameter along with its payments, writing the error response if it
+// does not exist
+func (s *Server) invoice(w http.ResponseWriter, r *http.Request) (*model.Invoice, bool) {
+	hash := mux.Vars(r)["hash"]
+	invoice, err := s.storageManager.GetInvoiceByHash(hash)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return nil, false
+	}
+	if invoice == nil {
+		s.writeError(w, errNotFound.WithDetails("invoice "+hash+" does not exist"))
+		return nil, false
+	}
+
+	return invoice, true
+}
+
+// GetPaymentsHandler lists the payments of an invoice, voided ones included
+func (s *Server) GetPaymentsHandler(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+	payments, err := s.storageManager.GetPayments(hash)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if payments == nil {
+		s.writeError(w, errNotFound.WithDetails("invoice "+hash+" does not exist"))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, payments)
+}
+
+// CreatePaymentHandler records a payment of an invoice
+func (s *Server) CreatePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	var update model.PaymentUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.logger.Warn("Failed to decode request body", zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	invoice, ok := s.invoice(w, r)
+	if !ok {
+		return
+	}
+
+	payment := &model.Payment{InvoiceHash: invoice.FileHash}
+	update.ApplyTo(payment)
+	if problem := validatePayment(payment, invoice); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
+		return
+	}
+
+	if err := s.storageManager.SavePayment(payment); err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, payment)
+}
+
+// UpdatePaymentHandler edits a payment of an invoice
+func (s *Server) UpdatePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.paymentID(w, r)
+	if !ok {
+		return
+	}
+
+	var update model.PaymentUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.logger.Warn("Failed to decode request body", zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	invoice, ok := s.invoice(w, r)
+	if !ok {
+		return
+	}
+
+	var payment *model.Payment
+	for i := range invoice.Payments {
+		if invoice.Payments[i].ID == id {
+			payment = &invoice.Payments[i]
+		}
+	}
+	if payment == nil {
+		s.writeError(w, errNotFound.WithDetails("payment "+strconv.FormatUint(uint64(id), 10)+" does not exist"))
+		return
+	}
+
+	update.ApplyTo(payment)
+	if problem := validatePayment(payment, invoice); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
+		return
+	}
+
+	if err := s.storageManager.SavePayment(payment); err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, payment)
+}
+
+// DeletePaymentHandler removes a payment of an invoice, as if it had never been recorded
+func (s *Server) DeletePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.paymentID(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.storageManager.DeletePayment(mux.Vars(r)["hash"], id)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if !deleted {
+		s.writeError(w, errNotFound.WithDetails("payment "+strconv.FormatUint(uint64(id), 10)+" does not exist"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
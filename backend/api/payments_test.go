@@ -0,0 +1,33 @@
+package api
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"testing"
+	"time"
+)
+
+func TestValidateAmountCurrency(t *testing.T) {
+	voided := time.Now()
+	payments := []model.Payment{
+		{Amount: model.Money{Minor: 5000, Currency: "EUR"}},
+		{Amount: model.Money{Minor: 500, Currency: "USD"}, VoidedAt: &voided},
+	}
+	tests := []struct {
+		name     string
+		amount   *model.Money
+		payments []model.Payment
+		want     string
+	}{
+		{"same currency", &model.Money{Minor: 10000, Currency: "EUR"}, payments, ""},
+		{"other currency", &model.Money{Minor: 10000, Currency: "USD"}, payments[:1], "amount must be in EUR, the currency of the payments"},
+		{"other currency than a voided payment", &model.Money{Minor: 10000, Currency: "EUR"}, payments[1:], ""},
+		{"unknown currency", &model.Money{Minor: 10000}, payments, ""},
+		{"without payments", &model.Money{Minor: 10000, Currency: "JPY"}, nil, ""},
+		{"amount unchanged", nil, payments, ""},
+	}
+	for _, test := range tests {
+		if got := validateAmountCurrency(test.amount, test.payments); got != test.want {
+			t.Errorf("%s: validateAmountCurrency = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
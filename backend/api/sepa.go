@@ -0,0 +1,180 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxTransfers is the max number of invoices exported to one payment file
+const maxTransfers = 1000
+
+// sepaExportRequest is the request body of ExportSEPATransfersHandler
+type sepaExportRequest struct {
+	Invoices      []string       `json:"invoices"`      // the hashes of the invoices to pay
+	ExecutionDate model.FormDate `json:"executionDate"` // defaults to today
+}
+
+// transferProblem returns a description of why the invoice cannot be paid by SEPA transfer, or an empty string
+func transferProblem(invoice *model.Invoice) string {
+	balance := invoice.Balance()
+	switch {
+	case invoice.IsPaid != nil && *invoice.IsPaid:
+		return "is paid"
+	case !invoice.PaymentScheduled.IsZero():
+		return "has a transfer scheduled already"
+	case balance == nil:
+		return "has no amount"
+	case balance.Currency != "EUR":
+		return "is not in EUR"
+	case balance.Minor <= 0:
+		return "has nothing left to pay"
+	case invoice.ID == nil || strings.TrimSpace(*invoice.ID) == "":
+		return "has no invoice number for the remittance information"
+	case invoice.Vendor == nil || strings.TrimSpace(invoice.Vendor.Name) == "":
+		return "has no vendor"
+	case invoice.Vendor.IBAN == "" && invoice.Vendor.SuggestedIBAN != "":
+		return "has a vendor whose IBAN is not confirmed"
+	case invoice.Vendor.IBAN == "":
+		return "has a vendor without bank details"
+	case !banking.ValidIBAN(invoice.Vendor.IBAN):
+		return "has a vendor with an invalid IBAN"
+	case invoice.Vendor.BIC != "" && !banking.ValidBIC(invoice.Vendor.BIC):
+		return "has a vendor with an invalid BIC"
+	default:
+		return ""
+	}
+}
+
+// messageID identifies the payment file to the bank, from the time it was created and the invoices it pays
+func messageID(createdAt time.Time, hashes []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(hashes, ",")))
+	return "INV-" + createdAt.UTC().Format("20060102150405") + "-" + hex.EncodeToString(sum[:])[:8]
+}
+
+// ExportSEPATransfersHandler returns a SEPA pain.001.001.03 payment file paying the balance of the invoices in the
+// request body, to be uploaded to the bank. All invoices must be unpaid EUR invoices of vendors with a confirmed IBAN,
+// or none is exported. The exported invoices are marked as scheduled for the execution date, the export fails with a
+// conflict if another export scheduled one of them meanwhile
+func (s *Server) ExportSEPATransfersHandler(w http.ResponseWriter, r *http.Request) {
+	if s.paymentAccount.IBAN == "" {
+		s.writeError(w, errServiceUnavailable.WithDetails("SEPA export is not configured, SEPA_DEBTOR_IBAN is not set"))
+		return
+	}
+
+	var request sepaExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		s.logger.Warn("Failed to decode request body", zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	hashes := slices.Compact(slices.Sorted(slices.Values(request.Invoices)))
+	if len(hashes) == 0 || hashes[0] == "" {
+		s.writeError(w, errValidationFailed.WithDetails("invoices must list the hashes of the invoices to pay"))
+		return
+	}
+	if len(hashes) > maxTransfers {
+		s.writeError(w, errValidationFailed.WithDetails("at most "+strconv.Itoa(maxTransfers)+" invoices can be paid at once"))
+		return
+	}
+	today := model.Today()
+	executionDate := today
+	if date := request.ExecutionDate.Time(); date != nil {
+		if date.Before(today) {
+			s.writeError(w, errValidationFailed.WithDetails("executionDate must not be in the past"))
+			return
+		}
+		executionDate = *date
+	}
+
+	invoices, err := s.storageManager.GetInvoicesForTransfer(hashes)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if len(invoices) < len(hashes) {
+		for _, hash := range hashes {
+			if !slices.ContainsFunc(invoices, func(invoice *model.Invoice) bool { return invoice.FileHash == hash }) {
+				s.writeError(w, errNotFound.WithDetails("invoice "+hash+" does not exist"))
+				return
+			}
+		}
+	}
+
+	problems := make([]string, 0)
+	order := banking.CreditTransferOrder{
+		MessageID:     messageID(time.Now(), hashes),
+		CreatedAt:     time.Now(),
+		ExecutionDate: executionDate,
+		Debtor:        s.paymentAccount,
+		Transfers:     make([]banking.CreditTransfer, 0, len(invoices)),
+	}
+	for _, invoice := range invoices {
+		if problem := transferProblem(invoice); problem != "" {
+			problems = append(problems, "invoice "+invoice.FileHash+" "+problem)
+			continue
+		}
+		order.Transfers = append(order.Transfers, banking.CreditTransfer{
+			EndToEndID:     invoice.FileHash[:min(len(invoice.FileHash), banking.MaxSEPAIDLength)],
+			Amount:         *invoice.Balance(),
+			Creditor:       banking.Account{Name: invoice.Vendor.Name, IBAN: invoice.Vendor.IBAN, BIC: invoice.Vendor.BIC},
+			RemittanceInfo: *invoice.ID,
+		})
+	}
+	if len(problems) > 0 {
+		s.writeError(w, errValidationFailed.WithDetails(strings.Join(problems, "; ")))
+		return
+	}
+
+	content, err := order.Pain001()
+	if err != nil {
+		s.logger.Error("Failed to create SEPA payment file", zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+	// another export may have scheduled some of the invoices since they were checked
+	err = s.storageManager.SchedulePayments(hashes, executionDate)
+	if errors.Is(err, db.ErrPaymentScheduled) {
+		s.writeError(w, errPaymentScheduled.WithDetails("a transfer of some of the invoices was exported meanwhile"))
+		return
+	}
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.logger.Info("Exported SEPA transfers", zap.String("messageId", order.MessageID), zap.Int("transfers", len(order.Transfers)))
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+order.MessageID+`.xml"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(content)
+}
+
+// UnschedulePaymentHandler clears the scheduled transfer of an invoice, e.g. when the bank rejected the payment file,
+// so it can be exported again
+func (s *Server) UnschedulePaymentHandler(w http.ResponseWriter, r *http.Request) {
+	hash := mux.Vars(r)["hash"]
+	found, err := s.storageManager.UnschedulePayment(hash)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if !found {
+		s.writeError(w, errNotFound.WithDetails("invoice "+hash+" does not exist"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"testing"
+)
+
+func TestTransferProblem(t *testing.T) {
+	id := "INV-1"
+	tests := []struct {
+		name   string
+		vendor *model.Vendor
+		want   string
+	}{
+		{"confirmed", &model.Vendor{Name: "ACME", IBAN: "DE89370400440532013000"}, ""},
+		{"suggested", &model.Vendor{Name: "ACME", SuggestedIBAN: "DE89370400440532013000"}, "has a vendor whose IBAN is not confirmed"},
+		{"confirmed and suggested", &model.Vendor{Name: "ACME", IBAN: "DE89370400440532013000", SuggestedIBAN: "GB82WEST12345698765432"}, ""},
+		{"without bank details", &model.Vendor{Name: "ACME"}, "has a vendor without bank details"},
+		{"invalid", &model.Vendor{Name: "ACME", IBAN: "DE89370400440532013001"}, "has a vendor with an invalid IBAN"},
+		{"without vendor", nil, "has no vendor"},
+	}
+	for _, test := range tests {
+		invoice := &model.Invoice{FileHash: "h1", ID: &id, Amount: &model.Money{Minor: 1000, Currency: "EUR"}, Vendor: test.vendor}
+		if got := transferProblem(invoice); got != test.want {
+			t.Errorf("%s: transferProblem = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
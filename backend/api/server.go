@@ -2,9 +2,13 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/ingest"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/preview"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/reconciliation"
 	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
-	"github.com/tmc/langchaingo/llms/openai"
 	"go.uber.org/zap"
 	"maps"
 	"net/http"
@@ -16,19 +20,54 @@ import (
 	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
 )
 
+// ServerConfig configures the HTTP server, zero values are replaced with the defaults
+type ServerConfig struct {
+	Addr              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration // the whole request including the body, uploads have to fit in it
+	WriteTimeout      time.Duration // from the end of the request headers to the end of the response
+	IdleTimeout       time.Duration
+	PaymentAccount    banking.Account // the debtor of exported SEPA transfers, the export is disabled without an IBAN
+}
+
+func (c ServerConfig) withDefaults() ServerConfig {
+	if c.Addr == "" {
+		c.Addr = ":8080"
+	}
+	if c.ReadHeaderTimeout <= 0 {
+		c.ReadHeaderTimeout = 10 * time.Second
+	}
+	if c.ReadTimeout <= 0 {
+		c.ReadTimeout = 5 * time.Minute
+	}
+	if c.WriteTimeout <= 0 {
+		c.WriteTimeout = 5 * time.Minute
+	}
+	if c.IdleTimeout <= 0 {
+		c.IdleTimeout = 2 * time.Minute
+	}
+
+	return c
+}
+
 type Server struct {
-	storageManager  *db.Manager
-	router          *mux.Router
-	filestoreClient *filestore.Client
-	llm             *openai.LLM
+	storageManager *db.Manager
+	router         *mux.Router
+	httpServer     *http.Server
+	fileStore      filestore.Store
+	ingester       *ingest.Ingester
+	renderer       *preview.Renderer
+	reconciler     *reconciliation.Reconciler
+	paymentAccount banking.Account
 
 	logger *zap.Logger
 }
 
+// Run serves requests until Shutdown is called
 func (s *Server) Run() {
-	s.logger.Info("Server is running at :8080")
-	err := http.ListenAndServe(":8080", s.router)
-	if err != nil {
+	s.logger.Info("Server is running at " + s.httpServer.Addr)
+	err := s.httpServer.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		s.logger.Error("Server returned an error", zap.Error(err))
 	}
 }
@@ -36,13 +75,17 @@ func (s *Server) Run() {
 func (s *Server) SyncFilestore() {
 	start := time.Now()
 	s.logger.Info("Syncing filestore")
-	filenames, err := s.filestoreClient.GetBucketFilenames(context.Background())
+	filenames, err := s.fileStore.List(context.Background())
 	if err != nil {
 		s.logger.Error("Failed to sync filestore", zap.Error(err))
 	}
 
 	existingHashes := make([]string, 0, len(filenames))
 	for filename := range maps.Keys(filenames) {
+		// the XML of e-invoices is stored next to their PDF, the PDF is the invoice file
+		if filepath.Ext(filename) != ".pdf" {
+			continue
+		}
 		hash := filename[:len(filename)-len(filepath.Ext(filename))]
 		existingHashes = append(existingHashes, hash)
 	}
@@ -56,7 +99,15 @@ func (s *Server) SyncFilestore() {
 	s.logger.Info("Filestore sync complete", zap.Duration("duration", time.Since(start)))
 }
 
-func (s *Server) Shutdown() error {
+// Shutdown stops accepting requests and waits for the running ones to finish. When ctx is done first, the remaining
+// connections are closed, which cancels the contexts of their requests
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		s.logger.Warn("Requests did not finish in time, closing connections", zap.Error(err))
+		return errors.Join(err, s.httpServer.Close())
+	}
+
 	return nil
 }
 
@@ -105,25 +156,72 @@ func (s *Server) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func NewServer(storageManager *db.Manager, filestoreClient *filestore.Client, llm *openai.LLM, logger *zap.Logger) *Server {
+func NewServer(storageManager *db.Manager, fileStore filestore.Store, ingester *ingest.Ingester, renderer *preview.Renderer, reconciler *reconciliation.Reconciler, config ServerConfig, logger *zap.Logger) *Server {
 	s := &Server{
-		storageManager:  storageManager,
-		filestoreClient: filestoreClient,
-		llm:             llm,
-		logger:          logger,
+		storageManager: storageManager,
+		fileStore:      fileStore,
+		ingester:       ingester,
+		renderer:       renderer,
+		reconciler:     reconciler,
+		paymentAccount: config.PaymentAccount,
+		logger:         logger,
 	}
 
 	r := mux.NewRouter()
 	apiRouter := r.PathPrefix("/api/v1").Subrouter()
 	apiRouter.Use(s.corsMiddleware)
 	apiRouter.Use(s.loggingMiddleware)
+	apiRouter.HandleFunc("/bank/statements", s.ImportBankStatementHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/bank/transactions", s.GetBankTransactionsHandler).Methods("GET")
+	apiRouter.HandleFunc("/bank/reconcile", s.ReconcileHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/bank/proposals", s.GetProposalsHandler).Methods("GET")
+	apiRouter.HandleFunc("/bank/proposals/{id}/confirm", s.ConfirmProposalHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/bank/proposals/{id}/reject", s.RejectProposalHandler).Methods("POST", "OPTIONS")
 	apiRouter.HandleFunc("/invoices", s.GetAllInvoicesHandler).Methods("GET")
+	apiRouter.HandleFunc("/invoices/search", s.SearchInvoicesHandler).Methods("GET")
+	apiRouter.HandleFunc("/invoices/aging", s.GetAgingReportHandler).Methods("GET")
 	apiRouter.HandleFunc("/invoice/{hash}/exists", s.CheckInvoiceExistsHandler).Methods("GET")
 	apiRouter.HandleFunc("/invoice/{hash}", s.GetInvoiceHandler).Methods("GET")
 	apiRouter.HandleFunc("/invoice/{hash}", s.UpdateInvoiceHandler).Methods("PATCH", "OPTIONS")
 	apiRouter.HandleFunc("/invoice/{hash}/file", s.GetInvoiceFileHandler).Methods("GET")
+	apiRouter.HandleFunc("/invoice/{hash}/pages/{page:[0-9]+}.png", s.GetPageImageHandler).Methods("GET")
+	apiRouter.HandleFunc("/invoice/{hash}/items", s.ReplaceLineItemsHandler).Methods("PUT", "OPTIONS")
+	apiRouter.HandleFunc("/invoice/{hash}/payments", s.GetPaymentsHandler).Methods("GET")
+	apiRouter.HandleFunc("/invoice/{hash}/payments", s.CreatePaymentHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/invoice/{hash}/payments/{id}", s.UpdatePaymentHandler).Methods("PATCH", "OPTIONS")
+	apiRouter.HandleFunc("/invoice/{hash}/payments/{id}", s.DeletePaymentHandler).Methods("DELETE", "OPTIONS")
+	apiRouter.HandleFunc("/invoice/{hash}/scheduled-payment", s.UnschedulePaymentHandler).Methods("DELETE", "OPTIONS")
 	apiRouter.HandleFunc("/invoice/upload", s.FileUploadHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/jobs/{id}", s.GetJobHandler).Methods("GET")
+	apiRouter.HandleFunc("/payments/sepa", s.ExportSEPATransfersHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/vat-summary", s.GetVATSummaryHandler).Methods("GET")
+	apiRouter.HandleFunc("/vendors", s.GetVendorsHandler).Methods("GET")
+	apiRouter.HandleFunc("/vendors", s.CreateVendorHandler).Methods("POST", "OPTIONS")
+	apiRouter.HandleFunc("/vendors/{id}", s.GetVendorHandler).Methods("GET")
+	apiRouter.HandleFunc("/vendors/{id}", s.UpdateVendorHandler).Methods("PATCH", "OPTIONS")
+	apiRouter.HandleFunc("/vendors/{id}", s.DeleteVendorHandler).Methods("DELETE", "OPTIONS")
+	if _, ok := fileStore.(filestore.SignedLinks); ok {
+		apiRouter.HandleFunc("/files/{key:.+}", s.ServeFileHandler).Methods("GET")
+	}
+
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, errNotFound.WithDetails(r.URL.Path))
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, &APIError{http.StatusMethodNotAllowed, ErrorValidationFailed, "Method not allowed", r.Method})
+	})
 
 	s.router = r
+
+	config = config.withDefaults()
+	s.httpServer = &http.Server{
+		Addr:              config.Addr,
+		Handler:           r,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		ErrorLog:          zap.NewStdLog(s.logger),
+	}
 	return s
 }
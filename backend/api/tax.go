@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"net/http"
+)
+
+// validateTaxBreakdown returns a description of the first invalid tax line, or an empty string
+func validateTaxBreakdown(lines []model.TaxLine) string {
+	for i, line := range lines {
+		if line.Rate < 0 || line.Rate > 100 {
+			return fmt.Sprintf("tax line %d: rate must be a percentage", i+1)
+		}
+		if line.Net == nil && line.Tax == nil {
+			return fmt.Sprintf("tax line %d: net or tax amount is required", i+1)
+		}
+	}
+
+	return ""
+}
+
+// GetVATSummaryHandler sums up the VAT of the invoices dated within dateFrom and dateTo, both optional and inclusive,
+// by month, quarter or year as given by the period query parameter. Defaults to months
+func (s *Server) GetVATSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, err := parseOptionalDate(query, "dateFrom")
+	if err != nil {
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+	to, err := parseOptionalDate(query, "dateTo")
+	if err != nil {
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+	period := query.Get("period")
+	if period == "" {
+		period = model.PeriodMonth
+	}
+	if !model.ValidPeriodType(period) {
+		s.writeError(w, errValidationFailed.WithDetails("period must be one of month, quarter and year"))
+		return
+	}
+
+	invoices, err := s.storageManager.GetInvoicesForVAT(from, to)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, model.SummarizeVAT(invoices, period))
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/gorilla/mux"
+	"go.uber.org/zap"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// vendorID reads the id path parameter, writing the error response if it is invalid
+func (s *Server) vendorID(w http.ResponseWriter, r *http.Request) (uint, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil || id == 0 {
+		s.logger.Warn("Invalid vendor id", zap.String("id", mux.Vars(r)["id"]))
+		s.writeError(w, errValidationFailed.WithDetails("vendor id must be a positive integer"))
+		return 0, false
+	}
+
+	return uint(id), true
+}
+
+// validateVendor checks the vendor after an update, returns a description of the problem or an empty string
+func validateVendor(vendor *model.Vendor) string {
+	if strings.TrimSpace(vendor.Name) == "" {
+		return "name is required"
+	}
+	if vendor.IBAN != "" && !banking.ValidIBAN(banking.NormalizeIBAN(vendor.IBAN)) {
+		return "iban is not a valid IBAN"
+	}
+	if vendor.BIC != "" && !banking.ValidBIC(banking.NormalizeBIC(vendor.BIC)) {
+		return "bic is not a valid BIC"
+	}
+
+	return ""
+}
+
+func (s *Server) GetVendorsHandler(w http.ResponseWriter, r *http.Request) {
+	vendors, err := s.storageManager.GetVendors()
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, vendors)
+}
+
+func (s *Server) GetVendorHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.vendorID(w, r)
+	if !ok {
+		return
+	}
+
+	vendor, err := s.storageManager.GetVendor(id)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if vendor == nil {
+		s.writeError(w, errNotFound.WithDetails("vendor "+strconv.FormatUint(uint64(id), 10)+" does not exist"))
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, vendor)
+}
+
+func (s *Server) CreateVendorHandler(w http.ResponseWriter, r *http.Request) {
+	var update model.VendorUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.logger.Warn("Failed to decode request body", zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	vendor := &model.Vendor{}
+	update.ApplyTo(vendor)
+	if problem := validateVendor(vendor); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
+		return
+	}
+
+	if err := s.storageManager.CreateVendor(vendor); err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusCreated, vendor)
+}
+
+func (s *Server) UpdateVendorHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.vendorID(w, r)
+	if !ok {
+		return
+	}
+
+	var update model.VendorUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		s.logger.Warn("Failed to decode request body", zap.Error(err))
+		s.writeError(w, errValidationFailed.WithDetails(err.Error()))
+		return
+	}
+
+	vendor, err := s.storageManager.GetVendor(id)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if vendor == nil {
+		s.writeError(w, errNotFound.WithDetails("vendor "+strconv.FormatUint(uint64(id), 10)+" does not exist"))
+		return
+	}
+
+	update.ApplyTo(vendor)
+	if problem := validateVendor(vendor); problem != "" {
+		s.writeError(w, errValidationFailed.WithDetails(problem))
+		return
+	}
+
+	if err = s.storageManager.SaveVendor(vendor); err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, vendor)
+}
+
+// DeleteVendorHandler deletes a vendor, its invoices are kept without a vendor
+func (s *Server) DeleteVendorHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := s.vendorID(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.storageManager.DeleteVendor(id)
+	if err != nil {
+		s.writeError(w, errServerError)
+		return
+	}
+	if !deleted {
+		s.writeError(w, errNotFound.WithDetails("vendor "+strconv.FormatUint(uint64(id), 10)+" does not exist"))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
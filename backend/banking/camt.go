@@ -0,0 +1,187 @@
+package banking
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"strings"
+	"time"
+)
+
+// The elements of an ISO 20022 camt.053 document that are read, the namespace of the schema version is ignored
+type camtDocument struct {
+	XMLName    xml.Name
+	Statements []camtStatement `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtStatement struct {
+	Account struct {
+		IBAN  string `xml:"Id>IBAN"`
+		Other string `xml:"Id>Othr>Id"`
+	} `xml:"Acct"`
+	Entries []camtEntry `xml:"Ntry"`
+}
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+type camtEntry struct {
+	Amount      camtAmount `xml:"Amt"`
+	Indicator   string     `xml:"CdtDbtInd"`
+	Reversal    bool       `xml:"RvslInd"`
+	BookingDate camtDate   `xml:"BookgDt"`
+	ValueDate   camtDate   `xml:"ValDt"`
+	Reference   string     `xml:"AcctSvcrRef"`
+	Details     []camtTx   `xml:"NtryDtls>TxDtls"`
+	Info        string     `xml:"AddtlNtryInf"`
+}
+
+type camtParty struct {
+	Name string `xml:"Nm"`
+	// since camt.053.001.08 the party is wrapped in Pty
+	PartyName string `xml:"Pty>Nm"`
+}
+
+type camtTx struct {
+	Amount     *camtAmount `xml:"AmtDtls>TxAmt>Amt"`
+	Indicator  string      `xml:"CdtDbtInd"`
+	EndToEndID string      `xml:"Refs>EndToEndId"`
+	Debtor     camtParty   `xml:"RltdPties>Dbtr"`
+	DebtorIBAN string      `xml:"RltdPties>DbtrAcct>Id>IBAN"`
+	Creditor   camtParty   `xml:"RltdPties>Cdtr"`
+	CreditIBAN string      `xml:"RltdPties>CdtrAcct>Id>IBAN"`
+	Remittance []string    `xml:"RmtInf>Ustrd"`
+	References []string    `xml:"RmtInf>Strd>CdtrRefInf>Ref"`
+	Info       string      `xml:"AddtlTxInf"`
+}
+
+// parseCAMT053 reads the entries of a camt.053 bank to customer statement. Batch entries with details per transaction
+// are split into one transaction each
+func parseCAMT053(content []byte) (*Statement, error) {
+	var document camtDocument
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("invalid CAMT.053 statement: %w", err)
+	}
+	if document.XMLName.Local != "Document" || len(document.Statements) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	statement := &Statement{Format: FormatCAMT053}
+	for _, s := range document.Statements {
+		if statement.Account == "" {
+			statement.Account = NormalizeIBAN(s.Account.IBAN + s.Account.Other)
+		}
+
+		for _, entry := range s.Entries {
+			bookingDate, err := entry.BookingDate.parse()
+			if err != nil {
+				return nil, fmt.Errorf("invalid booking date of entry %s: %w", entry.Reference, err)
+			}
+			valueDate, err := entry.ValueDate.parse()
+			if err != nil {
+				return nil, fmt.Errorf("invalid value date of entry %s: %w", entry.Reference, err)
+			}
+
+			if bookingDate.IsZero() {
+				bookingDate = valueDate
+			}
+			if bookingDate.IsZero() {
+				return nil, fmt.Errorf("entry %s has no booking date", entry.Reference)
+			}
+
+			details := entry.Details
+			switch {
+			case len(details) == 0:
+				details = []camtTx{{}}
+			case len(details) > 1 && !allHaveAmounts(details):
+				// the amounts of the single transactions are not known, the entry is kept as a whole
+				details = details[:1]
+			}
+
+			for _, tx := range details {
+				amount, indicator := entry.Amount, entry.Indicator
+				if len(details) > 1 {
+					amount = *tx.Amount
+					if tx.Indicator != "" {
+						indicator = tx.Indicator
+					}
+				}
+
+				money, err := model.ParseMoney(amount.Value, amount.Currency)
+				if err != nil {
+					return nil, fmt.Errorf("invalid amount of entry %s: %w", entry.Reference, err)
+				}
+				// reversals book the opposite way of their indicator
+				if (indicator == "DBIT") != entry.Reversal {
+					money.Minor = -money.Minor
+				}
+
+				transaction := Transaction{
+					BookingDate:    bookingDate,
+					Amount:         money,
+					RemittanceInfo: strings.Join(append(tx.Remittance, tx.References...), " "),
+					Reference:      tx.EndToEndID,
+				}
+				if !valueDate.IsZero() {
+					transaction.ValueDate = &valueDate
+				}
+				if transaction.Reference == "" || transaction.Reference == "NOTPROVIDED" {
+					transaction.Reference = entry.Reference
+				}
+				if transaction.RemittanceInfo == "" {
+					transaction.RemittanceInfo = firstNonEmpty(tx.Info, entry.Info)
+				}
+				// the counterparty is the creditor of payments and the debtor of receipts
+				if money.Minor < 0 {
+					transaction.Counterparty = firstNonEmpty(tx.Creditor.Name, tx.Creditor.PartyName)
+					transaction.CounterpartyIBAN = tx.CreditIBAN
+				} else {
+					transaction.Counterparty = firstNonEmpty(tx.Debtor.Name, tx.Debtor.PartyName)
+					transaction.CounterpartyIBAN = tx.DebtorIBAN
+				}
+
+				statement.Transactions = append(statement.Transactions, transaction)
+			}
+		}
+	}
+
+	return statement, nil
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	switch {
+	case d.Date != "":
+		return time.Parse(time.DateOnly, strings.TrimSpace(d.Date))
+	case d.DateTime != "":
+		// the time of the day is dropped, with or without a zone
+		date, _, _ := strings.Cut(strings.TrimSpace(d.DateTime), "T")
+		return time.Parse(time.DateOnly, date)
+	default:
+		return time.Time{}, nil
+	}
+}
+
+func allHaveAmounts(details []camtTx) bool {
+	for _, tx := range details {
+		if tx.Amount == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
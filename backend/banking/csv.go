@@ -0,0 +1,221 @@
+package banking
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The column headers recognized in CSV exports, in English and German, compared without case, spaces and punctuation
+var (
+	csvBookingDate    = []string{"date", "bookingdate", "transactiondate", "buchungstag", "buchungsdatum", "datum"}
+	csvValueDate      = []string{"valuedate", "valuta", "valutadatum", "wertstellung"}
+	csvAmount         = []string{"amount", "betrag", "umsatz"}
+	csvCredit         = []string{"credit", "paidin", "moneyin", "haben", "eingang"}
+	csvDebit          = []string{"debit", "paidout", "moneyout", "soll", "ausgang"}
+	csvCurrency       = []string{"currency", "wahrung", "waehrung", "whrg"}
+	csvCounterparty   = []string{"counterparty", "name", "payee", "payer", "beneficiary", "begunstigterzahlungspflichtiger", "beguenstigterzahlungspflichtiger", "empfanger", "zahlungsempfanger", "auftraggeber", "namezahlungsbeteiligter"}
+	csvIBAN           = []string{"iban", "counterpartyiban", "kontonummeriban", "ibanzahlungsbeteiligter", "kontonummer"}
+	csvRemittanceInfo = []string{"description", "purpose", "remittanceinformation", "details", "memo", "verwendungszweck", "buchungstext"}
+	csvReference      = []string{"reference", "endtoendreference", "endtoendid", "referenz", "kundenreferenz", "glaubigerid"}
+	csvAccount        = []string{"account", "accountiban", "auftragskonto", "ibanauftragskonto"}
+
+	csvDateLayouts = []string{time.DateOnly, "02.01.2006", "02.01.06", "02/01/2006", "2.1.2006"}
+)
+
+// csvColumns are the indexes of the recognized columns, -1 if missing
+type csvColumns struct {
+	bookingDate, valueDate, amount, credit, debit, currency, counterparty, iban, remittanceInfo, reference, account int
+}
+
+// parseCSV reads a CSV export with a header row. The delimiter is the first of semicolon, tab and comma in the header.
+// Dates are read day first, amounts are either in one signed column or in separate credit and debit columns
+func parseCSV(content []byte) (*Statement, error) {
+	header, _, _ := bytes.Cut(content, []byte("\n"))
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	switch {
+	case bytes.ContainsRune(header, ';'):
+		reader.Comma = ';'
+	case bytes.ContainsRune(header, '\t'):
+		reader.Comma = '\t'
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV statement: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	columns := findCSVColumns(records[0])
+	if columns.bookingDate < 0 || columns.amount < 0 && (columns.credit < 0 || columns.debit < 0) {
+		return nil, ErrUnknownFormat
+	}
+
+	statement := &Statement{Format: FormatCSV}
+	for i, record := range records[1:] {
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		transaction, err := columns.read(record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV statement row %d: %w", i+2, err)
+		}
+		if statement.Account == "" {
+			statement.Account = NormalizeIBAN(column(record, columns.account))
+		}
+		statement.Transactions = append(statement.Transactions, transaction)
+	}
+
+	return statement, nil
+}
+
+func findCSVColumns(header []string) csvColumns {
+	keys := make([]string, len(header))
+	for i, name := range header {
+		keys[i] = headerKey(name)
+	}
+	find := func(names []string) int {
+		// the names are in order of preference
+		for _, name := range names {
+			if i := slices.Index(keys, name); i >= 0 {
+				return i
+			}
+		}
+		return -1
+	}
+
+	return csvColumns{
+		bookingDate:    find(csvBookingDate),
+		valueDate:      find(csvValueDate),
+		amount:         find(csvAmount),
+		credit:         find(csvCredit),
+		debit:          find(csvDebit),
+		currency:       find(csvCurrency),
+		counterparty:   find(csvCounterparty),
+		iban:           find(csvIBAN),
+		remittanceInfo: find(csvRemittanceInfo),
+		reference:      find(csvReference),
+		account:        find(csvAccount),
+	}
+}
+
+// headerKey lower-cases the column header and drops everything but letters and digits, umlauts lose their dots.
+// Units such as "Betrag (EUR)" are dropped as well
+func headerKey(name string) string {
+	name, _, _ = strings.Cut(strings.TrimPrefix(name, "\ufeff"), "(")
+	name = strings.NewReplacer("ä", "a", "ö", "o", "ü", "u", "Ä", "a", "Ö", "o", "Ü", "u", "ß", "ss").Replace(name)
+	return strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+func (c csvColumns) read(record []string) (Transaction, error) {
+	bookingDate, err := parseCSVDate(column(record, c.bookingDate))
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	currency := strings.TrimSpace(column(record, c.currency))
+	var amount model.Money
+	if c.amount >= 0 {
+		amount, err = parseAmount(column(record, c.amount), currency)
+	} else {
+		amount, err = creditMinusDebit(column(record, c.credit), column(record, c.debit), currency)
+	}
+	if err != nil {
+		return Transaction{}, err
+	}
+
+	transaction := Transaction{
+		BookingDate:      bookingDate,
+		Amount:           amount,
+		Counterparty:     column(record, c.counterparty),
+		CounterpartyIBAN: column(record, c.iban),
+		RemittanceInfo:   column(record, c.remittanceInfo),
+		Reference:        column(record, c.reference),
+	}
+	if value := column(record, c.valueDate); strings.TrimSpace(value) != "" {
+		valueDate, err := parseCSVDate(value)
+		if err != nil {
+			return Transaction{}, err
+		}
+		transaction.ValueDate = &valueDate
+	}
+
+	return transaction, nil
+}
+
+// creditMinusDebit combines separate credit and debit columns, debits may be given with or without their sign
+func creditMinusDebit(credit string, debit string, currency string) (model.Money, error) {
+	if strings.TrimSpace(credit) != "" {
+		return parseAmount(credit, currency)
+	}
+	if strings.TrimSpace(debit) == "" {
+		return model.Money{}, errors.New("neither a credit nor a debit amount")
+	}
+
+	amount, err := parseAmount(debit, currency)
+	if amount.Minor > 0 {
+		amount.Minor = -amount.Minor
+	}
+	return amount, err
+}
+
+func parseCSVDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range csvDateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", value)
+}
+
+// column returns the value of the column, empty if the column is missing
+func column(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return record[index]
+}
+
+// parseAmount parses an amount with either a decimal point or comma. With both, the last one is the decimal separator.
+// A single separator followed by exactly three digits, or one that repeats, separates thousands
+func parseAmount(value string, currency string) (model.Money, error) {
+	value = strings.NewReplacer(" ", "", "'", "", "\u00a0", "").Replace(strings.TrimSpace(value))
+
+	decimal := strings.LastIndexAny(value, ".,")
+	if decimal >= 0 {
+		separator := value[decimal : decimal+1]
+		other := strings.Trim(".,", separator)
+		if !strings.Contains(value, other) && (strings.Count(value, separator) > 1 || len(value)-decimal-1 == 3) {
+			decimal = -1
+		}
+	}
+
+	integer, fraction := value, ""
+	if decimal >= 0 {
+		integer, fraction = value[:decimal], "."+value[decimal+1:]
+	}
+	value = strings.NewReplacer(".", "", ",", "").Replace(integer) + fraction
+
+	amount, err := model.ParseMoney(value, currency)
+	if err != nil {
+		return model.Money{}, fmt.Errorf("invalid amount %q: %w", value, err)
+	}
+	return amount, nil
+}
@@ -0,0 +1,46 @@
+// Package banking handles bank account identifiers and bank file formats
+package banking
+
+import (
+	"strings"
+	"unicode"
+)
+
+// NormalizeIBAN removes spaces and other separators and upper-cases the IBAN, without validating it
+func NormalizeIBAN(iban string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, iban)
+}
+
+// ValidIBAN checks the format and the mod 97 check digits of a normalized IBAN
+func ValidIBAN(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	for i, r := range iban {
+		switch {
+		case i < 2 && (r < 'A' || r > 'Z'):
+			return false
+		case i >= 2 && i < 4 && (r < '0' || r > '9'):
+			return false
+		case (r < 'A' || r > 'Z') && (r < '0' || r > '9'):
+			return false
+		}
+	}
+
+	// the first four characters are moved to the end, letters are replaced with 10-35
+	remainder := 0
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' {
+			remainder = (remainder*100 + int(r-'A'+10)) % 97
+		} else {
+			remainder = (remainder*10 + int(r-'0')) % 97
+		}
+	}
+
+	return remainder == 1
+}
@@ -0,0 +1,161 @@
+package banking
+
+import (
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// a field starts a line with its tag, e.g. ":61:" or ":60F:"
+	mt940Tag = regexp.MustCompile(`(?m)^:(\d{2}[A-Z]?):`)
+	// :61: value date, optional booking date, (reversal of) debit or credit, the third currency letter, amount,
+	// transaction type and the references
+	mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(R?[DC])([A-Z])?(\d+,\d*)([NSF][A-Z0-9]{3})([^/\n]*)(?://([^\n]*))?`)
+	// :60F: the opening balance, its currency is the one of the statement
+	mt940Balance = regexp.MustCompile(`^[DC]\d{6}([A-Z]{3})`)
+	// ?20 to ?29 in the structured :86: field, as used by German banks
+	mt940Subfield = regexp.MustCompile(`\?(\d{2})`)
+)
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+// parseMT940 reads the statement lines of a SWIFT MT940 statement. The information to the account owner of each line
+// is read as structured subfields if it has them, as free text otherwise
+func parseMT940(content []byte) (*Statement, error) {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+
+	statement := &Statement{Format: FormatMT940}
+	currency := ""
+	var transaction *Transaction
+	for _, field := range mt940Fields(text) {
+		switch field.tag {
+		case "25":
+			if statement.Account == "" {
+				// either an IBAN or the bank code and account number separated by a slash
+				statement.Account = NormalizeIBAN(field.value)
+			}
+		case "60F", "60M":
+			if m := mt940Balance.FindStringSubmatch(field.value); m != nil {
+				currency = m[1]
+			}
+		case "61":
+			parsed, err := parseMT940Line(field.value, currency)
+			if err != nil {
+				return nil, err
+			}
+			statement.Transactions = append(statement.Transactions, parsed)
+			transaction = &statement.Transactions[len(statement.Transactions)-1]
+		case "86":
+			if transaction != nil {
+				readMT940Info(transaction, field.value)
+				transaction = nil
+			}
+		}
+	}
+
+	if len(statement.Transactions) == 0 && statement.Account == "" {
+		return nil, ErrUnknownFormat
+	}
+	return statement, nil
+}
+
+func mt940Fields(text string) []mt940Field {
+	locations := mt940Tag.FindAllStringSubmatchIndex(text, -1)
+	fields := make([]mt940Field, 0, len(locations))
+	for i, location := range locations {
+		end := len(text)
+		if i+1 < len(locations) {
+			end = locations[i+1][0]
+		}
+		// a line starting with a dash ends the message, the headers of the next one may follow it
+		value, _, _ := strings.Cut(text[location[1]:end], "\n-")
+		fields = append(fields, mt940Field{tag: text[location[2]:location[3]], value: strings.TrimSpace(value)})
+	}
+
+	return fields
+}
+
+func parseMT940Line(value string, currency string) (Transaction, error) {
+	m := mt940Line.FindStringSubmatch(value)
+	if m == nil {
+		return Transaction{}, fmt.Errorf("invalid MT940 statement line %q", value)
+	}
+
+	valueDate, err := time.Parse("060102", m[1])
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid value date in MT940 statement line %q", value)
+	}
+	bookingDate := valueDate
+	if m[2] != "" {
+		// the booking date has no year, it is the one closest to the value date
+		bookingDate, err = time.Parse("20060102", valueDate.Format("2006")+m[2])
+		if err != nil {
+			return Transaction{}, fmt.Errorf("invalid booking date in MT940 statement line %q", value)
+		}
+		switch {
+		case bookingDate.Sub(valueDate) > 180*24*time.Hour:
+			bookingDate = bookingDate.AddDate(-1, 0, 0)
+		case valueDate.Sub(bookingDate) > 180*24*time.Hour:
+			bookingDate = bookingDate.AddDate(1, 0, 0)
+		}
+	}
+
+	amount, err := model.ParseMoney(strings.Replace(m[5], ",", ".", 1), currency)
+	if err != nil {
+		return Transaction{}, fmt.Errorf("invalid amount in MT940 statement line %q: %w", value, err)
+	}
+	// debits and reversals of credits lower the balance
+	if m[3] == "D" || m[3] == "RC" {
+		amount.Minor = -amount.Minor
+	}
+
+	transaction := Transaction{
+		BookingDate: bookingDate,
+		ValueDate:   &valueDate,
+		Amount:      amount,
+		Reference:   strings.TrimSpace(m[7]),
+	}
+	if transaction.Reference == "" || transaction.Reference == "NONREF" {
+		transaction.Reference = strings.TrimSpace(m[8])
+	}
+	return transaction, nil
+}
+
+// readMT940Info reads the remittance information and the counterparty, the subfields ?20 to ?29 and ?60 to ?63 are
+// the remittance information, ?31 the account and ?32 and ?33 the name of the counterparty
+func readMT940Info(transaction *Transaction, value string) {
+	value = strings.ReplaceAll(value, "\n", "")
+	locations := mt940Subfield.FindAllStringSubmatchIndex(value, -1)
+	if len(locations) == 0 {
+		transaction.RemittanceInfo = value
+		return
+	}
+
+	var remittance, name []string
+	for i, location := range locations {
+		end := len(value)
+		if i+1 < len(locations) {
+			end = locations[i+1][0]
+		}
+		content := value[location[1]:end]
+
+		switch code := value[location[2]:location[3]]; {
+		case code >= "20" && code <= "29", code >= "60" && code <= "63":
+			remittance = append(remittance, content)
+		case code == "31":
+			transaction.CounterpartyIBAN = content
+		case code == "32", code == "33":
+			name = append(name, content)
+		}
+	}
+
+	// subfields split the text at fixed lengths, words may be split across them
+	transaction.RemittanceInfo = strings.Join(remittance, "")
+	transaction.Counterparty = strings.Join(name, "")
+}
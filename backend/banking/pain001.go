@@ -0,0 +1,250 @@
+package banking
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The max lengths of the SEPA text fields
+const (
+	MaxSEPAIDLength         = 35
+	MaxSEPANameLength       = 70
+	MaxSEPARemittanceLength = 140
+)
+
+const pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"
+
+var (
+	bicPattern = regexp.MustCompile(`^[A-Z]{6}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	// the characters of the SEPA Latin character set, everything else is replaced
+	sepaForbidden = regexp.MustCompile(`[^A-Za-z0-9/\-?:().,'+ ]`)
+	sepaLetters   = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "Ä", "Ae", "Ö", "Oe", "Ü", "Ue", "ß", "ss",
+		"é", "e", "è", "e", "ê", "e", "á", "a", "à", "a", "â", "a", "ç", "c", "ñ", "n", "ó", "o", "ô", "o", "í", "i",
+		"ú", "u", "É", "E", "&", "+", "_", "-")
+)
+
+// NormalizeBIC removes spaces and upper-cases the BIC, without validating it
+func NormalizeBIC(bic string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(bic), ""))
+}
+
+// ValidBIC checks the format of a normalized BIC, 8 or 11 characters
+func ValidBIC(bic string) bool {
+	return bicPattern.MatchString(bic)
+}
+
+// SEPAText replaces the characters outside of the SEPA character set, umlauts are transliterated, and cuts the text
+// to the max length
+func SEPAText(text string, maxLength int) string {
+	text = sepaForbidden.ReplaceAllString(sepaLetters.Replace(text), " ")
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) > maxLength {
+		text = strings.TrimSpace(text[:maxLength])
+	}
+	return text
+}
+
+// Account is the bank account of a party to a transfer, with a normalized IBAN. The BIC is optional
+type Account struct {
+	Name string
+	IBAN string
+	BIC  string
+}
+
+// CreditTransfer is a single transfer of a payment order
+type CreditTransfer struct {
+	EndToEndID     string      // passed on to the creditor, at most 35 characters
+	Amount         model.Money // in EUR
+	Creditor       Account
+	RemittanceInfo string // at most 140 characters
+}
+
+// CreditTransferOrder is a SEPA payment order of several transfers from the debtor account, executed on the same day
+type CreditTransferOrder struct {
+	MessageID     string // unique per order, banks reject orders with a message id they know, at most 35 characters
+	CreatedAt     time.Time
+	ExecutionDate time.Time
+	Debtor        Account
+	Transfers     []CreditTransfer
+}
+
+// The elements of a pain.001.001.03 customer credit transfer initiation, in the order of the schema
+type painDocument struct {
+	XMLName  xml.Name     `xml:"Document"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Initiate painInitiate `xml:"CstmrCdtTrfInitn"`
+}
+
+type painInitiate struct {
+	GroupHeader painGroupHeader `xml:"GrpHdr"`
+	PaymentInfo painPaymentInfo `xml:"PmtInf"`
+}
+
+type painGroupHeader struct {
+	MessageID       string    `xml:"MsgId"`
+	CreatedAt       string    `xml:"CreDtTm"`
+	NumberOfTxs     int       `xml:"NbOfTxs"`
+	ControlSum      string    `xml:"CtrlSum"`
+	InitiatingParty painParty `xml:"InitgPty"`
+}
+
+type painParty struct {
+	Name string `xml:"Nm"`
+}
+
+type painAccount struct {
+	IBAN string `xml:"Id>IBAN"`
+}
+
+type painAgent struct {
+	BIC   string     `xml:"FinInstnId>BIC,omitempty"`
+	Other *painOther `xml:"FinInstnId>Othr"`
+}
+
+type painOther struct {
+	ID string `xml:"Id"`
+}
+
+type painPaymentInfo struct {
+	ID            string         `xml:"PmtInfId"`
+	Method        string         `xml:"PmtMtd"`
+	BatchBooking  bool           `xml:"BtchBookg"`
+	NumberOfTxs   int            `xml:"NbOfTxs"`
+	ControlSum    string         `xml:"CtrlSum"`
+	ServiceLevel  string         `xml:"PmtTpInf>SvcLvl>Cd"`
+	ExecutionDate string         `xml:"ReqdExctnDt"`
+	Debtor        painParty      `xml:"Dbtr"`
+	DebtorAccount painAccount    `xml:"DbtrAcct"`
+	DebtorAgent   painAgent      `xml:"DbtrAgt"`
+	ChargeBearer  string         `xml:"ChrgBr"`
+	Transfers     []painTransfer `xml:"CdtTrfTxInf"`
+}
+
+type painAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type painTransfer struct {
+	EndToEndID      string          `xml:"PmtId>EndToEndId"`
+	Amount          painAmount      `xml:"Amt>InstdAmt"`
+	CreditorAgent   *painAgent      `xml:"CdtrAgt"`
+	Creditor        painParty       `xml:"Cdtr"`
+	CreditorAccount painAccount     `xml:"CdtrAcct"`
+	RemittanceInfo  *painRemittance `xml:"RmtInf"`
+}
+
+// painRemittance is left out without a text, an empty RmtInf is not valid
+type painRemittance struct {
+	Unstructured string `xml:"Ustrd"`
+}
+
+// Validate checks the order against the rules of SEPA credit transfers, returns the first problem found
+func (o *CreditTransferOrder) Validate() error {
+	if len(o.Transfers) == 0 {
+		return errors.New("the order has no transfers")
+	}
+	if err := validateSEPAAccount(o.Debtor); err != nil {
+		return fmt.Errorf("debtor: %w", err)
+	}
+	for _, transfer := range o.Transfers {
+		switch {
+		case transfer.Amount.Currency != "EUR":
+			return fmt.Errorf("transfer %s: SEPA transfers are in EUR", transfer.EndToEndID)
+		case transfer.Amount.Minor <= 0:
+			return fmt.Errorf("transfer %s: amount must be positive", transfer.EndToEndID)
+		case transfer.EndToEndID == "" || len(transfer.EndToEndID) > MaxSEPAIDLength:
+			return fmt.Errorf("transfer %s: end to end id must have 1 to %d characters", transfer.EndToEndID, MaxSEPAIDLength)
+		}
+		if err := validateSEPAAccount(transfer.Creditor); err != nil {
+			return fmt.Errorf("transfer %s: creditor: %w", transfer.EndToEndID, err)
+		}
+	}
+
+	return nil
+}
+
+func validateSEPAAccount(account Account) error {
+	switch {
+	case strings.TrimSpace(account.Name) == "":
+		return errors.New("name is required")
+	case !ValidIBAN(account.IBAN):
+		return errors.New("IBAN is not valid")
+	case account.BIC != "" && !ValidBIC(account.BIC):
+		return errors.New("BIC is not valid")
+	default:
+		return nil
+	}
+}
+
+// Pain001 returns the order as a pain.001.001.03 XML document, in the SEPA character set
+func (o *CreditTransferOrder) Pain001() ([]byte, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	var total int64
+	transfers := make([]painTransfer, len(o.Transfers))
+	for i, transfer := range o.Transfers {
+		total += transfer.Amount.Minor
+		transfers[i] = painTransfer{
+			EndToEndID:      SEPAText(transfer.EndToEndID, MaxSEPAIDLength),
+			Amount:          painAmount{Value: transfer.Amount.Decimal(), Currency: transfer.Amount.Currency},
+			Creditor:        painParty{Name: SEPAText(transfer.Creditor.Name, MaxSEPANameLength)},
+			CreditorAccount: painAccount{IBAN: transfer.Creditor.IBAN},
+		}
+		if remittance := SEPAText(transfer.RemittanceInfo, MaxSEPARemittanceLength); remittance != "" {
+			transfers[i].RemittanceInfo = &painRemittance{Unstructured: remittance}
+		}
+		// the creditor agent may be left out within the EEA
+		if transfer.Creditor.BIC != "" {
+			transfers[i].CreditorAgent = &painAgent{BIC: transfer.Creditor.BIC}
+		}
+	}
+	controlSum := model.Money{Minor: total, Currency: "EUR"}.Decimal()
+
+	debtorAgent := painAgent{BIC: o.Debtor.BIC}
+	if o.Debtor.BIC == "" {
+		debtorAgent = painAgent{Other: &painOther{ID: "NOTPROVIDED"}}
+	}
+	messageID := SEPAText(o.MessageID, MaxSEPAIDLength)
+	debtorName := SEPAText(o.Debtor.Name, MaxSEPANameLength)
+
+	document := painDocument{
+		Xmlns: pain001Namespace,
+		Initiate: painInitiate{
+			GroupHeader: painGroupHeader{
+				MessageID:       messageID,
+				CreatedAt:       o.CreatedAt.UTC().Format("2006-01-02T15:04:05"),
+				NumberOfTxs:     len(transfers),
+				ControlSum:      controlSum,
+				InitiatingParty: painParty{Name: debtorName},
+			},
+			PaymentInfo: painPaymentInfo{
+				ID:            messageID,
+				Method:        "TRF",
+				BatchBooking:  true,
+				NumberOfTxs:   len(transfers),
+				ControlSum:    controlSum,
+				ServiceLevel:  "SEPA",
+				ExecutionDate: o.ExecutionDate.Format(time.DateOnly),
+				Debtor:        painParty{Name: debtorName},
+				DebtorAccount: painAccount{IBAN: o.Debtor.IBAN},
+				DebtorAgent:   debtorAgent,
+				ChargeBearer:  "SLEV",
+				Transfers:     transfers,
+			},
+		},
+	}
+
+	content, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), content...), nil
+}
@@ -0,0 +1,211 @@
+package banking
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// testOrder returns a valid order of two transfers
+func testOrder() *CreditTransferOrder {
+	return &CreditTransferOrder{
+		MessageID:     "INV-20240301120000-abcdef12",
+		CreatedAt:     time.Date(2024, 3, 1, 13, 0, 0, 0, time.FixedZone("CET", 3600)),
+		ExecutionDate: date(2024, 3, 4),
+		Debtor:        Account{Name: "Beispiel & Söhne GmbH", IBAN: "DE89370400440532013000"},
+		Transfers: []CreditTransfer{
+			{
+				EndToEndID:     "a1b2c3",
+				Amount:         eur(11900),
+				Creditor:       Account{Name: "Müller Büro_bedarf", IBAN: "DE02120300000000202051", BIC: "BYLADEM1001"},
+				RemittanceInfo: "RE-4711 vom 01.03.2024 – Danke!",
+			},
+			{
+				EndToEndID: "d4e5f6",
+				Amount:     eur(5),
+				Creditor:   Account{Name: "Dupont SARL", IBAN: "FR1420041010050500013M02606"},
+			},
+		},
+	}
+}
+
+func TestPain001(t *testing.T) {
+	content, err := testOrder().Pain001()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <CstmrCdtTrfInitn>
+    <GrpHdr>
+      <MsgId>INV-20240301120000-abcdef12</MsgId>
+      <CreDtTm>2024-03-01T12:00:00</CreDtTm>
+      <NbOfTxs>2</NbOfTxs>
+      <CtrlSum>119.05</CtrlSum>
+      <InitgPty>
+        <Nm>Beispiel + Soehne GmbH</Nm>
+      </InitgPty>
+    </GrpHdr>
+    <PmtInf>
+      <PmtInfId>INV-20240301120000-abcdef12</PmtInfId>
+      <PmtMtd>TRF</PmtMtd>
+      <BtchBookg>true</BtchBookg>
+      <NbOfTxs>2</NbOfTxs>
+      <CtrlSum>119.05</CtrlSum>
+      <PmtTpInf>
+        <SvcLvl>
+          <Cd>SEPA</Cd>
+        </SvcLvl>
+      </PmtTpInf>
+      <ReqdExctnDt>2024-03-04</ReqdExctnDt>
+      <Dbtr>
+        <Nm>Beispiel + Soehne GmbH</Nm>
+      </Dbtr>
+      <DbtrAcct>
+        <Id>
+          <IBAN>DE89370400440532013000</IBAN>
+        </Id>
+      </DbtrAcct>
+      <DbtrAgt>
+        <FinInstnId>
+          <Othr>
+            <Id>NOTPROVIDED</Id>
+          </Othr>
+        </FinInstnId>
+      </DbtrAgt>
+      <ChrgBr>SLEV</ChrgBr>
+      <CdtTrfTxInf>
+        <PmtId>
+          <EndToEndId>a1b2c3</EndToEndId>
+        </PmtId>
+        <Amt>
+          <InstdAmt Ccy="EUR">119.00</InstdAmt>
+        </Amt>
+        <CdtrAgt>
+          <FinInstnId>
+            <BIC>BYLADEM1001</BIC>
+          </FinInstnId>
+        </CdtrAgt>
+        <Cdtr>
+          <Nm>Mueller Buero-bedarf</Nm>
+        </Cdtr>
+        <CdtrAcct>
+          <Id>
+            <IBAN>DE02120300000000202051</IBAN>
+          </Id>
+        </CdtrAcct>
+        <RmtInf>
+          <Ustrd>RE-4711 vom 01.03.2024 Danke</Ustrd>
+        </RmtInf>
+      </CdtTrfTxInf>
+      <CdtTrfTxInf>
+        <PmtId>
+          <EndToEndId>d4e5f6</EndToEndId>
+        </PmtId>
+        <Amt>
+          <InstdAmt Ccy="EUR">0.05</InstdAmt>
+        </Amt>
+        <Cdtr>
+          <Nm>Dupont SARL</Nm>
+        </Cdtr>
+        <CdtrAcct>
+          <Id>
+            <IBAN>FR1420041010050500013M02606</IBAN>
+          </Id>
+        </CdtrAcct>
+      </CdtTrfTxInf>
+    </PmtInf>
+  </CstmrCdtTrfInitn>
+</Document>`
+	if string(content) != want {
+		t.Errorf("Pain001 =\n%s\nwant\n%s", content, want)
+	}
+
+	order := testOrder()
+	order.Debtor.BIC = "COBADEFFXXX"
+	content, err = order.Pain001()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "<DbtrAgt>\n        <FinInstnId>\n          <BIC>COBADEFFXXX</BIC>") ||
+		strings.Contains(string(content), "NOTPROVIDED") {
+		t.Errorf("Pain001 with a debtor BIC =\n%s", content)
+	}
+}
+
+func TestCreditTransferOrderValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(order *CreditTransferOrder)
+		want   string // part of the error, empty if the order is valid
+	}{
+		{"valid", func(order *CreditTransferOrder) {}, ""},
+		{"no transfers", func(order *CreditTransferOrder) { order.Transfers = nil }, "no transfers"},
+		{"debtor without a name", func(order *CreditTransferOrder) { order.Debtor.Name = " " }, "debtor: name is required"},
+		{"debtor with an invalid IBAN", func(order *CreditTransferOrder) { order.Debtor.IBAN = "DE88370400440532013000" }, "debtor: IBAN"},
+		{"debtor with an invalid BIC", func(order *CreditTransferOrder) { order.Debtor.BIC = "COBA" }, "debtor: BIC"},
+		{"not in EUR", func(order *CreditTransferOrder) { order.Transfers[1].Amount.Currency = "CHF" }, "transfer d4e5f6: SEPA transfers are in EUR"},
+		{"nothing to pay", func(order *CreditTransferOrder) { order.Transfers[0].Amount = eur(0) }, "amount must be positive"},
+		{"refund", func(order *CreditTransferOrder) { order.Transfers[0].Amount = eur(-100) }, "amount must be positive"},
+		{"no end to end id", func(order *CreditTransferOrder) { order.Transfers[0].EndToEndID = "" }, "end to end id"},
+		{"long end to end id", func(order *CreditTransferOrder) { order.Transfers[0].EndToEndID = strings.Repeat("a", 36) }, "end to end id"},
+		{"creditor with an invalid IBAN", func(order *CreditTransferOrder) { order.Transfers[1].Creditor.IBAN = "" }, "transfer d4e5f6: creditor: IBAN"},
+		{"creditor with an invalid BIC", func(order *CreditTransferOrder) { order.Transfers[0].Creditor.BIC = "byladem1001" }, "creditor: BIC"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order := testOrder()
+			test.change(order)
+			err := order.Validate()
+			if (err == nil) != (test.want == "") || (err != nil && !strings.Contains(err.Error(), test.want)) {
+				t.Errorf("Validate = %v, want %q", err, test.want)
+			}
+			// invalid orders are not exported
+			if _, exportErr := order.Pain001(); (exportErr == nil) != (err == nil) {
+				t.Errorf("Pain001 = %v, want %v", exportErr, err)
+			}
+		})
+	}
+}
+
+func TestSEPAText(t *testing.T) {
+	tests := []struct {
+		text      string
+		maxLength int
+		want      string
+	}{
+		{"RE-4711", 140, "RE-4711"},
+		{"Größe & Maße", 140, "Groesse + Masse"},
+		{"Café <Crème>", 140, "Cafe Creme"},
+		{"a\tb\n\nc", 140, "a b c"},
+		{"€ 100 / 2 = 50 %", 140, "100 / 2 50"},
+		{"12345 6789", 6, "12345"},
+		{"日本", 140, ""},
+	}
+	for _, test := range tests {
+		if got := SEPAText(test.text, test.maxLength); got != test.want {
+			t.Errorf("SEPAText(%q, %d) = %q, want %q", test.text, test.maxLength, got, test.want)
+		}
+	}
+}
+
+func TestBIC(t *testing.T) {
+	tests := []struct {
+		bic   string
+		valid bool
+	}{
+		{"COBADEFF", true},
+		{"COBADEFFXXX", true},
+		{"coba de ff xxx", true},
+		{"COBADEF", false},
+		{"COBADEFFXX", false},
+		{"C0BADEFF", false},
+		{"COBADEFFXXXX", false},
+	}
+	for _, test := range tests {
+		if got := ValidBIC(NormalizeBIC(test.bic)); got != test.valid {
+			t.Errorf("ValidBIC(%q) = %t, want %t", test.bic, got, test.valid)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package banking
+
+import (
+	"bytes"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"strings"
+	"time"
+)
+
+// Statement formats
+const (
+	FormatCAMT053 = "camt.053"
+	FormatMT940   = "mt940"
+	FormatCSV     = "csv"
+)
+
+// ErrUnknownFormat is returned for files that are not bank statements in one of the supported formats
+var ErrUnknownFormat = errors.New("not a CAMT.053, MT940 or CSV bank statement")
+
+// Statement is a bank statement of a single account
+type Statement struct {
+	Format       string
+	Account      string // normalized IBAN or account number of the statement, empty if not stated
+	Transactions []Transaction
+}
+
+// Transaction is a single booking of a statement
+type Transaction struct {
+	BookingDate      time.Time
+	ValueDate        *time.Time
+	Amount           model.Money // positive for credits, negative for debits
+	Counterparty     string      // name of the other party
+	CounterpartyIBAN string      // normalized, empty if not stated
+	RemittanceInfo   string      // the purpose of the payment as entered by the payer
+	Reference        string      // end-to-end or bank reference
+}
+
+// ParseStatement reads a bank statement, the format is detected from the content
+func ParseStatement(content []byte) (*Statement, error) {
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")))
+
+	var statement *Statement
+	var err error
+	switch {
+	case len(trimmed) == 0:
+		return nil, ErrUnknownFormat
+	case trimmed[0] == '<':
+		statement, err = parseCAMT053(trimmed)
+	case bytes.HasPrefix(trimmed, []byte("{1:")) || bytes.HasPrefix(trimmed, []byte(":20:")):
+		statement, err = parseMT940(trimmed)
+	default:
+		statement, err = parseCSV(trimmed)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range statement.Transactions {
+		t := &statement.Transactions[i]
+		t.Counterparty = strings.Join(strings.Fields(t.Counterparty), " ")
+		t.RemittanceInfo = strings.Join(strings.Fields(t.RemittanceInfo), " ")
+		t.Reference = strings.TrimSpace(t.Reference)
+		t.CounterpartyIBAN = NormalizeIBAN(t.CounterpartyIBAN)
+	}
+	return statement, nil
+}
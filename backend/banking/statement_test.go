@@ -0,0 +1,198 @@
+package banking
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func datePointer(year int, month time.Month, day int) *time.Time {
+	d := date(year, month, day)
+	return &d
+}
+
+func eur(minor int64) model.Money {
+	return model.Money{Minor: minor, Currency: "EUR"}
+}
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *Statement
+	}{
+		{
+			name: "camt.053",
+			content: `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.08">
+<BkToCstmrStmt><Stmt>
+  <Acct><Id><IBAN>DE89 3704 0044 0532 0130 00</IBAN></Id></Acct>
+  <Ntry>
+    <Amt Ccy="EUR">119.00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+    <BookgDt><Dt>2024-03-01</Dt></BookgDt><ValDt><Dt>2024-03-02</Dt></ValDt>
+    <AcctSvcrRef>BANKREF1</AcctSvcrRef>
+    <NtryDtls><TxDtls>
+      <Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs>
+      <RltdPties><Cdtr><Pty><Nm>ACME  GmbH</Nm></Pty></Cdtr><CdtrAcct><Id><IBAN>fr14 2004 1010 0505 0001 3m02 606</IBAN></Id></CdtrAcct></RltdPties>
+      <RmtInf><Ustrd>RE-4711</Ustrd><Ustrd>Kunde 42</Ustrd></RmtInf>
+    </TxDtls></NtryDtls>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">30.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+    <BookgDt><DtTm>2024-03-03T10:15:00+01:00</DtTm></BookgDt>
+    <NtryDtls>
+      <TxDtls><AmtDtls><TxAmt><Amt Ccy="EUR">10.00</Amt></TxAmt></AmtDtls><Refs><EndToEndId>E2E-1</EndToEndId></Refs>
+        <RltdPties><Dbtr><Nm>Customer One</Nm></Dbtr></RltdPties><RmtInf><Strd><CdtrRefInf><Ref>RF18539007547034</Ref></CdtrRefInf></Strd></RmtInf></TxDtls>
+      <TxDtls><AmtDtls><TxAmt><Amt Ccy="EUR">20.00</Amt></TxAmt></AmtDtls><Refs><EndToEndId>E2E-2</EndToEndId></Refs>
+        <RltdPties><Dbtr><Nm>Customer Two</Nm></Dbtr></RltdPties><AddtlTxInf>Deposit</AddtlTxInf></TxDtls>
+    </NtryDtls>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">5.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><RvslInd>true</RvslInd>
+    <ValDt><Dt>2024-03-04</Dt></ValDt>
+    <AddtlNtryInf>Reversed fee</AddtlNtryInf>
+  </Ntry>
+</Stmt></BkToCstmrStmt>
+</Document>`,
+			want: &Statement{Format: FormatCAMT053, Account: "DE89370400440532013000", Transactions: []Transaction{
+				{BookingDate: date(2024, 3, 1), ValueDate: datePointer(2024, 3, 2), Amount: eur(-11900), Counterparty: "ACME GmbH",
+					CounterpartyIBAN: "FR1420041010050500013M02606", RemittanceInfo: "RE-4711 Kunde 42", Reference: "BANKREF1"},
+				{BookingDate: date(2024, 3, 3), Amount: eur(1000), Counterparty: "Customer One", RemittanceInfo: "RF18539007547034", Reference: "E2E-1"},
+				{BookingDate: date(2024, 3, 3), Amount: eur(2000), Counterparty: "Customer Two", RemittanceInfo: "Deposit", Reference: "E2E-2"},
+				{BookingDate: date(2024, 3, 4), ValueDate: datePointer(2024, 3, 4), Amount: eur(500), RemittanceInfo: "Reversed fee"},
+			}},
+		},
+		{
+			name: "camt.053 batch without amounts per transaction",
+			content: `<Document><BkToCstmrStmt><Stmt>
+  <Ntry><Amt Ccy="EUR">30.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><BookgDt><Dt>2024-03-03</Dt></BookgDt><AcctSvcrRef>BATCH</AcctSvcrRef>
+    <NtryDtls><TxDtls><RltdPties><Dbtr><Nm>One</Nm></Dbtr></RltdPties></TxDtls><TxDtls><RltdPties><Dbtr><Nm>Two</Nm></Dbtr></RltdPties></TxDtls></NtryDtls>
+  </Ntry>
+</Stmt></BkToCstmrStmt></Document>`,
+			want: &Statement{Format: FormatCAMT053, Transactions: []Transaction{
+				{BookingDate: date(2024, 3, 3), Amount: eur(3000), Counterparty: "One", Reference: "BATCH"},
+			}},
+		},
+		{
+			name: "mt940",
+			content: "{1:F01BANKDEFFAXXX0000000000}{4:\r\n" +
+				":20:STARTUMS\r\n" +
+				":25:10020030/1234567\r\n" +
+				":28C:1/1\r\n" +
+				":60F:C231229EUR1000,00\r\n" +
+				// booked in the new year, valued in the old one
+				":61:2312290102D119,00NTRFNONREF//BANK-1\r\n" +
+				":86:116?00SEPA-UEBERWEISUNG?20EREF+RE-4711 Rech?21nung Maerz?31DE893704004405\r\n" +
+				"32013000?32ACME Gm?33bH\r\n" +
+				":61:240105C50,5NTRFKREF-2\r\n" +
+				":86:Payment for invoice 12\r\n" +
+				":61:240106RC10,00NCHK\r\n" +
+				":62F:C240106EUR921,50\r\n" +
+				"-}",
+			want: &Statement{Format: FormatMT940, Account: "100200301234567", Transactions: []Transaction{
+				{BookingDate: date(2024, 1, 2), ValueDate: datePointer(2023, 12, 29), Amount: eur(-11900), Counterparty: "ACME GmbH",
+					CounterpartyIBAN: "DE89370400440532013000", RemittanceInfo: "EREF+RE-4711 Rechnung Maerz", Reference: "BANK-1"},
+				{BookingDate: date(2024, 1, 5), ValueDate: datePointer(2024, 1, 5), Amount: eur(5050),
+					RemittanceInfo: "Payment for invoice 12", Reference: "KREF-2"},
+				{BookingDate: date(2024, 1, 6), ValueDate: datePointer(2024, 1, 6), Amount: eur(-1000)},
+			}},
+		},
+		{
+			name: "german csv with debit and credit columns",
+			content: "\ufeffBuchungstag;Valuta;Auftraggeber;IBAN;Verwendungszweck;Soll (EUR);Haben (EUR);Währung;IBAN Auftragskonto\n" +
+				"01.03.2024;02.03.2024;ACME GmbH;DE89 3704 0044 0532 0130 00;RE-4711;-1.190,00;;EUR;DE02 1203 0000 0000 2020 51\n" +
+				"\n" +
+				"03.03.24;;Kunde;;\"Rechnung; 12\";;50,5;EUR;\n",
+			want: &Statement{Format: FormatCSV, Account: "DE02120300000000202051", Transactions: []Transaction{
+				{BookingDate: date(2024, 3, 1), ValueDate: datePointer(2024, 3, 2), Amount: eur(-119000), Counterparty: "ACME GmbH",
+					CounterpartyIBAN: "DE89370400440532013000", RemittanceInfo: "RE-4711"},
+				{BookingDate: date(2024, 3, 3), Amount: eur(5050), Counterparty: "Kunde", RemittanceInfo: "Rechnung; 12"},
+			}},
+		},
+		{
+			name: "english csv with a signed amount",
+			content: "Date,Description,Amount,Currency,Reference\n" +
+				"2024-03-01,Invoice 12,\"-1,234.50\",USD,REF-1\n" +
+				"2024-03-02,Refund,20,USD,\n",
+			want: &Statement{Format: FormatCSV, Transactions: []Transaction{
+				{BookingDate: date(2024, 3, 1), Amount: model.Money{Minor: -123450, Currency: "USD"}, RemittanceInfo: "Invoice 12", Reference: "REF-1"},
+				{BookingDate: date(2024, 3, 2), Amount: model.Money{Minor: 2000, Currency: "USD"}, RemittanceInfo: "Refund"},
+			}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statement, err := ParseStatement([]byte(test.content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if statement.Format != test.want.Format || statement.Account != test.want.Account ||
+				len(statement.Transactions) != len(test.want.Transactions) {
+				t.Fatalf("ParseStatement = %+v, want %+v", statement, test.want)
+			}
+			for i, transaction := range statement.Transactions {
+				if !reflect.DeepEqual(transaction, test.want.Transactions[i]) {
+					t.Errorf("transaction %d = %+v, want %+v", i, transaction, test.want.Transactions[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatementErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		unknown bool // the error is ErrUnknownFormat rather than one of an invalid statement
+	}{
+		{"empty", " \n", true},
+		{"other xml", "<Invoice/>", true},
+		{"csv without amounts", "Date;Name\n01.03.2024;ACME\n", true},
+		{"text", "Hello", true},
+		{"camt without a booking date", `<Document><BkToCstmrStmt><Stmt><Ntry><Amt Ccy="EUR">1.00</Amt></Ntry></Stmt></BkToCstmrStmt></Document>`, false},
+		{"camt with an invalid amount", `<Document><BkToCstmrStmt><Stmt><Ntry><Amt Ccy="EUR">1.005</Amt><BookgDt><Dt>2024-03-01</Dt></BookgDt></Ntry></Stmt></BkToCstmrStmt></Document>`, false},
+		{"mt940 with an invalid line", ":20:X\n:60F:C240101EUR0,00\n:61:24XX01C1,00NTRF\n", false},
+		{"csv with an invalid date", "Date,Amount\n2024-13-01,1.00\n", false},
+		{"csv without credit or debit", "Date,Credit,Debit\n2024-03-01,,\n", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseStatement([]byte(test.content))
+			if err == nil || errors.Is(err, ErrUnknownFormat) != test.unknown {
+				t.Errorf("ParseStatement = %v, want unknown format %t", err, test.unknown)
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"12", 1200, false},
+		{"12,5", 1250, false},
+		{"-1.234,56", -123456, false},
+		{"1,234.56", 123456, false},
+		{"1.234", 123400, false},
+		{"1,234,567", 123456700, false},
+		{"1 234,00", 123400, false},
+		{"1'234.00", 123400, false},
+		{"0.123", 12300, false},
+		{"12.3456", 0, true},
+		{"abc", 0, true},
+	}
+	for _, test := range tests {
+		amount, err := parseAmount(test.value, "EUR")
+		if (err != nil) != test.wantErr || (err == nil && amount.Minor != test.want) {
+			t.Errorf("parseAmount(%q) = %v, %v, want %d", test.value, amount.Minor, err, test.want)
+		}
+	}
+}
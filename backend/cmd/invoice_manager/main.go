@@ -1,6 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/email"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/extractor"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/ingest"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/preview"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/processing"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/reconciliation"
 	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
 	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
 	"go.uber.org/zap"
@@ -9,7 +20,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/Wiblz/Fun-Invoice-Manager/backend/api"
 	"github.com/spf13/viper"
@@ -20,6 +33,11 @@ const (
 	defaultLogPath    = "../logs/invoice.log"
 	defaultLogLevel   = zapcore.InfoLevel
 	defaultSQLiteFile = "invoice.db"
+	// How long running requests and uploads get to finish on shutdown
+	defaultShutdownTimeout = 30 * time.Second
+	defaultOCRCommand      = "tesseract"
+	defaultOCRLanguages    = "deu+eng"
+	defaultHEIFConvert     = "heif-convert"
 )
 
 func newLogger(production bool, debug bool, path string) *zap.Logger {
@@ -48,6 +66,26 @@ func newLogger(production bool, debug bool, path string) *zap.Logger {
 	return zap.New(core)
 }
 
+// storageManagerType returns the manager type selected by DATABASE_TYPE along with its arguments, defaults to SQLite
+func storageManagerType(config *viper.Viper) (string, []string, error) {
+	switch databaseType := config.GetString("DATABASE_TYPE"); databaseType {
+	case "", "sqlite":
+		sqliteFile := config.GetString("SQLITE_FILE")
+		if sqliteFile == "" {
+			sqliteFile = defaultSQLiteFile
+		}
+		return "sqlite", []string{sqliteFile}, nil
+	case "postgres":
+		dsn := config.GetString("POSTGRES_DSN")
+		if dsn == "" {
+			return "", nil, errors.New("POSTGRES_DSN must be set for the postgres database")
+		}
+		return "postgres", []string{dsn}, nil
+	default:
+		return "", nil, fmt.Errorf("unknown database type %q", databaseType)
+	}
+}
+
 func main() {
 	config := viper.New()
 	config.SetConfigFile(".env")
@@ -67,10 +105,17 @@ func main() {
 	logger := newLogger(production, debug, logPath)
 	defer logger.Sync()
 
-	var llm *openai.LLM
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(config, logger, os.Args[2:])
+		logger.Sync()
+		os.Exit(code)
+	}
+
+	// e-invoices come first, their fields are exact
+	extractors := []extractor.Extractor{extractor.NewEInvoice(logger), extractor.NewRules()}
 	groqApiKey := config.GetString("GROQ_API_KEY")
 	if groqApiKey != "" {
-		llm, err = openai.New(
+		llm, err := openai.New(
 			openai.WithModel("llama3-8b-8192"),
 			openai.WithResponseFormat(openai.ResponseFormatJSON),
 			openai.WithBaseURL("https://api.groq.com/openai/v1"),
@@ -78,27 +123,109 @@ func main() {
 		)
 		if err != nil {
 			logger.Warn("Failed to create LLM client, invoices will not be processed by LLM", zap.Error(err))
+		} else {
+			extractors = append(extractors, extractor.NewLLM(llm, logger))
 		}
 	} else {
 		logger.Warn("GROQ_API_KEY not set, invoices will not be processed by LLM")
 	}
 
-	sqliteFile := config.GetString("SQLITE_FILE")
-	if sqliteFile == "" {
-		config.Set("SQLITE_FILE", defaultSQLiteFile)
+	managerType, managerArgs, err := storageManagerType(config)
+	if err != nil {
+		logger.Fatal("Invalid database configuration", zap.Error(err))
 	}
-
-	storageManager, err := db.NewManagerOfType("sqlite", logger, config.GetString("SQLITE_FILE"))
+	storageManager, err := db.NewManagerOfType(managerType, logger, managerArgs...)
 	if err != nil {
 		logger.Fatal("Failed to create storage manager", zap.Error(err))
 	}
 
-	filestoreClient, err := filestore.NewClient(config, logger)
+	fileStore, err := filestore.New(config, logger)
 	if err != nil {
-		logger.Fatal("Failed to create filestore client", zap.Error(err))
+		logger.Fatal("Failed to create filestore", zap.Error(err))
 	}
 
-	s := api.NewServer(storageManager, filestoreClient, llm, logger)
+	// scans have no text layer, without OCR only their file name is left to extract from
+	var ocr document.OCR
+	ocrCommand, ocrLanguages := config.GetString("OCR_COMMAND"), config.GetString("OCR_LANGUAGES")
+	if ocrCommand == "" {
+		ocrCommand = defaultOCRCommand
+	}
+	if ocrLanguages == "" {
+		ocrLanguages = defaultOCRLanguages
+	}
+	if tesseract, err := document.NewTesseract(ocrCommand, ocrLanguages); err != nil {
+		logger.Warn("OCR is not available, scanned invoices will have no text", zap.Error(err))
+	} else {
+		ocr = tesseract
+	}
+	reader := document.NewReader(ocr, logger)
+
+	renderer := preview.NewRenderer(fileStore, logger)
+	processor := processing.NewProcessor(storageManager, fileStore, reader, extractor.NewChain(logger, extractors...), renderer, config.GetInt("PROCESSING_WORKERS"), logger)
+	processingCtx, stopProcessing := context.WithCancel(context.Background())
+	if err := processor.Start(processingCtx); err != nil {
+		logger.Fatal("Failed to start invoice processing", zap.Error(err))
+	}
+
+	var imageConverter document.ImageConverter
+	heifConvertCommand := config.GetString("HEIF_CONVERT_COMMAND")
+	if heifConvertCommand == "" {
+		heifConvertCommand = defaultHEIFConvert
+	}
+	if heifConvert, err := document.NewHEIFConvert(heifConvertCommand); err != nil {
+		logger.Warn("HEIC images cannot be converted, their uploads are rejected", zap.Error(err))
+	} else {
+		imageConverter = heifConvert
+	}
+
+	limits := ingest.Limits{MaxFileSize: int64(config.GetSizeInBytes("MAX_FILE_SIZE")), MaxPages: config.GetInt("MAX_PAGES")}
+	ingester := ingest.NewIngester(fileStore, processor, imageConverter, limits, logger)
+
+	// invoices sent by email are picked up from the mailbox, if one is configured
+	pollingCtx, stopPolling := context.WithCancel(context.Background())
+	var poller *ingest.MailboxPoller
+	if imapAddr := config.GetString("IMAP_ADDR"); imapAddr != "" {
+		mailbox := email.NewIMAPMailbox(email.IMAPConfig{
+			Addr:      imapAddr,
+			Username:  config.GetString("IMAP_USERNAME"),
+			Password:  config.GetString("IMAP_PASSWORD"),
+			Folder:    config.GetString("IMAP_FOLDER"),
+			PlainText: config.GetBool("IMAP_PLAINTEXT"),
+		})
+		poller = ingest.NewMailboxPoller(ingester, mailbox, config.GetDuration("IMAP_POLL_INTERVAL"), logger)
+		poller.Start(pollingCtx)
+	}
+	// scanners drop their files into watched folders
+	var watcher *ingest.FolderWatcher
+	if watchDirs := config.GetString("WATCH_DIRS"); watchDirs != "" {
+		var dirs []string
+		for _, dir := range strings.Split(watchDirs, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+		watcher = ingest.NewFolderWatcher(ingester, dirs, config.GetDuration("WATCH_INTERVAL"), logger)
+		watcher.Start(pollingCtx)
+	}
+	serverConfig := api.ServerConfig{
+		Addr:              config.GetString("HTTP_ADDR"),
+		ReadHeaderTimeout: config.GetDuration("HTTP_READ_HEADER_TIMEOUT"),
+		ReadTimeout:       config.GetDuration("HTTP_READ_TIMEOUT"),
+		WriteTimeout:      config.GetDuration("HTTP_WRITE_TIMEOUT"),
+		IdleTimeout:       config.GetDuration("HTTP_IDLE_TIMEOUT"),
+		PaymentAccount: banking.Account{
+			Name: config.GetString("SEPA_DEBTOR_NAME"),
+			IBAN: banking.NormalizeIBAN(config.GetString("SEPA_DEBTOR_IBAN")),
+			BIC:  banking.NormalizeBIC(config.GetString("SEPA_DEBTOR_BIC")),
+		},
+	}
+	if debtor := serverConfig.PaymentAccount; debtor.IBAN == "" {
+		logger.Warn("SEPA_DEBTOR_IBAN not set, SEPA transfers cannot be exported")
+	} else if !banking.ValidIBAN(debtor.IBAN) || debtor.BIC != "" && !banking.ValidBIC(debtor.BIC) || debtor.Name == "" {
+		logger.Fatal("Invalid SEPA debtor account, SEPA_DEBTOR_NAME, SEPA_DEBTOR_IBAN and SEPA_DEBTOR_BIC must be valid")
+	}
+	reconciler := reconciliation.NewReconciler(storageManager, logger)
+	s := api.NewServer(storageManager, fileStore, ingester, renderer, reconciler, serverConfig, logger)
 	s.SyncFilestore()
 	go s.Run()
 
@@ -107,9 +234,28 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
-	if err := s.Shutdown(); err != nil {
+	shutdownTimeout := config.GetDuration("SHUTDOWN_TIMEOUT")
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = defaultShutdownTimeout
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
 		logger.Error("Failed to shutdown server properly", zap.Error(err))
 	}
+	// Emails and files being ingested are picked up again on the next start, the invoices stored so far are
+	// duplicates then
+	stopPolling()
+	if poller != nil {
+		poller.Wait()
+	}
+	if watcher != nil {
+		watcher.Wait()
+	}
+	// Requests cut off by the timeout still finish or roll back the files they started storing
+	ingester.Shutdown()
+	// Interrupted jobs are picked up again on the next start
+	stopProcessing()
+	processor.Wait()
 	logger.Info("Server exiting")
-	os.Exit(0)
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"strconv"
+)
+
+const migrateUsage = `Usage: invoice_manager migrate <command>
+
+Commands:
+  status        show the schema version of the database and the pending migrations
+  up            apply all pending migrations
+  down          roll back the last applied migration
+  to <version>  apply or roll back migrations until the database is at the version, 0 rolls back everything
+`
+
+// runMigrate runs the migrate command against the configured database and returns the exit code
+func runMigrate(config *viper.Viper, logger *zap.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	managerType, managerArgs, err := storageManagerType(config)
+	if err != nil {
+		logger.Error("Invalid database configuration", zap.Error(err))
+		return 1
+	}
+	migrator, err := db.NewMigratorOfType(managerType, logger, managerArgs...)
+	if err != nil {
+		logger.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+
+	switch command := args[0]; {
+	case command == "status" && len(args) == 1:
+		err = printMigrationStatus(migrator)
+	case command == "up" && len(args) == 1:
+		err = migrator.Up()
+	case command == "down" && len(args) == 1:
+		err = migrator.Down()
+	case command == "to" && len(args) == 2:
+		version, parseErr := strconv.Atoi(args[1])
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "invalid version %q\n\n%s", args[1], migrateUsage)
+			return 2
+		}
+		err = migrator.To(version)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err == nil && args[0] != "status" {
+		err = printMigrationStatus(migrator)
+	}
+	if err != nil {
+		logger.Error("Migration failed", zap.Error(err))
+		return 1
+	}
+
+	return 0
+}
+
+func printMigrationStatus(migrator *db.Migrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Schema version: %d (latest known: %d)\n", status.Current, status.Latest)
+	if status.Current > status.Latest {
+		fmt.Println("The database has been migrated by a newer version, this binary cannot run against it")
+	}
+	for _, migration := range status.Pending {
+		fmt.Printf("Pending: %d_%s\n", migration.Version, migration.Name)
+	}
+
+	return nil
+}
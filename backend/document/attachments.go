@@ -0,0 +1,87 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// maxAttachmentSize is the max size of an embedded file once decompressed
+const maxAttachmentSize = 10 * 1024 * 1024
+
+var (
+	streamStart  = regexp.MustCompile(`>>\s*stream(?:\r\n|\n|\r)`)
+	embeddedType = regexp.MustCompile(`/Type\s*/EmbeddedFile\b`)
+	streamLength = regexp.MustCompile(`/Length\s+(\d+)(?:\s+\d+\s+R)?`)
+	flateDecode  = regexp.MustCompile(`/Filter\s*\[?\s*/FlateDecode\s*\]?`)
+	otherFilter  = regexp.MustCompile(`/Filter\s*\[?\s*/(?:[A-Za-z0-9]+)`)
+)
+
+// EmbeddedFiles returns the contents of the files attached to a PDF, such as the XML invoice of a ZUGFeRD or
+// Factur-X invoice. Only uncompressed and Flate compressed files of unencrypted documents are read, others are
+// skipped along with an error
+func EmbeddedFiles(content []byte) ([][]byte, error) {
+	var files [][]byte
+	var errs []error
+	for _, match := range streamStart.FindAllIndex(content, -1) {
+		objectStart := bytes.LastIndex(content[:match[0]], []byte("obj"))
+		if objectStart < 0 {
+			continue
+		}
+		dictionary := content[objectStart : match[0]+2]
+		if !embeddedType.Match(dictionary) {
+			continue
+		}
+
+		data := content[match[1]:]
+		end := bytes.Index(data, []byte("endstream"))
+		if end < 0 {
+			errs = append(errs, fmt.Errorf("embedded file at %d has no end", match[1]))
+			continue
+		}
+		// the length may be an indirect object, the end of the stream is good enough then
+		data = bytes.TrimRight(data[:end], "\r\n")
+		if m := streamLength.FindSubmatch(dictionary); m != nil && !bytes.Contains(m[0], []byte("R")) {
+			if length, err := strconv.Atoi(string(m[1])); err == nil && length <= end {
+				data = content[match[1] : match[1]+length]
+			}
+		}
+
+		switch {
+		case flateDecode.Match(dictionary):
+			decoded, err := inflate(data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("embedded file at %d: %w", match[1], err))
+				continue
+			}
+			files = append(files, decoded)
+		case otherFilter.Match(dictionary):
+			errs = append(errs, fmt.Errorf("embedded file at %d has an unsupported filter", match[1]))
+		default:
+			files = append(files, data)
+		}
+	}
+
+	return files, errors.Join(errs...)
+}
+
+func inflate(data []byte) ([]byte, error) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decoded, err := io.ReadAll(io.LimitReader(reader, maxAttachmentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) > maxAttachmentSize {
+		return nil, fmt.Errorf("larger than %d bytes", maxAttachmentSize)
+	}
+	return decoded, nil
+}
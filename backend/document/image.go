@@ -0,0 +1,253 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// imagePageSize is the longer side of the page an image is put on, the one of A4 in points
+const imagePageSize = 842
+
+var ErrInvalidImage = errors.New("invalid image")
+
+// ImageConverter converts images of formats a PDF cannot hold, such as HEIC photos, to JPEG
+type ImageConverter interface {
+	ToJPEG(ctx context.Context, content []byte) ([]byte, error)
+}
+
+// HEIFConvert converts HEIC and HEIF images with the heif-convert binary of libheif
+type HEIFConvert struct {
+	command string
+}
+
+// NewHEIFConvert returns a converter running the command, which is looked up in PATH unless it is a path
+func NewHEIFConvert(command string) (*HEIFConvert, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, fmt.Errorf("heif-convert not found: %w", err)
+	}
+
+	return &HEIFConvert{command: path}, nil
+}
+
+func (h *HEIFConvert) ToJPEG(ctx context.Context, content []byte) ([]byte, error) {
+	// heif-convert only reads and writes files
+	dir, err := os.MkdirTemp("", "heif-convert")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input, output := filepath.Join(dir, "image.heic"), filepath.Join(dir, "image.jpg")
+	if err = os.WriteFile(input, content, 0o600); err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.command, "-q", "90", input, output)
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: heif-convert failed: %w: %s", ErrInvalidImage, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return os.ReadFile(output)
+}
+
+// ImagePDF puts a JPEG or PNG image on a single page PDF of the same proportions, so that photos of invoices are
+// previewed and processed like any other. JPEGs are embedded as they are, turned as their EXIF orientation says
+func ImagePDF(content []byte) ([]byte, error) {
+	format := ""
+	switch {
+	case bytes.HasPrefix(content, []byte("\xff\xd8\xff")):
+		format = "jpeg"
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1a\n")):
+		format = "png"
+	default:
+		return nil, fmt.Errorf("%w: not a JPEG or PNG image", ErrInvalidImage)
+	}
+
+	var width, height int
+	var dictionary string
+	var data []byte
+	orientation := 1
+	if format == "jpeg" {
+		config, err := jpeg.DecodeConfig(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+		}
+		colorSpace := "/DeviceRGB"
+		switch config.ColorModel {
+		case color.GrayModel:
+			colorSpace = "/DeviceGray"
+		case color.CMYKModel:
+			// Adobe CMYK JPEGs are stored inverted
+			colorSpace = "/DeviceCMYK /Decode [1 0 1 0 1 0 1 0]"
+		}
+		width, height, data = config.Width, config.Height, content
+		dictionary = fmt.Sprintf("/ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode", colorSpace)
+		orientation = exifOrientation(content)
+	} else {
+		decoded, err := png.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidImage, err)
+		}
+		// transparent parts are shown on white paper
+		bounds := decoded.Bounds()
+		rgba := image.NewRGBA(bounds)
+		draw.Draw(rgba, bounds, image.White, image.Point{}, draw.Src)
+		draw.Draw(rgba, bounds, decoded, bounds.Min, draw.Over)
+
+		var compressed bytes.Buffer
+		writer := zlib.NewWriter(&compressed)
+		row := make([]byte, 3*bounds.Dx())
+		for y := 0; y < bounds.Dy(); y++ {
+			pixels := rgba.Pix[y*rgba.Stride:]
+			for x := 0; x < bounds.Dx(); x++ {
+				copy(row[3*x:3*x+3], pixels[4*x:4*x+3])
+			}
+			if _, err = writer.Write(row); err != nil {
+				return nil, err
+			}
+		}
+		if err = writer.Close(); err != nil {
+			return nil, err
+		}
+		width, height, data = bounds.Dx(), bounds.Dy(), compressed.Bytes()
+		dictionary = "/ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode"
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("%w: empty image", ErrInvalidImage)
+	}
+
+	// orientations 5 to 8 turn the image by 90 degrees
+	pageWidth, pageHeight := float64(width), float64(height)
+	if orientation >= 5 {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+	scale := imagePageSize / max(pageWidth, pageHeight)
+	pageWidth, pageHeight = pageWidth*scale, pageHeight*scale
+
+	page := fmt.Sprintf("q %s cm /Im1 Do Q", orientationMatrix(orientation, pageWidth, pageHeight))
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Contents 4 0 R /Resources << /XObject << /Im1 5 0 R >> >> >>",
+			pageWidth, pageHeight),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(page), page),
+		fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d %s /Length %d >>\nstream\n%s\nendstream",
+			width, height, dictionary, len(data), data),
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	return pdf.Bytes(), nil
+}
+
+// orientationMatrix returns the transformation that draws the image, the unit square, on the page of the given size
+// as the EXIF orientation says
+func orientationMatrix(orientation int, width, height float64) string {
+	matrix := [6]float64{width, 0, 0, height, 0, 0}
+	switch orientation {
+	case 2: // mirrored
+		matrix = [6]float64{-width, 0, 0, height, width, 0}
+	case 3: // upside down
+		matrix = [6]float64{-width, 0, 0, -height, width, height}
+	case 4: // upside down, mirrored
+		matrix = [6]float64{width, 0, 0, -height, 0, height}
+	case 5: // transposed
+		matrix = [6]float64{0, -height, -width, 0, width, height}
+	case 6: // turned by 90 degrees clockwise
+		matrix = [6]float64{0, -height, width, 0, 0, height}
+	case 7: // transversed
+		matrix = [6]float64{0, height, width, 0, 0, 0}
+	case 8: // turned by 90 degrees counterclockwise
+		matrix = [6]float64{0, height, -width, 0, width, 0}
+	}
+
+	parts := make([]string, len(matrix))
+	for i, value := range matrix {
+		parts[i] = fmt.Sprintf("%.2f", value)
+	}
+	return strings.Join(parts, " ")
+}
+
+// exifOrientation returns the orientation stated in the EXIF data of a JPEG, 1 (upright) if there is none
+func exifOrientation(content []byte) int {
+	// the segments before the image data, each a marker followed by its length
+	for offset := 2; offset+4 <= len(content); {
+		if content[offset] != 0xff {
+			return 1
+		}
+		marker := content[offset+1]
+		length := int(binary.BigEndian.Uint16(content[offset+2:]))
+		if marker == 0xda || length < 2 || offset+2+length > len(content) {
+			return 1
+		}
+		segment := content[offset+4 : offset+2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		offset += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation reads the orientation tag of the first IFD of the TIFF structure of EXIF data
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// the orientation is a single short, stored in the value field itself
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
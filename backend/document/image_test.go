@@ -0,0 +1,149 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testJPEG returns a JPEG of the size, the EXIF orientation is written into it unless 0
+func testJPEG(t *testing.T, width int, height int, gray bool, orientation uint16) []byte {
+	t.Helper()
+	var img image.Image = image.NewRGBA(image.Rect(0, 0, width, height))
+	if gray {
+		img = image.NewGray(image.Rect(0, 0, width, height))
+	}
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	if orientation == 0 {
+		return buffer.Bytes()
+	}
+
+	// an APP1 segment right after the start of image, holding a single IFD entry
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.BigEndian.PutUint16(tiff[18:], orientation)
+	segment := append([]byte("\xff\xe1\x00\x00Exif\x00\x00"), tiff...)
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(segment)-2))
+	content := buffer.Bytes()
+	return append(append(append([]byte{}, content[:2]...), segment...), content[2:]...)
+}
+
+// testPNG returns a half transparent PNG of the size
+func testPNG(t *testing.T, width int, height int) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, img); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+// fakeCommand puts an executable shell script of the name in front of PATH
+func fakeCommand(t *testing.T, name string, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestImagePDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    []string
+		wantErr error
+	}{
+		{"jpeg", testJPEG(t, 40, 20, false, 0), []string{"/MediaBox [0 0 842.00 421.00]", "/DeviceRGB", "/DCTDecode"}, nil},
+		{"grayscale jpeg", testJPEG(t, 40, 20, true, 0), []string{"/DeviceGray", "/DCTDecode"}, nil},
+		// the page is turned along with the image
+		{"jpeg taken upright", testJPEG(t, 40, 20, false, 6), []string{"/MediaBox [0 0 421.00 842.00]", "0.00 -842.00 421.00 0.00 0.00 842.00 cm"}, nil},
+		{"jpeg upside down", testJPEG(t, 40, 20, false, 3), []string{"/MediaBox [0 0 842.00 421.00]", "-842.00 0.00 0.00 -421.00 842.00 421.00 cm"}, nil},
+		{"png", testPNG(t, 20, 40), []string{"/MediaBox [0 0 421.00 842.00]", "/DeviceRGB", "/FlateDecode"}, nil},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), nil, ErrInvalidImage},
+		{"truncated jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), nil, ErrInvalidImage},
+		{"truncated png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), nil, ErrInvalidImage},
+		{"empty", nil, nil, ErrInvalidImage},
+	}
+	for _, test := range tests {
+		pdf, err := ImagePDF(test.content)
+		if !errors.Is(err, test.wantErr) || test.wantErr == nil && err != nil {
+			t.Errorf("ImagePDF(%s) error = %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		for _, want := range test.want {
+			if !bytes.Contains(pdf, []byte(want)) {
+				t.Errorf("ImagePDF(%s) does not contain %q", test.name, want)
+			}
+		}
+		if pages, err := ValidatePDF(pdf, 0); err != nil || pages != 1 {
+			t.Errorf("ValidatePDF(ImagePDF(%s)) = %d, %v, want a single page", test.name, pages, err)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	for orientation := uint16(1); orientation <= 8; orientation++ {
+		if got := exifOrientation(testJPEG(t, 4, 4, false, orientation)); got != int(orientation) {
+			t.Errorf("exifOrientation(%d) = %d, want %d", orientation, got, orientation)
+		}
+	}
+	tests := []struct {
+		name    string
+		content []byte
+	}{
+		{"without exif", testJPEG(t, 4, 4, false, 0)},
+		{"invalid orientation", testJPEG(t, 4, 4, false, 9)},
+		{"truncated", testJPEG(t, 4, 4, false, 6)[:20]},
+	}
+	for _, test := range tests {
+		if got := exifOrientation(test.content); got != 1 {
+			t.Errorf("exifOrientation(%s) = %d, want 1", test.name, got)
+		}
+	}
+}
+
+func TestHEIFConvert(t *testing.T) {
+	// heif-convert -q 90 input output, the fake copies the input
+	fakeCommand(t, "heif-convert", `cp "$3" "$4"`)
+	converter, err := NewHEIFConvert("heif-convert")
+	if err != nil {
+		t.Fatalf("NewHEIFConvert() error = %v", err)
+	}
+	photo := testJPEG(t, 40, 20, false, 0)
+	converted, err := converter.ToJPEG(context.Background(), photo)
+	if err != nil || !bytes.Equal(converted, photo) {
+		t.Errorf("ToJPEG() = %d bytes, %v, want the converted image", len(converted), err)
+	}
+
+	fakeCommand(t, "heif-convert", `echo "Could not read HEIF/AVIF file: Invalid input: No 'ftyp' box" >&2; exit 1`)
+	if converter, err = NewHEIFConvert("heif-convert"); err != nil {
+		t.Fatalf("NewHEIFConvert() error = %v", err)
+	}
+	_, err = converter.ToJPEG(context.Background(), []byte("not an image"))
+	if !errors.Is(err, ErrInvalidImage) || !strings.Contains(err.Error(), "No 'ftyp' box") {
+		t.Errorf("ToJPEG() of a broken image error = %v, want %v with the output of heif-convert", err, ErrInvalidImage)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err = NewHEIFConvert("heif-convert"); err == nil {
+		t.Errorf("NewHEIFConvert() without heif-convert error = nil, want error")
+	}
+}
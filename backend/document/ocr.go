@@ -0,0 +1,48 @@
+package document
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// OCR recognizes the text of a page rendered as a PNG image
+type OCR interface {
+	Recognize(ctx context.Context, image []byte) (string, error)
+}
+
+// Tesseract recognizes text with a local Tesseract binary
+type Tesseract struct {
+	command   string
+	languages string // e.g. deu+eng, the language data has to be installed
+}
+
+// NewTesseract returns an OCR running the command, which is looked up in PATH unless it is a path
+func NewTesseract(command string, languages string) (*Tesseract, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, fmt.Errorf("tesseract not found: %w", err)
+	}
+
+	return &Tesseract{command: path, languages: languages}, nil
+}
+
+func (t *Tesseract) Recognize(ctx context.Context, image []byte) (string, error) {
+	args := []string{"stdin", "stdout"}
+	if t.languages != "" {
+		args = append(args, "-l", t.languages)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.command, args...)
+	cmd.Stdin = bytes.NewReader(image)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
@@ -0,0 +1,97 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+// stubOCR recognizes the same text on every image, or fails
+type stubOCR struct {
+	text  string
+	err   error
+	calls int
+}
+
+func (s *stubOCR) Recognize(_ context.Context, image []byte) (string, error) {
+	s.calls++
+	if !strings.HasPrefix(string(image), "\x89PNG") {
+		return "", errors.New("not a PNG image")
+	}
+	return s.text, s.err
+}
+
+func TestTesseract(t *testing.T) {
+	// the fake prints its arguments and the size of the image it is given
+	fakeCommand(t, "tesseract", `echo "$@"; wc -c`)
+	tesseract, err := NewTesseract("tesseract", "deu+eng")
+	if err != nil {
+		t.Fatalf("NewTesseract() error = %v", err)
+	}
+	text, err := tesseract.Recognize(context.Background(), []byte("image"))
+	if want := "stdin stdout -l deu+eng\n5\n"; err != nil || strings.ReplaceAll(text, " ", "") != strings.ReplaceAll(want, " ", "") {
+		t.Errorf("Recognize() = %q, %v, want %q", text, err, want)
+	}
+
+	fakeCommand(t, "tesseract", `echo "Failed loading language 'deu'" >&2; exit 1`)
+	if tesseract, err = NewTesseract("tesseract", "deu"); err != nil {
+		t.Fatalf("NewTesseract() error = %v", err)
+	}
+	if _, err = tesseract.Recognize(context.Background(), []byte("image")); err == nil || !strings.Contains(err.Error(), "Failed loading language 'deu'") {
+		t.Errorf("Recognize() error = %v, want the output of tesseract", err)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if _, err = NewTesseract("tesseract", "deu+eng"); err == nil {
+		t.Errorf("NewTesseract() without tesseract error = nil, want error")
+	}
+}
+
+func TestReaderOCR(t *testing.T) {
+	// a photo has no text layer at all
+	scan, err := ImagePDF(testJPEG(t, 40, 20, false, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	ocr := &stubOCR{text: "Invoice INV-1 over 119.00 EUR"}
+	text, err := NewReader(ocr, zap.NewNop()).Text(ctx, scan)
+	if err != nil || text != ocr.text || ocr.calls != 1 {
+		t.Errorf("Text() of a scan = %q, %v after %d OCR calls, want %q", text, err, ocr.calls, ocr.text)
+	}
+
+	// the page is kept as it is if the OCR fails
+	ocr = &stubOCR{err: errors.New("tesseract failed")}
+	text, err = NewReader(ocr, zap.NewNop()).Text(ctx, scan)
+	if err == nil || !strings.Contains(err.Error(), "page 0: tesseract failed") || strings.TrimSpace(text) != "" {
+		t.Errorf("Text() with a failing OCR = %q, %v, want the error of page 0", text, err)
+	}
+
+	text, err = NewReader(nil, zap.NewNop()).Text(ctx, scan)
+	if err != nil || strings.TrimSpace(text) != "" {
+		t.Errorf("Text() without OCR = %q, %v, want no text", text, err)
+	}
+}
+
+func TestUsableText(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"Invoice INV-2024-001 of ACME GmbH", true},
+		{"12345678901234567890", true},
+		// scanner headers and page numbers
+		{"Page 1 of 2", false},
+		{"Scan 2024-03-01 10:15", false},
+		{" \n\t-- ./ ()\n --", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := usableText(test.text); got != test.want {
+			t.Errorf("usableText(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package document
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gen2brain/go-fitz"
+)
+
+// maxImageSide is the max width and height of a rendered page in pixels, pages of posters and drawings are rendered at
+// a lower resolution than requested
+const maxImageSide = 6000
+
+var ErrNoSuchPage = errors.New("page does not exist")
+
+// RenderPage renders a page of a PDF as a PNG image at the resolution, pages are counted from 1
+func RenderPage(content []byte, page int, dpi float64) ([]byte, error) {
+	doc, err := fitz.NewFromMemory(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document: %w", err)
+	}
+	defer doc.Close()
+
+	if page < 1 || page > doc.NumPage() {
+		return nil, fmt.Errorf("%w: page %d of %d", ErrNoSuchPage, page, doc.NumPage())
+	}
+	bounds, err := doc.Bound(page - 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load page %d: %w", page, err)
+	}
+	if side := float64(max(bounds.Dx(), bounds.Dy())); side > 0 {
+		dpi = min(dpi, maxImageSide*72/side)
+	}
+
+	return renderPNG(doc, page-1, dpi)
+}
+
+// RenderThumbnail renders the first page of a PDF as a PNG image of the width in pixels
+func RenderThumbnail(content []byte, width int) ([]byte, error) {
+	doc, err := fitz.NewFromMemory(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document: %w", err)
+	}
+	defer doc.Close()
+
+	if doc.NumPage() == 0 {
+		return nil, fmt.Errorf("%w: the document has no pages", ErrNoSuchPage)
+	}
+	// bounds are in points, 72 to the inch
+	bounds, err := doc.Bound(0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load page 1: %w", err)
+	}
+	if bounds.Dx() <= 0 || bounds.Dy() <= 0 {
+		return nil, errors.New("page 1 is empty")
+	}
+	dpi := float64(width) * 72 / float64(bounds.Dx())
+	// pages far taller than wide, such as receipts, would come out as long as a poster
+	dpi = min(dpi, float64(width)*3*72/float64(bounds.Dy()))
+
+	return renderPNG(doc, 0, dpi)
+}
+
+func renderPNG(doc *fitz.Document, page int, dpi float64) ([]byte, error) {
+	image, err := doc.ImagePNG(page, dpi)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render page %d: %w", page+1, err)
+	}
+	return image, nil
+}
@@ -0,0 +1,143 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gen2brain/go-fitz"
+	"regexp"
+	"strconv"
+)
+
+// headerWindow is how far into a file the %PDF- header may start, readers accept leading garbage up to 1024 bytes.
+// MuPDF does not, such files are told apart from other types but fail validation
+const headerWindow = 1024
+
+var (
+	ErrInvalidPDF    = errors.New("invalid PDF")
+	ErrEncryptedPDF  = errors.New("PDF is encrypted or password protected")
+	ErrPDFJavaScript = errors.New("PDF contains JavaScript")
+	ErrTooManyPages  = errors.New("PDF has too many pages")
+)
+
+var (
+	// encryptEntry is the /Encrypt entry of a trailer or of the dictionary of a cross-reference stream
+	encryptEntry = regexp.MustCompile(`/Encrypt\s*(?:\d+\s+\d+\s+R|<<)`)
+	pdfName      = regexp.MustCompile(`/[^\s/<>\[\]()%{}]+`)
+	objectStream = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	hexEscape    = regexp.MustCompile(`#[0-9A-Fa-f]{2}`)
+)
+
+// IsPDF reports whether the content starts with a PDF header
+func IsPDF(content []byte) bool {
+	return bytes.Contains(content[:min(len(content), headerWindow)], []byte("%PDF-"))
+}
+
+// ValidatePDF checks that a PDF can be read: it has to open, have at least one page and at most maxPages pages, every
+// page has to load. Encrypted PDFs, which cannot be processed, and PDFs with JavaScript, which previews would run,
+// are rejected. maxPages is not checked if not positive. Returns the number of pages
+func ValidatePDF(content []byte, maxPages int) (int, error) {
+	if !IsPDF(content) {
+		return 0, fmt.Errorf("%w: no PDF header", ErrInvalidPDF)
+	}
+	// documents with an owner password only open without one, they are still encrypted
+	if encryptEntry.Match(content) {
+		return 0, ErrEncryptedPDF
+	}
+	if hasJavaScript(content) {
+		return 0, ErrPDFJavaScript
+	}
+
+	doc, err := fitz.NewFromMemory(content)
+	if err != nil {
+		if errors.Is(err, fitz.ErrNeedsPassword) {
+			return 0, ErrEncryptedPDF
+		}
+		return 0, fmt.Errorf("%w: %w", ErrInvalidPDF, err)
+	}
+	defer doc.Close()
+
+	pages := doc.NumPage()
+	if pages == 0 {
+		return 0, fmt.Errorf("%w: no pages", ErrInvalidPDF)
+	}
+	if maxPages > 0 && pages > maxPages {
+		return pages, fmt.Errorf("%w: %d pages, at most %d are allowed", ErrTooManyPages, pages, maxPages)
+	}
+	// MuPDF repairs broken cross-reference tables on open, pages that are missing only show up when they are loaded
+	for i := 0; i < pages; i++ {
+		if _, err = doc.Bound(i); err != nil {
+			return pages, fmt.Errorf("%w: page %d: %w", ErrInvalidPDF, i+1, err)
+		}
+	}
+
+	return pages, nil
+}
+
+// hasJavaScript reports whether a PDF has JavaScript actions or name trees. Objects may be compressed into object
+// streams, which are read as well, and names may be written with #xx escapes to hide them
+func hasJavaScript(content []byte) bool {
+	// the data of streams is left out, compressed images would come with names by chance
+	var objects []byte
+	var streams [][]int
+	previous := 0
+	for _, match := range streamStart.FindAllIndex(content, -1) {
+		if match[0] < previous {
+			continue
+		}
+		end := bytes.Index(content[match[1]:], []byte("endstream"))
+		if end < 0 {
+			end = len(content) - match[1]
+		}
+		objects = append(objects, content[previous:match[1]]...)
+		streams = append(streams, []int{match[0], match[1], match[1] + end})
+		previous = match[1] + end
+	}
+	objects = append(objects, content[previous:]...)
+	if hasJavaScriptName(objects) {
+		return true
+	}
+
+	for _, stream := range streams {
+		objectStart := bytes.LastIndex(content[:stream[0]], []byte("obj"))
+		if objectStart < 0 {
+			continue
+		}
+		dictionary := content[objectStart : stream[0]+2]
+		if !objectStream.Match(dictionary) {
+			continue
+		}
+
+		data := content[stream[1]:stream[2]]
+		if m := streamLength.FindSubmatch(dictionary); m != nil && !bytes.Contains(m[0], []byte("R")) {
+			if length, err := strconv.Atoi(string(m[1])); err == nil && length <= len(data) {
+				data = data[:length]
+			}
+		}
+		switch {
+		case flateDecode.Match(dictionary):
+			// streams that fail to inflate are left to the structural check
+			if decoded, err := inflate(data); err == nil && hasJavaScriptName(decoded) {
+				return true
+			}
+		case !otherFilter.Match(dictionary):
+			if hasJavaScriptName(data) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasJavaScriptName(content []byte) bool {
+	for _, name := range pdfName.FindAll(content, -1) {
+		name = hexEscape.ReplaceAllFunc(name, func(escape []byte) []byte {
+			b, _ := strconv.ParseUint(string(escape[1:]), 16, 8)
+			return []byte{byte(b)}
+		})
+		if string(name) == "/JavaScript" || string(name) == "/JS" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDF returns a PDF of the pages, all showing the same text. The entries are added to the catalog and the objects
+// are numbered from 5 on, the trailer entries are added to the trailer
+func testPDF(pages int, catalog string, trailer string, objects ...string) []byte {
+	stream := "BT /F1 12 Tf 72 720 Td (Invoice) Tj ET"
+	kids := make([]string, pages)
+	for i := range kids {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+len(objects)+i)
+	}
+	all := []string{
+		fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R %s >>", catalog),
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+	}
+	all = append(all, objects...)
+	for range pages {
+		all = append(all, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 3 0 R >> >> >>")
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.7\n")
+	offsets := make([]int, len(all))
+	for i, object := range all {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(all)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R %s >>\nstartxref\n%d\n%%%%EOF\n", len(all)+1, trailer, xref)
+	return pdf.Bytes()
+}
+
+// testObjectStream returns an object stream holding the object, compressed unless raw
+func testObjectStream(object string, compressed bool) string {
+	data := []byte("6 0 " + object)
+	filter := ""
+	if compressed {
+		var buffer bytes.Buffer
+		writer := zlib.NewWriter(&buffer)
+		writer.Write(data)
+		writer.Close()
+		data = buffer.Bytes()
+		filter = "/Filter /FlateDecode "
+	}
+	return fmt.Sprintf("<< /Type /ObjStm /N 1 /First 4 %s/Length %d >>\nstream\n%s\nendstream", filter, len(data), data)
+}
+
+func TestValidatePDF(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   []byte
+		maxPages  int
+		wantPages int
+		wantErr   error
+	}{
+		{"one page", testPDF(1, "", ""), 10, 1, nil},
+		{"no page limit", testPDF(3, "", ""), 0, 3, nil},
+		{"at the page limit", testPDF(3, "", ""), 3, 3, nil},
+		{"too many pages", testPDF(3, "", ""), 2, 3, ErrTooManyPages},
+		{"leading garbage", append([]byte("garbage\n"), testPDF(1, "", "")...), 10, 0, ErrInvalidPDF},
+		{"no header", []byte("PK\x03\x04 not a PDF"), 10, 0, ErrInvalidPDF},
+		{"header beyond the window", append(bytes.Repeat([]byte(" "), headerWindow), testPDF(1, "", "")...), 10, 0, ErrInvalidPDF},
+		{"header only", []byte("%PDF-1.7\n%%EOF\n"), 10, 0, ErrInvalidPDF},
+		{"no pages", testPDF(0, "", ""), 10, 0, ErrInvalidPDF},
+		{"encrypted", testPDF(1, "", "/Encrypt 5 0 R", "<< /Filter /Standard /V 2 /R 3 /Length 128 /P -44 >>"), 10, 0, ErrEncryptedPDF},
+		{"encrypted inline", testPDF(1, "", "/Encrypt << /Filter /Standard /V 1 /R 2 >>"), 10, 0, ErrEncryptedPDF},
+		{"JavaScript", testPDF(1, "/OpenAction 5 0 R", "", "<< /S /JavaScript /JS (app.alert(1)) >>"), 10, 0, ErrPDFJavaScript},
+	}
+	for _, test := range tests {
+		pages, err := ValidatePDF(test.content, test.maxPages)
+		if !errors.Is(err, test.wantErr) || test.wantErr == nil && err != nil {
+			t.Errorf("ValidatePDF(%s) error = %v, want %v", test.name, err, test.wantErr)
+			continue
+		}
+		if pages != test.wantPages {
+			t.Errorf("ValidatePDF(%s) = %d pages, want %d", test.name, pages, test.wantPages)
+		}
+	}
+}
+
+func TestHasJavaScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		content []byte
+		want    bool
+	}{
+		{"none", testPDF(1, "", ""), false},
+		{"open action", testPDF(1, "/OpenAction 5 0 R", "", "<< /S /JavaScript /JS (app.alert(1)) >>"), true},
+		{"JS entry only", testPDF(1, "/OpenAction << /S /Launch /JS 5 0 R >>", ""), true},
+		{"name tree", testPDF(1, "/Names << /JavaScript 5 0 R >>", "", "<< /Names [(a) 6 0 R] >>"), true},
+		{"escaped name", testPDF(1, "/OpenAction << /S /Java#53cript /J#53 (app.alert(1)) >>", ""), true},
+		{"compressed object stream", testPDF(1, "", "", testObjectStream("<< /S /JavaScript /JS (app.alert(1)) >>", true)), true},
+		{"raw object stream", testPDF(1, "", "", testObjectStream("<< /S /JavaScript /JS (app.alert(1)) >>", false)), true},
+		{"compressed object stream without JavaScript", testPDF(1, "", "", testObjectStream("<< /S /URI /URI (https://example.com) >>", true)), false},
+		// names in the data of other streams, such as content streams, are not actions
+		{"name in a content stream", testPDF(1, "", "", "<< /Length 20 >>\nstream\nBT /JS 12 Tf ET    \nendstream"), false},
+		{"similar names", testPDF(1, "/JSON 5 0 R /JavaScripts 5 0 R", "", "<< >>"), false},
+	}
+	for _, test := range tests {
+		if got := hasJavaScript(test.content); got != test.want {
+			t.Errorf("hasJavaScript(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
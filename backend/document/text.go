@@ -0,0 +1,91 @@
+// Package document reads the contents of uploaded invoice files
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gen2brain/go-fitz"
+	"go.uber.org/zap"
+	"unicode"
+)
+
+const (
+	// minPageText is the number of letters and digits a text layer needs to be used, scans often come with a few
+	// characters of a scanner header or a page number
+	minPageText = 20
+	// ocrDPI is the resolution pages are rendered at for OCR
+	ocrDPI = 300
+)
+
+// Reader extracts the text of documents
+type Reader struct {
+	ocr    OCR
+	logger *zap.Logger
+}
+
+// NewReader returns a reader passing the pages without a usable text layer, such as scans, through the OCR.
+// ocr may be nil, such pages are read as they are then
+func NewReader(ocr OCR, logger *zap.Logger) *Reader {
+	return &Reader{ocr: ocr, logger: logger}
+}
+
+// Text extracts the text of every page of a document.
+// Pages that fail are skipped, their errors are returned along with the text of the other pages
+func (r *Reader) Text(ctx context.Context, content []byte) (string, error) {
+	doc, err := fitz.NewFromMemory(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to open document: %w", err)
+	}
+	defer doc.Close()
+
+	var text string
+	var pageErrors []error
+	for i := 0; i < doc.NumPage(); i++ {
+		pageText, err := doc.Text(i)
+		if err != nil {
+			pageErrors = append(pageErrors, fmt.Errorf("page %d: %w", i, err))
+			continue
+		}
+		if r.ocr != nil && !usableText(pageText) {
+			recognized, err := r.recognize(ctx, doc, i)
+			if err != nil {
+				// the text layer is still better than nothing
+				pageErrors = append(pageErrors, fmt.Errorf("page %d: %w", i, err))
+			} else {
+				pageText = recognized
+			}
+		}
+		text += pageText
+	}
+
+	return text, errors.Join(pageErrors...)
+}
+
+func (r *Reader) recognize(ctx context.Context, doc *fitz.Document, page int) (string, error) {
+	image, err := doc.ImagePNG(page, ocrDPI)
+	if err != nil {
+		return "", fmt.Errorf("failed to render page: %w", err)
+	}
+
+	text, err := r.ocr.Recognize(ctx, image)
+	if err != nil {
+		return "", err
+	}
+	r.logger.Debug("Recognized page without text layer", zap.Int("page", page), zap.Int("length", len(text)))
+	return text, nil
+}
+
+// usableText reports whether a text layer has enough letters and digits to be read
+func usableText(text string) bool {
+	count := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			count++
+			if count >= minPageText {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"strings"
+)
+
+// The elements of a CII invoice (D16B, ZUGFeRD 2 and Factur-X) that are read. Namespaces are ignored, the element
+// names are unique enough
+type ciiInvoice struct {
+	Profile    string        `xml:"ExchangedDocumentContext>GuidelineSpecifiedDocumentContextParameter>ID"`
+	Number     string        `xml:"ExchangedDocument>ID"`
+	IssueDate  ciiDate       `xml:"ExchangedDocument>IssueDateTime>DateTimeString"`
+	LineItems  []ciiLineItem `xml:"SupplyChainTradeTransaction>IncludedSupplyChainTradeLineItem"`
+	Seller     ciiParty      `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeAgreement>SellerTradeParty"`
+	Settlement ciiSettlement `xml:"SupplyChainTradeTransaction>ApplicableHeaderTradeSettlement"`
+}
+
+type ciiDate struct {
+	Value  string `xml:",chardata"`
+	Format string `xml:"format,attr"`
+}
+
+type ciiAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"currencyID,attr"`
+}
+
+type ciiParty struct {
+	Name             string   `xml:"Name"`
+	AddressLineOne   string   `xml:"PostalTradeAddress>LineOne"`
+	AddressLineTwo   string   `xml:"PostalTradeAddress>LineTwo"`
+	AddressLineThree string   `xml:"PostalTradeAddress>LineThree"`
+	Postcode         string   `xml:"PostalTradeAddress>PostcodeCode"`
+	City             string   `xml:"PostalTradeAddress>CityName"`
+	Country          string   `xml:"PostalTradeAddress>CountryID"`
+	URIs             []ciiID  `xml:"URIUniversalCommunication>URIID"`
+	ContactEmails    []string `xml:"DefinedTradeContact>EmailURIUniversalCommunication>URIID"`
+	TaxRegistrations []ciiID  `xml:"SpecifiedTaxRegistration>ID"`
+}
+
+type ciiID struct {
+	Value  string `xml:",chardata"`
+	Scheme string `xml:"schemeID,attr"`
+}
+
+type ciiSettlement struct {
+	Currency     string             `xml:"InvoiceCurrencyCode"`
+	PaymentMeans []ciiPaymentMeans  `xml:"SpecifiedTradeSettlementPaymentMeans"`
+	Taxes        []ciiTax           `xml:"ApplicableTradeTax"`
+	PaymentTerms []ciiPaymentTerms  `xml:"SpecifiedTradePaymentTerms"`
+	Summation    ciiHeaderSummation `xml:"SpecifiedTradeSettlementHeaderMonetarySummation"`
+}
+
+type ciiPaymentMeans struct {
+	IBAN string `xml:"PayeePartyCreditorFinancialAccount>IBANID"`
+	BIC  string `xml:"PayeeSpecifiedCreditorFinancialInstitution>BICID"`
+}
+
+type ciiTax struct {
+	Type       string `xml:"TypeCode"`
+	Calculated string `xml:"CalculatedAmount"`
+	Basis      string `xml:"BasisAmount"`
+	Rate       string `xml:"RateApplicablePercent"`
+}
+
+type ciiPaymentTerms struct {
+	Description string  `xml:"Description"`
+	DueDate     ciiDate `xml:"DueDateDateTime>DateTimeString"`
+}
+
+type ciiHeaderSummation struct {
+	TaxBasisTotal string      `xml:"TaxBasisTotalAmount"`
+	TaxTotals     []ciiAmount `xml:"TaxTotalAmount"`
+	GrandTotal    string      `xml:"GrandTotalAmount"`
+}
+
+type ciiLineItem struct {
+	Position      string `xml:"AssociatedDocumentLineDocument>LineID"`
+	Name          string `xml:"SpecifiedTradeProduct>Name"`
+	Description   string `xml:"SpecifiedTradeProduct>Description"`
+	NetPrice      string `xml:"SpecifiedLineTradeAgreement>NetPriceProductTradePrice>ChargeAmount"`
+	BasisQuantity string `xml:"SpecifiedLineTradeAgreement>NetPriceProductTradePrice>BasisQuantity"`
+	Quantity      string `xml:"SpecifiedLineTradeDelivery>BilledQuantity"`
+	TaxRate       string `xml:"SpecifiedLineTradeSettlement>ApplicableTradeTax>RateApplicablePercent"`
+	Total         string `xml:"SpecifiedLineTradeSettlement>SpecifiedTradeSettlementLineMonetarySummation>LineTotalAmount"`
+}
+
+// parseCII reads a CII invoice. Amounts are in the invoice currency, the tax total in the tax currency is skipped
+func parseCII(content []byte) (*Invoice, error) {
+	var document ciiInvoice
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("invalid CII invoice: %w", err)
+	}
+
+	settlement := document.Settlement
+	currency := strings.ToUpper(strings.TrimSpace(settlement.Currency))
+	if !model.ValidCurrency(currency) {
+		return nil, fmt.Errorf("invalid CII invoice: unknown currency %q", settlement.Currency)
+	}
+
+	invoice := &Invoice{
+		Format:   FormatCII,
+		Profile:  strings.TrimSpace(document.Profile),
+		Number:   strings.TrimSpace(document.Number),
+		Currency: currency,
+		Seller:   document.Seller.party(),
+	}
+	var err error
+	if invoice.Date, err = parseDate(document.IssueDate.Value, document.IssueDate.Format); err != nil {
+		return nil, fmt.Errorf("invalid CII invoice: issue date: %w", err)
+	}
+
+	for _, terms := range settlement.PaymentTerms {
+		if description := strings.TrimSpace(terms.Description); description != "" {
+			invoice.PaymentTerms = strings.TrimSpace(invoice.PaymentTerms + "\n" + description)
+		}
+		if invoice.DueDate == nil {
+			if invoice.DueDate, err = parseDate(terms.DueDate.Value, terms.DueDate.Format); err != nil {
+				return nil, fmt.Errorf("invalid CII invoice: due date: %w", err)
+			}
+		}
+	}
+	for _, means := range settlement.PaymentMeans {
+		if invoice.Seller.IBAN == "" && strings.TrimSpace(means.IBAN) != "" {
+			invoice.Seller.IBAN = strings.TrimSpace(means.IBAN)
+			invoice.Seller.BIC = strings.TrimSpace(means.BIC)
+		}
+	}
+
+	summation := settlement.Summation
+	if invoice.Amount, err = parseAmount(summation.GrandTotal, currency); err != nil {
+		return nil, fmt.Errorf("invalid CII invoice: grand total: %w", err)
+	}
+	if invoice.NetAmount, err = parseAmount(summation.TaxBasisTotal, currency); err != nil {
+		return nil, fmt.Errorf("invalid CII invoice: tax basis total: %w", err)
+	}
+	for _, total := range summation.TaxTotals {
+		if total.Currency == "" || strings.EqualFold(total.Currency, currency) {
+			if invoice.TaxAmount, err = parseAmount(total.Value, currency); err != nil {
+				return nil, fmt.Errorf("invalid CII invoice: tax total: %w", err)
+			}
+			break
+		}
+	}
+
+	for _, tax := range settlement.Taxes {
+		if tax.Type != "" && tax.Type != "VAT" {
+			continue
+		}
+		line, err := taxLine(tax.Rate, tax.Basis, tax.Calculated, currency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CII invoice: tax: %w", err)
+		}
+		invoice.TaxBreakdown = append(invoice.TaxBreakdown, line)
+	}
+
+	for i, item := range document.LineItems {
+		lineItem, err := item.lineItem(i+1, currency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CII invoice: line %s: %w", item.Position, err)
+		}
+		invoice.LineItems = append(invoice.LineItems, lineItem)
+	}
+
+	invoice.Terms = skontoTerms(invoice.PaymentTerms, invoice.Date, invoice.DueDate)
+	return invoice, nil
+}
+
+func (p ciiParty) party() Party {
+	party := Party{
+		Name: strings.TrimSpace(p.Name),
+		Address: joinAddress(p.AddressLineOne, p.AddressLineTwo, p.AddressLineThree,
+			strings.TrimSpace(p.Postcode+" "+p.City), p.Country),
+	}
+	for _, registration := range p.TaxRegistrations {
+		if registration.Scheme == "VA" {
+			party.VATID = strings.TrimSpace(registration.Value)
+		}
+	}
+	for _, uri := range p.URIs {
+		if uri.Scheme == "EM" {
+			party.Email = strings.TrimSpace(uri.Value)
+		}
+	}
+	for _, email := range p.ContactEmails {
+		if party.Email == "" {
+			party.Email = strings.TrimSpace(email)
+		}
+	}
+	return party
+}
+
+func (i ciiLineItem) lineItem(position int, currency string) (model.LineItem, error) {
+	description := strings.TrimSpace(i.Name)
+	if description == "" {
+		description = strings.TrimSpace(i.Description)
+	}
+	return lineItem(position, description, i.Quantity, i.NetPrice, i.BasisQuantity, i.TaxRate, i.Total, currency)
+}
@@ -0,0 +1,219 @@
+package einvoice
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCII is a Factur-X EN 16931 invoice of two positions, the second priced per 100 pieces
+const testCII = `<?xml version="1.0" encoding="UTF-8"?>
+<rsm:CrossIndustryInvoice xmlns:rsm="urn:un:unece:uncefact:data:standard:CrossIndustryInvoice:100"
+    xmlns:ram="urn:un:unece:uncefact:data:standard:ReusableAggregateBusinessInformationEntity:100"
+    xmlns:udt="urn:un:unece:uncefact:data:standard:UnqualifiedDataType:100">
+  <rsm:ExchangedDocumentContext>
+    <ram:GuidelineSpecifiedDocumentContextParameter>
+      <ram:ID>urn:cen.eu:en16931:2017</ram:ID>
+    </ram:GuidelineSpecifiedDocumentContextParameter>
+  </rsm:ExchangedDocumentContext>
+  <rsm:ExchangedDocument>
+    <ram:ID>RE-2024-0042</ram:ID>
+    <ram:TypeCode>380</ram:TypeCode>
+    <ram:IssueDateTime><udt:DateTimeString format="102">20240301</udt:DateTimeString></ram:IssueDateTime>
+  </rsm:ExchangedDocument>
+  <rsm:SupplyChainTradeTransaction>
+    <ram:IncludedSupplyChainTradeLineItem>
+      <ram:AssociatedDocumentLineDocument><ram:LineID>1</ram:LineID></ram:AssociatedDocumentLineDocument>
+      <ram:SpecifiedTradeProduct><ram:Name>Beratung</ram:Name></ram:SpecifiedTradeProduct>
+      <ram:SpecifiedLineTradeAgreement>
+        <ram:NetPriceProductTradePrice><ram:ChargeAmount>90.00</ram:ChargeAmount></ram:NetPriceProductTradePrice>
+      </ram:SpecifiedLineTradeAgreement>
+      <ram:SpecifiedLineTradeDelivery><ram:BilledQuantity unitCode="HUR">10</ram:BilledQuantity></ram:SpecifiedLineTradeDelivery>
+      <ram:SpecifiedLineTradeSettlement>
+        <ram:ApplicableTradeTax><ram:TypeCode>VAT</ram:TypeCode><ram:RateApplicablePercent>19</ram:RateApplicablePercent></ram:ApplicableTradeTax>
+        <ram:SpecifiedTradeSettlementLineMonetarySummation><ram:LineTotalAmount>900.00</ram:LineTotalAmount></ram:SpecifiedTradeSettlementLineMonetarySummation>
+      </ram:SpecifiedLineTradeSettlement>
+    </ram:IncludedSupplyChainTradeLineItem>
+    <ram:IncludedSupplyChainTradeLineItem>
+      <ram:AssociatedDocumentLineDocument><ram:LineID>2</ram:LineID></ram:AssociatedDocumentLineDocument>
+      <ram:SpecifiedTradeProduct><ram:Description>Schrauben M4</ram:Description></ram:SpecifiedTradeProduct>
+      <ram:SpecifiedLineTradeAgreement>
+        <ram:NetPriceProductTradePrice>
+          <ram:ChargeAmount>12.50</ram:ChargeAmount>
+          <ram:BasisQuantity unitCode="H87">100</ram:BasisQuantity>
+        </ram:NetPriceProductTradePrice>
+      </ram:SpecifiedLineTradeAgreement>
+      <ram:SpecifiedLineTradeDelivery><ram:BilledQuantity unitCode="H87">800</ram:BilledQuantity></ram:SpecifiedLineTradeDelivery>
+      <ram:SpecifiedLineTradeSettlement>
+        <ram:ApplicableTradeTax><ram:TypeCode>VAT</ram:TypeCode><ram:RateApplicablePercent>19</ram:RateApplicablePercent></ram:ApplicableTradeTax>
+        <ram:SpecifiedTradeSettlementLineMonetarySummation><ram:LineTotalAmount>100.00</ram:LineTotalAmount></ram:SpecifiedTradeSettlementLineMonetarySummation>
+      </ram:SpecifiedLineTradeSettlement>
+    </ram:IncludedSupplyChainTradeLineItem>
+    <ram:ApplicableHeaderTradeAgreement>
+      <ram:SellerTradeParty>
+        <ram:Name>Muster GmbH</ram:Name>
+        <ram:DefinedTradeContact>
+          <ram:EmailURIUniversalCommunication><ram:URIID>kontakt@muster.de</ram:URIID></ram:EmailURIUniversalCommunication>
+        </ram:DefinedTradeContact>
+        <ram:PostalTradeAddress>
+          <ram:PostcodeCode>10115</ram:PostcodeCode>
+          <ram:LineOne>Hauptstraße  1</ram:LineOne>
+          <ram:CityName>Berlin</ram:CityName>
+          <ram:CountryID>DE</ram:CountryID>
+        </ram:PostalTradeAddress>
+        <ram:URIUniversalCommunication><ram:URIID schemeID="EM">rechnung@muster.de</ram:URIID></ram:URIUniversalCommunication>
+        <ram:SpecifiedTaxRegistration><ram:ID schemeID="FC">30/123/45678</ram:ID></ram:SpecifiedTaxRegistration>
+        <ram:SpecifiedTaxRegistration><ram:ID schemeID="VA">DE123456789</ram:ID></ram:SpecifiedTaxRegistration>
+      </ram:SellerTradeParty>
+    </ram:ApplicableHeaderTradeAgreement>
+    <ram:ApplicableHeaderTradeSettlement>
+      <ram:InvoiceCurrencyCode>eur</ram:InvoiceCurrencyCode>
+      <ram:SpecifiedTradeSettlementPaymentMeans>
+        <ram:TypeCode>30</ram:TypeCode>
+      </ram:SpecifiedTradeSettlementPaymentMeans>
+      <ram:SpecifiedTradeSettlementPaymentMeans>
+        <ram:TypeCode>58</ram:TypeCode>
+        <ram:PayeePartyCreditorFinancialAccount><ram:IBANID>DE89370400440532013000</ram:IBANID></ram:PayeePartyCreditorFinancialAccount>
+        <ram:PayeeSpecifiedCreditorFinancialInstitution><ram:BICID>COBADEFFXXX</ram:BICID></ram:PayeeSpecifiedCreditorFinancialInstitution>
+      </ram:SpecifiedTradeSettlementPaymentMeans>
+      <ram:ApplicableTradeTax>
+        <ram:CalculatedAmount>190.00</ram:CalculatedAmount>
+        <ram:TypeCode>VAT</ram:TypeCode>
+        <ram:BasisAmount>1000.00</ram:BasisAmount>
+        <ram:CategoryCode>S</ram:CategoryCode>
+        <ram:RateApplicablePercent>19</ram:RateApplicablePercent>
+      </ram:ApplicableTradeTax>
+      <ram:ApplicableTradeTax>
+        <ram:CalculatedAmount>5.00</ram:CalculatedAmount>
+        <ram:TypeCode>LOC</ram:TypeCode>
+        <ram:BasisAmount>1000.00</ram:BasisAmount>
+      </ram:ApplicableTradeTax>
+      <ram:SpecifiedTradePaymentTerms>
+        <ram:Description>Zahlbar innerhalb von 30 Tagen netto</ram:Description>
+        <ram:DueDateDateTime><udt:DateTimeString format="102">20240331</udt:DateTimeString></ram:DueDateDateTime>
+      </ram:SpecifiedTradePaymentTerms>
+      <ram:SpecifiedTradeSettlementHeaderMonetarySummation>
+        <ram:LineTotalAmount>1000.00</ram:LineTotalAmount>
+        <ram:TaxBasisTotalAmount>1000.00</ram:TaxBasisTotalAmount>
+        <ram:TaxTotalAmount currencyID="CHF">181.50</ram:TaxTotalAmount>
+        <ram:TaxTotalAmount currencyID="EUR">190.00</ram:TaxTotalAmount>
+        <ram:GrandTotalAmount>1190.00</ram:GrandTotalAmount>
+        <ram:DuePayableAmount>1190.00</ram:DuePayableAmount>
+      </ram:SpecifiedTradeSettlementHeaderMonetarySummation>
+    </ram:ApplicableHeaderTradeSettlement>
+  </rsm:SupplyChainTradeTransaction>
+</rsm:CrossIndustryInvoice>`
+
+func date(year int, month time.Month, day int) *time.Time {
+	date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	return &date
+}
+
+func eur(minor int64) *model.Money {
+	return &model.Money{Minor: minor, Currency: "EUR"}
+}
+
+func number(value float64) *float64 {
+	return &value
+}
+
+func TestParseCII(t *testing.T) {
+	want := &Invoice{
+		Format:       FormatCII,
+		Profile:      "urn:cen.eu:en16931:2017",
+		Number:       "RE-2024-0042",
+		Date:         date(2024, time.March, 1),
+		DueDate:      date(2024, time.March, 31),
+		PaymentTerms: "Zahlbar innerhalb von 30 Tagen netto",
+		Currency:     "EUR",
+		Amount:       eur(119000),
+		NetAmount:    eur(100000),
+		// the tax total in CHF is skipped
+		TaxAmount: eur(19000),
+		// the local tax is not VAT
+		TaxBreakdown: []model.TaxLine{{Rate: 19, Net: eur(100000), Tax: eur(19000)}},
+		LineItems: []model.LineItem{
+			{
+				Position:    1,
+				Description: "Beratung",
+				Quantity:    number(10),
+				TaxRate:     number(19),
+				Total:       eur(90000),
+				UnitPrice:   &model.Price{Units: 9000, Scale: 2, Currency: "EUR"},
+			},
+			{
+				Position:    2,
+				Description: "Schrauben M4",
+				Quantity:    number(800),
+				TaxRate:     number(19),
+				Total:       eur(10000),
+				UnitPrice:   &model.Price{Units: 125, Scale: 3, Currency: "EUR"},
+			},
+		},
+		Seller: Party{
+			Name:    "Muster GmbH",
+			Address: "Hauptstraße 1, 10115 Berlin, DE",
+			VATID:   "DE123456789",
+			IBAN:    "DE89370400440532013000",
+			BIC:     "COBADEFFXXX",
+			// the electronic address is preferred over the email of the contact
+			Email: "rechnung@muster.de",
+		},
+	}
+
+	got, err := Parse([]byte(testCII))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseCIIContactEmail(t *testing.T) {
+	content := strings.Replace(testCII, `schemeID="EM"`, `schemeID="GLN"`, 1)
+	got, err := Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got.Seller.Email != "kontakt@muster.de" {
+		t.Errorf("Parse() seller email = %q, want %q", got.Seller.Email, "kontakt@muster.de")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr error // nil if any error is wanted
+	}{
+		{"ZUGFeRD 1", `<rsm:CrossIndustryDocument xmlns:rsm="urn:ferd:CrossIndustryDocument:invoice:1p0"/>`, ErrUnsupportedFormat},
+		{"other XML", `<?xml version="1.0"?><order><id>1</id></order>`, ErrUnknownFormat},
+		{"UBL invoice of another namespace", `<Invoice xmlns="urn:example:invoice"/>`, ErrUnknownFormat},
+		{"no XML", "%PDF-1.7", ErrUnknownFormat},
+		{"empty", "", ErrUnknownFormat},
+		{"unknown currency", strings.Replace(testCII, "<ram:InvoiceCurrencyCode>eur", "<ram:InvoiceCurrencyCode>EURO", 1), nil},
+		{"date format", strings.Replace(testCII, `format="102">20240301`, `format="610">202403`, 1), nil},
+		{"invalid date", strings.Replace(testCII, "20240301", "20240231", 1), nil},
+		{"too many decimals", strings.Replace(testCII, "<ram:GrandTotalAmount>1190.00", "<ram:GrandTotalAmount>1190.001", 1), nil},
+		{"invalid quantity", strings.Replace(testCII, `unitCode="HUR">10<`, `unitCode="HUR">ten<`, 1), nil},
+		{"truncated", testCII[:len(testCII)/2], nil},
+	}
+	for _, test := range tests {
+		got, err := Parse([]byte(test.content))
+		if err == nil {
+			t.Errorf("Parse(%s) = %+v, want error", test.name, got)
+			continue
+		}
+		if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+			t.Errorf("Parse(%s) error = %v, want %v", test.name, err, test.wantErr)
+		}
+		// invalid invoices are not mistaken for other documents
+		if test.wantErr == nil && errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Parse(%s) error = %v, want an invalid invoice", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package einvoice reads structured electronic invoices: the CII XML embedded in ZUGFeRD and Factur-X PDFs, and
+// UBL or CII XML invoices such as XRechnung. Their fields are exact, unlike the ones extracted from the text of a
+// document
+package einvoice
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of electronic invoices
+const (
+	FormatCII = "cii" // UN/CEFACT Cross Industry Invoice, the XML of ZUGFeRD 2, Factur-X and XRechnung
+	FormatUBL = "ubl" // OASIS UBL 2.1, of Peppol BIS and XRechnung
+)
+
+var (
+	// ErrUnknownFormat is returned for XML documents that are not electronic invoices
+	ErrUnknownFormat = errors.New("not an electronic invoice")
+	// ErrUnsupportedFormat is returned for electronic invoices of formats that cannot be read, such as ZUGFeRD 1
+	ErrUnsupportedFormat = errors.New("unsupported electronic invoice format")
+)
+
+// Invoice holds the fields of an electronic invoice, nil or empty if the invoice does not state them
+type Invoice struct {
+	Format  string
+	Profile string // the specification the invoice conforms to, e.g. urn:cen.eu:en16931:2017
+	Number  string
+	Date    *time.Time
+	DueDate *time.Time
+	// the terms of payment as stated, e.g. "Zahlbar innerhalb von 30 Tagen"
+	PaymentTerms string
+	// the terms stated in the structured XRechnung syntax, nil if not stated that way
+	Terms        *model.PaymentTerms
+	Currency     string
+	Amount       *model.Money // the gross amount
+	NetAmount    *model.Money
+	TaxAmount    *model.Money
+	TaxBreakdown []model.TaxLine
+	LineItems    []model.LineItem
+	Seller       Party
+}
+
+// Party holds the details of the seller that issued the invoice
+type Party struct {
+	Name    string
+	Address string // in a single line
+	VATID   string
+	IBAN    string
+	BIC     string
+	Email   string
+}
+
+// Parse reads an electronic invoice, the format is detected from the root element
+func Parse(content []byte) (*Invoice, error) {
+	root, err := rootElement(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnknownFormat, err)
+	}
+
+	switch {
+	case root.Local == "CrossIndustryInvoice":
+		return parseCII(content)
+	case (root.Local == "Invoice" || root.Local == "CreditNote") && strings.HasPrefix(root.Space, ublNamespace):
+		return parseUBL(content)
+	case root.Local == "CrossIndustryDocument":
+		return nil, fmt.Errorf("%w: ZUGFeRD 1", ErrUnsupportedFormat)
+	default:
+		return nil, fmt.Errorf("%w: root element %s", ErrUnknownFormat, root.Local)
+	}
+}
+
+// ublNamespace is the prefix of the namespaces of UBL documents, the root element is not enough to tell them apart
+const ublNamespace = "urn:oasis:names:specification:ubl:schema:xsd:"
+
+// rootElement returns the name of the root element of an XML document
+func rootElement(content []byte) (xml.Name, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return xml.Name{}, errors.New("no root element")
+		}
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
+
+// skonto is the XRechnung syntax of early payment discounts in the payment terms, "#SKONTO#TAGE=14#PROZENT=2.00#"
+var skonto = regexp.MustCompile(`#SKONTO#TAGE=(\d+)#PROZENT=(\d+(?:\.\d+)?)#`)
+
+// skontoTerms returns the terms of an early payment discount stated in the XRechnung syntax, the net days are the
+// days from the invoice date to the due date. Nil if there is no such discount or either date is missing
+func skontoTerms(text string, date, dueDate *time.Time) *model.PaymentTerms {
+	m := skonto.FindStringSubmatch(text)
+	if m == nil || date == nil || dueDate == nil || dueDate.Before(*date) {
+		return nil
+	}
+
+	days, _ := strconv.Atoi(m[1])
+	percent, _ := strconv.ParseFloat(m[2], 64)
+	terms := &model.PaymentTerms{NetDays: int(dueDate.Sub(*date).Hours() / 24), DiscountPercent: percent, DiscountDays: days}
+	if percent <= 0 || percent >= 100 || days > terms.NetDays {
+		return nil
+	}
+	return terms
+}
+
+// lineItem reads a position of an invoice, the price may be stated for a basis quantity, e.g. per 100 pieces
+func lineItem(position int, description, quantity, price, basisQuantity, taxRate, total, currency string) (model.LineItem, error) {
+	item := model.LineItem{Position: position, Description: description}
+
+	var err error
+	if item.Quantity, err = parseNumber(quantity); err != nil {
+		return item, fmt.Errorf("quantity: %w", err)
+	}
+	if item.TaxRate, err = parseNumber(taxRate); err != nil {
+		return item, fmt.Errorf("tax rate: %w", err)
+	}
+	if item.Total, err = parseAmount(total, currency); err != nil {
+		return item, fmt.Errorf("total: %w", err)
+	}
+
+	if item.UnitPrice, err = parsePrice(price, basisQuantity, currency); err != nil {
+		return item, fmt.Errorf("price: %w", err)
+	}
+	return item, nil
+}
+
+// parsePrice reads a unit price stated for a basis quantity, nil for an empty price. Prices per unit that would have
+// more than model.MaxPriceScale decimals, such as 10 for 3 pieces, are left out, the line total is stated anyway
+func parsePrice(price, basisQuantity, currency string) (*model.Price, error) {
+	price = strings.TrimSpace(price)
+	if price == "" {
+		return nil, nil
+	}
+	unitPrice, err := model.ParsePrice(price, currency)
+	if err != nil {
+		return nil, err
+	}
+
+	basisQuantity = strings.TrimSpace(basisQuantity)
+	if basisQuantity == "" {
+		return &unitPrice, nil
+	}
+	basis, ok := new(big.Rat).SetString(basisQuantity)
+	if !ok || strings.ContainsAny(basisQuantity, "eE/") {
+		return nil, fmt.Errorf("invalid basis quantity %q", basisQuantity)
+	}
+	if basis.Sign() <= 0 {
+		return &unitPrice, nil
+	}
+	perUnit, exact := model.PriceFromRat(new(big.Rat).Quo(unitPrice.Rat(), basis), currency)
+	if !exact {
+		return nil, nil
+	}
+	return &perUnit, nil
+}
+
+// taxLine reads a rate of the VAT breakdown
+func taxLine(rate, basis, calculated, currency string) (model.TaxLine, error) {
+	var line model.TaxLine
+	percent, err := parseNumber(rate)
+	if err != nil {
+		return line, fmt.Errorf("rate: %w", err)
+	}
+	if percent != nil {
+		line.Rate = *percent
+	}
+	if line.Net, err = parseAmount(basis, currency); err != nil {
+		return line, fmt.Errorf("basis: %w", err)
+	}
+	if line.Tax, err = parseAmount(calculated, currency); err != nil {
+		return line, fmt.Errorf("tax: %w", err)
+	}
+	return line, nil
+}
+
+// parseDate reads a date in the format of its format code, 102 is YYYYMMDD. Dates without a format code are read as
+// YYYYMMDD or YYYY-MM-DD
+func parseDate(value string, format string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	layout := "20060102"
+	switch {
+	case format != "" && format != "102":
+		return nil, fmt.Errorf("unsupported date format %s", format)
+	case format == "" && strings.Contains(value, "-"):
+		layout = time.DateOnly
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return nil, err
+	}
+	return &date, nil
+}
+
+// parseAmount reads a decimal amount in the currency exactly, amounts with more decimals than the currency has are
+// rejected. Returns nil for an empty value
+func parseAmount(value string, currency string) (*model.Money, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	amount, err := model.ParseMoney(value, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
+
+// parseNumber reads a decimal number such as a quantity or a tax rate, nil for an empty value
+func parseNumber(value string) (*float64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &number, nil
+}
+
+// joinAddress joins the non-empty parts of an address into a single line
+func joinAddress(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part = strings.Join(strings.Fields(part), " "); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ", ")
+}
@@ -0,0 +1,64 @@
+package einvoice
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     *model.Money
+		wantErr  bool
+	}{
+		{"1190.00", "EUR", &model.Money{Minor: 119000, Currency: "EUR"}, false},
+		{" -5.5 ", "EUR", &model.Money{Minor: -550, Currency: "EUR"}, false},
+		{"1500", "JPY", &model.Money{Minor: 1500, Currency: "JPY"}, false},
+		{"", "EUR", nil, false},
+		// amounts of electronic invoices are exact, they are not rounded
+		{"12.345", "EUR", nil, true},
+		{"1500.5", "JPY", nil, true},
+		{"1e3", "EUR", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parseAmount(test.value, test.currency)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseAmount(%q, %s) error = %v, want error %v", test.value, test.currency, err, test.wantErr)
+			continue
+		}
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("parseAmount(%q, %s) = %v, want %v", test.value, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		price   string
+		basis   string
+		want    *model.Price
+		wantErr bool
+	}{
+		{"0.2345", "", &model.Price{Units: 2345, Scale: 4, Currency: "EUR"}, false},
+		{"12.50", "1", &model.Price{Units: 1250, Scale: 2, Currency: "EUR"}, false},
+		// per 100 pieces
+		{"12.50", "100", &model.Price{Units: 125, Scale: 3, Currency: "EUR"}, false},
+		{"12.50", "0", &model.Price{Units: 1250, Scale: 2, Currency: "EUR"}, false},
+		// 3.333… per piece is not exact, the price is left out
+		{"10", "3", nil, false},
+		{"", "100", nil, false},
+		{"12,50", "", nil, true},
+		{"12.50", "1/3", nil, true},
+	}
+	for _, test := range tests {
+		got, err := parsePrice(test.price, test.basis, "EUR")
+		if (err != nil) != test.wantErr {
+			t.Errorf("parsePrice(%q, %q) error = %v, want error %v", test.price, test.basis, err, test.wantErr)
+			continue
+		}
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("parsePrice(%q, %q) = %+v, want %+v", test.price, test.basis, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package einvoice
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// The layout of rendered invoices: A4 pages of monospaced text, so that the columns line up without font metrics
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 50
+	fontSize     = 9
+	lineHeight   = 12
+	lineWidth    = 90 // characters of Courier at the font size that fit between the margins
+	linesPerPage = (pageHeight - 2*pageMargin) / lineHeight
+)
+
+// RenderPDF lays out the invoice as a PDF for people to read, with the XML attached under the filename. The PDF is
+// stored in place of an uploaded XML invoice, so it is previewed like any other invoice and the XML is found again
+// when it is processed
+func RenderPDF(invoice *Invoice, content []byte, filename string) ([]byte, error) {
+	return writePDF(renderLines(invoice), content, filename)
+}
+
+// renderLines lays out the fields of the invoice as lines of text
+func renderLines(invoice *Invoice) []string {
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, wrap(fmt.Sprintf(format, args...), lineWidth)...)
+	}
+	addField := func(label string, value string) {
+		if value != "" {
+			add("%-16s%s", label+":", value)
+		}
+	}
+
+	seller := invoice.Seller
+	add("%s", seller.Name)
+	addField("Address", seller.Address)
+	addField("VAT ID", seller.VATID)
+	addField("IBAN", seller.IBAN)
+	addField("BIC", seller.BIC)
+	addField("Email", seller.Email)
+	add("")
+	add("INVOICE %s", invoice.Number)
+	add("")
+	addField("Date", formatDate(invoice.Date))
+	addField("Due date", formatDate(invoice.DueDate))
+	addField("Payment terms", strings.Join(strings.Fields(invoice.PaymentTerms), " "))
+	addField("Currency", invoice.Currency)
+
+	if len(invoice.LineItems) > 0 {
+		add("")
+		add("%-4s %-43s %8s %12s %6s %12s", "Pos", "Description", "Quantity", "Unit price", "Tax %", "Total")
+		add("%s", strings.Repeat("-", lineWidth))
+		for _, item := range invoice.LineItems {
+			description := wrap(item.Description, 43)
+			if len(description) == 0 {
+				description = []string{""}
+			}
+			add("%-4d %-43s %8s %12s %6s %12s", item.Position, description[0], formatNumber(item.Quantity),
+				formatPrice(item.UnitPrice), formatNumber(item.TaxRate), formatMoney(item.Total))
+			for _, line := range description[1:] {
+				add("%-4s %s", "", line)
+			}
+		}
+		add("%s", strings.Repeat("-", lineWidth))
+	}
+
+	add("")
+	total := func(label string, value string) {
+		if value != "" {
+			add("%*s %14s", lineWidth-15, label, value)
+		}
+	}
+	total("Net amount", formatMoney(invoice.NetAmount))
+	for _, line := range invoice.TaxBreakdown {
+		rate := line.Rate
+		total("VAT "+formatNumber(&rate)+"% of "+formatMoney(line.Net), formatMoney(line.Tax))
+	}
+	total("Tax amount", formatMoney(invoice.TaxAmount))
+	total("Total", formatMoney(invoice.Amount))
+	add("")
+	add("Rendered from the attached %s e-invoice %s", strings.ToUpper(invoice.Format), invoice.Profile)
+
+	return lines
+}
+
+func formatDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+	return date.Format(time.DateOnly)
+}
+
+func formatNumber(number *float64) string {
+	if number == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*number, 'f', -1, 64)
+}
+
+func formatMoney(amount *model.Money) string {
+	if amount == nil {
+		return ""
+	}
+	return amount.Decimal()
+}
+
+func formatPrice(price *model.Price) string {
+	if price == nil {
+		return ""
+	}
+	return price.Decimal()
+}
+
+// wrap breaks the text into lines of at most width characters, at spaces where possible
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if strings.TrimSpace(paragraph) == "" || line != "" {
+			lines = append(lines, strings.TrimRight(line, " "))
+		}
+	}
+	return lines
+}
+
+// writePDF writes the lines as pages of a PDF and attaches the file. Text is encoded in WinAnsiEncoding, characters
+// outside of it are replaced
+func writePDF(lines []string, attachment []byte, filename string) ([]byte, error) {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	if _, err := writer.Write(attachment); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	pages := (len(lines) + linesPerPage - 1) / linesPerPage
+	pages = max(pages, 1)
+	// objects: catalog, pages, font, file specification, embedded file, then a page and its contents per page
+	const catalog, pageTree, font, fileSpec, embeddedFile, firstPage = 1, 2, 3, 4, 5, 6
+	name := pdfString(filename)
+
+	objects := []string{
+		fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R /Names << /EmbeddedFiles << /Names [%s %d 0 R] >> >> /AF [%d 0 R] >>",
+			pageTree, name, fileSpec, fileSpec),
+		"", // the page tree, once the pages are known
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Type /Filespec /F %s /UF %s /AFRelationship /Source /EF << /F %d 0 R /UF %d 0 R >> >>",
+			name, name, embeddedFile, embeddedFile),
+		fmt.Sprintf("<< /Type /EmbeddedFile /Subtype /application#2Fxml /Filter /FlateDecode /Length %d /Params << /Size %d >> >>\nstream\n%s\nendstream",
+			compressed.Len(), len(attachment), compressed.String()),
+	}
+	kids := make([]string, 0, pages)
+	for page := 0; page < pages; page++ {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", fontSize, lineHeight, pageMargin, pageHeight-pageMargin)
+		for _, line := range lines[page*linesPerPage : min((page+1)*linesPerPage, len(lines))] {
+			fmt.Fprintf(&content, "%s '\n", pdfString(line))
+		}
+		content.WriteString("ET")
+
+		pageObject := firstPage + 2*page
+		kids = append(kids, fmt.Sprintf("%d 0 R", pageObject))
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %d %d] /Contents %d 0 R /Resources << /Font << /F1 %d 0 R >> >> >>",
+				pageTree, pageWidth, pageHeight, pageObject+1, font),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+	objects[pageTree-1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages)
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, catalog, xref)
+
+	return pdf.Bytes(), nil
+}
+
+// winAnsi maps the characters of WinAnsiEncoding outside of Latin-1 to their codes
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a,
+	'‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// pdfString encodes the text as a PDF string literal in WinAnsiEncoding
+func pdfString(text string) string {
+	var encoded strings.Builder
+	encoded.WriteByte('(')
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			encoded.WriteByte('\\')
+			encoded.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			encoded.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&encoded, "\\%03o", r)
+		case winAnsi[r] != 0:
+			fmt.Fprintf(&encoded, "\\%03o", winAnsi[r])
+		default:
+			encoded.WriteByte('?')
+		}
+	}
+	encoded.WriteByte(')')
+	return encoded.String()
+}
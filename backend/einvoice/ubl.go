@@ -0,0 +1,187 @@
+package einvoice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"strings"
+)
+
+// The elements of a UBL 2.1 invoice or credit note that are read, the ones of Peppol BIS and XRechnung included.
+// Namespaces are ignored
+type ublInvoice struct {
+	Customization   string     `xml:"CustomizationID"`
+	Number          string     `xml:"ID"`
+	IssueDate       string     `xml:"IssueDate"`
+	DueDate         string     `xml:"DueDate"`
+	Currency        string     `xml:"DocumentCurrencyCode"`
+	Seller          ublParty   `xml:"AccountingSupplierParty>Party"`
+	PaymentMeans    []ublMeans `xml:"PaymentMeans"`
+	PaymentTerms    []string   `xml:"PaymentTerms>Note"`
+	TaxTotals       []ublTax   `xml:"TaxTotal"`
+	Totals          ublTotals  `xml:"LegalMonetaryTotal"`
+	InvoiceLines    []ublLine  `xml:"InvoiceLine"`
+	CreditNoteLines []ublLine  `xml:"CreditNoteLine"`
+}
+
+type ublParty struct {
+	Endpoint         ciiID    `xml:"EndpointID"`
+	Names            []string `xml:"PartyName>Name"`
+	Street           string   `xml:"PostalAddress>StreetName"`
+	AdditionalStreet string   `xml:"PostalAddress>AdditionalStreetName"`
+	AddressLine      string   `xml:"PostalAddress>AddressLine>Line"`
+	Postcode         string   `xml:"PostalAddress>PostalZone"`
+	City             string   `xml:"PostalAddress>CityName"`
+	Country          string   `xml:"PostalAddress>Country>IdentificationCode"`
+	TaxSchemes       []struct {
+		CompanyID string `xml:"CompanyID"`
+		Scheme    string `xml:"TaxScheme>ID"`
+	} `xml:"PartyTaxScheme"`
+	RegistrationName string `xml:"PartyLegalEntity>RegistrationName"`
+	Email            string `xml:"Contact>ElectronicMail"`
+}
+
+type ublMeans struct {
+	DueDate string `xml:"PaymentDueDate"`
+	IBAN    string `xml:"PayeeFinancialAccount>ID"`
+	BIC     string `xml:"PayeeFinancialAccount>FinancialInstitutionBranch>ID"`
+}
+
+type ublTax struct {
+	Amount    ciiAmount `xml:"TaxAmount"`
+	Subtotals []struct {
+		Taxable string `xml:"TaxableAmount"`
+		Tax     string `xml:"TaxAmount"`
+		Percent string `xml:"TaxCategory>Percent"`
+		Scheme  string `xml:"TaxCategory>TaxScheme>ID"`
+	} `xml:"TaxSubtotal"`
+}
+
+type ublTotals struct {
+	TaxExclusive string `xml:"TaxExclusiveAmount"`
+	TaxInclusive string `xml:"TaxInclusiveAmount"`
+}
+
+type ublLine struct {
+	ID               string `xml:"ID"`
+	InvoicedQuantity string `xml:"InvoicedQuantity"`
+	CreditedQuantity string `xml:"CreditedQuantity"`
+	Total            string `xml:"LineExtensionAmount"`
+	Name             string `xml:"Item>Name"`
+	Description      string `xml:"Item>Description"`
+	TaxRate          string `xml:"Item>ClassifiedTaxCategory>Percent"`
+	Price            string `xml:"Price>PriceAmount"`
+	BaseQuantity     string `xml:"Price>BaseQuantity"`
+}
+
+// parseUBL reads a UBL invoice or credit note, the amounts of credit notes are positive as stated
+func parseUBL(content []byte) (*Invoice, error) {
+	var document ublInvoice
+	if err := xml.Unmarshal(content, &document); err != nil {
+		return nil, fmt.Errorf("invalid UBL invoice: %w", err)
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(document.Currency))
+	if !model.ValidCurrency(currency) {
+		return nil, fmt.Errorf("invalid UBL invoice: unknown currency %q", document.Currency)
+	}
+
+	invoice := &Invoice{
+		Format:       FormatUBL,
+		Profile:      strings.TrimSpace(document.Customization),
+		Number:       strings.TrimSpace(document.Number),
+		Currency:     currency,
+		PaymentTerms: strings.TrimSpace(strings.Join(document.PaymentTerms, "\n")),
+		Seller:       document.Seller.party(),
+	}
+	var err error
+	if invoice.Date, err = parseDate(document.IssueDate, ""); err != nil {
+		return nil, fmt.Errorf("invalid UBL invoice: issue date: %w", err)
+	}
+	if invoice.DueDate, err = parseDate(document.DueDate, ""); err != nil {
+		return nil, fmt.Errorf("invalid UBL invoice: due date: %w", err)
+	}
+	for _, means := range document.PaymentMeans {
+		if invoice.DueDate == nil {
+			if invoice.DueDate, err = parseDate(means.DueDate, ""); err != nil {
+				return nil, fmt.Errorf("invalid UBL invoice: due date: %w", err)
+			}
+		}
+		if invoice.Seller.IBAN == "" && strings.TrimSpace(means.IBAN) != "" {
+			invoice.Seller.IBAN = strings.TrimSpace(means.IBAN)
+			invoice.Seller.BIC = strings.TrimSpace(means.BIC)
+		}
+	}
+
+	if invoice.Amount, err = parseAmount(document.Totals.TaxInclusive, currency); err != nil {
+		return nil, fmt.Errorf("invalid UBL invoice: tax inclusive amount: %w", err)
+	}
+	if invoice.NetAmount, err = parseAmount(document.Totals.TaxExclusive, currency); err != nil {
+		return nil, fmt.Errorf("invalid UBL invoice: tax exclusive amount: %w", err)
+	}
+	// a second tax total states the tax in the accounting currency, without subtotals
+	for _, total := range document.TaxTotals {
+		if total.Amount.Currency != "" && !strings.EqualFold(total.Amount.Currency, currency) {
+			continue
+		}
+		if invoice.TaxAmount, err = parseAmount(total.Amount.Value, currency); err != nil {
+			return nil, fmt.Errorf("invalid UBL invoice: tax amount: %w", err)
+		}
+		for _, subtotal := range total.Subtotals {
+			if subtotal.Scheme != "" && subtotal.Scheme != "VAT" {
+				continue
+			}
+			line, err := taxLine(subtotal.Percent, subtotal.Taxable, subtotal.Tax, currency)
+			if err != nil {
+				return nil, fmt.Errorf("invalid UBL invoice: tax subtotal: %w", err)
+			}
+			invoice.TaxBreakdown = append(invoice.TaxBreakdown, line)
+		}
+		break
+	}
+
+	for i, line := range append(document.InvoiceLines, document.CreditNoteLines...) {
+		quantity := line.InvoicedQuantity
+		if quantity == "" {
+			quantity = line.CreditedQuantity
+		}
+		description := strings.TrimSpace(line.Name)
+		if description == "" {
+			description = strings.TrimSpace(line.Description)
+		}
+
+		item, err := lineItem(i+1, description, quantity, line.Price, line.BaseQuantity, line.TaxRate, line.Total, currency)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UBL invoice: line %s: %w", line.ID, err)
+		}
+		invoice.LineItems = append(invoice.LineItems, item)
+	}
+
+	invoice.Terms = skontoTerms(invoice.PaymentTerms, invoice.Date, invoice.DueDate)
+	return invoice, nil
+}
+
+func (p ublParty) party() Party {
+	party := Party{
+		Name: strings.TrimSpace(p.RegistrationName),
+		Address: joinAddress(p.Street, p.AdditionalStreet, p.AddressLine, strings.TrimSpace(p.Postcode+" "+p.City),
+			p.Country),
+		Email: strings.TrimSpace(p.Email),
+	}
+	// the trading name is the one on the letterhead, the registration name is the legal one
+	for _, name := range p.Names {
+		if strings.TrimSpace(name) != "" {
+			party.Name = strings.TrimSpace(name)
+			break
+		}
+	}
+	for _, scheme := range p.TaxSchemes {
+		if scheme.Scheme == "VAT" {
+			party.VATID = strings.TrimSpace(scheme.CompanyID)
+		}
+	}
+	if party.Email == "" && p.Endpoint.Scheme == "EM" {
+		party.Email = strings.TrimSpace(p.Endpoint.Value)
+	}
+	return party
+}
@@ -0,0 +1,290 @@
+package einvoice
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testUBL is an XRechnung invoice with an early payment discount, due as stated by the payment means
+const testUBL = `<?xml version="1.0" encoding="UTF-8"?>
+<ubl:Invoice xmlns:ubl="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"
+    xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+    xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+  <cbc:CustomizationID>urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0</cbc:CustomizationID>
+  <cbc:ID>2024-117</cbc:ID>
+  <cbc:IssueDate>2024-03-01</cbc:IssueDate>
+  <cbc:InvoiceTypeCode>380</cbc:InvoiceTypeCode>
+  <cbc:DocumentCurrencyCode>EUR</cbc:DocumentCurrencyCode>
+  <cac:AccountingSupplierParty>
+    <cac:Party>
+      <cbc:EndpointID schemeID="EM">rechnung@werkstatt.de</cbc:EndpointID>
+      <cac:PartyName><cbc:Name>Werkstatt Nord</cbc:Name></cac:PartyName>
+      <cac:PostalAddress>
+        <cbc:StreetName>Hafenweg 7</cbc:StreetName>
+        <cbc:AdditionalStreetName>Halle 2</cbc:AdditionalStreetName>
+        <cbc:CityName>Hamburg</cbc:CityName>
+        <cbc:PostalZone>20457</cbc:PostalZone>
+        <cac:Country><cbc:IdentificationCode>DE</cbc:IdentificationCode></cac:Country>
+      </cac:PostalAddress>
+      <cac:PartyTaxScheme>
+        <cbc:CompanyID>22/815/08154</cbc:CompanyID>
+        <cac:TaxScheme><cbc:ID>FC</cbc:ID></cac:TaxScheme>
+      </cac:PartyTaxScheme>
+      <cac:PartyTaxScheme>
+        <cbc:CompanyID>DE987654321</cbc:CompanyID>
+        <cac:TaxScheme><cbc:ID>VAT</cbc:ID></cac:TaxScheme>
+      </cac:PartyTaxScheme>
+      <cac:PartyLegalEntity><cbc:RegistrationName>Werkstatt Nord GmbH &amp; Co. KG</cbc:RegistrationName></cac:PartyLegalEntity>
+    </cac:Party>
+  </cac:AccountingSupplierParty>
+  <cac:PaymentMeans>
+    <cbc:PaymentMeansCode>58</cbc:PaymentMeansCode>
+    <cbc:PaymentDueDate>2024-03-31</cbc:PaymentDueDate>
+    <cac:PayeeFinancialAccount>
+      <cbc:ID>DE02120300000000202051</cbc:ID>
+      <cac:FinancialInstitutionBranch><cbc:ID>BYLADEM1001</cbc:ID></cac:FinancialInstitutionBranch>
+    </cac:PayeeFinancialAccount>
+  </cac:PaymentMeans>
+  <cac:PaymentTerms>
+    <cbc:Note>#SKONTO#TAGE=10#PROZENT=2.00#
+</cbc:Note>
+  </cac:PaymentTerms>
+  <cac:TaxTotal>
+    <cbc:TaxAmount currencyID="EUR">26.00</cbc:TaxAmount>
+    <cac:TaxSubtotal>
+      <cbc:TaxableAmount currencyID="EUR">100.00</cbc:TaxableAmount>
+      <cbc:TaxAmount currencyID="EUR">19.00</cbc:TaxAmount>
+      <cac:TaxCategory><cbc:ID>S</cbc:ID><cbc:Percent>19</cbc:Percent><cac:TaxScheme><cbc:ID>VAT</cbc:ID></cac:TaxScheme></cac:TaxCategory>
+    </cac:TaxSubtotal>
+    <cac:TaxSubtotal>
+      <cbc:TaxableAmount currencyID="EUR">100.00</cbc:TaxableAmount>
+      <cbc:TaxAmount currencyID="EUR">7.00</cbc:TaxAmount>
+      <cac:TaxCategory><cbc:ID>AA</cbc:ID><cbc:Percent>7</cbc:Percent><cac:TaxScheme><cbc:ID>VAT</cbc:ID></cac:TaxScheme></cac:TaxCategory>
+    </cac:TaxSubtotal>
+  </cac:TaxTotal>
+  <cac:LegalMonetaryTotal>
+    <cbc:LineExtensionAmount currencyID="EUR">200.00</cbc:LineExtensionAmount>
+    <cbc:TaxExclusiveAmount currencyID="EUR">200.00</cbc:TaxExclusiveAmount>
+    <cbc:TaxInclusiveAmount currencyID="EUR">226.00</cbc:TaxInclusiveAmount>
+    <cbc:PayableAmount currencyID="EUR">226.00</cbc:PayableAmount>
+  </cac:LegalMonetaryTotal>
+  <cac:InvoiceLine>
+    <cbc:ID>A1</cbc:ID>
+    <cbc:InvoicedQuantity unitCode="HUR">2</cbc:InvoicedQuantity>
+    <cbc:LineExtensionAmount currencyID="EUR">100.00</cbc:LineExtensionAmount>
+    <cac:Item>
+      <cbc:Name>Wartung</cbc:Name>
+      <cac:ClassifiedTaxCategory><cbc:ID>S</cbc:ID><cbc:Percent>19</cbc:Percent><cac:TaxScheme><cbc:ID>VAT</cbc:ID></cac:TaxScheme></cac:ClassifiedTaxCategory>
+    </cac:Item>
+    <cac:Price><cbc:PriceAmount currencyID="EUR">50.00</cbc:PriceAmount></cac:Price>
+  </cac:InvoiceLine>
+  <cac:InvoiceLine>
+    <cbc:ID>A2</cbc:ID>
+    <cbc:InvoicedQuantity unitCode="KGM">40</cbc:InvoicedQuantity>
+    <cbc:LineExtensionAmount currencyID="EUR">100.00</cbc:LineExtensionAmount>
+    <cac:Item>
+      <cbc:Description>Streusalz</cbc:Description>
+      <cac:ClassifiedTaxCategory><cbc:ID>AA</cbc:ID><cbc:Percent>7</cbc:Percent><cac:TaxScheme><cbc:ID>VAT</cbc:ID></cac:TaxScheme></cac:ClassifiedTaxCategory>
+    </cac:Item>
+    <cac:Price>
+      <cbc:PriceAmount currencyID="EUR">25.00</cbc:PriceAmount>
+      <cbc:BaseQuantity unitCode="KGM">10</cbc:BaseQuantity>
+    </cac:Price>
+  </cac:InvoiceLine>
+</ubl:Invoice>`
+
+// testCreditNote is a Peppol credit note in CHF, with the tax also stated in the accounting currency EUR
+const testCreditNote = `<?xml version="1.0" encoding="UTF-8"?>
+<CreditNote xmlns="urn:oasis:names:specification:ubl:schema:xsd:CreditNote-2"
+    xmlns:cac="urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2"
+    xmlns:cbc="urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2">
+  <cbc:CustomizationID>urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0</cbc:CustomizationID>
+  <cbc:ID>GS-9</cbc:ID>
+  <cbc:IssueDate>2024-04-02</cbc:IssueDate>
+  <cbc:DocumentCurrencyCode>CHF</cbc:DocumentCurrencyCode>
+  <cbc:TaxCurrencyCode>EUR</cbc:TaxCurrencyCode>
+  <cac:AccountingSupplierParty>
+    <cac:Party>
+      <cac:PostalAddress>
+        <cac:AddressLine><cbc:Line>Bahnhofstrasse 3</cbc:Line></cac:AddressLine>
+        <cbc:CityName>Zürich</cbc:CityName>
+        <cbc:PostalZone>8001</cbc:PostalZone>
+        <cac:Country><cbc:IdentificationCode>CH</cbc:IdentificationCode></cac:Country>
+      </cac:PostalAddress>
+      <cac:PartyLegalEntity><cbc:RegistrationName>Alpen AG</cbc:RegistrationName></cac:PartyLegalEntity>
+      <cac:Contact><cbc:ElectronicMail>buchhaltung@alpen.ch</cbc:ElectronicMail></cac:Contact>
+    </cac:Party>
+  </cac:AccountingSupplierParty>
+  <cac:TaxTotal>
+    <cbc:TaxAmount currencyID="EUR">7.90</cbc:TaxAmount>
+  </cac:TaxTotal>
+  <cac:TaxTotal>
+    <cbc:TaxAmount currencyID="CHF">8.10</cbc:TaxAmount>
+    <cac:TaxSubtotal>
+      <cbc:TaxableAmount currencyID="CHF">100.00</cbc:TaxableAmount>
+      <cbc:TaxAmount currencyID="CHF">8.10</cbc:TaxAmount>
+      <cac:TaxCategory><cbc:ID>S</cbc:ID><cbc:Percent>8.1</cbc:Percent><cac:TaxScheme><cbc:ID>VAT</cbc:ID></cac:TaxScheme></cac:TaxCategory>
+    </cac:TaxSubtotal>
+  </cac:TaxTotal>
+  <cac:LegalMonetaryTotal>
+    <cbc:TaxExclusiveAmount currencyID="CHF">100.00</cbc:TaxExclusiveAmount>
+    <cbc:TaxInclusiveAmount currencyID="CHF">108.10</cbc:TaxInclusiveAmount>
+  </cac:LegalMonetaryTotal>
+  <cac:CreditNoteLine>
+    <cbc:ID>1</cbc:ID>
+    <cbc:CreditedQuantity unitCode="C62">4</cbc:CreditedQuantity>
+    <cbc:LineExtensionAmount currencyID="CHF">100.00</cbc:LineExtensionAmount>
+    <cac:Item><cbc:Name>Rücknahme Leihgeräte</cbc:Name></cac:Item>
+    <cac:Price><cbc:PriceAmount currencyID="CHF">25.00</cbc:PriceAmount></cac:Price>
+  </cac:CreditNoteLine>
+</CreditNote>`
+
+func TestParseUBL(t *testing.T) {
+	chf := func(minor int64) *model.Money {
+		return &model.Money{Minor: minor, Currency: "CHF"}
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    *Invoice
+	}{
+		{
+			name:    "invoice",
+			content: testUBL,
+			want: &Invoice{
+				Format:       FormatUBL,
+				Profile:      "urn:cen.eu:en16931:2017#compliant#urn:xeinkauf.de:kosit:xrechnung_3.0",
+				Number:       "2024-117",
+				Date:         date(2024, time.March, 1),
+				DueDate:      date(2024, time.March, 31),
+				PaymentTerms: "#SKONTO#TAGE=10#PROZENT=2.00#",
+				Terms:        &model.PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 10},
+				Currency:     "EUR",
+				Amount:       eur(22600),
+				NetAmount:    eur(20000),
+				TaxAmount:    eur(2600),
+				TaxBreakdown: []model.TaxLine{
+					{Rate: 19, Net: eur(10000), Tax: eur(1900)},
+					{Rate: 7, Net: eur(10000), Tax: eur(700)},
+				},
+				LineItems: []model.LineItem{
+					{
+						Position:    1,
+						Description: "Wartung",
+						Quantity:    number(2),
+						TaxRate:     number(19),
+						Total:       eur(10000),
+						UnitPrice:   &model.Price{Units: 5000, Scale: 2, Currency: "EUR"},
+					},
+					{
+						Position:    2,
+						Description: "Streusalz",
+						Quantity:    number(40),
+						TaxRate:     number(7),
+						Total:       eur(10000),
+						UnitPrice:   &model.Price{Units: 250, Scale: 2, Currency: "EUR"},
+					},
+				},
+				Seller: Party{
+					// the trading name is preferred over the registration name
+					Name:    "Werkstatt Nord",
+					Address: "Hafenweg 7, Halle 2, 20457 Hamburg, DE",
+					VATID:   "DE987654321",
+					IBAN:    "DE02120300000000202051",
+					BIC:     "BYLADEM1001",
+					Email:   "rechnung@werkstatt.de",
+				},
+			},
+		},
+		{
+			name:    "credit note",
+			content: testCreditNote,
+			want: &Invoice{
+				Format:   FormatUBL,
+				Profile:  "urn:cen.eu:en16931:2017#compliant#urn:fdc:peppol.eu:2017:poacc:billing:3.0",
+				Number:   "GS-9",
+				Date:     date(2024, time.April, 2),
+				Currency: "CHF",
+				Amount:   chf(10810),
+				// the tax total in the accounting currency is skipped
+				NetAmount:    chf(10000),
+				TaxAmount:    chf(810),
+				TaxBreakdown: []model.TaxLine{{Rate: 8.1, Net: chf(10000), Tax: chf(810)}},
+				LineItems: []model.LineItem{
+					{
+						Position:    1,
+						Description: "Rücknahme Leihgeräte",
+						Quantity:    number(4),
+						Total:       chf(10000),
+						UnitPrice:   &model.Price{Units: 2500, Scale: 2, Currency: "CHF"},
+					},
+				},
+				Seller: Party{
+					Name:    "Alpen AG",
+					Address: "Bahnhofstrasse 3, 8001 Zürich, CH",
+					Email:   "buchhaltung@alpen.ch",
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		got, err := Parse([]byte(test.content))
+		if err != nil {
+			t.Errorf("Parse(%s) error = %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%s) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseUBLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown currency", strings.Replace(testUBL, "<cbc:DocumentCurrencyCode>EUR", "<cbc:DocumentCurrencyCode>", 1)},
+		{"invalid issue date", strings.Replace(testUBL, "<cbc:IssueDate>2024-03-01", "<cbc:IssueDate>01.03.2024", 1)},
+		{"invalid due date", strings.Replace(testUBL, "<cbc:PaymentDueDate>2024-03-31", "<cbc:PaymentDueDate>2024-02-30", 1)},
+		{"too many decimals", strings.Replace(testUBL, `"EUR">226.00</cbc:TaxInclusiveAmount>`, `"EUR">226.005</cbc:TaxInclusiveAmount>`, 1)},
+		{"invalid tax rate", strings.Replace(testUBL, "<cbc:Percent>7</cbc:Percent>", "<cbc:Percent>7%</cbc:Percent>", 1)},
+	}
+	for _, test := range tests {
+		if got, err := Parse([]byte(test.content)); err == nil {
+			t.Errorf("Parse(%s) = %+v, want error", test.name, got)
+		}
+	}
+}
+
+func TestSkontoTerms(t *testing.T) {
+	tests := []struct {
+		text    string
+		date    *time.Time
+		dueDate *time.Time
+		want    *model.PaymentTerms
+	}{
+		{"#SKONTO#TAGE=14#PROZENT=2.00#", date(2024, time.March, 1), date(2024, time.March, 31), &model.PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 14}},
+		{"Zahlbar bis 31.03.\n#SKONTO#TAGE=7#PROZENT=3#\n", date(2024, time.March, 1), date(2024, time.March, 31), &model.PaymentTerms{NetDays: 30, DiscountPercent: 3, DiscountDays: 7}},
+		{"#SKONTO#TAGE=30#PROZENT=1.5#", date(2024, time.March, 1), date(2024, time.March, 31), &model.PaymentTerms{NetDays: 30, DiscountPercent: 1.5, DiscountDays: 30}},
+		// the discount days exceed the net days
+		{"#SKONTO#TAGE=31#PROZENT=2.00#", date(2024, time.March, 1), date(2024, time.March, 31), nil},
+		{"#SKONTO#TAGE=14#PROZENT=0.00#", date(2024, time.March, 1), date(2024, time.March, 31), nil},
+		{"#SKONTO#TAGE=14#PROZENT=100#", date(2024, time.March, 1), date(2024, time.March, 31), nil},
+		{"#SKONTO#TAGE=14#PROZENT=2.00#", nil, date(2024, time.March, 31), nil},
+		{"#SKONTO#TAGE=14#PROZENT=2.00#", date(2024, time.March, 1), nil, nil},
+		{"#SKONTO#TAGE=14#PROZENT=2.00#", date(2024, time.March, 31), date(2024, time.March, 1), nil},
+		{"2% Skonto innerhalb von 14 Tagen", date(2024, time.March, 1), date(2024, time.March, 31), nil},
+		{"#SKONTO#TAGE=14#PROZENT=2,00#", date(2024, time.March, 1), date(2024, time.March, 31), nil},
+	}
+	for _, test := range tests {
+		got := skontoTerms(test.text, test.date, test.dueDate)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("skontoTerms(%q, %v, %v) = %v, want %v", test.text, test.date, test.dueDate, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// commandTimeout bounds every IMAP command, fetching a large message included
+	commandTimeout = 2 * time.Minute
+	// maxMessageSize is the max size of a fetched message, attachments are base64 encoded and a third larger
+	maxMessageSize = 50 * 1024 * 1024
+)
+
+var ErrIMAP = errors.New("IMAP error")
+
+// IMAPConfig is the folder of an IMAP account polled for invoices
+type IMAPConfig struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	Folder   string // defaults to INBOX
+	// PlainText connects without TLS, only meant for local servers such as test stand-ins
+	PlainText bool
+}
+
+// IMAPMailbox reads the unseen messages of an IMAP folder. Messages are marked as seen once they are handled, so that
+// every message is handled once even when the mailbox is read by people as well
+type IMAPMailbox struct {
+	config IMAPConfig
+}
+
+func NewIMAPMailbox(config IMAPConfig) *IMAPMailbox {
+	if config.Folder == "" {
+		config.Folder = "INBOX"
+	}
+	return &IMAPMailbox{config: config}
+}
+
+// Poll passes the unseen messages to handle, oldest first. Messages handle returns true for are marked as seen, the
+// others are passed again on the next poll
+func (m *IMAPMailbox) Poll(ctx context.Context, handle func(content []byte) bool) error {
+	client, err := dialIMAP(ctx, m.config)
+	if err != nil {
+		return err
+	}
+	defer client.close()
+
+	if _, err = client.command(ctx, "LOGIN %s %s", quote(m.config.Username), quote(m.config.Password)); err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	if _, err = client.command(ctx, "SELECT %s", quote(m.config.Folder)); err != nil {
+		return fmt.Errorf("failed to select %s: %w", m.config.Folder, err)
+	}
+
+	responses, err := client.command(ctx, "UID SEARCH UNSEEN")
+	if err != nil {
+		return fmt.Errorf("failed to search unseen messages: %w", err)
+	}
+	var uids []uint64
+	for _, response := range responses {
+		if fields := strings.Fields(response.line); len(fields) >= 2 && strings.EqualFold(fields[1], "SEARCH") {
+			for _, field := range fields[2:] {
+				if uid, err := strconv.ParseUint(field, 10, 32); err == nil {
+					uids = append(uids, uid)
+				}
+			}
+		}
+	}
+
+	for _, uid := range uids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// PEEK leaves the message unseen until it is handled
+		responses, err := client.command(ctx, "UID FETCH %d BODY.PEEK[]", uid)
+		if err != nil {
+			return fmt.Errorf("failed to fetch message %d: %w", uid, err)
+		}
+		var content []byte
+		for _, response := range responses {
+			if len(response.literals) > 0 {
+				content = response.literals[0]
+				break
+			}
+		}
+		if content == nil || !handle(content) {
+			continue
+		}
+		if _, err = client.command(ctx, "UID STORE %d +FLAGS.SILENT (\\Seen)", uid); err != nil {
+			return fmt.Errorf("failed to mark message %d as seen: %w", uid, err)
+		}
+	}
+
+	_, err = client.command(ctx, "LOGOUT")
+	return err
+}
+
+// imapClient speaks just enough IMAP4rev1 to read messages
+type imapClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	tag    int
+}
+
+// imapResponse is an untagged response line, with the literals it contains
+type imapResponse struct {
+	line     string
+	literals [][]byte
+}
+
+func dialIMAP(ctx context.Context, config IMAPConfig) (*imapClient, error) {
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if config.PlainText {
+		conn, err = dialer.DialContext(ctx, "tcp", config.Addr)
+	} else {
+		host, _, _ := net.SplitHostPort(config.Addr)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", config.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to connect to %s: %w", ErrIMAP, config.Addr, err)
+	}
+
+	client := &imapClient{conn: conn, reader: bufio.NewReader(conn)}
+	client.setDeadline(ctx)
+	greeting, err := client.readResponse()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrIMAP, err)
+	}
+	if !strings.HasPrefix(strings.ToUpper(greeting.line), "* OK") {
+		conn.Close()
+		return nil, fmt.Errorf("%w: unexpected greeting %q", ErrIMAP, greeting.line)
+	}
+	return client, nil
+}
+
+func (c *imapClient) close() {
+	c.conn.Close()
+}
+
+func (c *imapClient) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(commandTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	c.conn.SetDeadline(deadline)
+}
+
+// command sends a command and returns its untagged responses, or an error if it does not complete with OK
+func (c *imapClient) command(ctx context.Context, format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := "A" + strconv.Itoa(c.tag)
+	c.setDeadline(ctx)
+	// a canceled context interrupts the command rather than waiting for the deadline
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, fmt.Sprintf(format, args...)); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIMAP, err)
+	}
+
+	var responses []imapResponse
+	for {
+		response, err := c.readResponse()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrIMAP, err)
+		}
+		if !strings.HasPrefix(response.line, tag+" ") {
+			responses = append(responses, response)
+			continue
+		}
+
+		status := strings.TrimPrefix(response.line, tag+" ")
+		if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+			return responses, fmt.Errorf("%w: %s", ErrIMAP, status)
+		}
+		return responses, nil
+	}
+}
+
+// literalLength matches the announcement of a literal at the end of a line, e.g. "BODY[] {1234}"
+var literalLength = regexp.MustCompile(`\{(\d+)\}$`)
+
+// readResponse reads a response line, along with the literals it contains and the rest of the line after them
+func (c *imapClient) readResponse() (imapResponse, error) {
+	var response imapResponse
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return response, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		response.line += line
+
+		m := literalLength.FindStringSubmatch(line)
+		if m == nil {
+			return response, nil
+		}
+		length, err := strconv.Atoi(m[1])
+		if err != nil || length > maxMessageSize {
+			return response, fmt.Errorf("literal of %s bytes is too large", m[1])
+		}
+		literal := make([]byte, length)
+		if _, err = io.ReadFull(c.reader, literal); err != nil {
+			return response, err
+		}
+		response.literals = append(response.literals, literal)
+	}
+}
+
+// quote formats a string as an IMAP quoted string
+func quote(value string) string {
+	value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,195 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// imapStandIn is an IMAP server holding one folder of messages, speaking the commands IMAPMailbox uses
+type imapStandIn struct {
+	listener net.Listener
+	username string
+	password string
+
+	mu       sync.Mutex
+	messages map[uint64]string // by UID
+	seen     map[uint64]bool
+	commands []string
+}
+
+func newIMAPStandIn(t *testing.T, messages map[uint64]string) *imapStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on localhost: %v", err)
+	}
+	server := &imapStandIn{
+		listener: listener,
+		username: "invoices@example.com",
+		password: `pa"ss\word`,
+		messages: messages,
+		seen:     make(map[uint64]bool),
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *imapStandIn) config() IMAPConfig {
+	return IMAPConfig{Addr: s.listener.Addr().String(), Username: s.username, Password: s.password, PlainText: true}
+}
+
+func (s *imapStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK IMAP4rev1 stand-in ready\r\n")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		tag, command, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		s.mu.Lock()
+		s.commands = append(s.commands, command)
+		s.mu.Unlock()
+
+		fields := strings.Fields(command)
+		switch {
+		case fields[0] == "LOGIN":
+			if command != "LOGIN "+quote(s.username)+" "+quote(s.password) {
+				fmt.Fprintf(conn, "%s NO [AUTHENTICATIONFAILED] Invalid credentials\r\n", tag)
+				continue
+			}
+			fmt.Fprintf(conn, "%s OK LOGIN completed\r\n", tag)
+		case fields[0] == "SELECT":
+			fmt.Fprintf(conn, "* %d EXISTS\r\n%s OK [READ-WRITE] SELECT completed\r\n", len(s.messages), tag)
+		case command == "UID SEARCH UNSEEN":
+			s.mu.Lock()
+			var unseen []string
+			for _, uid := range slices.Sorted(maps.Keys(s.messages)) {
+				if !s.seen[uid] {
+					unseen = append(unseen, strconv.FormatUint(uid, 10))
+				}
+			}
+			s.mu.Unlock()
+			fmt.Fprintf(conn, "* SEARCH %s\r\n%s OK SEARCH completed\r\n", strings.Join(unseen, " "), tag)
+		case len(fields) == 4 && fields[1] == "FETCH" && fields[3] == "BODY.PEEK[]":
+			uid, _ := strconv.ParseUint(fields[2], 10, 64)
+			message := s.messages[uid]
+			fmt.Fprintf(conn, "* 1 FETCH (UID %d BODY[] {%d}\r\n%s FLAGS ())\r\n%s OK FETCH completed\r\n",
+				uid, len(message), message, tag)
+		case len(fields) == 5 && fields[1] == "STORE" && fields[3] == "+FLAGS.SILENT" && fields[4] == `(\Seen)`:
+			uid, _ := strconv.ParseUint(fields[2], 10, 64)
+			s.mu.Lock()
+			s.seen[uid] = true
+			s.mu.Unlock()
+			fmt.Fprintf(conn, "%s OK STORE completed\r\n", tag)
+		case command == "LOGOUT":
+			fmt.Fprintf(conn, "* BYE\r\n%s OK LOGOUT completed\r\n", tag)
+			return
+		default:
+			fmt.Fprintf(conn, "%s BAD unknown command\r\n", tag)
+		}
+	}
+}
+
+func TestIMAPMailboxPoll(t *testing.T) {
+	messages := map[uint64]string{
+		3: "Subject: first\r\n\r\nBody with a line break\r\n",
+		7: "Subject: second\r\n\r\n",
+		9: "Subject: third\r\n\r\n{12}\r\n",
+	}
+	server := newIMAPStandIn(t, messages)
+	mailbox := NewIMAPMailbox(server.config())
+
+	// messages that are not handled stay unseen and are passed again
+	var polled []string
+	err := mailbox.Poll(context.Background(), func(content []byte) bool {
+		polled = append(polled, string(content))
+		return string(content) != messages[7]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(polled, []string{messages[3], messages[7], messages[9]}) {
+		t.Errorf("first poll = %q, want all messages in order", polled)
+	}
+	server.mu.Lock()
+	if !server.seen[3] || server.seen[7] || !server.seen[9] {
+		t.Errorf("seen = %v, want the handled messages", server.seen)
+	}
+	server.mu.Unlock()
+
+	polled = nil
+	if err = mailbox.Poll(context.Background(), func(content []byte) bool {
+		polled = append(polled, string(content))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(polled, []string{messages[7]}) {
+		t.Errorf("second poll = %q, want the unhandled message", polled)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if !slices.Contains(server.commands, `SELECT "INBOX"`) {
+		t.Errorf("commands = %q, want INBOX selected", server.commands)
+	}
+	for _, command := range server.commands {
+		if strings.Contains(command, "FETCH") && !strings.Contains(command, "PEEK") {
+			t.Errorf("command %q marks messages as seen before they are handled", command)
+		}
+	}
+}
+
+func TestIMAPMailboxLoginFailed(t *testing.T) {
+	server := newIMAPStandIn(t, map[uint64]string{1: "Subject: first\r\n\r\n"})
+	config := server.config()
+	config.Password = "wrong"
+
+	err := NewIMAPMailbox(config).Poll(context.Background(), func(content []byte) bool {
+		t.Error("a message was passed without logging in")
+		return true
+	})
+	if !errors.Is(err, ErrIMAP) || !strings.Contains(err.Error(), "AUTHENTICATIONFAILED") {
+		t.Errorf("Poll = %v, want the login failure", err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"INBOX", `"INBOX"`},
+		{`Rech"nungen`, `"Rech\"nungen"`},
+		{`back\slash`, `"back\\slash"`},
+		{"line\r\nbreak", `"linebreak"`},
+	}
+	for _, test := range tests {
+		if got := quote(test.value); got != test.want {
+			t.Errorf("quote(%q) = %s, want %s", test.value, got, test.want)
+		}
+	}
+}
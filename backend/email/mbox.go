@@ -0,0 +1,40 @@
+package email
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// escapedFrom matches the lines of message bodies that start with "From ", escaped as ">From " in mbox files
+var escapedFrom = regexp.MustCompile(`(?m)^>(>*From )`)
+
+// SplitMbox splits an mbox file into its messages. Each message starts with a "From " line, which is dropped, and
+// ">From " lines of the bodies are unescaped as in the mboxrd format
+func SplitMbox(content []byte) [][]byte {
+	content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+
+	var messages [][]byte
+	var current []byte
+	started := false
+	flush := func() {
+		if started && len(bytes.TrimSpace(current)) > 0 {
+			messages = append(messages, escapedFrom.ReplaceAll(current, []byte("$1")))
+		}
+		current = nil
+	}
+
+	previousBlank := true
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		// "From " lines separate messages only after a blank line or at the start of the file
+		if previousBlank && bytes.HasPrefix(line, []byte("From ")) {
+			flush()
+			started = true
+		} else if started {
+			current = append(current, line...)
+		}
+		previousBlank = len(bytes.TrimRight(line, "\n")) == 0
+	}
+	flush()
+
+	return messages
+}
@@ -0,0 +1,194 @@
+// Package email reads invoices sent as email attachments: single messages, mbox files and IMAP folders
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxDepth is how deep multiparts and attached messages are read, forwarded emails nest one level per forward
+const maxDepth = 10
+
+var ErrInvalidMessage = errors.New("invalid email message")
+
+// Message holds the headers of an email that are kept as the provenance of its invoices, along with its attachments
+type Message struct {
+	From        string // e.g. "Acme GmbH <billing@acme.example>"
+	Subject     string
+	MessageID   string // without the angle brackets
+	Date        *time.Time
+	Attachments []Attachment
+}
+
+// Attachment is a file attached to an email, attachments of attached emails included
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+var wordDecoder = &mime.WordDecoder{}
+
+// Parse reads an email in the RFC 5322 format, as saved to .eml files
+func Parse(content []byte) (*Message, error) {
+	message, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	parsed := &Message{
+		From:      decodeAddress(message.Header.Get("From")),
+		Subject:   decodeHeader(message.Header.Get("Subject")),
+		MessageID: strings.Trim(strings.TrimSpace(message.Header.Get("Message-Id")), "<>"),
+	}
+	if date, err := message.Header.Date(); err == nil {
+		parsed.Date = &date
+	}
+
+	header := textproto.MIMEHeader(message.Header)
+	if parsed.Attachments, err = attachments(header, message.Body, 0); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+	return parsed, nil
+}
+
+// attachments returns the attachments of a part of a message, the message itself included
+func attachments(header textproto.MIMEHeader, body io.Reader, depth int) ([]Attachment, error) {
+	if depth > maxDepth {
+		return nil, errors.New("too deeply nested")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		// the default of RFC 2045
+		mediaType, params = "text/plain", nil
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		reader := multipart.NewReader(body, params["boundary"])
+		var found []Attachment
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return found, nil
+			}
+			if err != nil {
+				return found, err
+			}
+			partAttachments, err := attachments(part.Header, part, depth+1)
+			if err != nil {
+				return found, err
+			}
+			found = append(found, partAttachments...)
+		}
+	case mediaType == "message/rfc822":
+		// forwarded emails come as attachments, the invoice is attached to them
+		message, err := mail.ReadMessage(decode(header, body))
+		if err != nil {
+			return nil, err
+		}
+		return attachments(textproto.MIMEHeader(message.Header), message.Body, depth+1)
+	}
+
+	filename := attachmentName(header, params)
+	if filename == "" {
+		// the text of the message
+		return nil, nil
+	}
+	content, err := io.ReadAll(decode(header, body))
+	if err != nil {
+		return nil, fmt.Errorf("attachment %s: %w", filename, err)
+	}
+	return []Attachment{{Filename: filename, ContentType: mediaType, Content: content}}, nil
+}
+
+// attachmentName returns the file name of a part, empty if it has none. Parts without one are the text of the message
+func attachmentName(header textproto.MIMEHeader, contentTypeParams map[string]string) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = contentTypeParams["name"]
+	}
+	if name == "" {
+		return ""
+	}
+
+	// some mail clients encode the names as headers rather than the way of RFC 2231, and send the path along
+	name = path.Base(strings.ReplaceAll(decodeHeader(name), "\\", "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// decode undoes the transfer encoding of a part
+func decode(header textproto.MIMEHeader, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &base64Cleaner{reader: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// base64Cleaner drops the characters that are not base64 but still show up in encoded attachments, such as spaces
+// at the ends of lines. Line breaks are skipped by the decoder itself
+type base64Cleaner struct {
+	reader io.Reader
+}
+
+func (c *base64Cleaner) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	kept := 0
+	for _, b := range p[:n] {
+		if b == ' ' || b == '\t' {
+			continue
+		}
+		p[kept] = b
+		kept++
+	}
+	if kept == 0 && n > 0 && err == nil {
+		return c.Read(p)
+	}
+	return kept, err
+}
+
+// decodeHeader decodes the encoded words of a header, e.g. =?UTF-8?B?...?=. Headers in charsets that cannot be
+// decoded are returned as they are
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(decoded)
+}
+
+// decodeAddress formats the address of a From header as "name <address>", or returns the header as it is if it is not
+// a valid address
+func decodeAddress(value string) string {
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	address, err := parser.Parse(value)
+	if err != nil {
+		return decodeHeader(value)
+	}
+	if address.Name == "" {
+		return address.Address
+	}
+	return address.Name + " <" + address.Address + ">"
+}
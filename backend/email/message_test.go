@@ -0,0 +1,159 @@
+package email
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// lines are joined with CRLF as on the wire
+	message := func(lines ...string) []byte {
+		return []byte(strings.Join(lines, "\r\n"))
+	}
+
+	tests := []struct {
+		name        string
+		content     []byte
+		from        string
+		subject     string
+		attachments []Attachment
+	}{
+		{
+			name: "text only",
+			content: message(
+				"From: billing@acme.example",
+				"Subject: Your invoice",
+				"",
+				"See you next month",
+			),
+			from:    "billing@acme.example",
+			subject: "Your invoice",
+		},
+		{
+			name: "base64 attachment with encoded headers",
+			content: message(
+				"From: =?UTF-8?Q?M=C3=BCller_GmbH?= <rechnung@mueller.example>",
+				"Subject: =?UTF-8?B?UmVjaG51bmcgTcOkcno=?=",
+				"MIME-Version: 1.0",
+				`Content-Type: multipart/mixed; boundary="b1"`,
+				"",
+				"--b1",
+				"Content-Type: text/plain",
+				"",
+				"Anbei die Rechnung",
+				"--b1",
+				`Content-Type: application/pdf; name="ignored.pdf"`,
+				`Content-Disposition: attachment; filename="=?UTF-8?Q?Rechnung_M=C3=A4rz.pdf?="`,
+				"Content-Transfer-Encoding: base64",
+				"",
+				"JVBERi0x ",
+				"LjQK",
+				"--b1--",
+			),
+			from:        "Müller GmbH <rechnung@mueller.example>",
+			subject:     "Rechnung März",
+			attachments: []Attachment{{Filename: "Rechnung März.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.4\n")}},
+		},
+		{
+			name: "forwarded message with a path in the name",
+			content: message(
+				"From: Me <me@example.com>",
+				"Subject: Fwd: invoice",
+				`Content-Type: multipart/mixed; boundary="outer"`,
+				"",
+				"--outer",
+				"Content-Type: message/rfc822",
+				"",
+				"From: billing@acme.example",
+				`Content-Type: multipart/mixed; boundary="inner"`,
+				"",
+				"--inner",
+				`Content-Type: text/xml; name="C:\invoices\invoice.xml"`,
+				"Content-Transfer-Encoding: quoted-printable",
+				"",
+				"<Invoice id=3D\"1\"/>",
+				"--inner--",
+				"--outer--",
+			),
+			from:        "Me <me@example.com>",
+			subject:     "Fwd: invoice",
+			attachments: []Attachment{{Filename: "invoice.xml", ContentType: "text/xml", Content: []byte(`<Invoice id="1"/>`)}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := Parse(test.content)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if parsed.From != test.from || parsed.Subject != test.subject {
+				t.Errorf("From, Subject = %q, %q, want %q, %q", parsed.From, parsed.Subject, test.from, test.subject)
+			}
+			if !reflect.DeepEqual(parsed.Attachments, test.attachments) {
+				t.Errorf("attachments = %+v, want %+v", parsed.Attachments, test.attachments)
+			}
+		})
+	}
+}
+
+func TestParseProvenance(t *testing.T) {
+	parsed, err := Parse([]byte("Message-ID: <a1@mail.example>\r\nDate: Fri, 01 Mar 2024 10:00:00 +0100\r\n\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.MessageID != "a1@mail.example" {
+		t.Errorf("MessageID = %q, want it without brackets", parsed.MessageID)
+	}
+	if want := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC); parsed.Date == nil || !parsed.Date.Equal(want) {
+		t.Errorf("Date = %v, want %v", parsed.Date, want)
+	}
+
+	if _, err = Parse([]byte("not a header\r\n")); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("Parse = %v, want ErrInvalidMessage", err)
+	}
+}
+
+func TestSplitMbox(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", nil},
+		{"no separator", "Subject: a\n\nbody\n", nil},
+		{
+			name:    "two messages",
+			content: "From a@example.com Fri Mar  1 10:00:00 2024\nSubject: a\n\nfirst\n\nFrom b@example.com Fri Mar  1 11:00:00 2024\nSubject: b\n\nsecond\n",
+			want:    []string{"Subject: a\n\nfirst\n\n", "Subject: b\n\nsecond\n"},
+		},
+		{
+			name:    "CRLF line breaks",
+			content: "From a@example.com\r\nSubject: a\r\n\r\nfirst\r\n",
+			want:    []string{"Subject: a\n\nfirst\n"},
+		},
+		{
+			name:    "From in a body",
+			content: "From a@example.com\nSubject: a\n\nquoted\nFrom here on\n>From the escaped line\n>>From twice\n",
+			want:    []string{"Subject: a\n\nquoted\nFrom here on\nFrom the escaped line\n>From twice\n"},
+		},
+		{
+			name:    "empty message",
+			content: "From a@example.com\n\nFrom b@example.com\nSubject: b\n",
+			want:    []string{"Subject: b\n"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, message := range SplitMbox([]byte(test.content)) {
+				got = append(got, string(message))
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("SplitMbox = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
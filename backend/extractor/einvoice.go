@@ -0,0 +1,107 @@
+package extractor
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/einvoice"
+	"go.uber.org/zap"
+)
+
+// EInvoice takes the fields of structured e-invoices: the CII XML embedded in ZUGFeRD and Factur-X PDFs, and the XML
+// e-invoices uploaded as is, which are stored as a rendered PDF with the XML embedded the same way. Its fields
+// are exact, so it runs first in the chain and the heuristic extractors only look for the fields it did not find.
+// Documents without an e-invoice are left to the other extractors, as are invalid ones
+type EInvoice struct {
+	logger *zap.Logger
+}
+
+func NewEInvoice(logger *zap.Logger) *EInvoice {
+	return &EInvoice{logger: logger}
+}
+
+// einvoiceSource is the name of the EInvoice extractor
+const einvoiceSource = "einvoice"
+
+func (e *EInvoice) Name() string {
+	return einvoiceSource
+}
+
+func (e *EInvoice) Extract(_ context.Context, doc *Document, result *Result) error {
+	invoice := e.find(doc)
+	if invoice == nil {
+		return nil
+	}
+
+	if invoice.Number != "" {
+		result.SetID(invoice.Number, e.Name())
+	}
+	if invoice.Date != nil {
+		result.SetDate(*invoice.Date, e.Name())
+	}
+	result.SetCurrency(invoice.Currency, e.Name())
+	if invoice.Amount != nil {
+		result.SetAmount(*invoice.Amount, e.Name())
+	}
+	if invoice.NetAmount != nil {
+		result.SetNetAmount(*invoice.NetAmount, e.Name())
+	}
+	if invoice.TaxAmount != nil {
+		result.SetTaxAmount(*invoice.TaxAmount, e.Name())
+	}
+	if len(invoice.TaxBreakdown) > 0 {
+		result.SetTaxBreakdown(invoice.TaxBreakdown, e.Name())
+	}
+	if len(invoice.LineItems) > 0 {
+		result.SetLineItems(invoice.LineItems, e.Name())
+	}
+	if invoice.DueDate != nil {
+		result.SetDueDate(*invoice.DueDate, e.Name())
+	}
+	// the terms are stated as text, e.g. "Zahlbar innerhalb von 30 Tagen netto", unless XRechnung states a discount
+	if invoice.Terms != nil {
+		result.SetPaymentTerms(*invoice.Terms, e.Name())
+	} else if terms, ok := findPaymentTerms(nonEmptyLines(invoice.PaymentTerms)); ok {
+		result.SetPaymentTerms(terms, e.Name())
+	}
+
+	seller := invoice.Seller
+	result.SetVendorDetail(FieldVendorName, seller.Name, e.Name())
+	result.SetVendorDetail(FieldVendorAddress, seller.Address, e.Name())
+	result.SetVendorDetail(FieldVendorVATID, seller.VATID, e.Name())
+	result.SetVendorDetail(FieldVendorIBAN, seller.IBAN, e.Name())
+	result.SetVendorDetail(FieldVendorBIC, seller.BIC, e.Name())
+	result.SetVendorDetail(FieldVendorEmail, seller.Email, e.Name())
+
+	return nil
+}
+
+// find returns the e-invoice of the document, nil if it has none. The document is either an XML e-invoice itself or
+// a PDF with the XML attached
+func (e *EInvoice) find(doc *Document) *einvoice.Invoice {
+	candidates := [][]byte{doc.Content}
+	if !bytes.HasPrefix(bytes.TrimSpace(doc.Content), []byte("<")) {
+		files, err := document.EmbeddedFiles(doc.Content)
+		if err != nil {
+			e.logger.Warn("Failed to read files embedded in document", zap.String("filename", doc.Filename), zap.Error(err))
+		}
+		candidates = files
+	}
+
+	for _, candidate := range candidates {
+		invoice, err := einvoice.Parse(candidate)
+		if errors.Is(err, einvoice.ErrUnknownFormat) {
+			continue
+		}
+		if err != nil {
+			e.logger.Warn("Failed to read e-invoice, falling back to the text", zap.String("filename", doc.Filename), zap.Error(err))
+			continue
+		}
+
+		e.logger.Info("Found e-invoice", zap.String("filename", doc.Filename), zap.String("format", invoice.Format), zap.String("profile", invoice.Profile))
+		return invoice
+	}
+
+	return nil
+}
@@ -0,0 +1,420 @@
+// Package extractor finds invoice fields in uploaded documents.
+// Extractors are chained: each of them only fills in the fields the previous ones could not find
+package extractor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// Field names, as used in Result.Sources and model.Invoice.FieldSources
+const (
+	FieldID     = "id"
+	FieldDate   = "date"
+	FieldAmount = "amount"
+	// ISO 4217 code of the amounts
+	FieldCurrency = "currency"
+	// the amount before tax, the tax and the tax by rate, model.TaxLine. The amount is the gross one
+	FieldNetAmount    = "netAmount"
+	FieldTaxAmount    = "taxAmount"
+	FieldTaxBreakdown = "taxBreakdown"
+	// the positions of the invoice, model.LineItem
+	FieldLineItems = "lineItems"
+	// the due date, derived from the date and the payment terms if not found, see model.Invoice.DeriveDueDate
+	FieldDueDate      = "dueDate"
+	FieldPaymentTerms = "paymentTerms"
+
+	// Details of the issuer, used to match the invoice to a vendor
+	FieldVendorName    = "vendorName"
+	FieldVendorAddress = "vendorAddress"
+	FieldVendorVATID   = "vendorVatId"
+	FieldVendorIBAN    = "vendorIban"
+	FieldVendorEmail   = "vendorEmail"
+	// only stated by e-invoices, the other extractors do not look for it
+	FieldVendorBIC = "vendorBic"
+)
+
+// vendorFields are the vendor details in the order they are asked for
+var vendorFields = []string{FieldVendorName, FieldVendorAddress, FieldVendorVATID, FieldVendorIBAN, FieldVendorEmail}
+
+// SourceUser is the source of the fields entered by the user rather than extracted
+const SourceUser = "user"
+
+// Document is a single uploaded file along with the text extracted from it
+type Document struct {
+	Filename string
+	Content  []byte
+	Text     string
+}
+
+// Result holds the fields found in a document, nil if not found.
+// Sources maps the names of the found fields to the names of the extractors that found them
+type Result struct {
+	ID   *string
+	Date *time.Time
+	// the currency of the amounts is only known once Currency is found
+	Amount    *model.Money
+	Currency  *string
+	NetAmount *model.Money
+	TaxAmount *model.Money
+	// nil if not found
+	TaxBreakdown []model.TaxLine
+	// nil if not found, an invoice without positions has none
+	LineItems    []model.LineItem
+	DueDate      *time.Time
+	PaymentTerms *model.PaymentTerms
+	// vendor details by field name, not looked for if the invoice already has a vendor
+	Vendor      map[string]string
+	vendorKnown bool
+
+	Sources map[string]string
+}
+
+func NewResult() *Result {
+	return &Result{Vendor: make(map[string]string), Sources: make(map[string]string)}
+}
+
+// NewResultFor returns a result holding the fields the invoice already has, so that the extractors only look for
+// the missing ones. Fields without a recorded source were entered by the user
+func NewResultFor(invoice *model.Invoice) *Result {
+	result := NewResult()
+	source := func(field string) string {
+		if s, ok := invoice.FieldSources[field]; ok {
+			return s
+		}
+		return SourceUser
+	}
+
+	if invoice.ID != nil {
+		result.SetID(*invoice.ID, source(FieldID))
+	}
+	if date := invoice.Date.Time(); date != nil {
+		result.SetDate(*date, source(FieldDate))
+	}
+	if invoice.Amount != nil {
+		result.SetAmount(*invoice.Amount, source(FieldAmount))
+		if invoice.Amount.Currency != "" {
+			result.SetCurrency(invoice.Amount.Currency, source(FieldCurrency))
+		}
+	}
+	if invoice.NetAmount != nil {
+		result.SetNetAmount(*invoice.NetAmount, source(FieldNetAmount))
+	}
+	if invoice.TaxAmount != nil {
+		result.SetTaxAmount(*invoice.TaxAmount, source(FieldTaxAmount))
+	}
+	if len(invoice.TaxBreakdown) > 0 {
+		result.SetTaxBreakdown(invoice.TaxBreakdown, source(FieldTaxBreakdown))
+	}
+	if len(invoice.LineItems) > 0 {
+		result.SetLineItems(invoice.LineItems, source(FieldLineItems))
+	}
+	// derived due dates are looked for, a due date stated on the invoice replaces them
+	if dueDate := invoice.DueDate.Time(); dueDate != nil && source(FieldDueDate) != model.SourcePaymentTerms {
+		result.SetDueDate(*dueDate, source(FieldDueDate))
+	}
+	if invoice.PaymentTerms != nil {
+		result.SetPaymentTerms(*invoice.PaymentTerms, source(FieldPaymentTerms))
+	}
+	result.vendorKnown = invoice.VendorID != nil
+
+	return result
+}
+
+func (r *Result) SetID(id string, source string) {
+	if r.ID == nil {
+		r.ID = &id
+		r.Sources[FieldID] = source
+	}
+}
+
+func (r *Result) SetDate(date time.Time, source string) {
+	if r.Date == nil {
+		r.Date = &date
+		r.Sources[FieldDate] = source
+	}
+}
+
+func (r *Result) SetAmount(amount model.Money, source string) {
+	if r.Amount == nil {
+		r.Amount = &amount
+		r.Sources[FieldAmount] = source
+	}
+}
+
+// SetCurrency sets the currency, codes that are not ISO 4217 currencies are ignored
+func (r *Result) SetCurrency(code string, source string) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if r.Currency == nil && model.ValidCurrency(code) {
+		r.Currency = &code
+		r.Sources[FieldCurrency] = source
+	}
+}
+
+func (r *Result) SetNetAmount(amount model.Money, source string) {
+	if r.NetAmount == nil {
+		r.NetAmount = &amount
+		r.Sources[FieldNetAmount] = source
+	}
+}
+
+func (r *Result) SetTaxAmount(amount model.Money, source string) {
+	if r.TaxAmount == nil {
+		r.TaxAmount = &amount
+		r.Sources[FieldTaxAmount] = source
+	}
+}
+
+func (r *Result) SetTaxBreakdown(lines []model.TaxLine, source string) {
+	if r.TaxBreakdown == nil && lines != nil {
+		r.TaxBreakdown = lines
+		r.Sources[FieldTaxBreakdown] = source
+	}
+}
+
+func (r *Result) SetLineItems(items []model.LineItem, source string) {
+	if r.LineItems == nil && items != nil {
+		r.LineItems = items
+		r.Sources[FieldLineItems] = source
+	}
+}
+
+func (r *Result) SetDueDate(date time.Time, source string) {
+	if r.DueDate == nil {
+		r.DueDate = &date
+		r.Sources[FieldDueDate] = source
+	}
+}
+
+func (r *Result) SetPaymentTerms(terms model.PaymentTerms, source string) {
+	if r.PaymentTerms == nil {
+		r.PaymentTerms = &terms
+		r.Sources[FieldPaymentTerms] = source
+	}
+}
+
+// SetVendorDetail sets one of the vendor detail fields, empty values are ignored
+func (r *Result) SetVendorDetail(field string, value string, source string) {
+	value = strings.TrimSpace(value)
+	if _, ok := r.Vendor[field]; !ok && value != "" {
+		r.Vendor[field] = value
+		r.Sources[field] = source
+	}
+}
+
+// Missing returns the names of the fields that have not been found yet
+func (r *Result) Missing() []string {
+	var missing []string
+	if r.ID == nil {
+		missing = append(missing, FieldID)
+	}
+	if r.Date == nil {
+		missing = append(missing, FieldDate)
+	}
+	if r.Amount == nil {
+		missing = append(missing, FieldAmount)
+	}
+	if r.Currency == nil {
+		missing = append(missing, FieldCurrency)
+	}
+	if r.NetAmount == nil {
+		missing = append(missing, FieldNetAmount)
+	}
+	if r.TaxAmount == nil {
+		missing = append(missing, FieldTaxAmount)
+	}
+	if r.TaxBreakdown == nil {
+		missing = append(missing, FieldTaxBreakdown)
+	}
+	if r.LineItems == nil {
+		missing = append(missing, FieldLineItems)
+	}
+	if r.DueDate == nil {
+		missing = append(missing, FieldDueDate)
+	}
+	if r.PaymentTerms == nil {
+		missing = append(missing, FieldPaymentTerms)
+	}
+	if !r.vendorKnown {
+		for _, field := range vendorFields {
+			if _, ok := r.Vendor[field]; !ok {
+				missing = append(missing, field)
+			}
+		}
+	}
+	return missing
+}
+
+// VendorCandidate returns the vendor described by the vendor details found, nil if none were found
+func (r *Result) VendorCandidate() *model.Vendor {
+	if r.vendorKnown || len(r.Vendor) == 0 {
+		return nil
+	}
+
+	vendor := &model.Vendor{
+		Name:    r.Vendor[FieldVendorName],
+		Address: r.Vendor[FieldVendorAddress],
+		VATID:   r.Vendor[FieldVendorVATID],
+		Email:   r.Vendor[FieldVendorEmail],
+	}
+	// payments are only made to bank details stated by the vendor in an electronic invoice, those found in the text
+	// may be misread or planted and are only suggested
+	if r.Sources[FieldVendorIBAN] == einvoiceSource {
+		vendor.IBAN = r.Vendor[FieldVendorIBAN]
+	} else {
+		vendor.SuggestedIBAN = r.Vendor[FieldVendorIBAN]
+	}
+	if r.Sources[FieldVendorBIC] == einvoiceSource {
+		vendor.BIC = r.Vendor[FieldVendorBIC]
+	} else {
+		vendor.SuggestedBIC = r.Vendor[FieldVendorBIC]
+	}
+	return vendor
+}
+
+// ApplyTo copies the found fields into the invoice, unless the invoice already has them set. The currency is applied to
+// the amounts that do not have one yet.
+// Vendor details only have their sources recorded, the vendor itself is resolved from VendorCandidate.
+// Returns the names of the fields that were copied
+func (r *Result) ApplyTo(invoice *model.Invoice) []string {
+	if invoice.FieldSources == nil {
+		invoice.FieldSources = make(model.FieldSources)
+	}
+	var applied []string
+
+	if invoice.ID == nil && r.ID != nil {
+		invoice.ID = r.ID
+		invoice.FieldSources[FieldID] = r.Sources[FieldID]
+		applied = append(applied, FieldID)
+	}
+	if invoice.Date.IsZero() && r.Date != nil {
+		invoice.Date = model.NewFormDate(*r.Date)
+		invoice.FieldSources[FieldDate] = r.Sources[FieldDate]
+		applied = append(applied, FieldDate)
+	}
+	if invoice.Amount == nil && r.Amount != nil {
+		invoice.Amount = r.Amount
+		invoice.FieldSources[FieldAmount] = r.Sources[FieldAmount]
+		applied = append(applied, FieldAmount)
+	}
+	if r.Currency != nil && invoice.Amount != nil && invoice.Amount.Currency == "" {
+		if amount := invoice.Amount.InCurrency(*r.Currency); amount.Currency != "" {
+			invoice.Amount = &amount
+			invoice.FieldSources[FieldCurrency] = r.Sources[FieldCurrency]
+			applied = append(applied, FieldCurrency)
+		}
+	}
+	if invoice.NetAmount == nil && r.NetAmount != nil {
+		invoice.NetAmount = r.inCurrency(r.NetAmount)
+		invoice.FieldSources[FieldNetAmount] = r.Sources[FieldNetAmount]
+		applied = append(applied, FieldNetAmount)
+	}
+	if invoice.TaxAmount == nil && r.TaxAmount != nil {
+		invoice.TaxAmount = r.inCurrency(r.TaxAmount)
+		invoice.FieldSources[FieldTaxAmount] = r.Sources[FieldTaxAmount]
+		applied = append(applied, FieldTaxAmount)
+	}
+	if len(invoice.TaxBreakdown) == 0 && len(r.TaxBreakdown) > 0 {
+		invoice.TaxBreakdown = r.TaxBreakdown
+		invoice.FieldSources[FieldTaxBreakdown] = r.Sources[FieldTaxBreakdown]
+		applied = append(applied, FieldTaxBreakdown)
+		for i := range invoice.TaxBreakdown {
+			invoice.TaxBreakdown[i].Net = r.inCurrency(invoice.TaxBreakdown[i].Net)
+			invoice.TaxBreakdown[i].Tax = r.inCurrency(invoice.TaxBreakdown[i].Tax)
+		}
+	}
+	if len(invoice.LineItems) == 0 && len(r.LineItems) > 0 {
+		invoice.LineItems = r.LineItems
+		invoice.FieldSources[FieldLineItems] = r.Sources[FieldLineItems]
+		applied = append(applied, FieldLineItems)
+		for i := range invoice.LineItems {
+			invoice.LineItems[i].UnitPrice = r.priceInCurrency(invoice.LineItems[i].UnitPrice)
+			invoice.LineItems[i].Total = r.inCurrency(invoice.LineItems[i].Total)
+		}
+	}
+	if r.DueDate != nil && (invoice.DueDate.IsZero() || invoice.FieldSources[FieldDueDate] == model.SourcePaymentTerms) {
+		invoice.DueDate = model.NewFormDate(*r.DueDate)
+		invoice.FieldSources[FieldDueDate] = r.Sources[FieldDueDate]
+		applied = append(applied, FieldDueDate)
+	}
+	if invoice.PaymentTerms == nil && r.PaymentTerms != nil {
+		invoice.PaymentTerms = r.PaymentTerms
+		invoice.FieldSources[FieldPaymentTerms] = r.Sources[FieldPaymentTerms]
+		applied = append(applied, FieldPaymentTerms)
+	}
+	if invoice.VendorID == nil {
+		for field := range r.Vendor {
+			invoice.FieldSources[field] = r.Sources[field]
+		}
+	}
+
+	return applied
+}
+
+// inCurrency applies the currency found to an amount that does not have one yet
+func (r *Result) inCurrency(amount *model.Money) *model.Money {
+	if amount == nil || r.Currency == nil {
+		return amount
+	}
+	converted := amount.InCurrency(*r.Currency)
+	return &converted
+}
+
+// priceInCurrency applies the currency found to a unit price that does not have one yet
+func (r *Result) priceInCurrency(price *model.Price) *model.Price {
+	if price == nil || r.Currency == nil {
+		return price
+	}
+	converted := price.InCurrency(*r.Currency)
+	return &converted
+}
+
+// Extractor looks for invoice fields in a document.
+// Implementations must only fill in the fields that are still missing from the result
+type Extractor interface {
+	// Name identifies the extractor in the field sources
+	Name() string
+	Extract(ctx context.Context, doc *Document, result *Result) error
+}
+
+// Chain runs extractors in order until all fields are found
+type Chain struct {
+	extractors []Extractor
+
+	logger *zap.Logger
+}
+
+func NewChain(logger *zap.Logger, extractors ...Extractor) *Chain {
+	return &Chain{extractors: extractors, logger: logger}
+}
+
+func (c *Chain) Name() string {
+	return "chain"
+}
+
+// Extract runs the extractors of the chain until all fields are found. A failing extractor does not stop the chain,
+// the next one gets a chance to find the fields. The errors of all failed extractors are returned together
+func (c *Chain) Extract(ctx context.Context, doc *Document, result *Result) error {
+	var errs []error
+	for _, extractor := range c.extractors {
+		if len(result.Missing()) == 0 {
+			break
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err := extractor.Extract(ctx, doc, result); err != nil {
+			c.logger.Warn("Extractor failed", zap.String("extractor", extractor.Name()), zap.String("filename", doc.Filename), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", extractor.Name(), err))
+		}
+	}
+
+	c.logger.Info("Extracted invoice fields", zap.String("filename", doc.Filename), zap.Any("sources", result.Sources), zap.Strings("missing", result.Missing()))
+	return errors.Join(errs...)
+}
@@ -0,0 +1,27 @@
+package extractor
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"reflect"
+	"testing"
+)
+
+func TestVendorCandidateBankDetails(t *testing.T) {
+	tests := []struct {
+		source string
+		want   model.Vendor
+	}{
+		{einvoiceSource, model.Vendor{Name: "ACME", IBAN: "DE89370400440532013000", BIC: "COBADEFFXXX"}},
+		{"llm", model.Vendor{Name: "ACME", SuggestedIBAN: "DE89370400440532013000", SuggestedBIC: "COBADEFFXXX"}},
+		{"rules", model.Vendor{Name: "ACME", SuggestedIBAN: "DE89370400440532013000", SuggestedBIC: "COBADEFFXXX"}},
+	}
+	for _, test := range tests {
+		result := NewResult()
+		result.SetVendorDetail(FieldVendorName, "ACME", test.source)
+		result.SetVendorDetail(FieldVendorIBAN, "DE89370400440532013000", test.source)
+		result.SetVendorDetail(FieldVendorBIC, "COBADEFFXXX", test.source)
+		if got := result.VendorCandidate(); got == nil || !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("VendorCandidate of %s = %+v, want %+v", test.source, got, test.want)
+		}
+	}
+}
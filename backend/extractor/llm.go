@@ -0,0 +1,263 @@
+package extractor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/tmc/langchaingo/llms"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+const (
+	llmPromptTemplate = `Extract %s from the following text. Fields are optional, set to null if not found in text. Your answer MUST contain ONLY a JSON response of a following format:
+	{
+%s
+	}
+
+	Text: %s`
+)
+
+// llmFields describes the fields the LLM can be asked for: how to name them in the prompt and an example value
+var llmFields = map[string]struct {
+	description string
+	example     string
+}{
+	FieldID:        {`the invoice number (aliased as "id")`, `"123456"`},
+	FieldDate:      {`date (formatted YYYY-MM-DD)`, `"2021-01-01"`},
+	FieldAmount:    {`total amount`, `"123.45"`},
+	FieldCurrency:  {`the currency of the amounts (ISO 4217 code)`, `"EUR"`},
+	FieldNetAmount: {`the net amount (before tax)`, `"103.74"`},
+	FieldTaxAmount: {`the total tax amount`, `"19.71"`},
+	FieldTaxBreakdown: {
+		`the VAT breakdown by rate (rates in percent, an empty list if no tax is charged)`,
+		`[{"rate": 19, "net": "103.74", "tax": "19.71"}]`,
+	},
+	FieldDueDate: {`the due date of the payment (formatted YYYY-MM-DD)`, `"2021-01-31"`},
+	FieldPaymentTerms: {
+		`the payment terms (days to pay within counted from the invoice date, and the discount for paying early if any)`,
+		`{"netDays": 30, "discountPercent": 2, "discountDays": 10}`,
+	},
+	FieldLineItems: {
+		`the line items (net line totals, tax rates in percent, an empty list if there are none)`,
+		`[{"description": "Consulting", "quantity": 2, "unitPrice": "50.00", "taxRate": 19, "total": "100.00"}]`,
+	},
+
+	FieldVendorName:    {`the name of the company that issued the invoice (the seller, not the customer)`, `"ACME GmbH"`},
+	FieldVendorAddress: {`the postal address of the issuer in a single line`, `"Hauptstr. 1, 10115 Berlin, Germany"`},
+	FieldVendorVATID:   {`the VAT ID of the issuer`, `"DE123456789"`},
+	FieldVendorIBAN:    {`the IBAN of the issuer's bank account`, `"DE89370400440532013000"`},
+	FieldVendorEmail:   {`the email address of the issuer`, `"billing@acme.example"`},
+}
+
+// ErrLLM is wrapped by all errors of the LLM extractor
+var ErrLLM = errors.New("LLM extraction failed")
+
+// llmResponse is the JSON object the LLM is asked to answer with
+type llmResponse struct {
+	ID       *string    `json:"id"`
+	Date     *string    `json:"date"`
+	Amount   *llmNumber `json:"amount"`
+	Currency *string    `json:"currency"`
+
+	NetAmount    *llmNumber `json:"netAmount"`
+	TaxAmount    *llmNumber `json:"taxAmount"`
+	TaxBreakdown []struct {
+		Rate *float64   `json:"rate"`
+		Net  *llmNumber `json:"net"`
+		Tax  *llmNumber `json:"tax"`
+	} `json:"taxBreakdown"`
+
+	DueDate      *string             `json:"dueDate"`
+	PaymentTerms *model.PaymentTerms `json:"paymentTerms"`
+
+	LineItems []struct {
+		Description string     `json:"description"`
+		Quantity    *float64   `json:"quantity"`
+		UnitPrice   *llmNumber `json:"unitPrice"`
+		TaxRate     *float64   `json:"taxRate"`
+		Total       *llmNumber `json:"total"`
+	} `json:"lineItems"`
+
+	VendorName    *string `json:"vendorName"`
+	VendorAddress *string `json:"vendorAddress"`
+	VendorVATID   *string `json:"vendorVatId"`
+	VendorIBAN    *string `json:"vendorIban"`
+	VendorEmail   *string `json:"vendorEmail"`
+}
+
+// llmNumber is a decimal the LLM may answer with either as a JSON number or as a string, kept as text so that
+// amounts are parsed exactly
+type llmNumber string
+
+func (n *llmNumber) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err != nil {
+		return err
+	}
+	*n = llmNumber(number)
+	return nil
+}
+
+// LLM asks a language model for the fields the previous extractors could not find
+type LLM struct {
+	model llms.Model
+
+	logger *zap.Logger
+}
+
+func NewLLM(model llms.Model, logger *zap.Logger) *LLM {
+	return &LLM{model: model, logger: logger}
+}
+
+func (l *LLM) Name() string {
+	return "llm"
+}
+
+func (l *LLM) Extract(ctx context.Context, doc *Document, result *Result) error {
+	missing := result.Missing()
+	if len(missing) == 0 {
+		return nil
+	}
+
+	descriptions := make([]string, 0, len(missing))
+	examples := make([]string, 0, len(missing))
+	for _, field := range missing {
+		descriptions = append(descriptions, llmFields[field].description)
+		examples = append(examples, fmt.Sprintf("\t\t%q: %s", field, llmFields[field].example))
+	}
+	prompt := fmt.Sprintf(llmPromptTemplate, strings.Join(descriptions, ", "), strings.Join(examples, ",\n"), doc.Text)
+
+	answer, err := llms.GenerateFromSinglePrompt(ctx, l.model, prompt, llms.WithJSONMode())
+	if err != nil {
+		return fmt.Errorf("%w: failed to process text with LLM: %w", ErrLLM, err)
+	}
+	l.logger.Info("LLM response", zap.String("response", answer))
+
+	var response llmResponse
+	if err = json.Unmarshal([]byte(answer), &response); err != nil {
+		return fmt.Errorf("%w: failed to unmarshal LLM response: %w", ErrLLM, err)
+	}
+
+	if response.ID != nil && *response.ID != "" {
+		result.SetID(*response.ID, l.Name())
+	}
+	if response.Date != nil {
+		if date, err := time.Parse("2006-01-02", *response.Date); err == nil {
+			result.SetDate(date, l.Name())
+		} else {
+			l.logger.Warn("LLM returned a malformed date", zap.String("date", *response.Date))
+		}
+	}
+	if response.Currency != nil {
+		result.SetCurrency(*response.Currency, l.Name())
+	}
+	// amounts are parsed in the currency found so far, ApplyTo sets it on those parsed without one
+	currency := ""
+	if result.Currency != nil {
+		currency = *result.Currency
+	}
+	if amount := l.amount(response.Amount, currency); amount != nil {
+		result.SetAmount(*amount, l.Name())
+	}
+	if net := l.amount(response.NetAmount, currency); net != nil {
+		result.SetNetAmount(*net, l.Name())
+	}
+	if tax := l.amount(response.TaxAmount, currency); tax != nil {
+		result.SetTaxAmount(*tax, l.Name())
+	}
+	if response.TaxBreakdown != nil {
+		lines := make([]model.TaxLine, 0, len(response.TaxBreakdown))
+		for _, line := range response.TaxBreakdown {
+			if line.Rate == nil {
+				continue
+			}
+			lines = append(lines, model.TaxLine{
+				Rate: *line.Rate,
+				Net:  l.amount(line.Net, currency),
+				Tax:  l.amount(line.Tax, currency),
+			})
+		}
+		result.SetTaxBreakdown(lines, l.Name())
+	}
+	if response.DueDate != nil {
+		if dueDate, err := time.Parse("2006-01-02", *response.DueDate); err == nil {
+			result.SetDueDate(dueDate, l.Name())
+		} else {
+			l.logger.Warn("LLM returned a malformed due date", zap.String("dueDate", *response.DueDate))
+		}
+	}
+	if terms := response.PaymentTerms; terms != nil {
+		if terms.NetDays >= 0 && terms.DiscountPercent >= 0 && terms.DiscountPercent < 100 &&
+			terms.DiscountDays >= 0 && terms.DiscountDays <= terms.NetDays {
+			result.SetPaymentTerms(*terms, l.Name())
+		} else {
+			l.logger.Warn("LLM returned invalid payment terms", zap.Any("paymentTerms", terms))
+		}
+	}
+	if response.LineItems != nil {
+		items := make([]model.LineItem, 0, len(response.LineItems))
+		for _, item := range response.LineItems {
+			items = append(items, model.LineItem{
+				Description: item.Description,
+				Quantity:    item.Quantity,
+				UnitPrice:   l.price(item.UnitPrice, currency),
+				TaxRate:     item.TaxRate,
+				Total:       l.amount(item.Total, currency),
+			})
+		}
+		result.SetLineItems(items, l.Name())
+	}
+	for field, value := range map[string]*string{
+		FieldVendorName:    response.VendorName,
+		FieldVendorAddress: response.VendorAddress,
+		FieldVendorVATID:   response.VendorVATID,
+		FieldVendorEmail:   response.VendorEmail,
+	} {
+		if value != nil {
+			result.SetVendorDetail(field, *value, l.Name())
+		}
+	}
+	// a made up IBAN would send payments to the wrong account
+	if response.VendorIBAN != nil {
+		if iban := banking.NormalizeIBAN(*response.VendorIBAN); banking.ValidIBAN(iban) {
+			result.SetVendorDetail(FieldVendorIBAN, iban, l.Name())
+		} else {
+			l.logger.Warn("LLM returned an invalid IBAN", zap.String("iban", *response.VendorIBAN))
+		}
+	}
+
+	return nil
+}
+
+// amount parses an amount of the response, malformed amounts are dropped
+func (l *LLM) amount(value *llmNumber, currency string) *model.Money {
+	if value == nil {
+		return nil
+	}
+
+	amount, err := model.ParseMoney(string(*value), currency)
+	if err != nil {
+		l.logger.Warn("LLM returned a malformed amount", zap.String("amount", string(*value)), zap.Error(err))
+		return nil
+	}
+	return &amount
+}
+
+// price parses a unit price of the response, malformed prices are dropped
+func (l *LLM) price(value *llmNumber, currency string) *model.Price {
+	if value == nil {
+		return nil
+	}
+
+	price, err := model.ParsePrice(string(*value), currency)
+	if err != nil {
+		l.logger.Warn("LLM returned a malformed price", zap.String("price", string(*value)), zap.Error(err))
+		return nil
+	}
+	return &price
+}
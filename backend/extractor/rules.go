@@ -0,0 +1,342 @@
+package extractor
+
+import (
+	"context"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rules is a deterministic extractor that looks for labelled fields in common English, German and French invoice layouts.
+// A value is taken from the line of its label, or from the next non-empty line if the label stands alone.
+// Vendor details are taken from the letterhead and from values with a recognizable format, see rules_vendor.go.
+// The currency is recognized by its symbol or code, see rules_currency.go, taxes by their rates, see rules_tax.go.
+// Payment terms are read from their short form or from sentences, see rules_terms.go
+type Rules struct{}
+
+func NewRules() *Rules {
+	return &Rules{}
+}
+
+func (r *Rules) Name() string {
+	return "rules"
+}
+
+func (r *Rules) Extract(_ context.Context, doc *Document, result *Result) error {
+	lines := nonEmptyLines(doc.Text)
+
+	if id, ok := findInvoiceNumber(lines); ok {
+		result.SetID(id, r.Name())
+	}
+	if date, ok := findInvoiceDate(lines); ok {
+		result.SetDate(date, r.Name())
+	}
+	if amount, ok := findTotal(lines); ok {
+		result.SetAmount(amount, r.Name())
+	}
+	if currency, ok := findCurrency(lines); ok {
+		result.SetCurrency(currency, r.Name())
+	}
+	if net, ok := findNetAmount(lines); ok {
+		result.SetNetAmount(net, r.Name())
+	}
+	taxLines, _ := findTaxLines(lines, result.NetAmount)
+	if tax, ok := findTaxAmount(lines, taxLines); ok {
+		result.SetTaxAmount(tax, r.Name())
+	}
+	if taxLines != nil {
+		result.SetTaxBreakdown(taxLines, r.Name())
+	}
+	if dueDate, ok := findDueDate(lines); ok {
+		result.SetDueDate(dueDate, r.Name())
+	}
+	if terms, ok := findPaymentTerms(lines); ok {
+		result.SetPaymentTerms(terms, r.Name())
+	}
+
+	if name, ok := findVendorName(lines); ok {
+		result.SetVendorDetail(FieldVendorName, name, r.Name())
+	}
+	if vatID, ok := findVATID(lines); ok {
+		result.SetVendorDetail(FieldVendorVATID, vatID, r.Name())
+	}
+	if iban, ok := findIBAN(doc.Text); ok {
+		result.SetVendorDetail(FieldVendorIBAN, iban, r.Name())
+	}
+	if email, ok := findEmail(doc.Text); ok {
+		result.SetVendorDetail(FieldVendorEmail, email, r.Name())
+	}
+
+	return nil
+}
+
+var (
+	invoiceNumberLabel = regexp.MustCompile(`(?i)(?:invoice\s*(?:no\.?|number|num\.?|nr\.?|#)|inv\.?\s*(?:no\.?|#)|rechnungs?\s*-?\s*(?:nr\.?|nummer)|facture\s*(?:n\s*[°º.o]|num[ée]ro)|n\s*[°º]\s*(?:de\s*)?facture|num[ée]ro\s*de\s*facture)\s*[:#.]?\s*`)
+	// invoice numbers must contain at least one digit, so that words following the label are not taken for one
+	invoiceNumberValue = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9\-/._]*`)
+
+	invoiceDateLabel = regexp.MustCompile(`(?i)(?:invoice\s*date|date\s*of\s*(?:issue|invoice)|issue\s*date|rechnungsdatum|ausstellungsdatum|date\s*de\s*(?:la\s*)?facture|date\s*d['’]?\s*[ée]mission|date\s*de\s*[ée]mission|\bdatum\b|\bdate\b)`)
+	// lines with dates that are not the invoice date
+	otherDateLine = regexp.MustCompile(`(?i)(?:due|payable|f[äa]llig|zahlbar|[ée]ch[ée]ance|delivery|liefer|livraison|period|zeitraum|p[ée]riode|order|bestell|commande)`)
+
+	// labels of the amount to pay, in order of preference
+	totalLabels = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)(?:total|amount|balance)\s*(?:amount\s*)?due|amount\s*payable|zu\s*zahlen|zahlbetrag|net\s*[àa]\s*payer|total\s*[àa]\s*payer|montant\s*d[ûu]`),
+		regexp.MustCompile(`(?i)grand\s*total|invoice\s*total|total\s*(?:amount|incl)|gesamtbetrag|rechnungsbetrag|endbetrag|bruttobetrag|gesamtsumme|total\s*ttc|montant\s*(?:total|ttc)`),
+		regexp.MustCompile(`(?i)\btotal\b|\bsumme\b|\bbrutto\b`),
+	}
+	// lines mentioning a total that is not the amount to pay
+	otherTotalLine = regexp.MustCompile(`(?i)sub\s*-?total|zwischensumme|netto|\bnet\b|\bht\b|hors\s*taxe|discount|rabatt|remise|\bqty\b|quantity|menge|quantit[ée]`)
+	taxLine        = regexp.MustCompile(`(?i)\b(?:tax|vat|mwst|ust|tva)\b`)
+	inclusiveLine  = regexp.MustCompile(`(?i)\b(?:incl|inkl|including|inklusive|gross|brutto|ttc)\b`)
+
+	amountValue = regexp.MustCompile(`-?\d{1,3}(?:[.,'’ \x{00a0}\x{202f}]\d{3})+(?:[.,]\d{1,2})?|-?\d+(?:[.,]\d{1,2})?`)
+)
+
+func findInvoiceNumber(lines []string) (string, bool) {
+	for i, line := range lines {
+		location := invoiceNumberLabel.FindStringIndex(line)
+		if location == nil {
+			continue
+		}
+
+		candidates := []string{line[location[1]:]}
+		if i+1 < len(lines) {
+			candidates = append(candidates, lines[i+1])
+		}
+		for _, candidate := range candidates {
+			value := strings.TrimRight(invoiceNumberValue.FindString(strings.TrimSpace(candidate)), "-/._")
+			if strings.ContainsAny(value, "0123456789") {
+				return value, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+func findInvoiceDate(lines []string) (time.Time, bool) {
+	for i, line := range lines {
+		location := invoiceDateLabel.FindStringIndex(line)
+		if location == nil || otherDateLine.MatchString(line) {
+			continue
+		}
+
+		if date, ok := parseDate(line[location[1]:]); ok {
+			return date, true
+		}
+		if i+1 < len(lines) {
+			if date, ok := parseDate(lines[i+1]); ok {
+				return date, true
+			}
+		}
+	}
+
+	// no labelled date, fall back to the first date that is not a due date or similar
+	for _, line := range lines {
+		if otherDateLine.MatchString(line) {
+			continue
+		}
+		if date, ok := parseDate(line); ok {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// findTotal returns the amount to pay, its currency is found separately
+func findTotal(lines []string) (model.Money, bool) {
+	for _, label := range totalLabels {
+		found := false
+		var total model.Money
+		for i, line := range lines {
+			location := label.FindStringIndex(line)
+			if location == nil || isOtherTotal(line) {
+				continue
+			}
+
+			amount, ok := lastAmount(line[location[1]:])
+			if !ok && i+1 < len(lines) {
+				amount, ok = lastAmount(lines[i+1])
+			}
+			// the same label may be used for several totals, the amount to pay is the largest one
+			if ok && (!found || amount.Minor > total.Minor) {
+				found = true
+				total = amount
+			}
+		}
+
+		if found {
+			return total, true
+		}
+	}
+
+	return model.Money{}, false
+}
+
+// isOtherTotal reports whether the line holds a total other than the amount to pay, such as a net amount or a tax amount
+func isOtherTotal(line string) bool {
+	if totalLabels[0].MatchString(line) {
+		return false
+	}
+	if otherTotalLine.MatchString(line) {
+		return true
+	}
+	return taxLine.MatchString(line) && !inclusiveLine.MatchString(line)
+}
+
+// lastAmount returns the last amount in the text, amounts are usually right-aligned after their labels
+func lastAmount(text string) (model.Money, bool) {
+	locations := amountValue.FindAllStringIndex(text, -1)
+	for i := len(locations) - 1; i >= 0; i-- {
+		start, end := locations[i][0], locations[i][1]
+		// skip percentages, such as tax rates
+		if rest := strings.TrimSpace(text[end:]); strings.HasPrefix(rest, "%") {
+			continue
+		}
+		if amount, ok := parseAmount(text[start:end]); ok {
+			return amount, true
+		}
+	}
+
+	return model.Money{}, false
+}
+
+// parseAmount parses numbers with either "." or "," as the decimal separator, and ".", ",", "'" or spaces as the
+// thousands separator. A separator followed by one or two trailing digits is taken as the decimal separator.
+// The amount has no currency yet
+func parseAmount(text string) (model.Money, bool) {
+	text = strings.TrimSpace(text)
+	decimal := ""
+	if i := strings.LastIndexAny(text, ".,"); i >= 0 && len(text)-i-1 <= 2 {
+		decimal = text[i+1:]
+		text = text[:i]
+	}
+
+	integer := strings.Map(func(r rune) rune {
+		if r == '-' || (r >= '0' && r <= '9') {
+			return r
+		}
+		return -1
+	}, text)
+	if decimal != "" {
+		integer += "." + decimal
+	}
+
+	amount, err := model.ParseMoney(integer, "")
+	return amount, err == nil
+}
+
+var (
+	isoDate     = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	numericDate = regexp.MustCompile(`\b(\d{1,2})([./-])(\d{1,2})([./-])(\d{4}|\d{2})\b`)
+	dayMonthStr = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th|er)?\.?\s+([a-zäéû]{3,9})\.?,?\s+(\d{4})\b`)
+	monthDayStr = regexp.MustCompile(`(?i)\b([a-z]{3,9})\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+
+	monthNames = map[string]time.Month{
+		"january": time.January, "jan": time.January, "januar": time.January, "jänner": time.January, "janvier": time.January, "janv": time.January,
+		"february": time.February, "feb": time.February, "februar": time.February, "février": time.February, "fevrier": time.February, "févr": time.February, "fev": time.February,
+		"march": time.March, "mar": time.March, "märz": time.March, "maerz": time.March, "mär": time.March, "mars": time.March,
+		"april": time.April, "apr": time.April, "avril": time.April, "avr": time.April,
+		"may": time.May, "mai": time.May,
+		"june": time.June, "jun": time.June, "juni": time.June, "juin": time.June,
+		"july": time.July, "jul": time.July, "juli": time.July, "juillet": time.July, "juil": time.July,
+		"august": time.August, "aug": time.August, "août": time.August, "aout": time.August,
+		"september": time.September, "sep": time.September, "sept": time.September, "septembre": time.September,
+		"october": time.October, "oct": time.October, "oktober": time.October, "okt": time.October, "octobre": time.October,
+		"november": time.November, "nov": time.November, "novembre": time.November,
+		"december": time.December, "dec": time.December, "dezember": time.December, "dez": time.December, "décembre": time.December, "decembre": time.December, "déc": time.December,
+	}
+)
+
+// parseDate returns the first date found in the text.
+// Numeric dates are read day first, as in German and French layouts, unless that makes for an invalid date
+func parseDate(text string) (time.Time, bool) {
+	type candidate struct {
+		start int
+		date  time.Time
+	}
+	var found []candidate
+
+	if m := isoDate.FindStringSubmatchIndex(text); m != nil {
+		year, month, day := atoi(text[m[2]:m[3]]), atoi(text[m[4]:m[5]]), atoi(text[m[6]:m[7]])
+		if date, ok := makeDate(year, month, day); ok {
+			found = append(found, candidate{m[0], date})
+		}
+	}
+
+	if m := numericDate.FindStringSubmatchIndex(text); m != nil && text[m[4]:m[5]] == text[m[8]:m[9]] {
+		first, second, year := atoi(text[m[2]:m[3]]), atoi(text[m[6]:m[7]]), atoi(text[m[10]:m[11]])
+		if year < 100 {
+			year += 2000
+		}
+		date, ok := makeDate(year, second, first)
+		if !ok {
+			date, ok = makeDate(year, first, second)
+		}
+		if ok {
+			found = append(found, candidate{m[0], date})
+		}
+	}
+
+	if m := dayMonthStr.FindStringSubmatchIndex(text); m != nil {
+		if month, ok := monthNames[strings.ToLower(text[m[4]:m[5]])]; ok {
+			if date, ok := makeDate(atoi(text[m[6]:m[7]]), int(month), atoi(text[m[2]:m[3]])); ok {
+				found = append(found, candidate{m[0], date})
+			}
+		}
+	}
+
+	if m := monthDayStr.FindStringSubmatchIndex(text); m != nil {
+		if month, ok := monthNames[strings.ToLower(text[m[2]:m[3]])]; ok {
+			if date, ok := makeDate(atoi(text[m[6]:m[7]]), int(month), atoi(text[m[4]:m[5]])); ok {
+				found = append(found, candidate{m[0], date})
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return time.Time{}, false
+	}
+
+	first := found[0]
+	for _, c := range found[1:] {
+		if c.start < first.start {
+			first = c
+		}
+	}
+
+	return first.date, true
+}
+
+func makeDate(year, month, day int) (time.Time, bool) {
+	if year < 1900 || year > 2999 || month < 1 || month > 12 || day < 1 {
+		return time.Time{}, false
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	// time.Date normalizes overflowing days into the next month, which means the input was invalid
+	if date.Day() != day {
+		return time.Time{}, false
+	}
+
+	return date, true
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func nonEmptyLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
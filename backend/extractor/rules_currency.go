@@ -0,0 +1,77 @@
+package extractor
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"regexp"
+)
+
+var (
+	// ISO 4217 codes are only taken next to a number, so that words such as "ALL" or "TOP" are not taken for one
+	currencyCode = regexp.MustCompile(`\b([A-Z]{3})\s?-?\d|\d\s?([A-Z]{3})\b`)
+
+	// currency symbols, the more specific ones first. A bare "$" is taken as US dollars
+	currencySymbols = []struct {
+		pattern *regexp.Regexp
+		code    string
+	}{
+		{regexp.MustCompile(`€`), "EUR"},
+		{regexp.MustCompile(`£`), "GBP"},
+		{regexp.MustCompile(`(?i)\bS?Fr\.\s?\d|\d\s?S?Fr\.`), "CHF"},
+		{regexp.MustCompile(`\bUS\$`), "USD"},
+		{regexp.MustCompile(`\b(?:CA|C)\$`), "CAD"},
+		{regexp.MustCompile(`\b(?:AU|A)\$`), "AUD"},
+		{regexp.MustCompile(`\bNZ\$`), "NZD"},
+		{regexp.MustCompile(`\$`), "USD"},
+		{regexp.MustCompile(`¥`), "JPY"},
+		{regexp.MustCompile(`₹`), "INR"},
+		{regexp.MustCompile(`\d\s?zł`), "PLN"},
+		{regexp.MustCompile(`\d\s?Kč`), "CZK"},
+	}
+)
+
+// findCurrency returns the currency of the amount to pay. The lines of the totals are looked at first, then the whole
+// document
+func findCurrency(lines []string) (string, bool) {
+	for _, label := range totalLabels {
+		for i, line := range lines {
+			if !label.MatchString(line) || isOtherTotal(line) {
+				continue
+			}
+			if currency, ok := currencyOf(line); ok {
+				return currency, true
+			}
+			if i+1 < len(lines) {
+				if currency, ok := currencyOf(lines[i+1]); ok {
+					return currency, true
+				}
+			}
+		}
+	}
+
+	for _, line := range lines {
+		if currency, ok := currencyOf(line); ok {
+			return currency, true
+		}
+	}
+
+	return "", false
+}
+
+// currencyOf returns the currency mentioned in the text, codes are preferred over the more ambiguous symbols
+func currencyOf(text string) (string, bool) {
+	for _, match := range currencyCode.FindAllStringSubmatch(text, -1) {
+		for _, code := range match[1:] {
+			if model.ValidCurrency(code) {
+				return code, true
+			}
+		}
+	}
+
+	for _, symbol := range currencySymbols {
+		if symbol.pattern.MatchString(text) {
+			return symbol.code, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,114 @@
+package extractor
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	netAmountLabel = regexp.MustCompile(`(?i)\b(?:net\s*(?:amount|total)|total\s*(?:net|excl)|sub\s*-?total|netto(?:summe|betrag)?|zwischensumme|total\s*ht|montant\s*ht)\b`)
+	// lines with tax identifiers rather than tax amounts
+	taxIDLine = regexp.MustCompile(`(?i)tax\s*(?:id|number|no)|steuer\s*-?\s*(?:nr|nummer)|siret|siren`)
+	taxRate   = regexp.MustCompile(`(\d{1,2}(?:[.,]\d{1,2})?)\s*%`)
+)
+
+// findNetAmount returns the amount before tax
+func findNetAmount(lines []string) (model.Money, bool) {
+	for i, line := range lines {
+		location := netAmountLabel.FindStringIndex(line)
+		// a line with a rate holds the tax of that rate
+		if location == nil || taxRate.MatchString(line) {
+			continue
+		}
+
+		if amount, ok := lastAmount(line[location[1]:]); ok {
+			return amount, true
+		}
+		if i+1 < len(lines) {
+			if amount, ok := lastAmount(lines[i+1]); ok {
+				return amount, true
+			}
+		}
+	}
+
+	return model.Money{}, false
+}
+
+// findTaxLines returns the tax by rate, from the lines stating a tax rate along with a tax amount. The net amounts of
+// the rates are only known if there is a single rate, then it is the net amount of the invoice
+func findTaxLines(lines []string, net *model.Money) ([]model.TaxLine, bool) {
+	var taxLines []model.TaxLine
+	for i, line := range lines {
+		if !isTaxLine(line) {
+			continue
+		}
+		match := taxRate.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		rate, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", "."), 64)
+		if err != nil {
+			continue
+		}
+
+		amount, ok := lastAmount(line)
+		if !ok && i+1 < len(lines) {
+			amount, ok = lastAmount(lines[i+1])
+		}
+		if ok {
+			tax := amount
+			taxLines = append(taxLines, model.TaxLine{Rate: rate, Tax: &tax})
+		}
+	}
+
+	if len(taxLines) == 1 && net != nil {
+		taxLines[0].Net = net
+	}
+	return taxLines, len(taxLines) > 0
+}
+
+// findTaxAmount returns the total tax, the sum of the tax by rate if there is a breakdown, or the amount of the only
+// tax line without a rate
+func findTaxAmount(lines []string, taxLines []model.TaxLine) (model.Money, bool) {
+	if len(taxLines) > 0 {
+		total := model.Money{Currency: taxLines[0].Tax.Currency}
+		for _, line := range taxLines {
+			total.Minor += line.Tax.Minor
+		}
+		return total, true
+	}
+
+	for i, line := range lines {
+		location := taxLine.FindStringIndex(line)
+		if location == nil || !isTaxLine(line) {
+			continue
+		}
+
+		if amount, ok := lastAmount(line[location[1]:]); ok {
+			return amount, true
+		}
+		if i+1 < len(lines) {
+			if amount, ok := lastAmount(lines[i+1]); ok {
+				return amount, true
+			}
+		}
+	}
+
+	return model.Money{}, false
+}
+
+// isTaxLine reports whether the line holds a tax amount, rather than a net or gross total mentioning the tax or a tax ID
+func isTaxLine(line string) bool {
+	if !taxLine.MatchString(line) || netAmountLabel.MatchString(line) || taxIDLine.MatchString(line) || vatIDLabel.MatchString(line) {
+		return false
+	}
+	for _, label := range totalLabels[:2] {
+		if label.MatchString(line) {
+			return false
+		}
+	}
+
+	return !(inclusiveLine.MatchString(line) && totalLabels[2].MatchString(line))
+}
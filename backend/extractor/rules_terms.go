@@ -0,0 +1,125 @@
+package extractor
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	dueDateLabel = regexp.MustCompile(`(?i)(?:due\s*(?:date|on|by)|date\s*due|payment\s*due|payable\s*(?:by|until|on|before)|f[äa]llig(?:keitsdatum|\s*am|\s*bis)?|zahlbar\s*bis|zahlungsziel|[ée]ch[ée]ance|date\s*limite\s*de\s*(?:paiement|r[èe]glement)|[àa]\s*payer\s*avant)\s*[:.]?`)
+
+	// lines about paying, the only ones days are taken from
+	termsLine = regexp.MustCompile(`(?i)pay|terms|due|\bnet|\bn/|zahl|skonto|f[äa]llig|paiement|r[èe]glement|escompte`)
+	// "2/10 net 30", "2/10, n/30"
+	discountNetTerms = regexp.MustCompile(`(?i)\b(\d{1,2}(?:[.,]\d{1,2})?)\s*%?\s*/\s*(\d{1,3})\s*,?\s*(?:net|n)\s*/?\s*(\d{1,3})\b`)
+	// "net 30", "n/30", the number must not be an amount
+	netTerms  = regexp.MustCompile(`(?i)\b(?:net|n/)\s*(\d{1,3})([.,]\d)?`)
+	daysCount = regexp.MustCompile(`(?i)\b(\d{1,3})\s*(?:days?|tagen?|tage|jours)\b`)
+	// "2% Skonto", "discount of 2%"
+	discountRate     = regexp.MustCompile(`(?i)(\d{1,2}(?:[.,]\d{1,2})?)\s*%\s*(?:skonto|discount|d['’]?\s*escompte)|(?:skonto|discount|escompte)\s*(?:von|of|de)?\s*(\d{1,2}(?:[.,]\d{1,2})?)\s*%`)
+	immediatePayment = regexp.MustCompile(`(?i)due\s*(?:up)?on\s*receipt|payable\s*immediately|sofort\s*(?:zahlbar|f[äa]llig)|ohne\s*abzug\s*sofort|d[èe]s\s*r[ée]ception|[àa]\s*r[ée]ception`)
+)
+
+// findDueDate returns the date following a due date label
+func findDueDate(lines []string) (time.Time, bool) {
+	for i, line := range lines {
+		location := dueDateLabel.FindStringIndex(line)
+		if location == nil {
+			continue
+		}
+
+		if date, ok := parseDate(line[location[1]:]); ok {
+			return date, true
+		}
+		if i+1 < len(lines) {
+			if date, ok := parseDate(lines[i+1]); ok {
+				return date, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// findPaymentTerms returns the days to pay within and the discount for paying early, from either the short form
+// "2/10 net 30" or sentences such as "2% Skonto innerhalb von 10 Tagen, 30 Tage netto". Terms without net days are
+// not returned
+func findPaymentTerms(lines []string) (model.PaymentTerms, bool) {
+	for _, line := range lines {
+		if m := discountNetTerms.FindStringSubmatch(line); m != nil {
+			if percent, ok := parsePercent(m[1]); ok {
+				return model.PaymentTerms{NetDays: atoi(m[3]), DiscountPercent: percent, DiscountDays: atoi(m[2])}, true
+			}
+		}
+	}
+
+	var terms model.PaymentTerms
+	netFound := false
+	for _, line := range lines {
+		if !termsLine.MatchString(line) {
+			continue
+		}
+
+		days := daysCount.FindAllStringSubmatchIndex(line, -1)
+		if m := discountRate.FindStringSubmatchIndex(line); m != nil && !terms.HasDiscount() && len(days) > 0 {
+			group := 2
+			if m[2] < 0 {
+				group = 4
+			}
+			if percent, ok := parsePercent(line[m[group]:m[group+1]]); ok {
+				// the days closest to the rate are the ones of the discount
+				closest := 0
+				for j := range days {
+					if distance(days[j][0], m[0], m[1]) < distance(days[closest][0], m[0], m[1]) {
+						closest = j
+					}
+				}
+				terms.DiscountPercent = percent
+				terms.DiscountDays = atoi(line[days[closest][2]:days[closest][3]])
+				days = append(days[:closest], days[closest+1:]...)
+			}
+		}
+
+		if netFound {
+			continue
+		}
+		if m := netTerms.FindStringSubmatch(line); m != nil && m[2] == "" {
+			terms.NetDays, netFound = atoi(m[1]), true
+		} else if len(days) > 0 {
+			for _, d := range days {
+				terms.NetDays = max(terms.NetDays, atoi(line[d[2]:d[3]]))
+			}
+			netFound = true
+		} else if immediatePayment.MatchString(line) {
+			terms.NetDays, netFound = 0, true
+		}
+	}
+
+	if !netFound {
+		return model.PaymentTerms{}, false
+	}
+	if terms.DiscountDays > terms.NetDays {
+		terms.DiscountPercent, terms.DiscountDays = 0, 0
+	}
+	return terms, true
+}
+
+func parsePercent(value string) (float64, bool) {
+	percent, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 64)
+	return percent, err == nil && percent > 0 && percent < 100
+}
+
+// distance returns how far the position is from the range
+func distance(position, start, end int) int {
+	switch {
+	case position < start:
+		return start - position
+	case position > end:
+		return position - end
+	default:
+		return 0
+	}
+}
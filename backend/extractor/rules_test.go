@@ -0,0 +1,306 @@
+package extractor
+
+import (
+	"context"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRulesExtract(t *testing.T) {
+	money := func(minor int64) *model.Money {
+		return &model.Money{Minor: minor}
+	}
+	date := func(year int, month time.Month, day int) *time.Time {
+		d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	str := func(s string) *string {
+		return &s
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want *Result
+	}{
+		{
+			name: "english",
+			text: `ACME Ltd.
+1 Main Street, London
+VAT Reg. No: GB 123 4567 89
+Bill to: Example GmbH
+
+Invoice No: INV-2024/001
+Invoice Date: March 5th, 2024
+Due Date: 04/04/2024
+
+Subtotal          1,000.00
+VAT 20%             200.00
+Total due     £ 1,200.00
+
+Payment terms: 2/10 net 30
+IBAN: GB29 NWBK 6016 1331 9268 19
+billing@ACME.example`,
+			want: &Result{
+				ID:           str("INV-2024/001"),
+				Date:         date(2024, time.March, 5),
+				Amount:       money(120000),
+				Currency:     str("GBP"),
+				NetAmount:    money(100000),
+				TaxAmount:    money(20000),
+				TaxBreakdown: []model.TaxLine{{Rate: 20, Net: money(100000), Tax: money(20000)}},
+				DueDate:      date(2024, time.April, 4),
+				PaymentTerms: &model.PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 10},
+				Vendor: map[string]string{
+					FieldVendorName:  "ACME Ltd.",
+					FieldVendorVATID: "GB123456789",
+					FieldVendorIBAN:  "GB29NWBK60161331926819",
+					FieldVendorEmail: "billing@acme.example",
+				},
+			},
+		},
+		{
+			name: "german with two rates",
+			text: `Müller & Söhne GmbH · Hauptstr. 1 · 10115 Berlin
+An: Beispiel AG
+Rechnungsnummer
+RE-4711
+Rechnungsdatum: 01.02.2024
+
+Nettobetrag 150,00 EUR
+zzgl. 19% MwSt. 19,00 EUR
+zzgl. 7% MwSt. 3,50 EUR
+Gesamtbetrag 172,50 EUR
+
+2% Skonto innerhalb von 14 Tagen, 30 Tage netto.
+USt-IdNr.: DE 123 456 789`,
+			want: &Result{
+				ID:        str("RE-4711"),
+				Date:      date(2024, time.February, 1),
+				Amount:    money(17250),
+				Currency:  str("EUR"),
+				NetAmount: money(15000),
+				TaxAmount: money(2250),
+				TaxBreakdown: []model.TaxLine{
+					{Rate: 19, Tax: money(1900)},
+					{Rate: 7, Tax: money(350)},
+				},
+				PaymentTerms: &model.PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 14},
+				Vendor: map[string]string{
+					FieldVendorName:  "Müller & Söhne GmbH",
+					FieldVendorVATID: "DE123456789",
+				},
+			},
+		},
+		{
+			name: "french",
+			text: `Dupont SARL
+Facture N° F-2024-12
+Date de facture : 15 janvier 2024
+Total HT 1 000,00 €
+TVA 20 % 200,00 €
+Net à payer 1 200,00 €
+Paiement à réception`,
+			want: &Result{
+				ID:           str("F-2024-12"),
+				Date:         date(2024, time.January, 15),
+				Amount:       money(120000),
+				Currency:     str("EUR"),
+				NetAmount:    money(100000),
+				TaxAmount:    money(20000),
+				TaxBreakdown: []model.TaxLine{{Rate: 20, Net: money(100000), Tax: money(20000)}},
+				PaymentTerms: &model.PaymentTerms{},
+				Vendor:       map[string]string{FieldVendorName: "Dupont SARL"},
+			},
+		},
+		{
+			name: "recipient and labels without values",
+			text: `Invoice
+Bill to: Example GmbH
+Invoice number: see below
+Amount due: pending
+Thank you for your business`,
+			want: &Result{Vendor: map[string]string{}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := NewResult()
+			if err := NewRules().Extract(context.Background(), &Document{Text: test.text}, result); err != nil {
+				t.Fatal(err)
+			}
+			result.Sources = nil
+			if !reflect.DeepEqual(result, test.want) {
+				t.Errorf("Extract =\n%s\nwant\n%s", describeResult(result), describeResult(test.want))
+			}
+		})
+	}
+}
+
+// describeResult prints the fields of the result rather than the addresses of its pointers
+func describeResult(r *Result) string {
+	s := ""
+	field := func(name string, value any) {
+		s += name + ": "
+		switch v := value.(type) {
+		case *string:
+			if v != nil {
+				s += *v
+			}
+		case *time.Time:
+			if v != nil {
+				s += v.Format(time.DateOnly)
+			}
+		case *model.Money:
+			if v != nil {
+				s += v.String()
+			}
+		case *model.PaymentTerms:
+			if v != nil {
+				s += fmt.Sprintf("%+v", *v)
+			}
+		case []model.TaxLine:
+			for _, line := range v {
+				s += fmt.Sprintf("{%v%% net %v tax %v} ", line.Rate, line.Net, line.Tax)
+			}
+		default:
+			s += fmt.Sprint(v)
+		}
+		s += "\n"
+	}
+	field("id", r.ID)
+	field("date", r.Date)
+	field("amount", r.Amount)
+	field("currency", r.Currency)
+	field("net", r.NetAmount)
+	field("tax", r.TaxAmount)
+	field("breakdown", r.TaxBreakdown)
+	field("due", r.DueDate)
+	field("terms", r.PaymentTerms)
+	field("vendor", r.Vendor)
+	return s
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		text  string
+		minor int64
+		ok    bool
+	}{
+		{"12", 1200, true},
+		{"12.5", 1250, true},
+		{"1,234.56", 123456, true},
+		{"1.234,56", 123456, true},
+		{"1 234,56", 123456, true},
+		{"1'234.50", 123450, true},
+		{"1.234", 123400, true},
+		{"-5,00", -500, true},
+		{"1,234,567", 123456700, true},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		amount, ok := parseAmount(test.text)
+		if ok != test.ok || amount.Minor != test.minor {
+			t.Errorf("parseAmount(%q) = %v, %t, want %d, %t", test.text, amount.Minor, ok, test.minor, test.ok)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		text string
+		want string // empty if no date is found
+	}{
+		{"2024-03-05", "2024-03-05"},
+		{"05.03.2024", "2024-03-05"},
+		{"05/03/24", "2024-03-05"},
+		// day first unless that is not a date
+		{"03/25/2024", "2024-03-25"},
+		{"5 March 2024", "2024-03-05"},
+		{"1er février 2024", "2024-02-01"},
+		{"Mar. 5th, 2024", "2024-03-05"},
+		{"issued 31.01.2024, delivered 2024-01-15", "2024-01-31"},
+		{"31.02.2024", ""},
+		{"05.03-2024", ""},
+		{"Order 12345", ""},
+	}
+	for _, test := range tests {
+		date, ok := parseDate(test.text)
+		got := ""
+		if ok {
+			got = date.Format(time.DateOnly)
+		}
+		if got != test.want {
+			t.Errorf("parseDate(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFindPaymentTerms(t *testing.T) {
+	tests := []struct {
+		text string
+		want *model.PaymentTerms // nil if none are found
+	}{
+		{"Terms: 2/10, n/30", &model.PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 10}},
+		{"Payment terms: net 14", &model.PaymentTerms{NetDays: 14}},
+		{"Zahlbar innerhalb von 30 Tagen ohne Abzug", &model.PaymentTerms{NetDays: 30}},
+		{"3% Skonto bei Zahlung innerhalb von 7 Tagen\nZahlbar innerhalb von 21 Tagen", &model.PaymentTerms{NetDays: 21, DiscountPercent: 3, DiscountDays: 7}},
+		{"Due upon receipt", &model.PaymentTerms{}},
+		{"Escompte de 1,5 % pour paiement sous 10 jours, règlement à 45 jours", &model.PaymentTerms{NetDays: 45, DiscountPercent: 1.5, DiscountDays: 10}},
+		// a discount for paying later than the net days is not one
+		{"2% discount within 30 days, payable within 10 days", &model.PaymentTerms{NetDays: 10}},
+		{"Net amount 30.00", nil},
+		{"Delivery within 5 days", nil},
+	}
+	for _, test := range tests {
+		terms, ok := findPaymentTerms(nonEmptyLines(test.text))
+		if ok != (test.want != nil) || (ok && terms != *test.want) {
+			t.Errorf("findPaymentTerms(%q) = %+v, %t, want %+v", test.text, terms, ok, test.want)
+		}
+	}
+}
+
+func TestCurrencyOf(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Total 12.00 EUR", "EUR"},
+		{"CHF 1'000.00", "CHF"},
+		{"Fr. 20.00", "CHF"},
+		{"US$ 5", "USD"},
+		{"C$ 5", "CAD"},
+		{"$5.00", "USD"},
+		{"100 zł", "PLN"},
+		// codes are taken next to numbers only, and preferred over symbols
+		{"ALL ITEMS 5 €", "EUR"},
+		{"$ 5.00 USD", "USD"},
+		{"TOP seller", ""},
+	}
+	for _, test := range tests {
+		if got, _ := currencyOf(test.text); got != test.want {
+			t.Errorf("currencyOf(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFindIBAN(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"IBAN: DE89 3704 0044 0532 0130 00", "DE89370400440532013000"},
+		{"iban de89370400440532013000", "DE89370400440532013000"},
+		// invalid check digits are skipped
+		{"DE00 3704 0044 0532 0130 00 or FR14 2004 1010 0505 0001 3M02 606", "FR1420041010050500013M02606"},
+		{"no bank details", ""},
+	}
+	for _, test := range tests {
+		if got, _ := findIBAN(test.text); got != test.want {
+			t.Errorf("findIBAN(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
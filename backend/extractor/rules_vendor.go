@@ -0,0 +1,80 @@
+package extractor
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"regexp"
+	"strings"
+)
+
+// vendorNameLines is how many lines from the top of the document are searched for the vendor name,
+// the issuer is usually in the letterhead
+const vendorNameLines = 12
+
+var (
+	// a company name ends with its legal form
+	companyName = regexp.MustCompile(`(?i)^[\p{L}\p{N}][\p{L}\p{N}&.,'’\- ]{1,60}?\s(?:GmbH(?:\s*&\s*Co\.?\s*KG)?|AG|KG|OHG|UG(?:\s*\(haftungsbeschränkt\))?|e\.\s?K\.|SE|Ltd\.?|Limited|LLC|LLP|Inc\.?|Corp\.?|PLC|S\.?A\.?S?|SARL|S\.?à\s?r\.?l\.?|EURL|B\.?V\.?|N\.?V\.?|S\.?r\.?l\.?)(?:$|[\s,|·•])`)
+	// lines of the recipient block, the vendor name is not taken from them
+	recipientLine = regexp.MustCompile(`(?i)\b(?:bill\s*to|billed\s*to|invoice\s*to|ship\s*to|customer|kunde|rechnungsempfänger|an:|client|destinataire|factur[ée]\s*à)\b`)
+
+	vatIDLabel = regexp.MustCompile(`(?i)(?:vat\s*(?:reg(?:istration)?\.?\s*)?(?:no\.?|number|id)|ust\.?\s*-?\s*id(?:\.|ent)?\s*-?\s*(?:nr\.?)?|umsatzsteuer\s*-?\s*identifikationsnummer|n[°º]\s*(?:de\s*)?tva(?:\s*intra(?:com(?:munautaire)?)?)?|tva\s*intra(?:com(?:munautaire)?)?|num[ée]ro\s*de\s*tva)\s*[:.]?\s*`)
+	// EU VAT IDs start with the country code, Greece uses EL. Separators are removed before matching
+	vatIDValue = regexp.MustCompile(`^(?:AT|BE|BG|CY|CZ|DE|DK|EE|EL|ES|FI|FR|GB|HR|HU|IE|IT|LT|LU|LV|MT|NL|PL|PT|RO|SE|SI|SK|XI)[0-9A-Z]{8,12}`)
+	vatIDToken = regexp.MustCompile(`[A-Z]{2}[0-9A-Z .\-]{8,16}`)
+
+	ibanValue  = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?:\s?[A-Z0-9]{4}){2,7}(?:\s?[A-Z0-9]{1,4})?\b`)
+	emailValue = regexp.MustCompile(`(?i)\b[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,}\b`)
+)
+
+func findVendorName(lines []string) (string, bool) {
+	for _, line := range lines[:min(len(lines), vendorNameLines)] {
+		if recipientLine.MatchString(line) {
+			// everything after the recipient label belongs to the recipient
+			break
+		}
+		if name := companyName.FindString(line); name != "" {
+			return strings.TrimRight(strings.TrimSpace(name), ",|·•"), true
+		}
+	}
+
+	return "", false
+}
+
+func findVATID(lines []string) (string, bool) {
+	for i, line := range lines {
+		location := vatIDLabel.FindStringIndex(line)
+		if location == nil {
+			continue
+		}
+
+		candidates := []string{line[location[1]:]}
+		if i+1 < len(lines) {
+			candidates = append(candidates, lines[i+1])
+		}
+		for _, candidate := range candidates {
+			token := vatIDToken.FindString(strings.ToUpper(candidate))
+			normalized := strings.NewReplacer(" ", "", ".", "", "-", "").Replace(token)
+			if vatID := vatIDValue.FindString(normalized); vatID != "" {
+				return vatID, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// findIBAN returns the first IBAN with valid check digits
+func findIBAN(text string) (string, bool) {
+	for _, candidate := range ibanValue.FindAllString(strings.ToUpper(text), -1) {
+		iban := banking.NormalizeIBAN(candidate)
+		if banking.ValidIBAN(iban) {
+			return iban, true
+		}
+	}
+
+	return "", false
+}
+
+func findEmail(text string) (string, bool) {
+	email := emailValue.FindString(text)
+	return strings.ToLower(email), email != ""
+}
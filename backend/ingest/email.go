@@ -0,0 +1,181 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/email"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"mime"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPollInterval = 5 * time.Minute
+
+var ErrNoAttachments = errors.New("no PDF or XML attachments")
+
+// attachmentTypes are the extensions of the attachments taken as invoices by their content type, for attachments
+// named without one. Images are left out, they are mostly logos of signatures
+var attachmentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"application/xml": ".xml",
+	"text/xml":        ".xml",
+}
+
+// IngestEmailFile ingests the invoices attached to an uploaded email, or to the emails of an mbox file
+func (i *Ingester) IngestEmailFile(ctx context.Context, filename string, content []byte) ([]Report, error) {
+	if sniff(content) != ".mbox" {
+		return i.IngestEmail(ctx, content)
+	}
+
+	var reports []Report
+	for _, message := range email.SplitMbox(content) {
+		if ctx.Err() != nil {
+			return reports, ctx.Err()
+		}
+		messageReports, err := i.IngestEmail(ctx, message)
+		reports = append(reports, messageReports...)
+		// replies and other messages without invoices are expected in a mailbox
+		if err != nil && !errors.Is(err, ErrNoAttachments) {
+			i.logger.Warn("Skipped email of mbox file", zap.String("filename", filename), zap.Error(err))
+		}
+	}
+	if len(reports) == 0 {
+		return nil, ErrNoAttachments
+	}
+	return reports, nil
+}
+
+// IngestEmail ingests the PDF and XML attachments of an email, with the email recorded as their source. Duplicates
+// are reported as such, so the same email can be ingested again
+func (i *Ingester) IngestEmail(ctx context.Context, content []byte) ([]Report, error) {
+	message, err := email.Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	source := &model.EmailSource{From: message.From, Subject: message.Subject, MessageID: message.MessageID, Date: message.Date}
+
+	var reports []Report
+	for _, attachment := range message.Attachments {
+		filename, ok := invoiceAttachment(attachment)
+		if !ok {
+			continue
+		}
+		if ctx.Err() != nil {
+			return reports, ctx.Err()
+		}
+		reports = append(reports, i.ingest(ctx, filename, attachment.Content, nil, source))
+	}
+	if len(reports) == 0 {
+		return nil, ErrNoAttachments
+	}
+
+	i.logger.Info("Ingested email", zap.String("messageId", message.MessageID), zap.String("from", message.From),
+		zap.Int("attachments", len(reports)))
+	return reports, nil
+}
+
+// invoiceAttachment returns the file name to ingest an attachment under, false if it is not a PDF or XML file
+func invoiceAttachment(attachment email.Attachment) (string, bool) {
+	extension := strings.ToLower(filepath.Ext(attachment.Filename))
+	if extension == ".pdf" || extension == ".xml" {
+		return attachment.Filename, true
+	}
+
+	// some mail clients send PDFs as application/octet-stream, those are found by their name only
+	mediaType, _, _ := mime.ParseMediaType(attachment.ContentType)
+	if extension, ok := attachmentTypes[mediaType]; ok {
+		return attachment.Filename + extension, true
+	}
+	return "", false
+}
+
+// Mailbox is a folder of emails polled for invoices, see email.IMAPMailbox
+type Mailbox interface {
+	// Poll passes the new messages to handle, the ones handle returns true for are not passed again
+	Poll(ctx context.Context, handle func(content []byte) bool) error
+}
+
+// MailboxPoller ingests the invoices attached to the new emails of a mailbox, every interval
+type MailboxPoller struct {
+	ingester *Ingester
+	mailbox  Mailbox
+	interval time.Duration
+	wg       sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+// NewMailboxPoller creates a poller, the interval defaults to 5 minutes if not positive
+func NewMailboxPoller(ingester *Ingester, mailbox Mailbox, interval time.Duration, logger *zap.Logger) *MailboxPoller {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	return &MailboxPoller{
+		ingester: ingester,
+		mailbox:  mailbox,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Start polls the mailbox right away and then every interval, until ctx is canceled
+func (p *MailboxPoller) Start(ctx context.Context) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			p.poll(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait blocks until the running poll is done after ctx of Start was canceled
+func (p *MailboxPoller) Wait() {
+	p.wg.Wait()
+}
+
+func (p *MailboxPoller) poll(ctx context.Context) {
+	messages, created := 0, 0
+	err := p.mailbox.Poll(ctx, func(content []byte) bool {
+		messages++
+		reports, err := p.ingester.IngestEmail(ctx, content)
+		if err != nil {
+			// an email that cannot be read or has no invoices is not read again
+			p.logger.Info("Skipped email", zap.Error(err))
+			return !errors.Is(err, context.Canceled)
+		}
+
+		// files that could not be stored are tried again with the whole email, the others are duplicates by then
+		handled := true
+		for _, report := range reports {
+			switch report.Status {
+			case StatusCreated:
+				created++
+			case StatusFailed:
+				handled = false
+			case StatusRejected:
+				p.logger.Warn("Rejected email attachment", zap.String("filename", report.Filename), zap.Error(report.Err))
+			}
+		}
+		return handled
+	})
+	if err != nil && ctx.Err() == nil {
+		p.logger.Error("Failed to poll mailbox", zap.Error(err))
+	}
+	if messages > 0 {
+		p.logger.Info("Polled mailbox", zap.Int("messages", messages), zap.Int("created", created))
+	}
+}
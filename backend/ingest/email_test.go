@@ -0,0 +1,157 @@
+package ingest
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/processing"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestIngester creates an ingester storing files in memory and invoices in an SQLite database. Jobs are queued,
+// nothing processes them
+func newTestIngester(t *testing.T) (*Ingester, *db.Manager, *filestore.MemoryStore) {
+	t.Helper()
+
+	manager, err := db.NewManagerOfType("sqlite", zap.NewNop(), filepath.Join(t.TempDir(), "invoices.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := manager.DB.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	store := filestore.NewMemoryStore(nil, zap.NewNop())
+	processor := processing.NewProcessor(manager, store, nil, nil, nil, 1, zap.NewNop())
+	return NewIngester(store, processor, nil, Limits{}, zap.NewNop()), manager, store
+}
+
+// testPDF returns a single page PDF showing the text
+func testPDF(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes()
+}
+
+// testEmail returns an email with the attachments, given as file names and contents
+func testEmail(messageID string, attachments ...string) string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: ACME <billing@acme.example>\nSubject: Invoice\nMessage-ID: <%s>\n", messageID)
+	message.WriteString("Date: Fri, 01 Mar 2024 10:00:00 +0000\nContent-Type: multipart/mixed; boundary=b\n\n")
+	message.WriteString("--b\nContent-Type: text/plain\n\nPlease find the invoice attached\n")
+	for i := 0; i+1 < len(attachments); i += 2 {
+		fmt.Fprintf(&message, "--b\nContent-Type: application/octet-stream\nContent-Disposition: attachment; filename=%q\n", attachments[i])
+		fmt.Fprintf(&message, "Content-Transfer-Encoding: base64\n\n%s\n", base64.StdEncoding.EncodeToString([]byte(attachments[i+1])))
+	}
+	message.WriteString("--b--\n")
+	return message.String()
+}
+
+func TestIngestEmailFile(t *testing.T) {
+	ingester, manager, store := newTestIngester(t)
+	mbox := "From billing@acme.example Fri Mar  1 10:00:00 2024\n" +
+		testEmail("a1@acme.example", "invoice.pdf", string(testPDF("Invoice 1")), "terms.txt", "not an invoice") +
+		"\nFrom me@example.com Fri Mar  1 11:00:00 2024\n" +
+		"From: me@example.com\nSubject: Re: Invoice\n\nThanks\n"
+
+	reports, err := ingester.IngestEmailFile(context.Background(), "inbox.mbox", []byte(mbox))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Status != StatusCreated || reports[0].Filename != "invoice.pdf" {
+		t.Fatalf("reports = %+v, want the PDF attachment created", reports)
+	}
+	if _, err = store.Stat(context.Background(), reports[0].FileHash+".pdf"); err != nil {
+		t.Errorf("stored file: %v", err)
+	}
+	invoice, err := manager.GetInvoiceByHash(reports[0].FileHash)
+	if err != nil || invoice == nil {
+		t.Fatalf("GetInvoiceByHash = %v, %v", invoice, err)
+	}
+	if invoice.Email == nil || invoice.Email.MessageID != "a1@acme.example" || invoice.Email.From != "ACME <billing@acme.example>" {
+		t.Errorf("email source = %+v, want the message the invoice came with", invoice.Email)
+	}
+
+	// the same email again is reported as a duplicate
+	reports, err = ingester.IngestEmailFile(context.Background(), "invoice.eml",
+		[]byte(testEmail("a1@acme.example", "copy.pdf", string(testPDF("Invoice 1")))))
+	if err != nil || len(reports) != 1 || reports[0].Status != StatusDuplicate {
+		t.Errorf("IngestEmailFile = %+v, %v, want a duplicate", reports, err)
+	}
+
+	if _, err = ingester.IngestEmailFile(context.Background(), "reply.eml", []byte(testEmail("a2@acme.example"))); !errors.Is(err, ErrNoAttachments) {
+		t.Errorf("IngestEmailFile without attachments = %v, want ErrNoAttachments", err)
+	}
+}
+
+// testMailbox passes its messages to every poll and keeps the ones that were handled
+type testMailbox struct {
+	messages []string
+	handled  map[string]bool
+}
+
+func (m *testMailbox) Poll(_ context.Context, handle func(content []byte) bool) error {
+	for _, message := range m.messages {
+		if !m.handled[message] && handle([]byte(message)) {
+			m.handled[message] = true
+		}
+	}
+	return nil
+}
+
+func TestMailboxPoller(t *testing.T) {
+	ingester, _, _ := newTestIngester(t)
+	mailbox := &testMailbox{
+		messages: []string{
+			testEmail("a1@acme.example", "invoice.pdf", string(testPDF("Invoice 1"))),
+			testEmail("a2@acme.example", "broken.pdf", "%PDF-1.4 truncated"),
+			"not an email",
+		},
+		handled: make(map[string]bool),
+	}
+
+	// rejected attachments and unreadable emails are not read again
+	NewMailboxPoller(ingester, mailbox, 0, zap.NewNop()).poll(context.Background())
+	for _, message := range mailbox.messages {
+		if !mailbox.handled[message] {
+			t.Errorf("message %.40q was not handled", message)
+		}
+	}
+
+	// files that could not be stored are tried again
+	ingester.Shutdown()
+	retried := testEmail("a3@acme.example", "invoice.pdf", string(testPDF("Invoice 3")))
+	mailbox.messages = append(mailbox.messages, retried)
+	NewMailboxPoller(ingester, mailbox, 0, zap.NewNop()).poll(context.Background())
+	if mailbox.handled[retried] {
+		t.Error("message with a failed attachment was handled")
+	}
+}
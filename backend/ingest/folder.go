@@ -0,0 +1,212 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultScanInterval = 10 * time.Second
+	// settleTime is how long a file has to stay unchanged to be picked up, scanners write files in several steps
+	settleTime = 5 * time.Second
+	// maxContainerSize is the max size of an archive or an email file dropped into a folder, the one of uploads
+	maxContainerSize = 200 * 1024 * 1024
+
+	DoneFolder   = "done"
+	FailedFolder = "failed"
+)
+
+// FolderWatcher ingests the files dropped into directories, such as the network share of a scanner. The directories
+// are scanned rather than watched for events, which network shares do not deliver reliably. Ingested files are moved
+// to the done subfolder, rejected ones to the failed subfolder along with an error report. Files that could not be
+// stored are left in place and tried again on the next scan
+type FolderWatcher struct {
+	ingester *Ingester
+	dirs     []string
+	interval time.Duration
+	wg       sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+// NewFolderWatcher creates a watcher of the directories, the interval defaults to 10 seconds if not positive
+func NewFolderWatcher(ingester *Ingester, dirs []string, interval time.Duration, logger *zap.Logger) *FolderWatcher {
+	if interval <= 0 {
+		interval = defaultScanInterval
+	}
+
+	return &FolderWatcher{
+		ingester: ingester,
+		dirs:     dirs,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Start scans the directories right away and then every interval, until ctx is canceled
+func (w *FolderWatcher) Start(ctx context.Context) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			for _, dir := range w.dirs {
+				if err := w.scan(ctx, dir); err != nil && ctx.Err() == nil {
+					w.logger.Warn("Failed to scan watched folder", zap.String("dir", dir), zap.Error(err))
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Wait blocks until the running scan is done after ctx of Start was canceled
+func (w *FolderWatcher) Wait() {
+	w.wg.Wait()
+}
+
+// scan ingests the files of a directory that have settled, subfolders are not scanned
+func (w *FolderWatcher) scan(ctx context.Context, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// hidden files include the temporary files of copies in progress and the metadata of macOS
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// removed since the directory was read
+			continue
+		}
+		if time.Since(info.ModTime()) < settleTime {
+			continue
+		}
+
+		w.ingest(ctx, dir, info)
+	}
+	return nil
+}
+
+// ingest ingests a file and moves it to the done or failed subfolder
+func (w *FolderWatcher) ingest(ctx context.Context, dir string, info os.FileInfo) {
+	name := info.Name()
+	path := filepath.Join(dir, name)
+	logger := w.logger.With(zap.String("path", path))
+
+	// whether the file is a container is told by its content, invoices larger than their own limit are rejected once
+	// the file is read
+	limit := max(w.ingester.Limits().MaxFileSize, maxContainerSize)
+	var reports []Report
+	if info.Size() > limit {
+		err := fmt.Errorf("%w: %d bytes, at most %d are allowed", ErrFileTooLarge, info.Size(), limit)
+		reports = []Report{{Filename: name, Status: StatusRejected, Err: err}}
+	} else {
+		content, err := readFile(path, limit)
+		if err != nil {
+			logger.Warn("Failed to read watched file", zap.Error(err))
+			return
+		}
+		reports = w.ingester.IngestFile(ctx, name, content, nil)
+	}
+
+	var failed []Report
+	for _, report := range reports {
+		switch report.Status {
+		case StatusFailed:
+			// the filestore or the database may be back on the next scan
+			logger.Warn("Failed to ingest watched file, trying again on the next scan", zap.Error(report.Err))
+			return
+		case StatusRejected:
+			failed = append(failed, report)
+		}
+	}
+
+	if len(failed) == 0 {
+		if _, err := moveFile(path, filepath.Join(dir, DoneFolder)); err != nil {
+			logger.Error("Failed to move ingested file, it is ingested again as a duplicate", zap.Error(err))
+			return
+		}
+		logger.Info("Ingested watched file", zap.Int("files", len(reports)))
+		return
+	}
+
+	// the report of an archive lists the rejected files only, the others were ingested
+	moved, err := moveFile(path, filepath.Join(dir, FailedFolder))
+	if err != nil {
+		logger.Error("Failed to move rejected file, it is ingested again", zap.Error(err))
+		return
+	}
+	if err = os.WriteFile(moved+".error.txt", []byte(errorReport(failed)), 0o644); err != nil {
+		logger.Error("Failed to write error report", zap.String("path", moved), zap.Error(err))
+	}
+	logger.Warn("Rejected watched file", zap.String("movedTo", moved), zap.Int("rejected", len(failed)))
+}
+
+func readFile(path string, limit int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(io.LimitReader(file, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, errors.New("file grew while it was read")
+	}
+	return content, nil
+}
+
+// moveFile moves a file into the folder and returns its new path. Files of the same name already there are kept, the
+// moved file is numbered then
+func moveFile(path string, folder string) (string, error) {
+	if err := os.MkdirAll(folder, 0o755); err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(path)
+	extension := filepath.Ext(name)
+	target := filepath.Join(folder, name)
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(target); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		target = filepath.Join(folder, strings.TrimSuffix(name, extension)+"-"+strconv.Itoa(n)+extension)
+	}
+
+	return target, os.Rename(path, target)
+}
+
+// errorReport lists why the files were rejected, one line each
+func errorReport(reports []Report) string {
+	var report strings.Builder
+	fmt.Fprintf(&report, "Rejected on %s\n", time.Now().Format(time.RFC3339))
+	for _, rejected := range reports {
+		fmt.Fprintf(&report, "%s: %v\n", rejected.Filename, rejected.Err)
+	}
+	return report.String()
+}
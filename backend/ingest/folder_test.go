@@ -0,0 +1,228 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// unavailableStore fails every call while down is set, like a filestore that cannot be reached
+type unavailableStore struct {
+	filestore.Store
+	down atomic.Bool
+}
+
+func (s *unavailableStore) Stat(ctx context.Context, key string) (*filestore.ObjectInfo, error) {
+	if s.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return s.Store.Stat(ctx, key)
+}
+
+func (s *unavailableStore) Put(ctx context.Context, key string, reader io.Reader, contentType string) error {
+	if s.down.Load() {
+		return errors.New("connection refused")
+	}
+	return s.Store.Put(ctx, key, reader, contentType)
+}
+
+// dropFile writes a file into the directory, modified the given time ago
+func dropFile(t *testing.T, dir string, name string, content []byte, age time.Duration) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Now().Add(-age)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listDir returns the names of the files of a directory and its subfolders, relative to it
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		relative, _ := filepath.Rel(dir, path)
+		names = append(names, filepath.ToSlash(relative))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestFolderWatcherScan(t *testing.T) {
+	ingester, manager, _ := newTestIngester(t)
+	watcher := NewFolderWatcher(ingester, nil, 0, zap.NewNop())
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	invoice := testPDF("Invoice INV-1")
+	dropFile(t, dir, "scan.pdf", invoice, time.Minute)
+	dropFile(t, dir, "copy.pdf", invoice, time.Minute)
+	dropFile(t, dir, "notes.txt", []byte("not an invoice"), time.Minute)
+	// still being written
+	dropFile(t, dir, "scanning.pdf", testPDF("Invoice INV-2"), time.Second)
+	dropFile(t, dir, ".~scan.pdf", invoice, time.Minute)
+	if err := os.Mkdir(filepath.Join(dir, "archive"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dropFile(t, filepath.Join(dir, "archive"), "old.pdf", testPDF("Invoice INV-3"), time.Minute)
+
+	if err := watcher.scan(ctx, dir); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	// the copy is a duplicate, which is done as well
+	want := []string{
+		".~scan.pdf",
+		"archive/old.pdf",
+		"done/copy.pdf",
+		"done/scan.pdf",
+		"failed/notes.txt",
+		"failed/notes.txt.error.txt",
+		"scanning.pdf",
+	}
+	if got := listDir(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("files after scan() = %v, want %v", got, want)
+	}
+
+	report, err := os.ReadFile(filepath.Join(dir, FailedFolder, "notes.txt.error.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(report), "Rejected on ") || !strings.Contains(string(report), "\nnotes.txt: "+ErrUnsupportedFileType.Error()) {
+		t.Errorf("error report = %q, want the reason notes.txt was rejected", report)
+	}
+
+	// once it has settled, the file being written is picked up
+	modified := time.Now().Add(-settleTime)
+	if err = os.Chtimes(filepath.Join(dir, "scanning.pdf"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+	if err = watcher.scan(ctx, dir); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, DoneFolder, "scanning.pdf")); err != nil {
+		t.Errorf("settled file was not ingested: %v", err)
+	}
+
+	_, total, err := manager.QueryInvoices(db.InvoiceFilter{Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 {
+		t.Errorf("invoices = %d, want 2", total)
+	}
+}
+
+func TestFolderWatcherRetry(t *testing.T) {
+	ingester, _, memoryStore := newTestIngester(t)
+	store := &unavailableStore{Store: memoryStore}
+	ingester.fileStore = store
+	watcher := NewFolderWatcher(ingester, nil, 0, zap.NewNop())
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	dropFile(t, dir, "scan.pdf", testPDF("Invoice INV-1"), time.Minute)
+	store.down.Store(true)
+	if err := watcher.scan(ctx, dir); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	// files that could not be stored are left in place, not reported as rejected
+	if got, want := listDir(t, dir), []string{"scan.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files after a failed scan() = %v, want %v", got, want)
+	}
+
+	store.down.Store(false)
+	if err := watcher.scan(ctx, dir); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+	if got, want := listDir(t, dir), []string{"done/scan.pdf"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("files after the retry = %v, want %v", got, want)
+	}
+}
+
+func TestFolderWatcherArchive(t *testing.T) {
+	ingester, _, _ := newTestIngester(t)
+	watcher := NewFolderWatcher(ingester, nil, 0, zap.NewNop())
+	dir := t.TempDir()
+
+	archive := testArchive(t,
+		archiveEntry{name: "a.pdf", content: testPDF("Invoice INV-1")},
+		archiveEntry{name: "notes.txt", content: []byte("not an invoice")},
+	)
+	dropFile(t, dir, "scans.zip", archive, time.Minute)
+	if err := watcher.scan(context.Background(), dir); err != nil {
+		t.Fatalf("scan() error = %v", err)
+	}
+
+	// the archive is failed for its rejected file, the report lists only that one
+	report, err := os.ReadFile(filepath.Join(dir, FailedFolder, "scans.zip.error.txt"))
+	if err != nil {
+		t.Fatalf("error report was not written: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(report)), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "notes.txt: ") {
+		t.Errorf("error report = %q, want a line for notes.txt only", report)
+	}
+}
+
+func TestMoveFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		want     string
+	}{
+		{"scan.pdf", nil, "scan.pdf"},
+		{"scan.pdf", []string{"scan.pdf"}, "scan-2.pdf"},
+		{"scan.pdf", []string{"scan.pdf", "scan-2.pdf", "scan-3.pdf"}, "scan-4.pdf"},
+		// only taken names are skipped
+		{"scan.pdf", []string{"scan.pdf", "scan-3.pdf"}, "scan-2.pdf"},
+		{"scan", []string{"scan"}, "scan-2"},
+		{"scan.tar.gz", []string{"scan.tar.gz"}, "scan.tar-2.gz"},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		folder := filepath.Join(dir, DoneFolder)
+		for _, name := range test.existing {
+			dropFile(t, dir, name, []byte("existing"), 0)
+			if _, err := moveFile(filepath.Join(dir, name), folder); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dropFile(t, dir, test.name, []byte("moved"), 0)
+
+		moved, err := moveFile(filepath.Join(dir, test.name), folder)
+		if err != nil {
+			t.Errorf("moveFile(%s) error = %v", test.name, err)
+			continue
+		}
+		if want := filepath.Join(folder, test.want); moved != want {
+			t.Errorf("moveFile(%s) with %v = %s, want %s", test.name, test.existing, moved, want)
+		}
+		// files already there are kept
+		if content, err := os.ReadFile(moved); err != nil || string(content) != "moved" {
+			t.Errorf("moveFile(%s) content = %q, %v, want the moved file", test.name, content, err)
+		}
+		if got := listDir(t, folder); len(got) != len(test.existing)+1 {
+			t.Errorf("moveFile(%s) left %v, want %d files", test.name, got, len(test.existing)+1)
+		}
+	}
+}
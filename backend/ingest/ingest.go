@@ -0,0 +1,368 @@
+// Package ingest takes in new invoice files: validates them, drops duplicates, stores them and schedules their processing
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/einvoice"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/processing"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultMaxFileSize is the max size of a single invoice file in bytes, unless configured otherwise
+	DefaultMaxFileSize = 10 * 1024 * 1024
+	// DefaultMaxPages is the max number of pages of a PDF, unless configured otherwise
+	DefaultMaxPages = 100
+	// MaxArchiveEntries is the max number of files in an uploaded archive
+	MaxArchiveEntries = 500
+)
+
+type Status string
+
+const (
+	StatusCreated   Status = "created"
+	StatusDuplicate Status = "duplicate" // the same file has been uploaded before
+	StatusRejected  Status = "rejected"  // the file is not acceptable, see the error
+	StatusFailed    Status = "failed"    // the file could not be stored, it may be uploaded again
+)
+
+var (
+	ErrUnsupportedFileType = errors.New("unsupported file type, expected a PDF, an XML e-invoice or a JPEG, PNG or HEIC image")
+	ErrInvalidEInvoice     = errors.New("invalid e-invoice")
+	ErrFileTooLarge        = errors.New("file is too large")
+	ErrInvalidArchive      = errors.New("invalid archive")
+	ErrStorageUnavailable  = errors.New("filestore is unavailable")
+	ErrShuttingDown        = errors.New("server is shutting down")
+)
+
+// Report is the outcome of ingesting a single file. Err is set for rejected and failed files
+type Report struct {
+	Filename string `json:"filename"`
+	Status   Status `json:"status"`
+	FileHash string `json:"fileHash,omitempty"`
+	JobID    uint   `json:"jobId,omitempty"`
+	Err      error  `json:"-"`
+}
+
+// Limits bound the invoice files that are accepted
+type Limits struct {
+	MaxFileSize int64 // in bytes
+	MaxPages    int   // of PDFs
+}
+
+type Ingester struct {
+	fileStore      filestore.Store
+	processor      *processing.Processor
+	imageConverter document.ImageConverter
+	limits         Limits
+
+	// inFlight tracks the running Ingest calls, so that Shutdown can wait for them
+	inFlight sync.WaitGroup
+	mu       sync.Mutex
+	closed   bool
+
+	logger *zap.Logger
+}
+
+// NewIngester creates an ingester, imageConverter may be nil if HEIC images are not accepted. Limits that are not
+// positive default to DefaultMaxFileSize and DefaultMaxPages
+func NewIngester(fileStore filestore.Store, processor *processing.Processor, imageConverter document.ImageConverter, limits Limits, logger *zap.Logger) *Ingester {
+	if limits.MaxFileSize <= 0 {
+		limits.MaxFileSize = DefaultMaxFileSize
+	}
+	if limits.MaxPages <= 0 {
+		limits.MaxPages = DefaultMaxPages
+	}
+
+	return &Ingester{
+		fileStore:      fileStore,
+		processor:      processor,
+		imageConverter: imageConverter,
+		limits:         limits,
+		logger:         logger,
+	}
+}
+
+// Limits returns the limits of the accepted invoice files
+func (i *Ingester) Limits() Limits {
+	return i.limits
+}
+
+// Shutdown rejects new files and waits until the files being ingested are either stored and scheduled or rolled back
+func (i *Ingester) Shutdown() {
+	i.mu.Lock()
+	i.closed = true
+	i.mu.Unlock()
+
+	i.inFlight.Wait()
+}
+
+// Ingest stores a single invoice file and schedules its processing. Invoice fields present in the form are used as is,
+// form may be nil. The type of the file is told by its content rather than its name, PDFs are checked to open before
+// they are stored. XML e-invoices are stored along with a PDF rendered from them, images are stored as a single page
+// PDF
+func (i *Ingester) Ingest(ctx context.Context, filename string, content []byte, form *url.Values) Report {
+	return i.ingest(ctx, filename, content, form, nil)
+}
+
+// ingest stores a single invoice file, source is the email it was attached to if any
+func (i *Ingester) ingest(ctx context.Context, filename string, content []byte, form *url.Values, source *model.EmailSource) Report {
+	report := Report{Filename: filename}
+
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		return i.fail(report, ErrShuttingDown)
+	}
+	i.inFlight.Add(1)
+	i.mu.Unlock()
+	defer i.inFlight.Done()
+
+	if int64(len(content)) > i.limits.MaxFileSize {
+		return i.reject(report, i.tooLarge(int64(len(content))))
+	}
+	extension := sniff(content)
+	if !invoiceTypes[extension] {
+		return i.reject(report, ErrUnsupportedFileType)
+	}
+	if extension == ".heic" && i.imageConverter == nil {
+		return i.reject(report, fmt.Errorf("%w: HEIC images cannot be converted on this server", ErrUnsupportedFileType))
+	}
+
+	var eInvoice *einvoice.Invoice
+	switch extension {
+	case ".pdf":
+		// a PDF that cannot be read would be stored with an invoice that never gets any fields
+		if _, err := document.ValidatePDF(content, i.limits.MaxPages); err != nil {
+			return i.reject(report, err)
+		}
+	case ".xml":
+		var err error
+		if eInvoice, err = einvoice.Parse(content); err != nil {
+			return i.reject(report, fmt.Errorf("%w: %w", ErrInvalidEInvoice, err))
+		}
+	}
+
+	// the hash of an XML invoice or an image is the one of the uploaded file, the PDF made of it may differ between
+	// versions
+	report.FileHash = fmt.Sprintf("%x", sha256.Sum256(content))
+	object := report.FileHash + ".pdf"
+
+	// The filestore is the source of truth for duplicates, see docs/README.md
+	exists, err := filestore.Exists(ctx, i.fileStore, object)
+	if err != nil {
+		i.logger.Error("Failed to check if file exists in filestore", zap.String("object", object), zap.Error(err))
+		return i.fail(report, fmt.Errorf("%w: %w", ErrStorageUnavailable, err))
+	}
+	if exists {
+		i.logger.Warn("File already exists", zap.String("filename", filename), zap.String("object", object))
+		report.Status = StatusDuplicate
+		return report
+	}
+
+	objects := []string{object}
+	switch {
+	case eInvoice != nil:
+		// the XML is kept as uploaded, the PDF is stored in its place to be previewed and processed like any other
+		objects, content, err = i.storeEInvoice(ctx, report.FileHash, filename, content, eInvoice)
+		if err != nil {
+			return i.fail(report, err)
+		}
+	case extension != ".pdf":
+		if content, err = i.imagePDF(ctx, extension, content); err != nil {
+			if errors.Is(err, document.ErrInvalidImage) {
+				return i.reject(report, err)
+			}
+			i.logger.Error("Failed to convert image", zap.String("filename", filename), zap.Error(err))
+			return i.fail(report, err)
+		}
+	}
+
+	if err = i.fileStore.Put(ctx, object, bytes.NewReader(content), "application/pdf"); err != nil {
+		i.logger.Error("Failed to upload file to filestore", zap.String("object", object), zap.Error(err))
+		i.rollback(ctx, objects[1:]...)
+		return i.fail(report, fmt.Errorf("%w: %w", ErrStorageUnavailable, err))
+	}
+
+	invoice := &model.Invoice{
+		FileHash:         report.FileHash,
+		OriginalFileName: filename,
+		FileExists:       true,
+		Email:            source,
+	}
+	if form != nil {
+		// Values provided with the upload take precedence over extracted ones
+		invoice.FromFormData(form)
+	}
+
+	// Text and field extraction are done in the background
+	job, err := i.processor.Enqueue(invoice)
+	if err != nil {
+		// the file would be reported as a duplicate on the next upload while it has no invoice
+		i.rollback(ctx, objects...)
+		return i.fail(report, err)
+	}
+
+	report.Status = StatusCreated
+	report.JobID = job.ID
+	return report
+}
+
+// storeEInvoice stores the XML of an e-invoice and renders the PDF to be stored for it. Returns the objects stored
+// for the invoice once the PDF is, the PDF first
+func (i *Ingester) storeEInvoice(ctx context.Context, hash string, filename string, content []byte, invoice *einvoice.Invoice) ([]string, []byte, error) {
+	rendered, err := einvoice.RenderPDF(invoice, content, path.Base(filepath.ToSlash(filename)))
+	if err != nil {
+		i.logger.Error("Failed to render e-invoice", zap.String("filename", filename), zap.Error(err))
+		return nil, nil, err
+	}
+
+	object := hash + ".xml"
+	if err = i.fileStore.Put(ctx, object, bytes.NewReader(content), "application/xml"); err != nil {
+		i.logger.Error("Failed to upload file to filestore", zap.String("object", object), zap.Error(err))
+		return nil, nil, fmt.Errorf("%w: %w", ErrStorageUnavailable, err)
+	}
+
+	return []string{hash + ".pdf", object}, rendered, nil
+}
+
+// imagePDF puts an image on a single page PDF, converting HEIC images to JPEG first
+func (i *Ingester) imagePDF(ctx context.Context, extension string, content []byte) ([]byte, error) {
+	if extension == ".heic" {
+		var err error
+		if content, err = i.imageConverter.ToJPEG(ctx, content); err != nil {
+			return nil, err
+		}
+	}
+
+	return document.ImagePDF(content)
+}
+
+// IngestFile ingests an uploaded file, which is either an invoice, a ZIP archive of invoices or an email file, and
+// reports the outcome for each invoice file. Containers are told by their content, like invoices. A container that
+// cannot be read at all is reported as rejected itself
+func (i *Ingester) IngestFile(ctx context.Context, filename string, content []byte, form *url.Values) []Report {
+	var reports []Report
+	var err error
+	switch {
+	case IsArchive(content):
+		reports, err = i.IngestArchive(ctx, filename, content)
+	case IsEmail(content):
+		reports, err = i.IngestEmailFile(ctx, filename, content)
+	default:
+		return []Report{i.Ingest(ctx, filename, content, form)}
+	}
+
+	if err != nil {
+		i.logger.Warn("Failed to ingest file", zap.String("filename", filename), zap.Error(err))
+		reports = append(reports, Report{Filename: filename, Status: StatusRejected, Err: err})
+	}
+	return reports
+}
+
+// IngestArchive ingests every file of a ZIP archive. Directories and hidden files, such as macOS metadata, are skipped
+func (i *Ingester) IngestArchive(ctx context.Context, filename string, content []byte) ([]Report, error) {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+
+	var entries []*zip.File
+	for _, entry := range archive.File {
+		name := entry.Name
+		if entry.FileInfo().IsDir() || strings.HasPrefix(path.Base(name), ".") || strings.HasPrefix(name, "__MACOSX/") {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) > MaxArchiveEntries {
+		return nil, fmt.Errorf("%w: %d files, at most %d are allowed", ErrInvalidArchive, len(entries), MaxArchiveEntries)
+	}
+
+	reports := make([]Report, 0, len(entries))
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return reports, ctx.Err()
+		}
+
+		report := Report{Filename: entry.Name}
+		// the declared size may be forged, archive/zip then fails reading past it and readEntry limits what is read
+		// in any case
+		if entry.UncompressedSize64 > uint64(i.limits.MaxFileSize) {
+			reports = append(reports, i.reject(report, i.tooLarge(int64(entry.UncompressedSize64))))
+			continue
+		}
+
+		entryContent, err := i.readEntry(entry)
+		if err != nil {
+			i.logger.Warn("Failed to read archive entry", zap.String("archive", filename), zap.String("entry", entry.Name), zap.Error(err))
+			reports = append(reports, i.reject(report, err))
+			continue
+		}
+
+		reports = append(reports, i.Ingest(ctx, entry.Name, entryContent, nil))
+	}
+
+	return reports, nil
+}
+
+func (i *Ingester) readEntry(entry *zip.File) ([]byte, error) {
+	reader, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(io.LimitReader(reader, i.limits.MaxFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+	}
+	if int64(len(content)) > i.limits.MaxFileSize {
+		return nil, fmt.Errorf("%w: larger than %d bytes", ErrFileTooLarge, i.limits.MaxFileSize)
+	}
+
+	return content, nil
+}
+
+// rollback deletes stored files that have no invoice. It runs even when ctx is canceled, e.g. by a shutdown
+func (i *Ingester) rollback(ctx context.Context, objects ...string) {
+	for _, object := range objects {
+		if err := i.fileStore.Delete(context.WithoutCancel(ctx), object); err != nil {
+			i.logger.Error("Failed to roll back stored file, it has no invoice", zap.String("object", object), zap.Error(err))
+			continue
+		}
+
+		i.logger.Info("Rolled back stored file", zap.String("object", object))
+	}
+}
+
+func (i *Ingester) tooLarge(size int64) error {
+	return fmt.Errorf("%w: %d bytes, at most %d are allowed", ErrFileTooLarge, size, i.limits.MaxFileSize)
+}
+
+func (i *Ingester) reject(report Report, err error) Report {
+	i.logger.Warn("Rejected invoice file", zap.String("filename", report.Filename), zap.Error(err))
+	report.Status = StatusRejected
+	report.Err = err
+	return report
+}
+
+func (i *Ingester) fail(report Report, err error) Report {
+	report.Status = StatusFailed
+	report.Err = err
+	return report
+}
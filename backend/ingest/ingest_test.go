@@ -0,0 +1,378 @@
+package ingest
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+	"time"
+)
+
+// archiveEntry is a file of a test archive. A declared size other than 0 is written into the header instead of the
+// actual one, like zip bombs do
+type archiveEntry struct {
+	name         string
+	content      []byte
+	declaredSize uint64
+}
+
+func testArchive(t *testing.T, entries ...archiveEntry) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	for _, entry := range entries {
+		if entry.declaredSize == 0 {
+			writer, err := archive.Create(entry.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = writer.Write(entry.content); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		var compressed bytes.Buffer
+		compressor, _ := flate.NewWriter(&compressed, flate.BestCompression)
+		compressor.Write(entry.content)
+		compressor.Close()
+		header := &zip.FileHeader{
+			Name:               entry.name,
+			Method:             zip.Deflate,
+			CompressedSize64:   uint64(compressed.Len()),
+			UncompressedSize64: entry.declaredSize,
+		}
+		writer, err := archive.CreateRaw(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = writer.Write(compressed.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestIngestArchive(t *testing.T) {
+	ingester, _, store := newTestIngester(t)
+	ingester.limits.MaxFileSize = 4096
+
+	invoice := testPDF("Invoice INV-1")
+	archive := testArchive(t,
+		archiveEntry{name: "invoices/"},
+		archiveEntry{name: "invoices/a.pdf", content: invoice},
+		// macOS metadata and hidden files are skipped without a report
+		archiveEntry{name: "__MACOSX/invoices/._a.pdf", content: []byte("metadata")},
+		archiveEntry{name: ".DS_Store", content: []byte("metadata")},
+		archiveEntry{name: "invoices/.hidden.pdf", content: invoice},
+		archiveEntry{name: "invoices/notes.txt", content: []byte("not an invoice")},
+		archiveEntry{name: "invoices/copy.pdf", content: invoice},
+		archiveEntry{name: "large.pdf", content: append([]byte("%PDF-1.7\n"), make([]byte, 5000)...)},
+		// 1 MB of zeros compress to about a kilobyte, the header claims 100 bytes. Reading fails at the declared size
+		archiveEntry{name: "bomb.pdf", content: append([]byte("%PDF-1.7\n"), make([]byte, 1<<20)...), declaredSize: 100},
+	)
+
+	reports, err := ingester.IngestArchive(context.Background(), "invoices.zip", archive)
+	if err != nil {
+		t.Fatalf("IngestArchive() error = %v", err)
+	}
+	want := []struct {
+		filename string
+		status   Status
+		err      error
+	}{
+		{"invoices/a.pdf", StatusCreated, nil},
+		{"invoices/notes.txt", StatusRejected, ErrUnsupportedFileType},
+		{"invoices/copy.pdf", StatusDuplicate, nil},
+		{"large.pdf", StatusRejected, ErrFileTooLarge},
+		{"bomb.pdf", StatusRejected, ErrInvalidArchive},
+	}
+	if len(reports) != len(want) {
+		t.Fatalf("IngestArchive() = %d reports %+v, want %d", len(reports), reports, len(want))
+	}
+	for i, report := range reports {
+		if report.Filename != want[i].filename || report.Status != want[i].status || !errors.Is(report.Err, want[i].err) {
+			t.Errorf("report %d = %s %s %v, want %s %s %v", i, report.Filename, report.Status, report.Err,
+				want[i].filename, want[i].status, want[i].err)
+		}
+	}
+
+	keys, err := store.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("stored files = %v, want only the invoice", keys)
+	}
+}
+
+func TestReadEntry(t *testing.T) {
+	ingester, _, _ := newTestIngester(t)
+	ingester.limits.MaxFileSize = 4096
+	archive := testArchive(t,
+		archiveEntry{name: "small.pdf", content: make([]byte, 4096)},
+		archiveEntry{name: "large.pdf", content: make([]byte, 4097)},
+	)
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the content is limited as it is decompressed, not only by the size in the header
+	if content, err := ingester.readEntry(reader.File[0]); err != nil || len(content) != 4096 {
+		t.Errorf("readEntry(small.pdf) = %d bytes, %v, want 4096", len(content), err)
+	}
+	if content, err := ingester.readEntry(reader.File[1]); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("readEntry(large.pdf) = %d bytes, %v, want %v", len(content), err, ErrFileTooLarge)
+	}
+}
+
+func TestIngestArchiveEntries(t *testing.T) {
+	entries := func(count int, hidden int) []archiveEntry {
+		var entries []archiveEntry
+		for i := range count {
+			entries = append(entries, archiveEntry{name: fmt.Sprintf("%03d.txt", i), content: []byte("not an invoice")})
+		}
+		for i := range hidden {
+			entries = append(entries, archiveEntry{name: fmt.Sprintf("__MACOSX/._%03d.txt", i), content: []byte("metadata")})
+		}
+		return entries
+	}
+
+	tests := []struct {
+		name        string
+		content     []byte
+		wantReports int
+		wantErr     error
+	}{
+		{"at the limit", testArchive(t, entries(MaxArchiveEntries, 0)...), MaxArchiveEntries, nil},
+		// skipped entries do not count
+		{"at the limit with metadata", testArchive(t, entries(MaxArchiveEntries, 10)...), MaxArchiveEntries, nil},
+		{"over the limit", testArchive(t, entries(MaxArchiveEntries+1, 0)...), 0, ErrInvalidArchive},
+		{"empty", testArchive(t), 0, nil},
+		{"not an archive", []byte("PK\x03\x04 truncated"), 0, ErrInvalidArchive},
+	}
+	for _, test := range tests {
+		ingester, _, _ := newTestIngester(t)
+		reports, err := ingester.IngestArchive(context.Background(), "invoices.zip", test.content)
+		if !errors.Is(err, test.wantErr) || test.wantErr == nil && err != nil {
+			t.Errorf("IngestArchive(%s) error = %v, want %v", test.name, err, test.wantErr)
+		}
+		if len(reports) != test.wantReports {
+			t.Errorf("IngestArchive(%s) = %d reports, want %d", test.name, len(reports), test.wantReports)
+		}
+		for _, report := range reports {
+			if report.Status != StatusRejected || !errors.Is(report.Err, ErrUnsupportedFileType) {
+				t.Errorf("IngestArchive(%s) report = %+v, want %s", test.name, report, ErrUnsupportedFileType)
+				break
+			}
+		}
+	}
+}
+
+func TestIngestArchiveCanceled(t *testing.T) {
+	ingester, _, _ := newTestIngester(t)
+	archive := testArchive(t, archiveEntry{name: "a.pdf", content: testPDF("Invoice INV-1")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reports, err := ingester.IngestArchive(ctx, "invoices.zip", archive)
+	if !errors.Is(err, context.Canceled) || len(reports) != 0 {
+		t.Errorf("IngestArchive() of a canceled context = %+v, %v, want %v", reports, err, context.Canceled)
+	}
+}
+
+// testConverter converts every HEIC image to the same JPEG, or fails
+type testConverter struct {
+	jpeg  []byte
+	err   error
+	calls int
+}
+
+func (c *testConverter) ToJPEG(_ context.Context, _ []byte) ([]byte, error) {
+	c.calls++
+	return c.jpeg, c.err
+}
+
+func TestIngestImage(t *testing.T) {
+	photo := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	var jpegImage, pngImage bytes.Buffer
+	if err := jpeg.Encode(&jpegImage, photo, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&pngImage, photo); err != nil {
+		t.Fatal(err)
+	}
+	heic := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00 photo")
+	killed := errors.New("signal: killed")
+
+	tests := []struct {
+		name       string
+		content    []byte
+		converter  *testConverter
+		wantStatus Status
+		wantErr    error
+		wantCalls  int
+	}{
+		{"jpeg", jpegImage.Bytes(), nil, StatusCreated, nil, 0},
+		{"png", pngImage.Bytes(), nil, StatusCreated, nil, 0},
+		{"heic", heic, &testConverter{jpeg: jpegImage.Bytes()}, StatusCreated, nil, 1},
+		{"heic without converter", heic, nil, StatusRejected, ErrUnsupportedFileType, 0},
+		{"broken heic", heic, &testConverter{err: fmt.Errorf("%w: no ftyp box", document.ErrInvalidImage)}, StatusRejected, document.ErrInvalidImage, 1},
+		// the upload may be retried once the converter works again
+		{"heic of a failing converter", heic, &testConverter{err: killed}, StatusFailed, killed, 1},
+		{"broken jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), nil, StatusRejected, document.ErrInvalidImage, 0},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00"), nil, StatusRejected, ErrUnsupportedFileType, 0},
+	}
+	for _, test := range tests {
+		ingester, _, store := newTestIngester(t)
+		if test.converter != nil {
+			ingester.imageConverter = test.converter
+		}
+
+		reports := ingester.IngestFile(context.Background(), "photo", test.content, nil)
+		if len(reports) != 1 {
+			t.Fatalf("IngestFile(%s) = %d reports, want 1", test.name, len(reports))
+		}
+		report := reports[0]
+		if report.Status != test.wantStatus || !errors.Is(report.Err, test.wantErr) {
+			t.Errorf("IngestFile(%s) = %s %v, want %s %v", test.name, report.Status, report.Err, test.wantStatus, test.wantErr)
+		}
+		if test.converter != nil && test.converter.calls != test.wantCalls {
+			t.Errorf("IngestFile(%s) converted %d times, want %d", test.name, test.converter.calls, test.wantCalls)
+		}
+		if test.wantStatus != StatusCreated {
+			continue
+		}
+
+		// the image is stored as a PDF under the hash of the upload
+		reader, err := store.Get(context.Background(), report.FileHash+".pdf")
+		if err != nil {
+			t.Errorf("IngestFile(%s) stored no PDF: %v", test.name, err)
+			continue
+		}
+		content, _ := io.ReadAll(reader)
+		if pages, err := document.ValidatePDF(content, 0); err != nil || pages != 1 {
+			t.Errorf("IngestFile(%s) stored %d pages, %v, want a single page PDF", test.name, pages, err)
+		}
+	}
+}
+
+// cancelingStore cancels the context of the upload once a file is stored, like the shutdown timeout cutting off a
+// request. Files are only deleted with a context that is not cancelled
+type cancelingStore struct {
+	filestore.Store
+	cancel context.CancelFunc
+}
+
+func (s *cancelingStore) Put(ctx context.Context, key string, reader io.Reader, contentType string) error {
+	err := s.Store.Put(ctx, key, reader, contentType)
+	s.cancel()
+	return err
+}
+
+func (s *cancelingStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.Delete(ctx, key)
+}
+
+func TestIngestRollback(t *testing.T) {
+	ingester, manager, memoryStore := newTestIngester(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	ingester.fileStore = &cancelingStore{Store: memoryStore, cancel: cancel}
+	// the invoice cannot be stored once the file is
+	sqlDB, err := manager.DB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.Close()
+
+	report := ingester.Ingest(ctx, "invoice.pdf", testPDF("Invoice INV-1"), nil)
+	if report.Status != StatusFailed || report.Err == nil {
+		t.Errorf("Ingest() = %s %v, want failed", report.Status, report.Err)
+	}
+	if ctx.Err() == nil {
+		t.Fatalf("context was not cancelled while the file was stored")
+	}
+	// the file would be taken for a duplicate on the next upload
+	keys, err := memoryStore.List(context.Background())
+	if err != nil || len(keys) != 0 {
+		t.Errorf("stored files after the rollback = %v, %v, want none", keys, err)
+	}
+}
+
+// blockingStore holds uploads until release is closed, stored is signalled as each upload starts
+type blockingStore struct {
+	filestore.Store
+	stored  chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) Put(ctx context.Context, key string, reader io.Reader, contentType string) error {
+	s.stored <- struct{}{}
+	<-s.release
+	return s.Store.Put(ctx, key, reader, contentType)
+}
+
+func TestIngesterShutdown(t *testing.T) {
+	ingester, manager, memoryStore := newTestIngester(t)
+	store := &blockingStore{Store: memoryStore, stored: make(chan struct{}, 1), release: make(chan struct{})}
+	ingester.fileStore = store
+
+	reports := make(chan Report, 1)
+	go func() {
+		reports <- ingester.Ingest(context.Background(), "invoice.pdf", testPDF("Invoice INV-1"), nil)
+	}()
+	<-store.stored
+
+	shutdown := make(chan struct{})
+	go func() {
+		ingester.Shutdown()
+		close(shutdown)
+	}()
+	// new files are turned away while the one being stored is waited for
+	for {
+		ingester.mu.Lock()
+		closed := ingester.closed
+		ingester.mu.Unlock()
+		if closed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if report := ingester.Ingest(context.Background(), "late.pdf", testPDF("Invoice INV-2"), nil); !errors.Is(report.Err, ErrShuttingDown) {
+		t.Errorf("Ingest() while shutting down = %s %v, want %v", report.Status, report.Err, ErrShuttingDown)
+	}
+	select {
+	case <-shutdown:
+		t.Fatalf("Shutdown() returned while a file was being stored")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(store.release)
+	<-shutdown
+	// the file is stored and scheduled before the processor is stopped
+	report := <-reports
+	if report.Status != StatusCreated {
+		t.Fatalf("Ingest() during the shutdown = %s %v, want created", report.Status, report.Err)
+	}
+	if job, err := manager.GetJob(report.JobID); err != nil || job == nil || job.Status != model.JobPending {
+		t.Errorf("job of the file = %+v, %v, want pending", job, err)
+	}
+}
@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"bytes"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"strings"
+)
+
+// invoiceTypes are the types of the accepted invoice files, see sniff
+var invoiceTypes = map[string]bool{".pdf": true, ".xml": true, ".jpg": true, ".png": true, ".heic": true}
+
+// heifBrands are the brands of the ftyp box of HEIC and HEIF images
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true, "hevc": true, "hevx": true, "hevm": true, "hevs": true,
+	"mif1": true, "msf1": true,
+}
+
+// emailFields are header fields of which an email has at least one, see isEmailHeader
+var emailFields = map[string]bool{
+	"from": true, "to": true, "date": true, "subject": true, "message-id": true, "received": true, "return-path": true,
+	"mime-version": true, "delivered-to": true,
+}
+
+// maxEmailHeader is how much of a file is looked at to tell whether it starts with the header of an email
+const maxEmailHeader = 64 * 1024
+
+// sniff tells the type of a file by its magic bytes, as the extension it is usually named with, e.g. ".pdf". Returns
+// an empty string for other files. File names are not trusted: scanners name files as they like, phones use upper
+// case extensions and anything can be renamed to .pdf
+func sniff(content []byte) string {
+	switch {
+	case document.IsPDF(content):
+		return ".pdf"
+	case bytes.HasPrefix(content, []byte("\xFF\xD8\xFF")):
+		return ".jpg"
+	case bytes.HasPrefix(content, []byte("\x89PNG\r\n\x1A\n")):
+		return ".png"
+	case len(content) >= 12 && string(content[4:8]) == "ftyp" && heifBrands[string(content[8:12])]:
+		return ".heic"
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		return ".zip"
+	// every message of an mbox file starts with a "From sender date" line
+	case bytes.HasPrefix(content, []byte("From ")):
+		return ".mbox"
+	}
+
+	// XML has no magic bytes, a declaration or the root element come first
+	text := bytes.TrimLeft(bytes.TrimPrefix(content, []byte("\xEF\xBB\xBF")), " \t\r\n")
+	if bytes.HasPrefix(text, []byte("<")) {
+		return ".xml"
+	}
+	if isEmailHeader(content) {
+		return ".eml"
+	}
+	return ""
+}
+
+// isEmailHeader reports whether the content starts with the header of an RFC 822 email: "Name: value" fields up to an
+// empty line, with folded lines continuing the field before, of which one is a field every email has
+func isEmailHeader(content []byte) bool {
+	header := content
+	if len(header) > maxEmailHeader {
+		// the last line is cut off
+		header = header[:bytes.LastIndexByte(header[:maxEmailHeader], '\n')+1]
+	}
+	known := false
+	for i, line := range bytes.Split(header, []byte("\n")) {
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if len(line) == 0 {
+			return i > 0 && known
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if i == 0 {
+				return false
+			}
+			continue
+		}
+
+		name, _, found := bytes.Cut(line, []byte(":"))
+		if !found || len(name) == 0 {
+			return false
+		}
+		for _, c := range name {
+			if c <= ' ' || c > '~' {
+				return false
+			}
+		}
+		known = known || emailFields[strings.ToLower(string(name))]
+	}
+	// the header does not end within the part looked at
+	return known
+}
+
+// IsArchive reports whether the file is a ZIP archive of invoices rather than an invoice, by its content
+func IsArchive(content []byte) bool {
+	return sniff(content) == ".zip"
+}
+
+// IsEmail reports whether the file is an email or an mbox file of emails rather than an invoice, by its content
+func IsEmail(content []byte) bool {
+	extension := sniff(content)
+	return extension == ".eml" || extension == ".mbox"
+}
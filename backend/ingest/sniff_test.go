@@ -0,0 +1,47 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"pdf", "%PDF-1.7\n%\xE2\xE3\xCF\xD3\n1 0 obj", ".pdf"},
+		{"pdf after junk", "\x00\x00junk%PDF-1.4\n", ".pdf"},
+		{"jpeg", "\xFF\xD8\xFF\xE0\x00\x10JFIF", ".jpg"},
+		{"png", "\x89PNG\r\n\x1A\n\x00\x00\x00\rIHDR", ".png"},
+		{"heic", "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00", ".heic"},
+		{"avif is not heic", "\x00\x00\x00\x18ftypavif\x00\x00\x00\x00", ""},
+		{"zip", "PK\x03\x04\x14\x00\x00\x00", ".zip"},
+		{"xml", "<?xml version=\"1.0\"?><Invoice/>", ".xml"},
+		{"xml with bom", "\xEF\xBB\xBF\n  <rsm:CrossIndustryInvoice/>", ".xml"},
+		{"mbox", "From billing@example.com Mon Jan  1 00:00:00 2024\nFrom: billing@example.com\n\nHello", ".mbox"},
+		{"email", "Return-Path: <billing@example.com>\r\nFrom: ACME <billing@example.com>\r\nSubject: Invoice\r\n\r\nHello", ".eml"},
+		{"email with folded field", "Received: from mail.example.com\n\tby mx.example.org\nTo: me@example.org\n\nHello", ".eml"},
+		{"email without known field", "X-Custom: 1\n\nHello", ""},
+		{"email header starting with a folded line", " From: a\n\nHello", ""},
+		{"text", "Invoice 2024-001\nTotal: 12.00 EUR\n", ""},
+		{"text with a colon", "Total: 12.00 EUR\nThank you for your order", ""},
+		{"empty", "", ""},
+	}
+	for _, test := range tests {
+		if got := sniff([]byte(test.content)); got != test.want {
+			t.Errorf("sniff of %s = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestIsEmailHeaderLimit(t *testing.T) {
+	// a header that does not end within the part looked at is taken by its fields so far
+	for _, padding := range []int{100, 101, 102, 103} {
+		long := "From: billing@example.com\n" + strings.Repeat("X-Padding: "+strings.Repeat("a", padding)+"\n", maxEmailHeader/100)
+		if !isEmailHeader([]byte(long)) {
+			t.Errorf("isEmailHeader of a long header padded by %d = false, want true", padding)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Payment statuses of invoices, computed from the due date for the current day
+const (
+	StatusPaid      = "paid"
+	StatusScheduled = "scheduled" // unpaid with a transfer scheduled, see Invoice.PaymentScheduled
+	StatusOverdue   = "overdue"   // unpaid past the due date
+	StatusDueSoon   = "dueSoon"   // unpaid and due within DueSoonDays, including today
+	StatusUpcoming  = "upcoming"  // unpaid and due later
+	StatusNoDueDate = "noDueDate" // unpaid without a due date
+)
+
+// DueSoonDays is how many days ahead unpaid invoices are due soon
+const DueSoonDays = 7
+
+// ValidStatus reports whether the status is one of the payment statuses
+func ValidStatus(status string) bool {
+	switch status {
+	case StatusPaid, StatusScheduled, StatusOverdue, StatusDueSoon, StatusUpcoming, StatusNoDueDate:
+		return true
+	default:
+		return false
+	}
+}
+
+// PaymentStatus returns the status of the invoice on the day
+func (i *Invoice) PaymentStatus(today time.Time) string {
+	due := i.DueDate.Time()
+	switch {
+	case i.IsPaid != nil && *i.IsPaid:
+		return StatusPaid
+	case !i.PaymentScheduled.IsZero():
+		return StatusScheduled
+	case due == nil:
+		return StatusNoDueDate
+	case due.Before(today):
+		return StatusOverdue
+	case !due.After(today.AddDate(0, 0, DueSoonDays)):
+		return StatusDueSoon
+	default:
+		return StatusUpcoming
+	}
+}
+
+// SetPaymentStatus fills in the fields computed for the day, the status and the terms of paying early
+func (i *Invoice) SetPaymentStatus(today time.Time) {
+	i.Status = i.PaymentStatus(today)
+	i.Outstanding = i.Balance()
+	i.EarlyPayment = nil
+	if i.Status != StatusPaid {
+		i.EarlyPayment = i.earlyPayment()
+	}
+}
+
+// AgingReport sums up the unpaid invoices by how many days they are past their due date
+type AgingReport struct {
+	Date    string        `json:"date"` // the day the ages are counted to, YYYY-MM-DD
+	Buckets []AgingBucket `json:"buckets"`
+}
+
+// AgingBucket holds the unpaid invoices of an age range
+type AgingBucket struct {
+	Bucket   string  `json:"bucket"`  // "current", "1-30", "31-60", "61-90", "90+" or "noDueDate"
+	MinDays  *int    `json:"minDays"` // days past the due date, inclusive. Nil if unbounded or without a due date
+	MaxDays  *int    `json:"maxDays"` // inclusive, nil if unbounded
+	Invoices int     `json:"invoices"`
+	Totals   []Money `json:"totals"` // outstanding by currency, invoices without an amount are only counted
+}
+
+// agingBuckets are the age ranges in days past the due date, inclusive. Invoices that are not overdue yet are current
+var agingBuckets = []struct {
+	name             string
+	minDays, maxDays int
+}{
+	{"current", math.MinInt, 0},
+	{"1-30", 1, 30},
+	{"31-60", 31, 60},
+	{"61-90", 61, 90},
+	{"90+", 91, math.MaxInt},
+}
+
+// AgeInvoices sums up the unpaid invoices by age on the day. Paid invoices are skipped
+func AgeInvoices(invoices []*Invoice, today time.Time) *AgingReport {
+	report := &AgingReport{Date: today.Format("2006-01-02"), Buckets: make([]AgingBucket, 0, len(agingBuckets)+1)}
+	for _, bucket := range agingBuckets {
+		report.Buckets = append(report.Buckets, AgingBucket{
+			Bucket:  bucket.name,
+			MinDays: agingBound(bucket.minDays),
+			MaxDays: agingBound(bucket.maxDays),
+			Totals:  make([]Money, 0),
+		})
+	}
+	report.Buckets = append(report.Buckets, AgingBucket{Bucket: StatusNoDueDate, Totals: make([]Money, 0)})
+
+	for _, invoice := range invoices {
+		if invoice.IsPaid != nil && *invoice.IsPaid {
+			continue
+		}
+
+		bucket := &report.Buckets[len(report.Buckets)-1]
+		if due := invoice.DueDate.Time(); due != nil {
+			days := int(today.Sub(*due).Hours() / 24)
+			for i, ages := range agingBuckets {
+				if days >= ages.minDays && days <= ages.maxDays {
+					bucket = &report.Buckets[i]
+				}
+			}
+		}
+		bucket.add(invoice)
+	}
+
+	for i := range report.Buckets {
+		totals := report.Buckets[i].Totals
+		sort.Slice(totals, func(a, b int) bool {
+			return totals[a].Currency < totals[b].Currency
+		})
+	}
+	return report
+}
+
+// agingBound returns the bound of an age range, nil if it is unbounded
+func agingBound(days int) *int {
+	if days == math.MinInt || days == math.MaxInt {
+		return nil
+	}
+	return &days
+}
+
+func (b *AgingBucket) add(invoice *Invoice) {
+	b.Invoices++
+	balance := invoice.Balance()
+	if balance == nil {
+		return
+	}
+
+	for i := range b.Totals {
+		if b.Totals[i].Currency == balance.Currency {
+			b.Totals[i].Minor += balance.Minor
+			return
+		}
+	}
+	b.Totals = append(b.Totals, *balance)
+}
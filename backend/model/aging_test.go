@@ -0,0 +1,168 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// day returns the date the days after 2024-03-15, the day the tests count from
+func day(days int) FormDate {
+	return NewFormDate(time.Date(2024, time.March, 15+days, 0, 0, 0, 0, time.UTC))
+}
+
+func TestPaymentStatus(t *testing.T) {
+	paid, unpaid := true, false
+	tests := []struct {
+		name    string
+		invoice Invoice
+		want    string
+	}{
+		{"paid", Invoice{IsPaid: &paid, DueDate: day(-10)}, StatusPaid},
+		{"scheduled", Invoice{IsPaid: &unpaid, DueDate: day(-10), PaymentScheduled: day(1)}, StatusScheduled},
+		{"no due date", Invoice{}, StatusNoDueDate},
+		{"overdue", Invoice{DueDate: day(-1)}, StatusOverdue},
+		{"due today", Invoice{DueDate: day(0)}, StatusDueSoon},
+		{"due on the last day of due soon", Invoice{DueDate: day(DueSoonDays)}, StatusDueSoon},
+		{"upcoming", Invoice{DueDate: day(DueSoonDays + 1)}, StatusUpcoming},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.invoice.PaymentStatus(*day(0).Time()); got != test.want {
+				t.Errorf("PaymentStatus = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestAgeInvoices(t *testing.T) {
+	paid := true
+	invoices := []*Invoice{
+		{DueDate: day(5), Amount: eur(1000)},
+		{DueDate: day(0), Amount: eur(500), PaidAmount: eur(200)},
+		{DueDate: day(-1), Amount: eur(100)},
+		{DueDate: day(-30), Amount: &Money{Minor: 700, Currency: "CHF"}},
+		{DueDate: day(-30), Amount: eur(50)},
+		{DueDate: day(-31)},
+		{DueDate: day(-90), Amount: eur(10)},
+		{DueDate: day(-91), Amount: eur(1)},
+		{Amount: eur(5)},
+		{DueDate: day(-60), Amount: eur(999), IsPaid: &paid},
+	}
+	bound := func(days int) *int {
+		return &days
+	}
+
+	want := &AgingReport{Date: "2024-03-15", Buckets: []AgingBucket{
+		{Bucket: "current", MaxDays: bound(0), Invoices: 2, Totals: []Money{*eur(1300)}},
+		{Bucket: "1-30", MinDays: bound(1), MaxDays: bound(30), Invoices: 3,
+			Totals: []Money{{Minor: 700, Currency: "CHF"}, *eur(150)}},
+		{Bucket: "31-60", MinDays: bound(31), MaxDays: bound(60), Invoices: 1, Totals: []Money{}},
+		{Bucket: "61-90", MinDays: bound(61), MaxDays: bound(90), Invoices: 1, Totals: []Money{*eur(10)}},
+		{Bucket: "90+", MinDays: bound(91), Invoices: 1, Totals: []Money{*eur(1)}},
+		{Bucket: StatusNoDueDate, Invoices: 1, Totals: []Money{*eur(5)}},
+	}}
+	if got := AgeInvoices(invoices, *day(0).Time()); !reflect.DeepEqual(got, want) {
+		t.Errorf("AgeInvoices = %+v, want %+v", got, want)
+	}
+}
+
+func TestDeriveDueDate(t *testing.T) {
+	terms := &PaymentTerms{NetDays: 30}
+	tests := []struct {
+		name    string
+		invoice Invoice
+		want    FormDate
+		derived bool
+	}{
+		{"from the terms", Invoice{Date: day(0), PaymentTerms: terms}, day(30), true},
+		{"due on receipt", Invoice{Date: day(0), PaymentTerms: &PaymentTerms{}}, day(0), true},
+		{"without terms", Invoice{Date: day(0)}, FormDate{}, false},
+		{"without a date", Invoice{PaymentTerms: terms}, FormDate{}, false},
+		{"entered due date", Invoice{Date: day(0), DueDate: day(10), PaymentTerms: terms}, day(10), false},
+		{
+			name: "extracted due date",
+			invoice: Invoice{Date: day(0), DueDate: day(10), PaymentTerms: terms,
+				FieldSources: FieldSources{dueDateField: "rules"}},
+			want: day(10),
+		},
+		{
+			// the date changed since the due date was derived
+			name: "derived due date",
+			invoice: Invoice{Date: day(1), DueDate: day(30), PaymentTerms: terms,
+				FieldSources: FieldSources{dueDateField: SourcePaymentTerms}},
+			want:    day(31),
+			derived: true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			derived := test.invoice.DeriveDueDate()
+			if derived != test.derived || !reflect.DeepEqual(test.invoice.DueDate.Time(), test.want.Time()) {
+				t.Errorf("DeriveDueDate = %t, due date %v, want %t, %v", derived, test.invoice.DueDate.Time(),
+					test.derived, test.want.Time())
+			}
+			if derived && test.invoice.FieldSources[dueDateField] != SourcePaymentTerms {
+				t.Errorf("due date source = %q, want it derived", test.invoice.FieldSources[dueDateField])
+			}
+		})
+	}
+}
+
+func TestSetPaymentStatus(t *testing.T) {
+	paid := true
+	tests := []struct {
+		name        string
+		invoice     Invoice
+		status      string
+		outstanding *Money
+		early       *EarlyPayment
+	}{
+		{
+			name:        "discount",
+			invoice:     Invoice{Date: day(0), DueDate: day(30), Amount: eur(10000), PaymentTerms: &PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 10}},
+			status:      StatusUpcoming,
+			outstanding: eur(10000),
+			early:       &EarlyPayment{DueDate: day(10), Amount: eur(9800)},
+		},
+		{
+			name:        "rounded discount",
+			invoice:     Invoice{Date: day(-40), DueDate: day(-10), Amount: eur(3333), PaidAmount: eur(1000), PaymentTerms: &PaymentTerms{NetDays: 30, DiscountPercent: 1.5, DiscountDays: 5}},
+			status:      StatusOverdue,
+			outstanding: eur(2333),
+			early:       &EarlyPayment{DueDate: day(-35), Amount: eur(3283)},
+		},
+		{
+			name:    "without an amount",
+			invoice: Invoice{Date: day(0), PaymentTerms: &PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 10}},
+			status:  StatusNoDueDate,
+			early:   &EarlyPayment{DueDate: day(10)},
+		},
+		{
+			name:        "paid",
+			invoice:     Invoice{IsPaid: &paid, Date: day(0), Amount: eur(100), PaidAmount: eur(100), PaymentTerms: &PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 10}},
+			status:      StatusPaid,
+			outstanding: eur(0),
+		},
+		{
+			name:        "without a discount",
+			invoice:     Invoice{Date: day(0), DueDate: day(3), Amount: eur(100), PaymentTerms: &PaymentTerms{NetDays: 3}},
+			status:      StatusDueSoon,
+			outstanding: eur(100),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.invoice.SetPaymentStatus(*day(0).Time())
+			if test.invoice.Status != test.status || !reflect.DeepEqual(test.invoice.Outstanding, test.outstanding) {
+				t.Errorf("status, outstanding = %q, %v, want %q, %v", test.invoice.Status, test.invoice.Outstanding,
+					test.status, test.outstanding)
+			}
+			early := test.invoice.EarlyPayment
+			if (early == nil) != (test.early == nil) || (early != nil && (!reflect.DeepEqual(early.DueDate.Time(), test.early.DueDate.Time()) ||
+				!reflect.DeepEqual(early.Amount, test.early.Amount))) {
+				t.Errorf("early payment = %+v, want %+v", early, test.early)
+			}
+		})
+	}
+}
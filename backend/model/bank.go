@@ -0,0 +1,96 @@
+package model
+
+import (
+	"database/sql/driver"
+	"time"
+)
+
+// The states of a bank transaction
+const (
+	TransactionUnmatched  = "unmatched"  // no open proposals
+	TransactionProposed   = "proposed"   // waiting for a proposal to be confirmed or rejected
+	TransactionReconciled = "reconciled" // a proposal was confirmed and recorded as a payment
+)
+
+// The states of a match proposal
+const (
+	ProposalOpen      = "open"
+	ProposalConfirmed = "confirmed"
+	ProposalRejected  = "rejected"
+)
+
+// ValidTransactionStatus reports whether the status is one of the transaction states
+func ValidTransactionStatus(status string) bool {
+	return status == TransactionUnmatched || status == TransactionProposed || status == TransactionReconciled
+}
+
+// ValidProposalStatus reports whether the status is one of the proposal states
+func ValidProposalStatus(status string) bool {
+	return status == ProposalOpen || status == ProposalConfirmed || status == ProposalRejected
+}
+
+// BankImport is an uploaded bank statement
+type BankImport struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Filename   string    `json:"filename"`
+	Format     string    `json:"format"`  // camt.053, mt940 or csv
+	Account    string    `json:"account"` // IBAN or account number of the statement, empty if not stated
+	Imported   int       `json:"imported"`
+	Duplicates int       `json:"duplicates"`         // transactions that were imported before with another statement
+	Proposals  int       `gorm:"-" json:"proposals"` // match proposals made for the imported transactions
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// BankTransaction is a booking of an imported bank statement. Debits are negative, they pay invoices
+type BankTransaction struct {
+	ID               uint            `gorm:"primaryKey" json:"id"`
+	ImportID         uint            `gorm:"index" json:"importId"`
+	Account          string          `json:"account"`
+	BookingDate      FormDate        `json:"bookingDate"`
+	ValueDate        FormDate        `json:"valueDate"`
+	Amount           Money           `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	Counterparty     string          `json:"counterparty"`
+	CounterpartyIBAN string          `gorm:"column:counterparty_iban" json:"counterpartyIban"`
+	RemittanceInfo   string          `json:"remittanceInfo"`
+	Reference        string          `json:"reference"`
+	Fingerprint      string          `gorm:"uniqueIndex" json:"-"` // identifies the booking when statements overlap
+	Status           string          `gorm:"index" json:"status"`
+	PaymentID        *uint           `json:"paymentId"` // the payment recorded when a proposal was confirmed
+	Proposals        []MatchProposal `gorm:"foreignKey:TransactionID" json:"proposals,omitempty"`
+	CreatedAt        time.Time       `json:"createdAt"`
+	UpdatedAt        time.Time       `json:"updatedAt"`
+}
+
+// PaymentAmount is the amount the transaction paid, debits pay invoices and credits are refunds
+func (t *BankTransaction) PaymentAmount() Money {
+	return Money{Minor: -t.Amount.Minor, Currency: t.Amount.Currency}
+}
+
+// MatchProposal proposes that a bank transaction paid an invoice
+type MatchProposal struct {
+	ID            uint             `gorm:"primaryKey" json:"id"`
+	TransactionID uint             `gorm:"index" json:"transactionId"`
+	InvoiceHash   string           `gorm:"index" json:"invoiceHash"`
+	Confidence    float64          `json:"confidence"` // from 0 to 1
+	Reasons       MatchReasons     `json:"reasons"`    // the signals that matched, e.g. amount and invoiceNumber
+	Status        string           `gorm:"index" json:"status"`
+	Transaction   *BankTransaction `gorm:"foreignKey:TransactionID" json:"transaction,omitempty"`
+	Invoice       *Invoice         `gorm:"foreignKey:InvoiceHash;references:FileHash" json:"invoice,omitempty"`
+	CreatedAt     time.Time        `json:"createdAt"`
+	UpdatedAt     time.Time        `json:"updatedAt"`
+}
+
+// MatchReasons is a list of match signals stored as a JSON encoded text column, like Aliases
+type MatchReasons []string
+
+func (r *MatchReasons) Scan(value interface{}) error {
+	return (*Aliases)(r).Scan(value)
+}
+
+func (r MatchReasons) Value() (driver.Value, error) {
+	return Aliases(r).Value()
+}
+
+func (MatchReasons) GormDataType() string {
+	return "text"
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"sort"
+	"strings"
+)
+
+// currencyExponents are the minor units of the active ISO 4217 currencies, funds codes included. Most currencies have
+// two decimals, only the exceptions are listed with their own exponent
+var currencyExponents = func() map[string]int {
+	exponents := map[string]int{
+		// no minor units
+		"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0, "RWF": 0,
+		"UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+		// thousandths
+		"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+		// units of account
+		"CLF": 4, "UYW": 4,
+	}
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF
+		CHW CNY COP COU CRC CUP CVE CZK DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL HTG
+		HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR
+		MWK MXN MXV MYR MZN NAD NGN NIO NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR SBD SCR SDG SEK SGD
+		SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD TWD TZS UAH USD USN UYU UZS VED VES WST XCD XCG
+		YER ZAR ZMW ZWG`) {
+		exponents[code] = 2
+	}
+	return exponents
+}()
+
+// CurrencyExponent returns the number of decimals of the minor unit of the currency, false if the code is not
+// an ISO 4217 currency
+func CurrencyExponent(code string) (int, bool) {
+	exponent, ok := currencyExponents[code]
+	return exponent, ok
+}
+
+// ValidCurrency reports whether the code is an ISO 4217 currency, codes are upper case
+func ValidCurrency(code string) bool {
+	_, ok := currencyExponents[code]
+	return ok
+}
+
+// CurrenciesWithExponent returns the sorted codes of the currencies with the given number of decimals
+func CurrenciesWithExponent(exponent int) []string {
+	var codes []string
+	for code, e := range currencyExponents {
+		if e == exponent {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
@@ -64,3 +64,17 @@ func (f FormDate) Value() (driver.Value, error) {
 
 	return *f.date, nil
 }
+
+func NewFormDate(date time.Time) FormDate {
+	return FormDate{&date}
+}
+
+// IsZero reports whether the date is not set
+func (f FormDate) IsZero() bool {
+	return f.date == nil
+}
+
+// Time returns the date, nil if it is not set
+func (f FormDate) Time() *time.Time {
+	return f.date
+}
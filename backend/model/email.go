@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// EmailSource is the email an invoice file came attached to, see the email package
+type EmailSource struct {
+	From      string     `json:"from"` // e.g. "Acme GmbH <billing@acme.example>"
+	Subject   string     `json:"subject"`
+	MessageID string     `json:"messageId"` // without the angle brackets
+	Date      *time.Time `json:"date"`
+}
@@ -11,11 +11,37 @@ type Invoice struct {
 	OriginalFileName string   `json:"originalFileName"`
 	ID               *string  `json:"id"` // not an id in database sense, just to cover invoice "numbers" with any characters
 	Date             FormDate `json:"date"`
-	Amount           *float64 `json:"amount"`
-	IsPaid           *bool    `json:"isPaid"`
+	Amount           *Money   `gorm:"embedded;embeddedPrefix:amount_" json:"amount"` // gross, the amount to pay
+	IsPaid           *bool    `json:"isPaid"`                                        // derived from the payments, unless there are none
 	IsReviewed       *bool    `json:"isReviewed"`
 	RawText          string   `json:"-"`
 	FileExists       bool     `json:"fileExists"` // if the file is stored in filestore
+	// the email the file was attached to, nil for files that were uploaded
+	Email    *EmailSource `gorm:"embedded;embeddedPrefix:email_" json:"email,omitempty"`
+	VendorID *uint        `json:"vendorId"`
+	Vendor   *Vendor      `json:"vendor,omitempty"`
+
+	LineItems      []LineItem `gorm:"foreignKey:InvoiceHash;references:FileHash" json:"lineItems,omitempty"`
+	TotalsMismatch bool       `json:"totalsMismatch"` // line items plus tax do not add up to the amount, see TotalsMismatch
+
+	NetAmount    *Money    `gorm:"embedded;embeddedPrefix:net_amount_" json:"netAmount"`
+	TaxAmount    *Money    `gorm:"embedded;embeddedPrefix:tax_amount_" json:"taxAmount"`
+	TaxBreakdown []TaxLine `gorm:"foreignKey:InvoiceHash;references:FileHash" json:"taxBreakdown,omitempty"` // by rate
+	TaxMismatch  bool      `json:"taxMismatch"`                                                              // see TaxMismatch
+
+	DueDate      FormDate      `json:"dueDate"` // extracted, entered or derived from the payment terms, see DeriveDueDate
+	PaymentTerms *PaymentTerms `gorm:"embedded;embeddedPrefix:payment_terms_" json:"paymentTerms"`
+	// computed for the current day by SetPaymentStatus, not stored
+	Status       string        `gorm:"-" json:"status"`
+	EarlyPayment *EarlyPayment `gorm:"-" json:"earlyPayment"` // nil if there is no discount for paying early
+
+	Payments    []Payment `gorm:"foreignKey:InvoiceHash;references:FileHash" json:"payments,omitempty"`
+	PaidAmount  *Money    `gorm:"embedded;embeddedPrefix:paid_amount_" json:"paidAmount"` // payments that are not voided
+	Outstanding *Money    `gorm:"-" json:"outstanding"`                                   // see Balance, set by SetPaymentStatus
+	// the execution date of the SEPA transfer exported for the invoice, nil if none is scheduled
+	PaymentScheduled FormDate `json:"paymentScheduled"`
+
+	FieldSources FieldSources `json:"fieldSources"` // which extractor found each of the extracted fields
 }
 
 func (i *Invoice) FromFormData(form *url.Values) {
@@ -32,7 +58,15 @@ func (i *Invoice) FromFormData(form *url.Values) {
 		}
 	}
 
-	amount, err := strconv.ParseFloat(form.Get("amount"), 64)
+	if dueDateStr := form.Get("dueDate"); dueDateStr != "" {
+		dueDate, err := time.Parse("2006-01-02", dueDateStr)
+		if err == nil {
+			i.DueDate = FormDate{&dueDate}
+		}
+	}
+
+	// the currency is optional, amounts without one have two decimals
+	amount, err := ParseMoney(form.Get("amount"), form.Get("currency"))
 	if err == nil {
 		i.Amount = &amount
 	}
@@ -54,9 +88,18 @@ type InvoiceUpdate struct {
 	FileHash   string   `json:"fileHash"` // cannot be updated, used as identifier
 	ID         *string  `json:"id"`
 	Date       FormDate `json:"date"`
-	Amount     *float64 `json:"amount"`
+	Amount     *Money   `json:"amount"`
 	IsPaid     *bool    `json:"isPaid"`
 	IsReviewed *bool    `json:"isReviewed"`
+	VendorID   *uint    `json:"vendorId"`
+
+	NetAmount *Money `json:"netAmount"`
+	TaxAmount *Money `json:"taxAmount"`
+	// replaces the whole breakdown, an empty list removes it
+	TaxBreakdown []TaxLine `json:"taxBreakdown"`
+
+	DueDate      FormDate      `json:"dueDate"` // derived from the payment terms again if the date or the terms change
+	PaymentTerms *PaymentTerms `json:"paymentTerms"`
 }
 
 func (iu *InvoiceUpdate) ToInvoice() *Invoice {
@@ -65,6 +108,14 @@ func (iu *InvoiceUpdate) ToInvoice() *Invoice {
 		ID:       iu.ID,
 		Date:     iu.Date,
 		Amount:   iu.Amount,
+		VendorID: iu.VendorID,
+
+		NetAmount:    iu.NetAmount,
+		TaxAmount:    iu.TaxAmount,
+		TaxBreakdown: iu.TaxBreakdown,
+
+		DueDate:      iu.DueDate,
+		PaymentTerms: iu.PaymentTerms,
 	}
 
 	if iu.IsPaid != nil {
@@ -77,3 +128,10 @@ func (iu *InvoiceUpdate) ToInvoice() *Invoice {
 
 	return invoice
 }
+
+// InvoiceSearchResult is an invoice matching a full-text search query
+type InvoiceSearchResult struct {
+	Invoice
+	Snippet string  `json:"snippet"` // HTML-escaped excerpt of the matching text, matches are wrapped with <mark>
+	Rank    float64 `json:"rank"`    // relevance score, higher is better
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+type JobStatus string
+
+const (
+	JobPending JobStatus = "pending"
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed" // all attempts failed, the job is not retried anymore
+)
+
+// JobFailure classifies the last error of a job
+type JobFailure string
+
+const (
+	JobFailureStorage  JobFailure = "storage" // the file could not be read from the filestore
+	JobFailureLLM      JobFailure = "llm"
+	JobFailureInternal JobFailure = "internal"
+)
+
+// Job is a unit of background processing of an uploaded invoice file: text and field extraction
+type Job struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	FileHash    string     `gorm:"index" json:"fileHash"`
+	Status      JobStatus  `gorm:"index" json:"status"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"maxAttempts"`
+	LastError   string     `json:"-"` // served as an API error, see JobFailure
+	Failure     JobFailure `json:"-"`
+	RunAt       time.Time  `gorm:"index" json:"runAt"` // the job is not picked up before this time, used for retry backoff
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	FinishedAt  *time.Time `json:"finishedAt"`
+}
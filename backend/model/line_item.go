@@ -0,0 +1,60 @@
+package model
+
+// LineItem is a single position of an invoice. Amounts are net, the tax is added on top according to TaxRate
+type LineItem struct {
+	ID          uint     `gorm:"primaryKey" json:"-"`
+	InvoiceHash string   `gorm:"index" json:"-"`
+	Position    int      `json:"position"` // order on the invoice, starting at 1
+	Description string   `json:"description"`
+	Quantity    *float64 `json:"quantity"`
+	UnitPrice   *Price   `gorm:"embedded;embeddedPrefix:unit_price_" json:"unitPrice"` // may have more decimals than the currency
+	TaxRate     *float64 `json:"taxRate"`                                              // percent, e.g. 19 for 19%
+	Total       *Money   `gorm:"embedded;embeddedPrefix:total_" json:"total"`          // net total of the line, quantity times unit price unless discounted
+}
+
+// NetTotal returns the stated line total, or quantity times unit price if the total is missing
+func (li *LineItem) NetTotal() (Money, bool) {
+	if li.Total != nil {
+		return *li.Total, true
+	}
+	if li.Quantity != nil && li.UnitPrice != nil {
+		return li.UnitPrice.Times(*li.Quantity), true
+	}
+
+	return Money{}, false
+}
+
+// GrossTotal returns the line total including tax, rounded to the minor unit. Lines without a tax rate are taken
+// as tax free
+func (li *LineItem) GrossTotal() (Money, bool) {
+	net, ok := li.NetTotal()
+	if !ok {
+		return Money{}, false
+	}
+	if li.TaxRate == nil {
+		return net, true
+	}
+
+	return net.Times(1 + *li.TaxRate/100), true
+}
+
+// TotalsMismatch reports whether the line totals plus tax do not add up to the amount of the invoice.
+// Every line may be off by one minor unit due to rounding. Invoices without an amount or line items cannot be checked
+func TotalsMismatch(amount *Money, items []LineItem) bool {
+	if amount == nil || len(items) == 0 {
+		return false
+	}
+
+	var sum int64
+	for _, item := range items {
+		gross, ok := item.GrossTotal()
+		if !ok || gross.Currency != amount.Currency {
+			// a line without an amount or in another currency, the invoice is flagged until it is corrected
+			return true
+		}
+		sum += gross.Minor
+	}
+
+	difference := sum - amount.Minor
+	return difference > int64(len(items)) || difference < -int64(len(items))
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+)
+
+func TestTotalsMismatch(t *testing.T) {
+	number := func(value float64) *float64 {
+		return &value
+	}
+	line := func(total int64, taxRate float64) LineItem {
+		return LineItem{Total: eur(total), TaxRate: number(taxRate)}
+	}
+	price := &Price{Units: 333, Scale: 2, Currency: "EUR"}
+
+	tests := []struct {
+		name   string
+		amount *Money
+		items  []LineItem
+		want   bool
+	}{
+		{"adds up", eur(11900), []LineItem{line(6000, 19), line(4000, 19)}, false},
+		{"mixed tax rates", eur(19200), []LineItem{line(10000, 19), line(5000, 7), line(1950, 0)}, false},
+		{"without tax rate", eur(1000), []LineItem{{Total: eur(1000)}}, false},
+		{"quantity times unit price", eur(1189), []LineItem{{Quantity: number(3), UnitPrice: price, TaxRate: number(19)}}, false},
+		// 3 × 3.96 are 11.88, the tax on the net sum of 9.99 is 11.89
+		{"rounding of every line", eur(1189), []LineItem{line(333, 19), line(333, 19), line(333, 19)}, false},
+		{"off by one per line", eur(1191), []LineItem{line(333, 19), line(333, 19), line(333, 19)}, false},
+		{"off by more than one per line", eur(1192), []LineItem{line(333, 19), line(333, 19), line(333, 19)}, true},
+		{"too low", eur(11900), []LineItem{line(6000, 19)}, true},
+		{"credit note", eur(-11900), []LineItem{line(-10000, 19)}, false},
+		// the invoice is flagged until the line is corrected
+		{"line without amount", eur(11900), []LineItem{line(10000, 19), {Description: "Shipping", TaxRate: number(19)}}, true},
+		{"line in another currency", eur(11900), []LineItem{line(5000, 19), {Total: &Money{Minor: 5000, Currency: "USD"}, TaxRate: number(19)}}, true},
+		{"amount in another currency", &Money{Minor: 11900, Currency: "CHF"}, []LineItem{line(10000, 19)}, true},
+		// nothing to check
+		{"without amount", nil, []LineItem{line(10000, 19)}, false},
+		{"without line items", eur(11900), nil, false},
+	}
+	for _, test := range tests {
+		if got := TotalsMismatch(test.amount, test.items); got != test.want {
+			t.Errorf("TotalsMismatch(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
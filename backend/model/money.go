@@ -0,0 +1,162 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in the minor units of its currency, e.g. cents for EUR.
+// Stored as two columns, <prefix>minor and <prefix>currency, when embedded into a model
+type Money struct {
+	Minor int64
+	// ISO 4217 code. Empty if not known, such as for amounts recorded before currencies were, those have two decimals
+	Currency string
+}
+
+// ParseMoney parses a decimal amount, such as "-1234.5", in the given currency. Amounts with more decimals than the
+// minor units of the currency are rejected rather than rounded. An empty currency stands for an unknown one
+func ParseMoney(value string, currency string) (Money, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	exponent, ok := CurrencyExponent(currency)
+	if !ok && currency != "" {
+		return Money{}, fmt.Errorf("unknown currency %q", currency)
+	}
+	if currency == "" {
+		exponent = 2
+	}
+
+	value = strings.TrimSpace(value)
+	negative, integer, fraction, err := splitDecimal(value)
+	if err != nil {
+		return Money{}, err
+	}
+	if len(fraction) > exponent {
+		if strings.Trim(fraction[exponent:], "0") != "" {
+			return Money{}, fmt.Errorf("amount %q has more than %d decimals, the minor units of %s", value, exponent, currency)
+		}
+		fraction = fraction[:exponent]
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	minor, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// splitDecimal splits a decimal number such as "-1234.5" into its sign, integer and fraction digits
+func splitDecimal(value string) (bool, string, string, error) {
+	negative := strings.HasPrefix(value, "-")
+	digits := strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+	integer, fraction, _ := strings.Cut(digits, ".")
+	if integer == "" && fraction == "" || strings.Trim(integer+fraction, "0123456789") != "" {
+		return false, "", "", fmt.Errorf("invalid amount %q", value)
+	}
+	return negative, integer, fraction, nil
+}
+
+func (m Money) exponent() int {
+	if exponent, ok := CurrencyExponent(m.Currency); ok {
+		return exponent
+	}
+	return 2
+}
+
+// InCurrency returns the amount in the given currency if its currency is not known yet. The amount is unchanged if
+// the currency is already known or the amount has more decimals than the currency allows
+func (m Money) InCurrency(currency string) Money {
+	if m.Currency != "" || currency == "" {
+		return m
+	}
+	if converted, err := ParseMoney(m.Decimal(), currency); err == nil {
+		return converted
+	}
+	return m
+}
+
+// Decimal formats the amount with all the decimals of its currency, e.g. "1234.50"
+func (m Money) Decimal() string {
+	return m.decimal(m.exponent())
+}
+
+// decimal formats the amount with the number of decimals
+func (m Money) decimal(exponent int) string {
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+
+	digits := strconv.FormatInt(minor, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func (m Money) String() string {
+	if m.Currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + m.Currency
+}
+
+// Times multiplies the amount, rounding to the minor unit. Used for quantities and tax rates
+func (m Money) Times(factor float64) Money {
+	return Money{Minor: int64(math.Round(float64(m.Minor) * factor)), Currency: m.Currency}
+}
+
+// moneyJSON is the JSON representation of Money. The value is a string so that clients do not lose precision,
+// numbers are accepted as well
+type moneyJSON struct {
+	Value    json.RawMessage `json:"value"`
+	Currency string          `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	value, _ := json.Marshal(m.Decimal())
+	return json.Marshal(moneyJSON{Value: value, Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw moneyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return errors.New("amount value is required")
+	}
+	if raw.Currency == "" {
+		return errors.New("amount currency is required")
+	}
+
+	value := string(raw.Value)
+	if strings.HasPrefix(value, `"`) {
+		if err := json.Unmarshal(raw.Value, &value); err != nil {
+			return err
+		}
+	} else if strings.ContainsAny(value, "eE") {
+		return fmt.Errorf("invalid amount %s, exponents are not supported", value)
+	}
+
+	money, err := ParseMoney(value, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
@@ -0,0 +1,198 @@
+package model
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Money
+		wantErr  bool
+	}{
+		{"1234.5", "EUR", Money{Minor: 123450, Currency: "EUR"}, false},
+		{"-0.07", "eur", Money{Minor: -7, Currency: "EUR"}, false},
+		{"+12", "", Money{Minor: 1200}, false},
+		{".5", "USD", Money{Minor: 50, Currency: "USD"}, false},
+		{"12.", "USD", Money{Minor: 1200, Currency: "USD"}, false},
+		{" 12.340 ", "EUR", Money{Minor: 1234, Currency: "EUR"}, false},
+		{"1500", "JPY", Money{Minor: 1500, Currency: "JPY"}, false},
+		{"1.234", "KWD", Money{Minor: 1234, Currency: "KWD"}, false},
+		{"92233720368547758.07", "EUR", Money{Minor: 9223372036854775807, Currency: "EUR"}, false},
+		// more decimals than the minor unit are rejected rather than rounded
+		{"12.345", "EUR", Money{}, true},
+		{"12.345", "", Money{}, true},
+		{"1500.5", "JPY", Money{}, true},
+		{"92233720368547758.08", "EUR", Money{}, true},
+		{"", "EUR", Money{}, true},
+		{"-", "EUR", Money{}, true},
+		{".", "EUR", Money{}, true},
+		{"1,50", "EUR", Money{}, true},
+		{"1e3", "EUR", Money{}, true},
+		{"12", "XYZ", Money{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.value+" "+test.currency, func(t *testing.T) {
+			got, err := ParseMoney(test.value, test.currency)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseMoney error = %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParseMoney = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMoneyDecimal(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Minor: 123450, Currency: "EUR"}, "1234.50"},
+		{Money{Minor: -7, Currency: "EUR"}, "-0.07"},
+		{Money{Minor: 0}, "0.00"},
+		{Money{Minor: 1500, Currency: "JPY"}, "1500"},
+		{Money{Minor: 5, Currency: "KWD"}, "0.005"},
+	}
+	for _, test := range tests {
+		if got := test.money.Decimal(); got != test.want {
+			t.Errorf("Decimal of %+v = %s, want %s", test.money, got, test.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    Money
+		wantErr bool
+	}{
+		{`{"value": "12.34", "currency": "EUR"}`, Money{Minor: 1234, Currency: "EUR"}, false},
+		{`{"value": 12.34, "currency": "EUR"}`, Money{Minor: 1234, Currency: "EUR"}, false},
+		{`{"value": 12.345, "currency": "EUR"}`, Money{}, true},
+		{`{"value": 1e2, "currency": "EUR"}`, Money{}, true},
+		{`{"value": "12.34"}`, Money{}, true},
+		{`{"currency": "EUR"}`, Money{}, true},
+	}
+	for _, test := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(test.json), &got)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("Unmarshal %s = %+v, %v, want %+v, error %v", test.json, got, err, test.want, test.wantErr)
+		}
+	}
+
+	data, err := json.Marshal(Money{Minor: -123450, Currency: "EUR"})
+	if err != nil || string(data) != `{"value":"-1234.50","currency":"EUR"}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+}
+
+func TestMoneyInCurrency(t *testing.T) {
+	tests := []struct {
+		money    Money
+		currency string
+		want     Money
+	}{
+		{Money{Minor: 1234}, "EUR", Money{Minor: 1234, Currency: "EUR"}},
+		{Money{Minor: 150000}, "JPY", Money{Minor: 1500, Currency: "JPY"}},
+		{Money{Minor: 1234}, "KWD", Money{Minor: 12340, Currency: "KWD"}},
+		// 12.34 yen does not exist, the amount keeps its unknown currency
+		{Money{Minor: 1234}, "JPY", Money{Minor: 1234}},
+		{Money{Minor: 1234, Currency: "USD"}, "EUR", Money{Minor: 1234, Currency: "USD"}},
+	}
+	for _, test := range tests {
+		if got := test.money.InCurrency(test.currency); got != test.want {
+			t.Errorf("InCurrency of %+v in %s = %+v, want %+v", test.money, test.currency, got, test.want)
+		}
+	}
+}
+
+func TestParsePrice(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     Price
+		wantErr  bool
+	}{
+		{"0.2345", "EUR", Price{Units: 2345, Scale: 4, Currency: "EUR"}, false},
+		{"19.9", "EUR", Price{Units: 1990, Scale: 2, Currency: "EUR"}, false},
+		{"19.90000", "", Price{Units: 1990, Scale: 2}, false},
+		{"-1.005", "usd", Price{Units: -1005, Scale: 3, Currency: "USD"}, false},
+		{"12", "JPY", Price{Units: 12, Scale: 0, Currency: "JPY"}, false},
+		{"12.5", "JPY", Price{Units: 125, Scale: 1, Currency: "JPY"}, false},
+		{"0.000000001", "EUR", Price{Units: 1, Scale: 9, Currency: "EUR"}, false},
+		{"0.0000000001", "EUR", Price{}, true},
+		{"0.10000000000", "EUR", Price{Units: 10, Scale: 2, Currency: "EUR"}, false},
+		{"abc", "EUR", Price{}, true},
+		{"1", "XYZ", Price{}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.value+" "+test.currency, func(t *testing.T) {
+			got, err := ParsePrice(test.value, test.currency)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParsePrice error = %v, want error %v", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("ParsePrice = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPriceTimes(t *testing.T) {
+	tests := []struct {
+		price    Price
+		quantity float64
+		want     Money
+	}{
+		{Price{Units: 2345, Scale: 4, Currency: "EUR"}, 1000, Money{Minor: 23450, Currency: "EUR"}},
+		{Price{Units: 2345, Scale: 4, Currency: "EUR"}, 3, Money{Minor: 70, Currency: "EUR"}},
+		{Price{Units: 1990, Scale: 2}, 2, Money{Minor: 3980}},
+		{Price{Units: 125, Scale: 1, Currency: "JPY"}, 3, Money{Minor: 38, Currency: "JPY"}},
+		{Price{Units: 5, Scale: 0, Currency: "KWD"}, 2, Money{Minor: 10000, Currency: "KWD"}},
+	}
+	for _, test := range tests {
+		if got := test.price.Times(test.quantity); got != test.want {
+			t.Errorf("%v times %v = %+v, want %+v", test.price, test.quantity, got, test.want)
+		}
+	}
+}
+
+func TestPriceFromRat(t *testing.T) {
+	tests := []struct {
+		value  *big.Rat
+		want   Price
+		wantOK bool
+	}{
+		{big.NewRat(2345, 100), Price{Units: 2345, Scale: 2, Currency: "EUR"}, true},
+		{big.NewRat(1, 8), Price{Units: 125, Scale: 3, Currency: "EUR"}, true},
+		{big.NewRat(5, 1), Price{Units: 500, Scale: 2, Currency: "EUR"}, true},
+		{big.NewRat(10, 3), Price{}, false},
+	}
+	for _, test := range tests {
+		got, ok := PriceFromRat(test.value, "EUR")
+		if ok != test.wantOK || got != test.want {
+			t.Errorf("PriceFromRat(%v) = %+v, %v, want %+v, %v", test.value, got, ok, test.want, test.wantOK)
+		}
+	}
+}
+
+func TestPriceJSON(t *testing.T) {
+	var price Price
+	if err := json.Unmarshal([]byte(`{"value": "0.2345", "currency": "EUR"}`), &price); err != nil {
+		t.Fatal(err)
+	}
+	if price != (Price{Units: 2345, Scale: 4, Currency: "EUR"}) {
+		t.Errorf("Unmarshal = %+v", price)
+	}
+
+	data, err := json.Marshal(price)
+	if err != nil || string(data) != `{"value":"0.2345","currency":"EUR"}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+}
@@ -0,0 +1,105 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// PaymentMethods are the accepted payment methods, a payment may also have none
+var PaymentMethods = []string{"bankTransfer", "directDebit", "card", "cash", "cheque", "paypal", "other"}
+
+// ValidPaymentMethod reports whether the method is one of the PaymentMethods or empty
+func ValidPaymentMethod(method string) bool {
+	return method == "" || slices.Contains(PaymentMethods, method)
+}
+
+// Payment is a single payment of an invoice, negative amounts are refunds
+type Payment struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	InvoiceHash string     `gorm:"index" json:"-"`
+	Date        FormDate   `json:"date"`
+	Amount      Money      `gorm:"embedded;embeddedPrefix:amount_" json:"amount"`
+	Method      string     `json:"method"`    // one of the PaymentMethods, empty if not known
+	Reference   string     `json:"reference"` // e.g. the remittance information of a transfer
+	Note        string     `json:"note"`
+	VoidedAt    *time.Time `json:"voidedAt"` // voided payments are kept for the record, but do not count
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+// PaymentUpdate is the request body for recording and editing payments, nil fields are left as is
+type PaymentUpdate struct {
+	Date      FormDate `json:"date"`
+	Amount    *Money   `json:"amount"`
+	Method    *string  `json:"method"`
+	Reference *string  `json:"reference"`
+	Note      *string  `json:"note"`
+}
+
+func (pu *PaymentUpdate) ApplyTo(payment *Payment) {
+	if !pu.Date.IsZero() {
+		payment.Date = pu.Date
+	}
+	if pu.Amount != nil {
+		payment.Amount = *pu.Amount
+	}
+	if pu.Method != nil {
+		payment.Method = *pu.Method
+	}
+	if pu.Reference != nil {
+		payment.Reference = *pu.Reference
+	}
+	if pu.Note != nil {
+		payment.Note = *pu.Note
+	}
+}
+
+// PaymentsTotal returns the sum of the payments that are not voided, nil if there are none
+func PaymentsTotal(payments []Payment) *Money {
+	var total *Money
+	for _, payment := range payments {
+		if payment.VoidedAt != nil {
+			continue
+		}
+		if total == nil {
+			total = &Money{Currency: payment.Amount.Currency}
+		}
+		total.Minor += payment.Amount.Minor
+	}
+
+	return total
+}
+
+// Settled reports whether the paid amount settles the amount of the invoice, over-payments included. Without a known
+// amount, any payment settles the invoice. Payments in another currency than the amount settle nothing
+func Settled(amount *Money, paid *Money) bool {
+	switch {
+	case paid == nil:
+		return false
+	case amount == nil:
+		return paid.Minor > 0
+	case !sameCurrency(*amount, *paid):
+		return false
+	default:
+		return paid.Minor >= amount.Minor
+	}
+}
+
+// Balance returns the amount still to pay, negative if the invoice was overpaid. Nil if the amount is not known or
+// the payments are in another currency
+func (i *Invoice) Balance() *Money {
+	if i.Amount == nil || i.PaidAmount != nil && !sameCurrency(*i.Amount, *i.PaidAmount) {
+		return nil
+	}
+
+	balance := *i.Amount
+	if i.PaidAmount != nil {
+		balance.Minor -= i.PaidAmount.Minor
+	}
+	return &balance
+}
+
+// sameCurrency reports whether the amounts can be compared, amounts of an unknown currency are taken to be in any
+func sameCurrency(a Money, b Money) bool {
+	return a.Currency == "" || b.Currency == "" || a.Currency == b.Currency
+}
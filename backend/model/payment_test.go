@@ -0,0 +1,69 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSettled(t *testing.T) {
+	usd := &Money{Minor: 10000, Currency: "USD"}
+	tests := []struct {
+		name   string
+		amount *Money
+		paid   *Money
+		want   bool
+	}{
+		{"paid in full", eur(10000), eur(10000), true},
+		{"overpaid", eur(10000), eur(12000), true},
+		{"partly paid", eur(10000), eur(9999), false},
+		{"not paid", eur(10000), nil, false},
+		{"refunded", eur(10000), eur(0), false},
+		{"without amount", nil, eur(100), true},
+		{"without amount, refunded", nil, eur(0), false},
+		// 10000 cents are not 10000 dollar cents
+		{"other currency", eur(10000), usd, false},
+		{"amount of an unknown currency", &Money{Minor: 10000}, eur(10000), true},
+	}
+	for _, test := range tests {
+		if got := Settled(test.amount, test.paid); got != test.want {
+			t.Errorf("Settled(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestBalance(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount *Money
+		paid   *Money
+		want   *Money
+	}{
+		{"not paid", eur(10000), nil, eur(10000)},
+		{"partly paid", eur(10000), eur(2500), eur(7500)},
+		{"overpaid", eur(10000), eur(12000), eur(-2000)},
+		{"without amount", nil, eur(2500), nil},
+		{"other currency", eur(10000), &Money{Minor: 2500, Currency: "JPY"}, nil},
+	}
+	for _, test := range tests {
+		invoice := &Invoice{Amount: test.amount, PaidAmount: test.paid}
+		got := invoice.Balance()
+		if (got == nil) != (test.want == nil) || got != nil && *got != *test.want {
+			t.Errorf("Balance(%s) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPaymentsTotal(t *testing.T) {
+	voided := time.Now()
+	payments := []Payment{
+		{Amount: *eur(5000)},
+		{Amount: *eur(3000), VoidedAt: &voided},
+		{Amount: *eur(-1000)},
+	}
+	if got := PaymentsTotal(payments); got == nil || *got != *eur(4000) {
+		t.Errorf("PaymentsTotal() = %v, want %v", got, eur(4000))
+	}
+	if got := PaymentsTotal(payments[1:2]); got != nil {
+		t.Errorf("PaymentsTotal() of voided payments = %v, want nil", got)
+	}
+}
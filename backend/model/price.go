@@ -0,0 +1,142 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxPriceScale is the max number of decimals of a price
+const MaxPriceScale = 9
+
+// Price is an exact decimal amount with its own number of decimals, for unit prices that are more precise than the
+// minor unit of their currency, e.g. 0.2345 EUR per kWh. Stored as three columns, <prefix>units, <prefix>scale and
+// <prefix>currency, when embedded into a model
+type Price struct {
+	Units int64 // the amount in 10^-Scale of the major unit
+	// at least the decimals of the currency, trailing zeros beyond those are dropped
+	Scale int
+	// ISO 4217 code. Empty if not known, the scale is at least 2 then
+	Currency string
+}
+
+// ParsePrice parses a decimal price, such as "0.2345", in the given currency. Prices with more than MaxPriceScale
+// decimals are rejected rather than rounded. An empty currency stands for an unknown one
+func ParsePrice(value string, currency string) (Price, error) {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	exponent, ok := CurrencyExponent(currency)
+	if !ok && currency != "" {
+		return Price{}, fmt.Errorf("unknown currency %q", currency)
+	}
+	if currency == "" {
+		exponent = 2
+	}
+
+	value = strings.TrimSpace(value)
+	negative, integer, fraction, err := splitDecimal(value)
+	if err != nil {
+		return Price{}, err
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > MaxPriceScale {
+		return Price{}, fmt.Errorf("price %q has more than %d decimals", value, MaxPriceScale)
+	}
+	scale := max(len(fraction), exponent)
+	fraction += strings.Repeat("0", scale-len(fraction))
+
+	units, err := strconv.ParseInt(integer+fraction, 10, 64)
+	if err != nil {
+		return Price{}, fmt.Errorf("invalid price %q", value)
+	}
+	if negative {
+		units = -units
+	}
+
+	return Price{Units: units, Scale: scale, Currency: currency}, nil
+}
+
+// InCurrency returns the price in the given currency if its currency is not known yet. The price is unchanged if the
+// currency is already known
+func (p Price) InCurrency(currency string) Price {
+	if p.Currency != "" || currency == "" {
+		return p
+	}
+	if converted, err := ParsePrice(p.Decimal(), currency); err == nil {
+		return converted
+	}
+	return p
+}
+
+// Decimal formats the price with all its decimals, e.g. "0.2345"
+func (p Price) Decimal() string {
+	return Money{Minor: p.Units}.decimal(p.Scale)
+}
+
+func (p Price) String() string {
+	if p.Currency == "" {
+		return p.Decimal()
+	}
+	return p.Decimal() + " " + p.Currency
+}
+
+// Times multiplies the price by a quantity, rounding to the minor unit of the currency
+func (p Price) Times(quantity float64) Money {
+	exponent := Money{Currency: p.Currency}.exponent()
+	total := float64(p.Units) * quantity * math.Pow10(exponent-p.Scale)
+	return Money{Minor: int64(math.Round(total)), Currency: p.Currency}
+}
+
+// Rat returns the price as a fraction of the major unit
+func (p Price) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(p.Units), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(p.Scale)), nil))
+}
+
+// PriceFromRat returns the price of a fraction of the major unit, false if it has more than MaxPriceScale decimals
+func PriceFromRat(value *big.Rat, currency string) (Price, bool) {
+	for scale := 0; scale <= MaxPriceScale; scale++ {
+		scaled := new(big.Rat).Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)))
+		if scaled.IsInt() && scaled.Num().IsInt64() {
+			price, err := ParsePrice(value.FloatString(scale), currency)
+			return price, err == nil
+		}
+	}
+	return Price{}, false
+}
+
+func (p Price) MarshalJSON() ([]byte, error) {
+	value, _ := json.Marshal(p.Decimal())
+	return json.Marshal(moneyJSON{Value: value, Currency: p.Currency})
+}
+
+func (p *Price) UnmarshalJSON(data []byte) error {
+	var raw moneyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Value) == 0 || string(raw.Value) == "null" {
+		return errors.New("price value is required")
+	}
+	if raw.Currency == "" {
+		return errors.New("price currency is required")
+	}
+
+	value := string(raw.Value)
+	if strings.HasPrefix(value, `"`) {
+		if err := json.Unmarshal(raw.Value, &value); err != nil {
+			return err
+		}
+	} else if strings.ContainsAny(value, "eE") {
+		return fmt.Errorf("invalid price %s, exponents are not supported", value)
+	}
+
+	price, err := ParsePrice(value, raw.Currency)
+	if err != nil {
+		return err
+	}
+	*p = price
+	return nil
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// FieldSources maps invoice field names to the name of the extractor that produced the field value
+type FieldSources map[string]string
+
+func (f *FieldSources) Scan(value interface{}) error {
+	if value == nil {
+		*f = nil
+		return nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	case []byte:
+		return json.Unmarshal(v, f)
+	default:
+		return fmt.Errorf("cannot convert %T to FieldSources", value)
+	}
+}
+
+func (f FieldSources) Value() (driver.Value, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+// GormDataType stores the sources as a JSON encoded text column
+func (FieldSources) GormDataType() string {
+	return "text"
+}
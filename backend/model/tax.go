@@ -0,0 +1,59 @@
+package model
+
+// TaxLine is one rate of the VAT breakdown of an invoice
+type TaxLine struct {
+	ID          uint    `gorm:"primaryKey" json:"-"`
+	InvoiceHash string  `gorm:"index" json:"-"`
+	Rate        float64 `json:"rate"` // percent, e.g. 19 for 19%
+	Net         *Money  `gorm:"embedded;embeddedPrefix:net_" json:"net"`
+	Tax         *Money  `gorm:"embedded;embeddedPrefix:tax_" json:"tax"`
+}
+
+// TaxMismatch reports whether net plus tax does not add up to the gross amount of the invoice, or the VAT breakdown
+// does not add up to the net and tax amounts, or the tax of a rate does not match its net amount.
+// Differences of a minor unit per rounded value are allowed. Amounts that are not known are not checked, amounts in
+// different currencies never add up
+func TaxMismatch(invoice *Invoice) bool {
+	if invoice.NetAmount != nil && invoice.TaxAmount != nil && invoice.Amount != nil &&
+		!addsUp(invoice.Amount, 1, invoice.NetAmount, invoice.TaxAmount) {
+		return true
+	}
+	if len(invoice.TaxBreakdown) == 0 {
+		return false
+	}
+
+	var nets, taxes []*Money
+	for _, line := range invoice.TaxBreakdown {
+		if line.Net != nil && line.Tax != nil {
+			expected := line.Net.Times(line.Rate / 100)
+			if !addsUp(&expected, 1, line.Tax) {
+				return true
+			}
+		}
+		nets = append(nets, line.Net)
+		taxes = append(taxes, line.Tax)
+	}
+
+	if invoice.NetAmount != nil && !addsUp(invoice.NetAmount, len(nets), nets...) {
+		return true
+	}
+	return invoice.TaxAmount != nil && !addsUp(invoice.TaxAmount, len(taxes), taxes...)
+}
+
+// addsUp reports whether the terms add up to the sum within the tolerance in minor units. Sums with unknown terms
+// are taken to add up
+func addsUp(sum *Money, tolerance int, terms ...*Money) bool {
+	var total int64
+	for _, term := range terms {
+		if term == nil {
+			return true
+		}
+		if term.Currency != sum.Currency {
+			return false
+		}
+		total += term.Minor
+	}
+
+	difference := total - sum.Minor
+	return difference <= int64(tolerance) && difference >= -int64(tolerance)
+}
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func eur(minor int64) *Money {
+	return &Money{Minor: minor, Currency: "EUR"}
+}
+
+func TestTaxMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		invoice Invoice
+		want    bool
+	}{
+		{"no amounts", Invoice{}, false},
+		{"adds up", Invoice{Amount: eur(11900), NetAmount: eur(10000), TaxAmount: eur(1900)}, false},
+		{"a cent off", Invoice{Amount: eur(11901), NetAmount: eur(10000), TaxAmount: eur(1900)}, false},
+		{"two cents off", Invoice{Amount: eur(11902), NetAmount: eur(10000), TaxAmount: eur(1900)}, true},
+		{"unknown tax", Invoice{Amount: eur(50000), NetAmount: eur(10000)}, false},
+		{"other currency", Invoice{Amount: eur(11900), NetAmount: &Money{Minor: 10000, Currency: "USD"}, TaxAmount: eur(1900)}, true},
+		{
+			name: "breakdown adds up",
+			invoice: Invoice{Amount: eur(12070), NetAmount: eur(10500), TaxAmount: eur(1570), TaxBreakdown: []TaxLine{
+				{Rate: 19, Net: eur(8000), Tax: eur(1520)},
+				{Rate: 2, Net: eur(2500), Tax: eur(50)},
+			}},
+			want: false,
+		},
+		{
+			name: "rounded tax of a rate",
+			invoice: Invoice{TaxBreakdown: []TaxLine{
+				{Rate: 19, Net: eur(1999), Tax: eur(380)}, // 379.81
+			}},
+			want: false,
+		},
+		{
+			name: "wrong tax of a rate",
+			invoice: Invoice{TaxBreakdown: []TaxLine{
+				{Rate: 19, Net: eur(10000), Tax: eur(700)},
+			}},
+			want: true,
+		},
+		{
+			name: "breakdown does not add up to the net amount",
+			invoice: Invoice{NetAmount: eur(10000), TaxBreakdown: []TaxLine{
+				{Rate: 19, Net: eur(5000), Tax: eur(950)},
+				{Rate: 7, Net: eur(4000), Tax: eur(280)},
+			}},
+			want: true,
+		},
+		{
+			name: "breakdown does not add up to the tax amount",
+			invoice: Invoice{TaxAmount: eur(2000), TaxBreakdown: []TaxLine{
+				{Rate: 19, Tax: eur(950)},
+				{Rate: 7, Tax: eur(280)},
+			}},
+			want: true,
+		},
+		{
+			// rounding a cent per rate is allowed
+			name: "rounded breakdown",
+			invoice: Invoice{TaxAmount: eur(1232), TaxBreakdown: []TaxLine{
+				{Rate: 19, Tax: eur(951)},
+				{Rate: 7, Tax: eur(280)},
+			}},
+			want: false,
+		},
+		{
+			name: "unknown net of a rate",
+			invoice: Invoice{NetAmount: eur(99999), TaxBreakdown: []TaxLine{
+				{Rate: 19, Tax: eur(950)},
+			}},
+			want: false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := TaxMismatch(&test.invoice); got != test.want {
+				t.Errorf("TaxMismatch = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSummarizeVAT(t *testing.T) {
+	date := func(year int, month time.Month, day int) FormDate {
+		return NewFormDate(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+	}
+	rate := func(rate float64) *float64 {
+		return &rate
+	}
+	invoices := []*Invoice{
+		{Date: date(2024, time.January, 31), TaxBreakdown: []TaxLine{
+			{Rate: 19, Net: eur(10000), Tax: eur(1900)},
+			{Rate: 7, Net: eur(1000), Tax: eur(70)},
+		}},
+		{Date: date(2024, time.March, 1), NetAmount: eur(500), TaxAmount: eur(95), TaxMismatch: true},
+		{Date: date(2024, time.February, 10), TaxBreakdown: []TaxLine{{Rate: 19, Net: eur(2000), Tax: eur(380)}}},
+		{Date: date(2024, time.April, 1), Amount: &Money{Minor: 1000, Currency: "USD"},
+			TaxBreakdown: []TaxLine{{Rate: 0}}},
+		{Date: date(2024, time.February, 29)},
+		// invoices without a date are left out
+		{NetAmount: eur(100), TaxAmount: eur(19)},
+	}
+
+	want := &VATSummary{PeriodType: PeriodQuarter, Periods: []VATPeriod{
+		{
+			Period: "2024-Q1", Start: "2024-01-01", End: "2024-03-31",
+			Totals: []VATTotal{
+				{Currency: "EUR", Rate: rate(7), Net: *eur(1000), Tax: *eur(70), Gross: *eur(1070), Invoices: 1},
+				{Currency: "EUR", Rate: rate(19), Net: *eur(12000), Tax: *eur(2280), Gross: *eur(14280), Invoices: 2},
+				{Currency: "EUR", Net: *eur(500), Tax: *eur(95), Gross: *eur(595), Invoices: 1},
+			},
+			Invoices: 4, WithoutTax: 1, TaxMismatches: 1,
+		},
+		{
+			Period: "2024-Q2", Start: "2024-04-01", End: "2024-06-30",
+			Totals: []VATTotal{{
+				Currency: "USD", Rate: rate(0), Net: Money{Currency: "USD"}, Tax: Money{Currency: "USD"},
+				Gross: Money{Currency: "USD"}, Invoices: 1,
+			}},
+			Invoices: 1,
+		},
+	}}
+	if got := SummarizeVAT(invoices, PeriodQuarter); !reflect.DeepEqual(got, want) {
+		t.Errorf("SummarizeVAT = %+v, want %+v", got, want)
+	}
+
+	periods := []struct {
+		periodType string
+		want       []string // period, start and end of each period
+	}{
+		{PeriodMonth, []string{"2024-01", "2024-01-01", "2024-01-31", "2024-02", "2024-02-01", "2024-02-29",
+			"2024-03", "2024-03-01", "2024-03-31", "2024-04", "2024-04-01", "2024-04-30"}},
+		{PeriodYear, []string{"2024", "2024-01-01", "2024-12-31"}},
+	}
+	for _, test := range periods {
+		var got []string
+		for _, period := range SummarizeVAT(invoices, test.periodType).Periods {
+			got = append(got, period.Period, period.Start, period.End)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("periods of %s = %v, want %v", test.periodType, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SourcePaymentTerms is the field source of due dates derived from the invoice date and the payment terms, rather
+// than extracted or entered. Derived due dates follow changes of the date and the terms
+const SourcePaymentTerms = "paymentTerms"
+
+// dueDateField is the name of the due date in FieldSources, extractor.FieldDueDate
+const dueDateField = "dueDate"
+
+// PaymentTerms are the days the invoice has to be paid within, counted from the invoice date, along with an optional
+// discount for paying early, as in "2/10 net 30"
+type PaymentTerms struct {
+	NetDays         int     `json:"netDays"`         // 0 if due on receipt
+	DiscountPercent float64 `json:"discountPercent"` // 0 if there is no discount
+	DiscountDays    int     `json:"discountDays"`    // days the discount can be taken within
+}
+
+// HasDiscount reports whether the terms offer a discount for paying early
+func (t *PaymentTerms) HasDiscount() bool {
+	return t.DiscountPercent > 0
+}
+
+// String formats the terms the usual way, e.g. "net 30" or "2/10 net 30"
+func (t *PaymentTerms) String() string {
+	if !t.HasDiscount() {
+		return fmt.Sprintf("net %d", t.NetDays)
+	}
+
+	return fmt.Sprintf("%s/%d net %d", strconv.FormatFloat(t.DiscountPercent, 'f', -1, 64), t.DiscountDays, t.NetDays)
+}
+
+// EarlyPayment is the discounted amount to pay and the last day it can be paid on
+type EarlyPayment struct {
+	DueDate FormDate `json:"dueDate"`
+	Amount  *Money   `json:"amount"` // nil if the amount of the invoice is not known
+}
+
+// DeriveDueDate sets the due date from the invoice date and the payment terms, unless the due date was extracted or
+// entered. Returns whether the due date was set
+func (i *Invoice) DeriveDueDate() bool {
+	if !i.DueDate.IsZero() && i.FieldSources[dueDateField] != SourcePaymentTerms {
+		return false
+	}
+	date := i.Date.Time()
+	if date == nil || i.PaymentTerms == nil {
+		return false
+	}
+
+	i.DueDate = NewFormDate(date.AddDate(0, 0, i.PaymentTerms.NetDays))
+	if i.FieldSources == nil {
+		i.FieldSources = make(FieldSources)
+	}
+	i.FieldSources[dueDateField] = SourcePaymentTerms
+	return true
+}
+
+// MarkDueDateEntered records the due date as entered rather than derived, so that it is kept when the date or the
+// payment terms change
+func (i *Invoice) MarkDueDateEntered() {
+	delete(i.FieldSources, dueDateField)
+}
+
+// earlyPayment returns the terms of paying early, nil if there is no discount or the invoice has no date
+func (i *Invoice) earlyPayment() *EarlyPayment {
+	date := i.Date.Time()
+	if i.PaymentTerms == nil || !i.PaymentTerms.HasDiscount() || date == nil {
+		return nil
+	}
+
+	payment := &EarlyPayment{DueDate: NewFormDate(date.AddDate(0, 0, i.PaymentTerms.DiscountDays))}
+	if i.Amount != nil {
+		amount := i.Amount.Times(1 - i.PaymentTerms.DiscountPercent/100)
+		payment.Amount = &amount
+	}
+	return payment
+}
+
+// Today returns the current date, as a UTC midnight like the dates of invoices
+func Today() time.Time {
+	year, month, day := time.Now().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,184 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// VAT summary periods
+const (
+	PeriodMonth   = "month"
+	PeriodQuarter = "quarter"
+	PeriodYear    = "year"
+)
+
+// VATSummary is the VAT of the invoices of a date range, by period, as needed for VAT returns
+type VATSummary struct {
+	PeriodType string      `json:"periodType"` // one of PeriodMonth, PeriodQuarter and PeriodYear
+	Periods    []VATPeriod `json:"periods"`
+}
+
+// VATPeriod holds the totals of a single period. Invoices without any net or tax amount are only counted
+type VATPeriod struct {
+	Period string `json:"period"` // e.g. "2024-03", "2024-Q1" or "2024"
+	Start  string `json:"start"`  // first day, YYYY-MM-DD
+	End    string `json:"end"`    // last day, YYYY-MM-DD
+
+	Totals []VATTotal `json:"totals"`
+
+	Invoices      int `json:"invoices"`
+	WithoutTax    int `json:"withoutTax"`    // invoices with neither a breakdown nor net and tax amounts
+	TaxMismatches int `json:"taxMismatches"` // invoices included whose amounts do not add up, see TaxMismatch
+}
+
+// VATTotal is the sum of the amounts taxed at the same rate in the same currency
+type VATTotal struct {
+	Currency string   `json:"currency"`
+	Rate     *float64 `json:"rate"` // nil for invoices without a breakdown by rate
+	Net      Money    `json:"net"`
+	Tax      Money    `json:"tax"`
+	Gross    Money    `json:"gross"`
+	Invoices int      `json:"invoices"`
+}
+
+// ValidPeriodType reports whether the VAT summary can be grouped by the period type
+func ValidPeriodType(periodType string) bool {
+	return periodType == PeriodMonth || periodType == PeriodQuarter || periodType == PeriodYear
+}
+
+// SummarizeVAT sums up the VAT of the invoices by period of their date, invoices without a date are skipped.
+// The breakdown by rate is used where an invoice has one, otherwise its net and tax amounts
+func SummarizeVAT(invoices []*Invoice, periodType string) *VATSummary {
+	periods := make(map[string]*VATPeriod)
+	for _, invoice := range invoices {
+		date := invoice.Date.Time()
+		if date == nil {
+			continue
+		}
+
+		period := periods[periodKey(*date, periodType)]
+		if period == nil {
+			period = newVATPeriod(*date, periodType)
+			periods[period.Period] = period
+		}
+		period.add(invoice)
+	}
+
+	summary := &VATSummary{PeriodType: periodType, Periods: make([]VATPeriod, 0, len(periods))}
+	for _, period := range periods {
+		sort.Slice(period.Totals, func(i, j int) bool {
+			a, b := period.Totals[i], period.Totals[j]
+			if a.Currency != b.Currency {
+				return a.Currency < b.Currency
+			}
+			// totals without a rate come last
+			return a.Rate != nil && (b.Rate == nil || *a.Rate < *b.Rate)
+		})
+		summary.Periods = append(summary.Periods, *period)
+	}
+	sort.Slice(summary.Periods, func(i, j int) bool {
+		return summary.Periods[i].Start < summary.Periods[j].Start
+	})
+
+	return summary
+}
+
+func periodKey(date time.Time, periodType string) string {
+	switch periodType {
+	case PeriodYear:
+		return fmt.Sprintf("%d", date.Year())
+	case PeriodQuarter:
+		return fmt.Sprintf("%d-Q%d", date.Year(), (int(date.Month())-1)/3+1)
+	default:
+		return date.Format("2006-01")
+	}
+}
+
+func newVATPeriod(date time.Time, periodType string) *VATPeriod {
+	start := time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	var end time.Time
+	switch periodType {
+	case PeriodYear:
+		start = time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(1, 0, -1)
+	case PeriodQuarter:
+		start = time.Date(date.Year(), (date.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+		end = start.AddDate(0, 3, -1)
+	default:
+		end = start.AddDate(0, 1, -1)
+	}
+
+	return &VATPeriod{
+		Period: periodKey(date, periodType),
+		Start:  start.Format("2006-01-02"),
+		End:    end.Format("2006-01-02"),
+		Totals: make([]VATTotal, 0),
+	}
+}
+
+func (p *VATPeriod) add(invoice *Invoice) {
+	p.Invoices++
+	if invoice.TaxMismatch {
+		p.TaxMismatches++
+	}
+
+	lines := invoice.TaxBreakdown
+	if len(lines) == 0 {
+		if invoice.NetAmount == nil && invoice.TaxAmount == nil {
+			p.WithoutTax++
+			return
+		}
+		lines = []TaxLine{{Net: invoice.NetAmount, Tax: invoice.TaxAmount}}
+	}
+
+	for i, line := range lines {
+		var rate *float64
+		if len(invoice.TaxBreakdown) > 0 {
+			rate = &lines[i].Rate
+		}
+		total := p.total(line.currency(invoice), rate)
+		if line.Net != nil {
+			total.Net.Minor += line.Net.Minor
+			total.Gross.Minor += line.Net.Minor
+		}
+		if line.Tax != nil {
+			total.Tax.Minor += line.Tax.Minor
+			total.Gross.Minor += line.Tax.Minor
+		}
+		total.Invoices++
+	}
+}
+
+// total returns the total of the currency and rate, adding it if there is none yet
+func (p *VATPeriod) total(currency string, rate *float64) *VATTotal {
+	for i := range p.Totals {
+		total := &p.Totals[i]
+		if total.Currency == currency && (total.Rate == nil) == (rate == nil) && (rate == nil || *total.Rate == *rate) {
+			return total
+		}
+	}
+
+	p.Totals = append(p.Totals, VATTotal{
+		Currency: currency,
+		Rate:     rate,
+		Net:      Money{Currency: currency},
+		Tax:      Money{Currency: currency},
+		Gross:    Money{Currency: currency},
+	})
+	return &p.Totals[len(p.Totals)-1]
+}
+
+// currency returns the currency of the tax line, falling back to the currency of the invoice
+func (l *TaxLine) currency(invoice *Invoice) string {
+	switch {
+	case l.Net != nil:
+		return l.Net.Currency
+	case l.Tax != nil:
+		return l.Tax.Currency
+	case invoice.Amount != nil:
+		return invoice.Amount.Currency
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,109 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Vendor is the issuer of invoices. VAT ID, IBAN and BIC are stored normalized, without separators.
+// IBAN and BIC are the confirmed bank details that transfers are made to, entered by the user or taken from an
+// electronic invoice. Bank details found in the text of invoices are only suggested until the user confirms them
+type Vendor struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `json:"name"`
+	Address       string    `json:"address"`
+	VATID         string    `gorm:"column:vat_id" json:"vatId"`
+	IBAN          string    `gorm:"column:iban" json:"iban"`
+	BIC           string    `gorm:"column:bic" json:"bic"` // optional, SEPA transfers within the EEA do without
+	SuggestedIBAN string    `gorm:"column:suggested_iban" json:"suggestedIban"`
+	SuggestedBIC  string    `gorm:"column:suggested_bic" json:"suggestedBic"`
+	Email         string    `json:"email"`
+	Aliases       Aliases   `json:"aliases"` // other names the vendor appears under on invoices, used for matching
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// VendorUpdate is the request body for creating and updating vendors, nil fields are left as is. Setting the IBAN or
+// BIC confirms it, the suggestion is dropped
+type VendorUpdate struct {
+	Name    *string  `json:"name"`
+	Address *string  `json:"address"`
+	VATID   *string  `json:"vatId"`
+	IBAN    *string  `json:"iban"`
+	BIC     *string  `json:"bic"`
+	Email   *string  `json:"email"`
+	Aliases *Aliases `json:"aliases"`
+}
+
+func (vu *VendorUpdate) ApplyTo(vendor *Vendor) {
+	if vu.Name != nil {
+		vendor.Name = *vu.Name
+	}
+	if vu.Address != nil {
+		vendor.Address = *vu.Address
+	}
+	if vu.VATID != nil {
+		vendor.VATID = *vu.VATID
+	}
+	if vu.IBAN != nil {
+		vendor.IBAN = *vu.IBAN
+		vendor.SuggestedIBAN = ""
+	}
+	if vu.BIC != nil {
+		vendor.BIC = *vu.BIC
+		vendor.SuggestedBIC = ""
+	}
+	if vu.Email != nil {
+		vendor.Email = *vu.Email
+	}
+	if vu.Aliases != nil {
+		vendor.Aliases = *vu.Aliases
+	}
+}
+
+// Aliases is a list of vendor names stored as a JSON encoded text column
+type Aliases []string
+
+func (a *Aliases) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	switch v := value.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	case []byte:
+		return json.Unmarshal(v, a)
+	default:
+		return fmt.Errorf("cannot convert %T to Aliases", value)
+	}
+}
+
+func (a Aliases) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(data), nil
+}
+
+func (Aliases) GormDataType() string {
+	return "text"
+}
+
+// MarshalJSON encodes missing aliases as an empty list
+func (a Aliases) MarshalJSON() ([]byte, error) {
+	if a == nil {
+		return []byte("[]"), nil
+	}
+
+	return json.Marshal([]string(a))
+}
@@ -0,0 +1,134 @@
+// Package preview renders images of the pages of invoice files, so that lists and previews do not have to load the
+// whole PDF. Rendered images are cached in the filestore next to the files
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"io"
+	"runtime"
+)
+
+const (
+	// ThumbnailWidth is the width of thumbnails in pixels
+	ThumbnailWidth = 240
+	MinDPI         = 36
+	MaxDPI         = 300
+	DefaultDPI     = 96
+)
+
+var ErrStorage = errors.New("filestore is unavailable")
+
+// Renderer renders the pages of stored invoice files as PNG images. Every image is rendered once and cached in the
+// filestore under a key derived from the file hash, see PageKey
+type Renderer struct {
+	fileStore filestore.Store
+	// renders bounds the pages rendered at the same time, a page at 300 DPI takes tens of megabytes and a CPU
+	renders chan struct{}
+
+	logger *zap.Logger
+}
+
+func NewRenderer(fileStore filestore.Store, logger *zap.Logger) *Renderer {
+	return &Renderer{
+		fileStore: fileStore,
+		renders:   make(chan struct{}, runtime.GOMAXPROCS(0)),
+		logger:    logger,
+	}
+}
+
+// PageKey returns the filestore key of the image of a page at the resolution
+func PageKey(hash string, page int, dpi int) string {
+	return fmt.Sprintf("pages/%s/%d-%ddpi.png", hash, page, dpi)
+}
+
+// ThumbnailKey returns the filestore key of the thumbnail of an invoice file
+func ThumbnailKey(hash string) string {
+	return "pages/" + hash + "/thumbnail.png"
+}
+
+// Page returns the image of a page of an invoice file, pages are counted from 1. Every resolution is cached on its
+// own, so callers keep dpi between MinDPI and MaxDPI. Returns filestore.ErrNotFound if the file is not stored and
+// document.ErrNoSuchPage if it has fewer pages
+func (r *Renderer) Page(ctx context.Context, hash string, page int, dpi int) ([]byte, error) {
+	return r.cached(ctx, PageKey(hash, page, dpi), hash, nil, func(content []byte) ([]byte, error) {
+		return document.RenderPage(content, page, float64(dpi))
+	})
+}
+
+// Thumbnail returns the thumbnail of the first page of an invoice file, ThumbnailWidth pixels wide
+func (r *Renderer) Thumbnail(ctx context.Context, hash string) ([]byte, error) {
+	return r.cached(ctx, ThumbnailKey(hash), hash, nil, renderThumbnail)
+}
+
+// StoreThumbnail renders and caches the thumbnail of an invoice file that was read already, so that it is there before
+// it is first asked for. Does nothing if the thumbnail is cached
+func (r *Renderer) StoreThumbnail(ctx context.Context, hash string, content []byte) error {
+	_, err := r.cached(ctx, ThumbnailKey(hash), hash, content, renderThumbnail)
+	return err
+}
+
+func renderThumbnail(content []byte) ([]byte, error) {
+	return document.RenderThumbnail(content, ThumbnailWidth)
+}
+
+// cached returns the image stored under key, or renders it from the invoice file and stores it. content is the
+// invoice file if it was read already, nil to get it from the filestore
+func (r *Renderer) cached(ctx context.Context, key string, hash string, content []byte, render func([]byte) ([]byte, error)) ([]byte, error) {
+	image, err := r.get(ctx, key)
+	if err == nil {
+		return image, nil
+	}
+	if !errors.Is(err, filestore.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrStorage, err)
+	}
+
+	if content == nil {
+		content, err = r.get(ctx, hash+".pdf")
+		if errors.Is(err, filestore.ErrNotFound) {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrStorage, err)
+		}
+	}
+
+	select {
+	case r.renders <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	image, err = render(content)
+	<-r.renders
+	if err != nil {
+		return nil, err
+	}
+
+	// the image is served even if it cannot be cached, it is rendered again next time
+	if err = r.fileStore.Put(ctx, key, bytes.NewReader(image), "image/png"); err != nil {
+		r.logger.Warn("Failed to cache page image", zap.String("key", key), zap.Error(err))
+	} else {
+		r.logger.Debug("Rendered page image", zap.String("key", key), zap.Int("size", len(image)))
+	}
+	return image, nil
+}
+
+// get reads a stored object. The object is looked up first, MinIO only reports missing objects once they are read
+func (r *Renderer) get(ctx context.Context, key string) ([]byte, error) {
+	if _, err := r.fileStore.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+
+	file, err := r.fileStore.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
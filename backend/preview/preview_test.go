@@ -0,0 +1,141 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// failingStore fails to stat objects while down is set and counts the files it is asked for
+type failingStore struct {
+	filestore.Store
+	down atomic.Bool
+	gets atomic.Int32
+}
+
+func (s *failingStore) Stat(ctx context.Context, key string) (*filestore.ObjectInfo, error) {
+	if s.down.Load() {
+		return nil, errors.New("connection refused")
+	}
+	return s.Store.Stat(ctx, key)
+}
+
+func (s *failingStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if strings.HasSuffix(key, ".pdf") {
+		s.gets.Add(1)
+	}
+	return s.Store.Get(ctx, key)
+}
+
+// testFile stores a single page PDF of the hash, a landscape page of 842 by 421 points
+func testFile(t *testing.T, store filestore.Store, hash string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 40, 20))); err != nil {
+		t.Fatal(err)
+	}
+	pdf, err := document.ImagePDF(buffer.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.Put(context.Background(), hash+".pdf", bytes.NewReader(pdf), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	return pdf
+}
+
+// imageSize decodes a PNG and returns its size
+func imageSize(t *testing.T, content []byte) image.Point {
+	t.Helper()
+	config, err := png.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("rendered image is not a PNG: %v", err)
+	}
+	return image.Point{X: config.Width, Y: config.Height}
+}
+
+// mustPage renders a page, failing the test if it cannot
+func mustPage(t *testing.T, renderer *Renderer, hash string, page int, dpi int) []byte {
+	t.Helper()
+	image, err := renderer.Page(context.Background(), hash, page, dpi)
+	if err != nil {
+		t.Fatalf("Page(%s, %d, %d) error = %v", hash, page, dpi, err)
+	}
+	return image
+}
+
+func TestRendererPage(t *testing.T) {
+	store := &failingStore{Store: filestore.NewMemoryStore(nil, zap.NewNop())}
+	renderer := NewRenderer(store, zap.NewNop())
+	ctx := context.Background()
+	testFile(t, store, "h1")
+
+	// 842 points are 11.7 inches
+	page, err := renderer.Page(ctx, "h1", 1, 72)
+	if err != nil {
+		t.Fatalf("Page() error = %v", err)
+	}
+	if size := imageSize(t, page); size != (image.Point{X: 842, Y: 421}) {
+		t.Errorf("Page() at 72 DPI = %v pixels, want 842x421", size)
+	}
+	if size := imageSize(t, mustPage(t, renderer, "h1", 1, 36)); size != (image.Point{X: 421, Y: 211}) {
+		t.Errorf("Page() at 36 DPI = %v pixels, want 421x211", size)
+	}
+
+	// every resolution is cached, the file is not read again
+	if _, err = store.Stat(ctx, PageKey("h1", 1, 72)); err != nil {
+		t.Errorf("page at 72 DPI was not cached: %v", err)
+	}
+	gets := store.gets.Load()
+	cached := mustPage(t, renderer, "h1", 1, 72)
+	if !bytes.Equal(cached, page) || store.gets.Load() != gets {
+		t.Errorf("Page() again read the file %d times, want the cached image", store.gets.Load()-gets)
+	}
+
+	if _, err = renderer.Page(ctx, "h1", 2, 72); !errors.Is(err, document.ErrNoSuchPage) {
+		t.Errorf("Page(2) of a single page error = %v, want %v", err, document.ErrNoSuchPage)
+	}
+	if _, err = renderer.Page(ctx, "h2", 1, 72); !errors.Is(err, filestore.ErrNotFound) {
+		t.Errorf("Page() of a missing file error = %v, want %v", err, filestore.ErrNotFound)
+	}
+
+	store.down.Store(true)
+	if _, err = renderer.Page(ctx, "h1", 1, 72); !errors.Is(err, ErrStorage) {
+		t.Errorf("Page() with the filestore down error = %v, want %v", err, ErrStorage)
+	}
+}
+
+func TestRendererThumbnail(t *testing.T) {
+	store := &failingStore{Store: filestore.NewMemoryStore(nil, zap.NewNop())}
+	renderer := NewRenderer(store, zap.NewNop())
+	ctx := context.Background()
+	pdf := testFile(t, store, "h1")
+
+	// the thumbnail is stored while the file is processed, from the content at hand
+	if err := renderer.StoreThumbnail(ctx, "h1", pdf); err != nil {
+		t.Fatalf("StoreThumbnail() error = %v", err)
+	}
+	if gets := store.gets.Load(); gets != 0 {
+		t.Errorf("StoreThumbnail() read the file %d times, want 0", gets)
+	}
+
+	thumbnail, err := renderer.Thumbnail(ctx, "h1")
+	if err != nil {
+		t.Fatalf("Thumbnail() error = %v", err)
+	}
+	if size := imageSize(t, thumbnail); size.X != ThumbnailWidth {
+		t.Errorf("Thumbnail() = %v pixels, want %d wide", size, ThumbnailWidth)
+	}
+	if gets := store.gets.Load(); gets != 0 {
+		t.Errorf("Thumbnail() read the file %d times, want the stored thumbnail", gets)
+	}
+}
@@ -0,0 +1,290 @@
+// Package processing runs the slow part of invoice uploads in the background: text and field extraction.
+// Jobs are persisted in the database, so they survive restarts and are retried with backoff when they fail
+package processing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/extractor"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/preview"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWorkers     = 2
+	defaultMaxAttempts = 5
+	// the queue is polled for jobs that become due after a backoff, new jobs wake the workers up immediately
+	pollInterval = 5 * time.Second
+	baseBackoff  = 10 * time.Second
+	maxBackoff   = 30 * time.Minute
+)
+
+type Processor struct {
+	storageManager *db.Manager
+	fileStore      filestore.Store
+	reader         *document.Reader
+	extractor      extractor.Extractor
+	renderer       *preview.Renderer
+	workers        int
+	// heartbeatInterval is how often running jobs are marked as alive, db.JobHeartbeatInterval but in tests
+	heartbeatInterval time.Duration
+
+	wakeUp chan struct{}
+	wg     sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+// NewProcessor creates a processor running the given number of workers, defaults to 2 if not positive. renderer may
+// be nil, thumbnails are rendered when they are first asked for then
+func NewProcessor(storageManager *db.Manager, fileStore filestore.Store, reader *document.Reader, extractor extractor.Extractor, renderer *preview.Renderer, workers int, logger *zap.Logger) *Processor {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	return &Processor{
+		storageManager:    storageManager,
+		fileStore:         fileStore,
+		reader:            reader,
+		extractor:         extractor,
+		renderer:          renderer,
+		workers:           workers,
+		heartbeatInterval: db.JobHeartbeatInterval,
+		wakeUp:            make(chan struct{}, 1),
+		logger:            logger,
+	}
+}
+
+// Enqueue stores a new invoice and schedules its processing
+func (p *Processor) Enqueue(invoice *model.Invoice) (*model.Job, error) {
+	job := &model.Job{
+		Status:      model.JobPending,
+		MaxAttempts: defaultMaxAttempts,
+		RunAt:       time.Now(),
+	}
+
+	if err := p.storageManager.CreateInvoiceWithJob(invoice, job); err != nil {
+		return nil, err
+	}
+
+	select {
+	case p.wakeUp <- struct{}{}:
+	default:
+		// a wake-up is already pending
+	}
+
+	return job, nil
+}
+
+// Start resumes the jobs interrupted by the previous shutdown and starts the workers. They run until ctx is cancelled
+func (p *Processor) Start(ctx context.Context) error {
+	if err := p.storageManager.ResetRunningJobs(); err != nil {
+		return err
+	}
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go p.work(ctx)
+	}
+
+	p.logger.Info("Started processing workers", zap.Int("workers", p.workers))
+	return nil
+}
+
+// Wait blocks until all workers have stopped
+func (p *Processor) Wait() {
+	p.wg.Wait()
+}
+
+func (p *Processor) work(ctx context.Context) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// drain the queue before going to sleep
+		for ctx.Err() == nil {
+			job, err := p.storageManager.ClaimJob()
+			if err != nil || job == nil {
+				break
+			}
+			p.run(ctx, job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wakeUp:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Processor) run(ctx context.Context, job *model.Job) {
+	logger := p.logger.With(zap.Uint("job", job.ID), zap.String("hash", job.FileHash), zap.Int("attempt", job.Attempts))
+	logger.Info("Processing invoice")
+	start := time.Now()
+
+	heartbeatCtx, stopHeartbeat := context.WithCancel(ctx)
+	go p.heartbeat(heartbeatCtx, job, logger)
+	err := p.process(ctx, job)
+	stopHeartbeat()
+	if ctx.Err() != nil {
+		// the job is left running and gets reset on the next start
+		logger.Info("Processing interrupted by shutdown")
+		return
+	}
+	if err == nil {
+		logger.Info("Invoice processed", zap.Duration("duration", time.Since(start)))
+		_ = p.storageManager.CompleteJob(job)
+		return
+	}
+
+	backoff := min(baseBackoff<<(job.Attempts-1), maxBackoff)
+	logger.Warn("Failed to process invoice", zap.Duration("retryIn", backoff), zap.Int("maxAttempts", job.MaxAttempts), zap.Error(err))
+	_ = p.storageManager.RetryJob(job, err, failureOf(err), time.Now().Add(backoff))
+}
+
+// heartbeat marks the job as alive while it runs, until ctx is cancelled. Jobs without a heartbeat are taken for
+// stale and claimed again, e.g. by another instance
+func (p *Processor) heartbeat(ctx context.Context, job *model.Job, logger *zap.Logger) {
+	ticker := time.NewTicker(p.heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := p.storageManager.HeartbeatJob(job); errors.Is(err, db.ErrJobReclaimed) {
+			logger.Warn("Job was claimed by another worker while it ran")
+			return
+		}
+	}
+}
+
+// ErrStorage is wrapped by the errors of reading invoice files from the filestore
+var ErrStorage = errors.New("filestore is unavailable")
+
+func failureOf(err error) model.JobFailure {
+	switch {
+	case errors.Is(err, ErrStorage):
+		return model.JobFailureStorage
+	case errors.Is(err, extractor.ErrLLM):
+		return model.JobFailureLLM
+	default:
+		return model.JobFailureInternal
+	}
+}
+
+// process extracts the text and the fields of the invoice file. The fields found are saved even if some of the
+// extractors failed, the next attempt only looks for the fields that are still missing
+func (p *Processor) process(ctx context.Context, job *model.Job) error {
+	invoice, err := p.storageManager.GetInvoiceByHash(job.FileHash)
+	if err != nil {
+		return err
+	}
+	if invoice == nil {
+		return fmt.Errorf("invoice %s does not exist", job.FileHash)
+	}
+
+	file, err := p.fileStore.Get(ctx, job.FileHash+".pdf")
+	if err != nil {
+		return fmt.Errorf("%w: failed to get file: %w", ErrStorage, err)
+	}
+	content, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("%w: failed to read file: %w", ErrStorage, err)
+	}
+
+	// lists show the thumbnail as soon as the invoice is there, a missing one is rendered when it is asked for
+	if p.renderer != nil {
+		if err := p.renderer.StoreThumbnail(ctx, job.FileHash, content); err != nil {
+			p.logger.Warn("Failed to render thumbnail", zap.String("hash", job.FileHash), zap.Error(err))
+		}
+	}
+
+	text := invoice.RawText
+	if text == "" {
+		text, err = p.reader.Text(ctx, content)
+		if err != nil {
+			p.logger.Warn("Failed to extract text from invoice file", zap.String("hash", job.FileHash), zap.Error(err))
+		}
+	}
+
+	result := extractor.NewResultFor(invoice)
+	doc := &extractor.Document{Filename: invoice.OriginalFileName, Content: content, Text: text}
+	extractErr := p.extractor.Extract(ctx, doc, result)
+
+	var vendorID *uint
+	if candidate := result.VendorCandidate(); candidate != nil && invoice.VendorID == nil {
+		vendor, err := p.storageManager.MatchOrCreateVendor(candidate)
+		if err != nil {
+			return err
+		}
+		if vendor != nil {
+			vendorID = &vendor.ID
+		}
+	}
+
+	// the invoice may have been edited while it was processed, the result is applied to the stored one
+	found, err := p.storageManager.SaveProcessingResult(job.FileHash, func(invoice *model.Invoice) []string {
+		return applyResult(invoice, result, text, vendorID)
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("invoice %s does not exist", job.FileHash)
+	}
+
+	return extractErr
+}
+
+// fieldColumns are the invoice columns of the fields found by extractors. Line items and the VAT breakdown are stored
+// in tables of their own
+var fieldColumns = map[string][]string{
+	extractor.FieldID:           {"id"},
+	extractor.FieldDate:         {"date"},
+	extractor.FieldAmount:       {"amount_minor", "amount_currency"},
+	extractor.FieldCurrency:     {"amount_minor", "amount_currency"},
+	extractor.FieldNetAmount:    {"net_amount_minor", "net_amount_currency"},
+	extractor.FieldTaxAmount:    {"tax_amount_minor", "tax_amount_currency"},
+	extractor.FieldDueDate:      {"due_date"},
+	extractor.FieldPaymentTerms: {"payment_terms_net_days", "payment_terms_discount_percent", "payment_terms_discount_days"},
+}
+
+// applyResult fills in the fields of the invoice that the result found and the invoice still lacks, along with the
+// text, the vendor and the checks that depend on them. Returns the columns that were set
+func applyResult(invoice *model.Invoice, result *extractor.Result, text string, vendorID *uint) []string {
+	columns := []string{"field_sources", "totals_mismatch", "tax_mismatch"}
+	if invoice.RawText == "" && text != "" {
+		invoice.RawText = text
+		columns = append(columns, "raw_text")
+	}
+	for _, field := range result.ApplyTo(invoice) {
+		columns = append(columns, fieldColumns[field]...)
+	}
+	if invoice.VendorID == nil && vendorID != nil {
+		invoice.VendorID = vendorID
+		columns = append(columns, "vendor_id")
+	}
+
+	invoice.TotalsMismatch = model.TotalsMismatch(invoice.Amount, invoice.LineItems)
+	invoice.TaxMismatch = model.TaxMismatch(invoice)
+	if invoice.DeriveDueDate() {
+		columns = append(columns, "due_date")
+	}
+	return columns
+}
@@ -0,0 +1,441 @@
+package processing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/document"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/extractor"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/preview"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/filestore"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubExtractor runs the function on every document
+type stubExtractor func(ctx context.Context, doc *extractor.Document, result *extractor.Result) error
+
+func (s stubExtractor) Name() string {
+	return "stub"
+}
+
+func (s stubExtractor) Extract(ctx context.Context, doc *extractor.Document, result *extractor.Result) error {
+	return s(ctx, doc, result)
+}
+
+// newTestProcessor creates a processor of a single worker, reading files from memory and invoices from an SQLite
+// database
+func newTestProcessor(t *testing.T, extract stubExtractor) (*Processor, *db.Manager, *filestore.MemoryStore) {
+	t.Helper()
+
+	manager, err := db.NewManagerOfType("sqlite", zap.NewNop(), filepath.Join(t.TempDir(), "invoices.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := manager.DB.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	store := filestore.NewMemoryStore(nil, zap.NewNop())
+	processor := NewProcessor(manager, store, document.NewReader(nil, zap.NewNop()), extract,
+		preview.NewRenderer(store, zap.NewNop()), 1, zap.NewNop())
+	return processor, manager, store
+}
+
+// testPDF returns a single page PDF showing the text
+func testPDF(text string) []byte {
+	stream := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes()
+}
+
+// enqueue stores the file of the invoice and queues its processing
+func enqueue(t *testing.T, p *Processor, store filestore.Store, invoice *model.Invoice) *model.Job {
+	t.Helper()
+	if err := store.Put(context.Background(), invoice.FileHash+".pdf", bytes.NewReader(testPDF("Invoice INV-1 of ACME")), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	job, err := p.Enqueue(invoice)
+	if err != nil {
+		t.Fatalf("Enqueue() error = %v", err)
+	}
+	return job
+}
+
+// claim claims the next job like a worker does
+func claim(t *testing.T, m *db.Manager) *model.Job {
+	t.Helper()
+	job, err := m.ClaimJob()
+	if err != nil || job == nil {
+		t.Fatalf("ClaimJob() = %v, %v, want a job", job, err)
+	}
+	return job
+}
+
+// waitForJob waits until the job has the status
+func waitForJob(t *testing.T, m *db.Manager, id uint, status model.JobStatus) *model.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.GetJob(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == status {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d is %s after 5 seconds, want %s", id, job.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProcessor(t *testing.T) {
+	var text string
+	p, m, store := newTestProcessor(t, func(_ context.Context, doc *extractor.Document, result *extractor.Result) error {
+		text = doc.Text
+		result.SetID("INV-1", "stub")
+		result.SetAmount(model.Money{Minor: 11900}, "stub")
+		result.SetCurrency("EUR", "stub")
+		result.SetPaymentTerms(model.PaymentTerms{NetDays: 14}, "stub")
+		result.SetVendorDetail(extractor.FieldVendorName, "ACME GmbH", "stub")
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer p.Wait()
+	defer cancel()
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// the ID was entered with the upload and is kept
+	id := "USER-1"
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	job := enqueue(t, p, store, &model.Invoice{FileHash: "h1", ID: &id, Date: model.NewFormDate(date), FileExists: true})
+	done := waitForJob(t, m, job.ID, model.JobDone)
+	if done.Attempts != 1 || done.FinishedAt == nil || done.LastError != "" {
+		t.Errorf("job = %+v, want done at the first attempt", done)
+	}
+	if strings.TrimSpace(text) != "Invoice INV-1 of ACME" {
+		t.Errorf("text given to the extractor = %q, want the text of the file", text)
+	}
+
+	invoice, err := m.GetInvoiceByHash("h1")
+	if err != nil || invoice == nil {
+		t.Fatalf("GetInvoiceByHash() = %v, %v", invoice, err)
+	}
+	if *invoice.ID != "USER-1" || invoice.FieldSources[extractor.FieldID] != "" {
+		t.Errorf("ID = %s from %q, want the one entered", *invoice.ID, invoice.FieldSources[extractor.FieldID])
+	}
+	if invoice.Amount == nil || *invoice.Amount != (model.Money{Minor: 11900, Currency: "EUR"}) || invoice.FieldSources[extractor.FieldAmount] != "stub" {
+		t.Errorf("amount = %v from %q, want 119.00 EUR found by stub", invoice.Amount, invoice.FieldSources[extractor.FieldAmount])
+	}
+	if dueDate := invoice.DueDate.Time(); dueDate == nil || !dueDate.Equal(date.AddDate(0, 0, 14)) {
+		t.Errorf("due date = %v, want 14 days after the invoice date", dueDate)
+	}
+	if invoice.RawText == "" {
+		t.Errorf("raw text was not saved")
+	}
+	if invoice.VendorID == nil {
+		t.Errorf("vendor was not matched or created")
+	} else if vendor, err := m.GetVendor(*invoice.VendorID); err != nil || vendor == nil || vendor.Name != "ACME GmbH" {
+		t.Errorf("vendor = %+v, %v, want ACME GmbH", vendor, err)
+	}
+	if _, err = store.Stat(context.Background(), preview.ThumbnailKey("h1")); err != nil {
+		t.Errorf("thumbnail was not rendered: %v", err)
+	}
+}
+
+func TestProcessorRetry(t *testing.T) {
+	llmErr := fmt.Errorf("%w: status 503", extractor.ErrLLM)
+	p, m, store := newTestProcessor(t, func(_ context.Context, _ *extractor.Document, result *extractor.Result) error {
+		// the fields found before the failure are saved
+		result.SetAmount(model.Money{Minor: 11900, Currency: "EUR"}, "rules")
+		return llmErr
+	})
+	ctx := context.Background()
+
+	job := enqueue(t, p, store, &model.Invoice{FileHash: "h1", FileExists: true})
+	before := time.Now()
+	p.run(ctx, claim(t, m))
+	retried, err := m.GetJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.Status != model.JobPending || retried.Attempts != 1 || retried.Failure != model.JobFailureLLM || retried.LastError != llmErr.Error() {
+		t.Errorf("job after a failed attempt = %+v, want pending with the LLM failure", retried)
+	}
+	if retried.RunAt.Before(before.Add(baseBackoff)) || retried.RunAt.After(time.Now().Add(baseBackoff)) {
+		t.Errorf("job runs again at %v, want %v after %v", retried.RunAt, baseBackoff, before)
+	}
+	if invoice, err := m.GetInvoiceByHash("h1"); err != nil || invoice.Amount == nil || invoice.Amount.Minor != 11900 {
+		t.Errorf("invoice after a failed attempt = %+v, %v, want the amount found", invoice, err)
+	}
+
+	// the file is gone, the failure is one of the filestore
+	if err = store.Delete(ctx, "h1.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err = m.DB.Model(&model.Job{}).Where("id = ?", job.ID).Update("run_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+	p.run(ctx, claim(t, m))
+	if retried, err = m.GetJob(job.ID); err != nil || retried.Status != model.JobPending || retried.Failure != model.JobFailureStorage {
+		t.Errorf("job of a missing file = %+v, %v, want pending with the storage failure", retried, err)
+	}
+	if retried.RunAt.Before(before.Add(2 * baseBackoff)) {
+		t.Errorf("job runs again at %v, want the backoff doubled", retried.RunAt)
+	}
+
+	// without attempts left the job fails for good
+	if err = m.DB.Model(&model.Job{}).Where("id = ?", job.ID).Updates(map[string]interface{}{
+		"run_at": time.Now(), "attempts": defaultMaxAttempts - 1,
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+	p.run(ctx, claim(t, m))
+	if failed, err := m.GetJob(job.ID); err != nil || failed.Status != model.JobFailed || failed.FinishedAt == nil {
+		t.Errorf("job after the last attempt = %+v, %v, want failed", failed, err)
+	}
+}
+
+func TestProcessorHeartbeat(t *testing.T) {
+	var m *db.Manager
+	var running *model.Job
+	var reclaimedAt time.Time
+	reclaim := false
+	var p *Processor
+	var store *filestore.MemoryStore
+	p, m, store = newTestProcessor(t, func(ctx context.Context, _ *extractor.Document, _ *extractor.Result) error {
+		claimed, err := m.GetJob(running.ID)
+		if err != nil {
+			return err
+		}
+		if reclaim {
+			// another worker takes the job for stale and claims it again
+			err = m.DB.Model(&model.Job{}).Where("id = ?", running.ID).UpdateColumn("attempts", gorm.Expr("attempts + 1")).Error
+			if err != nil {
+				return err
+			}
+			reclaimedAt = time.Now()
+		}
+
+		// the job is marked as alive while it runs
+		deadline := time.Now().Add(5 * time.Second)
+		if reclaim {
+			deadline = time.Now().Add(10 * p.heartbeatInterval)
+		}
+		for time.Now().Before(deadline) {
+			job, err := m.GetJob(running.ID)
+			if err != nil {
+				return err
+			}
+			if job.UpdatedAt.After(claimed.UpdatedAt) {
+				return nil
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if reclaim {
+			return nil
+		}
+		return errors.New("no heartbeat")
+	})
+	p.heartbeatInterval = 10 * time.Millisecond
+	ctx := context.Background()
+
+	job := enqueue(t, p, store, &model.Invoice{FileHash: "h1", FileExists: true})
+	running = claim(t, m)
+	p.run(ctx, running)
+	if done, err := m.GetJob(job.ID); err != nil || done.Status != model.JobDone {
+		t.Errorf("job = %+v, %v, want done after heartbeats", done, err)
+	}
+
+	// the heartbeat stops once the job was claimed by another worker, and its outcome is dropped
+	reclaim = true
+	job = enqueue(t, p, store, &model.Invoice{FileHash: "h2", FileExists: true})
+	running = claim(t, m)
+	p.run(ctx, running)
+	reclaimed, err := m.GetJob(job.ID)
+	if err != nil || reclaimed.Status != model.JobRunning || reclaimed.Attempts != 2 {
+		t.Errorf("reclaimed job = %+v, %v, want running at the attempt of the other worker", reclaimed, err)
+	}
+	if reclaimed.UpdatedAt.After(reclaimedAt) {
+		t.Errorf("reclaimed job was marked as alive at %v, want no heartbeats of the worker that lost it", reclaimed.UpdatedAt)
+	}
+}
+
+func TestProcessorShutdown(t *testing.T) {
+	started := make(chan struct{})
+	var interrupt sync.Once
+	p, m, store := newTestProcessor(t, func(ctx context.Context, _ *extractor.Document, _ *extractor.Result) error {
+		interrupted := false
+		interrupt.Do(func() {
+			// the first attempt runs until the shutdown
+			close(started)
+			<-ctx.Done()
+			interrupted = true
+		})
+		if interrupted {
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := p.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	job := enqueue(t, p, store, &model.Invoice{FileHash: "h1", FileExists: true})
+	<-started
+	cancel()
+	p.Wait()
+
+	// the interrupted job is neither failed nor retried with a backoff
+	interrupted, err := m.GetJob(job.ID)
+	if err != nil || interrupted.Status != model.JobRunning || interrupted.LastError != "" {
+		t.Fatalf("interrupted job = %+v, %v, want running", interrupted, err)
+	}
+
+	// and is resumed on the next start
+	ctx, cancel = context.WithCancel(context.Background())
+	defer p.Wait()
+	defer cancel()
+	if err = p.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if resumed := waitForJob(t, m, job.ID, model.JobDone); resumed.Attempts != 2 {
+		t.Errorf("resumed job = %+v, want done at the second attempt", resumed)
+	}
+}
+
+func TestApplyResult(t *testing.T) {
+	base := []string{"field_sources", "totals_mismatch", "tax_mismatch"}
+	vendorID := uint(7)
+	taxRate := 19.0
+	tests := []struct {
+		name        string
+		invoice     func(*model.Invoice)
+		result      func(*extractor.Result)
+		text        string
+		vendorID    *uint
+		wantColumns []string
+		want        func(*model.Invoice) bool
+	}{
+		{"nothing found", nil, nil, "", nil, base, nil},
+		{"text", nil, nil, "Invoice", nil, append(base, "raw_text"), func(i *model.Invoice) bool { return i.RawText == "Invoice" }},
+		{"text of an earlier attempt", func(i *model.Invoice) { i.RawText = "Invoice" }, nil, "Rechnung", nil, base, func(i *model.Invoice) bool { return i.RawText == "Invoice" }},
+		{
+			"amount and currency", nil, func(r *extractor.Result) {
+				r.SetAmount(model.Money{Minor: 11900}, "rules")
+				r.SetCurrency("EUR", "rules")
+			}, "", nil, append(base, "amount_minor", "amount_currency", "amount_minor", "amount_currency"),
+			func(i *model.Invoice) bool { return *i.Amount == model.Money{Minor: 11900, Currency: "EUR"} },
+		},
+		{
+			"net and tax amounts", nil, func(r *extractor.Result) {
+				r.SetNetAmount(model.Money{Minor: 10000, Currency: "EUR"}, "rules")
+				r.SetTaxAmount(model.Money{Minor: 1900, Currency: "EUR"}, "rules")
+			}, "", nil, append(base, "net_amount_minor", "net_amount_currency", "tax_amount_minor", "tax_amount_currency"), nil,
+		},
+		{
+			"ID and date", nil, func(r *extractor.Result) {
+				r.SetID("INV-1", "llm")
+				r.SetDate(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "llm")
+			}, "", nil, append(base, "id", "date"),
+			func(i *model.Invoice) bool { return *i.ID == "INV-1" && i.FieldSources[extractor.FieldID] == "llm" },
+		},
+		{
+			"edited meanwhile", func(i *model.Invoice) {
+				id := "USER-1"
+				i.ID = &id
+			}, func(r *extractor.Result) { r.SetID("INV-1", "llm") }, "", nil, base,
+			func(i *model.Invoice) bool { return *i.ID == "USER-1" },
+		},
+		{
+			"payment terms", func(i *model.Invoice) {
+				i.Date = model.NewFormDate(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC))
+			}, func(r *extractor.Result) { r.SetPaymentTerms(model.PaymentTerms{NetDays: 30}, "rules") }, "", nil,
+			append(base, "payment_terms_net_days", "payment_terms_discount_percent", "payment_terms_discount_days", "due_date"),
+			func(i *model.Invoice) bool {
+				return i.DueDate.Time().Equal(time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC))
+			},
+		},
+		{
+			"due date", nil, func(r *extractor.Result) { r.SetDueDate(time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC), "rules") },
+			"", nil, append(base, "due_date"), nil,
+		},
+		{"vendor", nil, nil, "", &vendorID, append(base, "vendor_id"), func(i *model.Invoice) bool { return *i.VendorID == 7 }},
+		{
+			"vendor chosen meanwhile", func(i *model.Invoice) {
+				chosen := uint(3)
+				i.VendorID = &chosen
+			}, nil, "", &vendorID, base, func(i *model.Invoice) bool { return *i.VendorID == 3 },
+		},
+		{
+			// line items are stored in a table of their own, the checks are updated along with them
+			"line items", func(i *model.Invoice) { i.Amount = &model.Money{Minor: 11900, Currency: "EUR"} },
+			func(r *extractor.Result) {
+				r.SetLineItems([]model.LineItem{{Total: &model.Money{Minor: 5000, Currency: "EUR"}, TaxRate: &taxRate}}, "llm")
+			}, "", nil, base, func(i *model.Invoice) bool { return len(i.LineItems) == 1 && i.TotalsMismatch },
+		},
+	}
+	invoiceSchema, err := schema.Parse(&model.Invoice{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		invoice := &model.Invoice{FileHash: "h1"}
+		if test.invoice != nil {
+			test.invoice(invoice)
+		}
+		result := extractor.NewResultFor(invoice)
+		if test.result != nil {
+			test.result(result)
+		}
+
+		columns := applyResult(invoice, result, test.text, test.vendorID)
+		if !reflect.DeepEqual(columns, test.wantColumns) {
+			t.Errorf("applyResult(%s) = %v, want %v", test.name, columns, test.wantColumns)
+		}
+		if test.want != nil && !test.want(invoice) {
+			t.Errorf("applyResult(%s) set %+v", test.name, invoice)
+		}
+		for _, column := range columns {
+			if invoiceSchema.LookUpField(column) == nil {
+				t.Errorf("applyResult(%s) set column %s, which invoices do not have", test.name, column)
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Package reconciliation imports bank statements and matches their transactions to the invoices they paid. Matches
+// are only proposed, with a confidence, they are recorded as payments once confirmed
+package reconciliation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/storage/db"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidStatement is returned for files that cannot be read as bank statements
+var ErrInvalidStatement = errors.New("invalid bank statement")
+
+type Reconciler struct {
+	storageManager *db.Manager
+
+	logger *zap.Logger
+}
+
+func NewReconciler(storageManager *db.Manager, logger *zap.Logger) *Reconciler {
+	return &Reconciler{
+		storageManager: storageManager,
+		logger:         logger,
+	}
+}
+
+// Import reads the bank statement, stores the transactions that were not imported before and proposes matches for
+// them
+func (r *Reconciler) Import(filename string, content []byte) (*model.BankImport, error) {
+	statement, err := banking.ParseStatement(content)
+	if err != nil {
+		r.logger.Warn("Failed to parse bank statement", zap.String("filename", filename), zap.Error(err))
+		return nil, fmt.Errorf("%w: %w", ErrInvalidStatement, err)
+	}
+
+	bankImport := &model.BankImport{Filename: filename, Format: statement.Format, Account: statement.Account}
+	transactions := make([]model.BankTransaction, len(statement.Transactions))
+	occurrences := make(map[string]int)
+	for i, t := range statement.Transactions {
+		transactions[i] = model.BankTransaction{
+			Account:          statement.Account,
+			BookingDate:      model.NewFormDate(t.BookingDate),
+			Amount:           t.Amount,
+			Counterparty:     t.Counterparty,
+			CounterpartyIBAN: t.CounterpartyIBAN,
+			RemittanceInfo:   t.RemittanceInfo,
+			Reference:        t.Reference,
+		}
+		if t.ValueDate != nil {
+			transactions[i].ValueDate = model.NewFormDate(*t.ValueDate)
+		}
+
+		// identical bookings on the same day are told apart by their order in the statement
+		key := bookingKey(statement.Account, &t)
+		transactions[i].Fingerprint = fingerprint(key, occurrences[key])
+		occurrences[key]++
+	}
+
+	created, err := r.storageManager.ImportBankTransactions(bankImport, transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	bankImport.Proposals, err = r.propose(created)
+	if err != nil {
+		return nil, err
+	}
+	return bankImport, nil
+}
+
+// Reconcile proposes matches for the transactions without open proposals, for invoices added since they were
+// imported. Returns the number of proposals made
+func (r *Reconciler) Reconcile() (int, error) {
+	transactions, err := r.storageManager.GetUnmatchedBankTransactions()
+	if err != nil {
+		return 0, err
+	}
+
+	return r.propose(transactions)
+}
+
+// propose matches the transactions to the unpaid invoices and stores the proposals, returns their number
+func (r *Reconciler) propose(transactions []model.BankTransaction) (int, error) {
+	if len(transactions) == 0 {
+		return 0, nil
+	}
+
+	invoices, err := r.storageManager.GetUnpaidInvoices()
+	if err != nil {
+		return 0, err
+	}
+
+	proposed := 0
+	for i := range transactions {
+		transaction := &transactions[i]
+		vendor, err := r.storageManager.MatchVendor(&model.Vendor{Name: transaction.Counterparty, IBAN: transaction.CounterpartyIBAN})
+		if err != nil {
+			return proposed, err
+		}
+
+		saved, err := r.storageManager.SaveProposals(transaction.ID, rank(transaction, invoices, vendor))
+		if err != nil {
+			return proposed, err
+		}
+		proposed += saved
+	}
+
+	r.logger.Info("Proposed matches for bank transactions", zap.Int("transactions", len(transactions)), zap.Int("proposals", proposed))
+	return proposed, nil
+}
+
+// bookingKey joins the details that identify a booking across statements of the same account
+func bookingKey(account string, t *banking.Transaction) string {
+	valueDate := ""
+	if t.ValueDate != nil {
+		valueDate = t.ValueDate.Format(time.DateOnly)
+	}
+
+	return strings.Join([]string{
+		account,
+		t.BookingDate.Format(time.DateOnly),
+		valueDate,
+		strconv.FormatInt(t.Amount.Minor, 10),
+		t.Amount.Currency,
+		t.CounterpartyIBAN,
+		t.Counterparty,
+		t.Reference,
+		t.RemittanceInfo,
+	}, "\x00")
+}
+
+func fingerprint(key string, occurrence int) string {
+	sum := sha256.Sum256([]byte(key + "\x00" + strconv.Itoa(occurrence)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,182 @@
+package reconciliation
+
+import (
+	"cmp"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The signals a transaction matched an invoice on, listed in the reasons of a proposal
+const (
+	ReasonAmount           = "amount"           // the transaction paid the balance of the invoice
+	ReasonDiscountedAmount = "discountedAmount" // the balance less the discount for paying early, in time for it
+	ReasonInvoiceNumber    = "invoiceNumber"    // in the remittance information or the reference
+	ReasonIBAN             = "iban"             // the counterparty account is the one of the vendor
+	ReasonName             = "name"             // the counterparty name is the one of the vendor or an alias
+	ReasonDate             = "date"             // booked close to the due date or within the payment period
+)
+
+// The weights of the signals, the confidence of a proposal is their sum
+var weights = map[string]float64{
+	ReasonAmount:           0.45,
+	ReasonDiscountedAmount: 0.4,
+	ReasonInvoiceNumber:    0.35,
+	ReasonIBAN:             0.15,
+	ReasonName:             0.1,
+	ReasonDate:             0.05,
+}
+
+const (
+	// MinConfidence is the least confidence a match is proposed with
+	MinConfidence = 0.35
+	// MaxProposals is the max number of proposals per transaction, the best are kept
+	MaxProposals = 3
+
+	// dueDateDays is how far from the due date a booking counts as on time, dueDateWeight replaces the date weight
+	dueDateDays   = 3
+	dueDateWeight = 0.1
+	// paymentPeriodDays is the period after the invoice date a booking counts as within, unless there is a due date
+	paymentPeriodDays = 60
+)
+
+// rank scores the invoices for the transaction and returns the proposals of the best ones, vendor is the known vendor
+// of the counterparty of the transaction, nil if there is none
+func rank(transaction *model.BankTransaction, invoices []*model.Invoice, vendor *model.Vendor) []model.MatchProposal {
+	proposals := make([]model.MatchProposal, 0)
+	for _, invoice := range invoices {
+		confidence, reasons := score(transaction, invoice, vendor)
+		if confidence < MinConfidence {
+			continue
+		}
+		proposals = append(proposals, model.MatchProposal{
+			TransactionID: transaction.ID,
+			InvoiceHash:   invoice.FileHash,
+			Confidence:    confidence,
+			Reasons:       reasons,
+		})
+	}
+
+	slices.SortStableFunc(proposals, func(a, b model.MatchProposal) int {
+		return cmp.Compare(b.Confidence, a.Confidence)
+	})
+	return proposals[:min(len(proposals), MaxProposals)]
+}
+
+// score rates how likely the transaction paid the invoice, from 0 to 1. A match needs either the amount or the
+// invoice number, the other signals only add to them
+func score(transaction *model.BankTransaction, invoice *model.Invoice, vendor *model.Vendor) (float64, model.MatchReasons) {
+	payment := transaction.PaymentAmount()
+	if payment.Minor == 0 || invoice.Amount != nil && invoice.Amount.Currency != "" && payment.Currency != "" &&
+		invoice.Amount.Currency != payment.Currency {
+		return 0, nil
+	}
+	bookingDate := transaction.BookingDate.Time()
+
+	reasons := make(model.MatchReasons, 0, 4)
+	if balance := invoice.Balance(); balance != nil && balance.InCurrency(payment.Currency).Minor == payment.Minor {
+		reasons = append(reasons, ReasonAmount)
+	} else if discounted(invoice, payment, bookingDate) {
+		reasons = append(reasons, ReasonDiscountedAmount)
+	}
+	if invoice.ID != nil && containsInvoiceNumber(transaction.RemittanceInfo+" "+transaction.Reference, *invoice.ID) {
+		reasons = append(reasons, ReasonInvoiceNumber)
+	}
+	if len(reasons) == 0 {
+		return 0, nil
+	}
+
+	if vendor != nil && invoice.VendorID != nil && *invoice.VendorID == vendor.ID {
+		if iban := transaction.CounterpartyIBAN; iban != "" && (iban == vendor.IBAN || iban == vendor.SuggestedIBAN) {
+			reasons = append(reasons, ReasonIBAN)
+		} else {
+			reasons = append(reasons, ReasonName)
+		}
+	}
+
+	confidence := 0.0
+	for _, reason := range reasons {
+		confidence += weights[reason]
+	}
+	if weight := dateWeight(invoice, bookingDate); weight > 0 {
+		reasons = append(reasons, ReasonDate)
+		confidence += weight
+	}
+
+	return math.Min(math.Round(confidence*100)/100, 1), reasons
+}
+
+// discounted reports whether the payment is the amount less the discount for paying early and was booked in time,
+// give or take the days a transfer takes. Only applies to invoices without other payments
+func discounted(invoice *model.Invoice, payment model.Money, bookingDate *time.Time) bool {
+	if bookingDate == nil || invoice.PaidAmount != nil && invoice.PaidAmount.Minor != 0 {
+		return false
+	}
+
+	candidate := *invoice
+	candidate.SetPaymentStatus(*bookingDate)
+	early := candidate.EarlyPayment
+	if early == nil || early.Amount == nil || early.Amount.InCurrency(payment.Currency).Minor != payment.Minor {
+		return false
+	}
+	return !bookingDate.After(early.DueDate.Time().AddDate(0, 0, dueDateDays))
+}
+
+// dateWeight rates the booking date, close to the due date weighs more than within the payment period
+func dateWeight(invoice *model.Invoice, bookingDate *time.Time) float64 {
+	if bookingDate == nil {
+		return 0
+	}
+
+	if dueDate := invoice.DueDate.Time(); dueDate != nil {
+		if math.Abs(bookingDate.Sub(*dueDate).Hours()) <= dueDateDays*24 {
+			return dueDateWeight
+		}
+		if date := invoice.Date.Time(); date != nil && !bookingDate.Before(*date) && !bookingDate.After(*dueDate) {
+			return weights[ReasonDate]
+		}
+		return 0
+	}
+
+	date := invoice.Date.Time()
+	if date != nil && !bookingDate.Before(*date) && !bookingDate.After(date.AddDate(0, 0, paymentPeriodDays)) {
+		return weights[ReasonDate]
+	}
+	return 0
+}
+
+// containsInvoiceNumber reports whether the text mentions the invoice number as whole words, separators aside:
+// "RE-2024/001" is found in "Rechnung RE 2024 001". Numbers without digits or shorter than three characters are
+// not looked for, they would be found by chance
+func containsInvoiceNumber(text string, number string) bool {
+	key := strings.Join(words(number), "")
+	if len(key) < 3 || !strings.ContainsFunc(key, unicode.IsDigit) {
+		return false
+	}
+
+	tokens := words(text)
+	for i := range tokens {
+		joined := ""
+		for _, token := range tokens[i:] {
+			joined += token
+			if len(joined) >= len(key) {
+				break
+			}
+		}
+		if joined == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// words splits the text into upper-cased runs of letters and digits
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToUpper(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
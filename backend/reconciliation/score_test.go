@@ -0,0 +1,234 @@
+package reconciliation
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(month time.Month, day int) model.FormDate {
+	return model.NewFormDate(time.Date(2024, month, day, 0, 0, 0, 0, time.UTC))
+}
+
+func eur(minor int64) *model.Money {
+	return &model.Money{Minor: minor, Currency: "EUR"}
+}
+
+// testInvoice is an invoice of ACME over 1000 EUR, dated March 1st and due March 31st
+func testInvoice() *model.Invoice {
+	id, vendorID := "RE-2024-001", uint(7)
+	return &model.Invoice{
+		FileHash: "h1",
+		ID:       &id,
+		Date:     date(time.March, 1),
+		DueDate:  date(time.March, 31),
+		Amount:   eur(100000),
+		VendorID: &vendorID,
+	}
+}
+
+// testTransaction is a debit of the amount booked on the date
+func testTransaction(amount int64, booked model.FormDate) *model.BankTransaction {
+	return &model.BankTransaction{ID: 1, BookingDate: booked, Amount: model.Money{Minor: -amount, Currency: "EUR"}}
+}
+
+func TestScore(t *testing.T) {
+	vendor := &model.Vendor{ID: 7, Name: "ACME", IBAN: "DE89370400440532013000"}
+	tests := []struct {
+		name        string
+		transaction func(*model.BankTransaction)
+		invoice     func(*model.Invoice)
+		vendor      *model.Vendor
+		booked      model.FormDate
+		amount      int64
+		want        float64
+		wantReasons model.MatchReasons
+	}{
+		{"amount", nil, nil, nil, date(time.June, 1), 100000, 0.45, model.MatchReasons{ReasonAmount}},
+		{"amount near the due date", nil, nil, nil, date(time.March, 28), 100000, 0.55, model.MatchReasons{ReasonAmount, ReasonDate}},
+		{"amount within the payment period", nil, nil, nil, date(time.March, 10), 100000, 0.5, model.MatchReasons{ReasonAmount, ReasonDate}},
+		{"amount before the invoice date", nil, nil, nil, date(time.February, 20), 100000, 0.45, model.MatchReasons{ReasonAmount}},
+		{
+			"amount within 60 days without due date", nil, func(i *model.Invoice) { i.DueDate = model.FormDate{} }, nil,
+			date(time.April, 29), 100000, 0.5, model.MatchReasons{ReasonAmount, ReasonDate},
+		},
+		{
+			"amount after 60 days without due date", nil, func(i *model.Invoice) { i.DueDate = model.FormDate{} }, nil,
+			date(time.May, 1), 100000, 0.45, model.MatchReasons{ReasonAmount},
+		},
+		{
+			"invoice number", func(t *model.BankTransaction) { t.RemittanceInfo = "Rechnung RE 2024 001, Teilzahlung" }, nil, nil,
+			date(time.June, 1), 50000, 0.35, model.MatchReasons{ReasonInvoiceNumber},
+		},
+		{
+			"invoice number in the reference", func(t *model.BankTransaction) { t.Reference = "RE2024001" }, nil, nil,
+			date(time.June, 1), 50000, 0.35, model.MatchReasons{ReasonInvoiceNumber},
+		},
+		{
+			"IBAN of the vendor", func(t *model.BankTransaction) { t.CounterpartyIBAN = vendor.IBAN }, nil, vendor,
+			date(time.June, 1), 100000, 0.6, model.MatchReasons{ReasonAmount, ReasonIBAN},
+		},
+		{
+			"suggested IBAN of the vendor", func(t *model.BankTransaction) { t.CounterpartyIBAN = "GB82WEST12345698765432" }, nil,
+			&model.Vendor{ID: 7, SuggestedIBAN: "GB82WEST12345698765432"}, date(time.June, 1), 100000, 0.6,
+			model.MatchReasons{ReasonAmount, ReasonIBAN},
+		},
+		{
+			"name of the vendor", func(t *model.BankTransaction) { t.CounterpartyIBAN = "GB82WEST12345698765432" }, nil, vendor,
+			date(time.June, 1), 100000, 0.55, model.MatchReasons{ReasonAmount, ReasonName},
+		},
+		{"vendor of another invoice", nil, nil, &model.Vendor{ID: 8}, date(time.June, 1), 100000, 0.45, model.MatchReasons{ReasonAmount}},
+		{
+			"all signals", func(t *model.BankTransaction) {
+				t.RemittanceInfo, t.CounterpartyIBAN = "RE-2024-001", vendor.IBAN
+			}, nil, vendor, date(time.March, 31), 100000, 1, model.MatchReasons{ReasonAmount, ReasonInvoiceNumber, ReasonIBAN, ReasonDate},
+		},
+		{
+			"balance of a partly paid invoice", nil, func(i *model.Invoice) { i.PaidAmount = eur(40000) }, nil,
+			date(time.June, 1), 60000, 0.45, model.MatchReasons{ReasonAmount},
+		},
+		{"amount of an unknown currency", nil, func(i *model.Invoice) { i.Amount.Currency = "" }, nil, date(time.June, 1), 100000, 0.45, model.MatchReasons{ReasonAmount}},
+		// the other signals only add to the amount or the invoice number
+		{
+			"vendor and date only", func(t *model.BankTransaction) { t.CounterpartyIBAN = vendor.IBAN }, nil, vendor,
+			date(time.March, 31), 50000, 0, nil,
+		},
+		{"other amount", nil, nil, nil, date(time.March, 31), 99999, 0, nil},
+		{"other currency", nil, func(i *model.Invoice) { i.Amount.Currency = "USD" }, nil, date(time.March, 31), 100000, 0, nil},
+		{"refund", nil, nil, nil, date(time.March, 31), -100000, 0, nil},
+		{"nothing paid", func(t *model.BankTransaction) { t.RemittanceInfo = "RE-2024-001" }, nil, nil, date(time.March, 31), 0, 0, nil},
+		{"without invoice number", func(t *model.BankTransaction) { t.RemittanceInfo = "RE-2024-001" }, func(i *model.Invoice) { i.ID = nil }, nil, date(time.June, 1), 50000, 0, nil},
+	}
+	for _, test := range tests {
+		invoice := testInvoice()
+		if test.invoice != nil {
+			test.invoice(invoice)
+		}
+		transaction := testTransaction(test.amount, test.booked)
+		if test.transaction != nil {
+			test.transaction(transaction)
+		}
+
+		got, reasons := score(transaction, invoice, test.vendor)
+		if got != test.want || !reflect.DeepEqual(reasons, test.wantReasons) {
+			t.Errorf("score(%s) = %v, %v, want %v, %v", test.name, got, reasons, test.want, test.wantReasons)
+		}
+	}
+}
+
+func TestScoreDiscount(t *testing.T) {
+	// 2% for paying within 10 days, until March 11th, give or take the 3 days a transfer takes
+	terms := &model.PaymentTerms{NetDays: 30, DiscountPercent: 2, DiscountDays: 10}
+	tests := []struct {
+		name        string
+		amount      int64
+		booked      model.FormDate
+		paid        *model.Money
+		want        float64
+		wantReasons model.MatchReasons
+	}{
+		{"within the discount period", 98000, date(time.March, 5), nil, 0.45, model.MatchReasons{ReasonDiscountedAmount, ReasonDate}},
+		{"on the last day", 98000, date(time.March, 11), nil, 0.45, model.MatchReasons{ReasonDiscountedAmount, ReasonDate}},
+		{"booked late by the days of a transfer", 98000, date(time.March, 14), nil, 0.45, model.MatchReasons{ReasonDiscountedAmount, ReasonDate}},
+		{"after the discount period", 98000, date(time.March, 15), nil, 0, nil},
+		{"without booking date", 98000, model.FormDate{}, nil, 0, nil},
+		// the discount applies to the whole amount, not to the rest of it
+		{"after a partial payment", 98000, date(time.March, 5), eur(1000), 0, nil},
+		{"full amount within the discount period", 100000, date(time.March, 5), nil, 0.5, model.MatchReasons{ReasonAmount, ReasonDate}},
+	}
+	for _, test := range tests {
+		invoice := testInvoice()
+		invoice.PaymentTerms = terms
+		invoice.PaidAmount = test.paid
+
+		got, reasons := score(testTransaction(test.amount, test.booked), invoice, nil)
+		if got != test.want || !reflect.DeepEqual(reasons, test.wantReasons) {
+			t.Errorf("score(%s) = %v, %v, want %v, %v", test.name, got, reasons, test.want, test.wantReasons)
+		}
+	}
+}
+
+func TestRank(t *testing.T) {
+	invoice := func(hash string, id string, amount int64) *model.Invoice {
+		invoice := testInvoice()
+		invoice.FileHash, invoice.ID, invoice.Amount = hash, &id, eur(amount)
+		return invoice
+	}
+	transaction := testTransaction(100000, date(time.June, 1))
+	transaction.RemittanceInfo = "Invoices INV-2 and INV-5"
+
+	tests := []struct {
+		name     string
+		invoices []*model.Invoice
+		want     []model.MatchProposal
+	}{
+		{
+			"best first",
+			[]*model.Invoice{invoice("h1", "INV-1", 100000), invoice("h2", "INV-2", 100000), invoice("h3", "INV-3", 50000)},
+			[]model.MatchProposal{
+				{TransactionID: 1, InvoiceHash: "h2", Confidence: 0.8, Reasons: model.MatchReasons{ReasonAmount, ReasonInvoiceNumber}},
+				{TransactionID: 1, InvoiceHash: "h1", Confidence: 0.45, Reasons: model.MatchReasons{ReasonAmount}},
+			},
+		},
+		{
+			// the invoice number alone is just enough
+			"at the least confidence",
+			[]*model.Invoice{invoice("h5", "INV-5", 50000)},
+			[]model.MatchProposal{{TransactionID: 1, InvoiceHash: "h5", Confidence: MinConfidence, Reasons: model.MatchReasons{ReasonInvoiceNumber}}},
+		},
+		{
+			"at most three, ties in order",
+			[]*model.Invoice{
+				invoice("h1", "INV-1", 100000), invoice("h3", "INV-3", 100000), invoice("h4", "INV-4", 100000),
+				invoice("h5", "INV-5", 50000), invoice("h2", "INV-2", 100000),
+			},
+			[]model.MatchProposal{
+				{TransactionID: 1, InvoiceHash: "h2", Confidence: 0.8, Reasons: model.MatchReasons{ReasonAmount, ReasonInvoiceNumber}},
+				{TransactionID: 1, InvoiceHash: "h1", Confidence: 0.45, Reasons: model.MatchReasons{ReasonAmount}},
+				{TransactionID: 1, InvoiceHash: "h3", Confidence: 0.45, Reasons: model.MatchReasons{ReasonAmount}},
+			},
+		},
+		{"no match", []*model.Invoice{invoice("h3", "INV-3", 50000)}, []model.MatchProposal{}},
+		{"no invoices", nil, []model.MatchProposal{}},
+	}
+	for _, test := range tests {
+		got := rank(transaction, test.invoices, nil)
+		if len(got) > MaxProposals {
+			t.Errorf("rank(%s) = %d proposals, want at most %d", test.name, len(got), MaxProposals)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("rank(%s) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestContainsInvoiceNumber(t *testing.T) {
+	tests := []struct {
+		text   string
+		number string
+		want   bool
+	}{
+		{"RE-2024/001", "RE-2024/001", true},
+		{"Rechnung RE 2024 001 vom 1.3.", "RE-2024/001", true},
+		{"re2024001", "RE-2024-001", true},
+		{"Invoice 4711, thanks", "4711", true},
+		{"Invoices 4711 and 4712", "4712", true},
+		// the number is part of a longer one
+		{"Invoice 47110", "4711", false},
+		{"Customer 14711", "4711", false},
+		{"RE-2024-0012", "RE-2024-001", false},
+		{"XRE-2024-001", "RE-2024-001", false},
+		{"RE2024001A", "RE-2024-001", false},
+		{"Order 2024 Invoice 001", "RE-2024-001", false},
+		// numbers too short or without digits would be found by chance
+		{"Invoice 12", "12", false},
+		{"Invoice ABCDEF", "ABCDEF", false},
+		{"", "4711", false},
+	}
+	for _, test := range tests {
+		if got := containsInvoiceNumber(test.text, test.number); got != test.want {
+			t.Errorf("containsInvoiceNumber(%q, %q) = %v, want %v", test.text, test.number, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ErrProposalNotOpen is returned for proposals that were confirmed or rejected already
+var ErrProposalNotOpen = errors.New("proposal is not open anymore")
+
+// proposalsOrder lists the best proposals first
+const proposalsOrder = "confidence DESC, id"
+
+// ImportBankTransactions stores the statement import along with its transactions. Transactions with a fingerprint
+// that is stored already are counted as duplicates instead. Returns the stored transactions
+func (m *Manager) ImportBankTransactions(bankImport *model.BankImport, transactions []model.BankTransaction) ([]model.BankTransaction, error) {
+	created := make([]model.BankTransaction, 0, len(transactions))
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(bankImport).Error; err != nil {
+			return err
+		}
+
+		fingerprints := make([]string, len(transactions))
+		for i, transaction := range transactions {
+			fingerprints[i] = transaction.Fingerprint
+		}
+		var existing []string
+		if len(fingerprints) > 0 {
+			if err := tx.Model(&model.BankTransaction{}).Where("fingerprint IN ?", fingerprints).Pluck("fingerprint", &existing).Error; err != nil {
+				return err
+			}
+		}
+		known := make(map[string]struct{}, len(existing))
+		for _, fingerprint := range existing {
+			known[fingerprint] = struct{}{}
+		}
+
+		for _, transaction := range transactions {
+			if _, ok := known[transaction.Fingerprint]; ok {
+				bankImport.Duplicates++
+				continue
+			}
+			transaction.ImportID = bankImport.ID
+			transaction.Status = model.TransactionUnmatched
+			if err := tx.Create(&transaction).Error; err != nil {
+				return err
+			}
+			created = append(created, transaction)
+		}
+
+		bankImport.Imported = len(created)
+		return tx.Model(bankImport).Updates(map[string]interface{}{
+			"imported":   bankImport.Imported,
+			"duplicates": bankImport.Duplicates,
+		}).Error
+	})
+	if err != nil {
+		m.logger.Error("Failed to import bank statement", zap.String("filename", bankImport.Filename), zap.Error(err))
+		return nil, err
+	}
+
+	m.logger.Info("Imported bank statement", zap.Uint("id", bankImport.ID), zap.String("filename", bankImport.Filename),
+		zap.Int("imported", bankImport.Imported), zap.Int("duplicates", bankImport.Duplicates))
+	return created, nil
+}
+
+// GetBankTransactions returns a page of the transactions in the status, or of all if it is empty, along with their
+// proposals and the total number of such transactions
+func (m *Manager) GetBankTransactions(status string, offset int, limit int) ([]*model.BankTransaction, int64, error) {
+	var total int64
+	if err := withStatus(m.DB.Model(&model.BankTransaction{}), status).Count(&total).Error; err != nil {
+		m.logger.Error("Failed to count bank transactions", zap.Error(err))
+		return nil, 0, err
+	}
+
+	transactions := make([]*model.BankTransaction, 0)
+	result := withStatus(m.DB, status).Preload("Proposals", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order(proposalsOrder)
+	}).Order("booking_date, id").Offset(offset).Limit(limit).Find(&transactions)
+	if result.Error != nil {
+		m.logger.Error("Failed to retrieve bank transactions", zap.Error(result.Error))
+		return nil, 0, result.Error
+	}
+
+	return transactions, total, nil
+}
+
+// GetUnmatchedBankTransactions returns the transactions without open or confirmed proposals
+func (m *Manager) GetUnmatchedBankTransactions() ([]model.BankTransaction, error) {
+	transactions := make([]model.BankTransaction, 0)
+	result := m.DB.Where("status = ?", model.TransactionUnmatched).Order("booking_date, id").Find(&transactions)
+	if result.Error != nil {
+		m.logger.Error("Failed to retrieve unmatched bank transactions", zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return transactions, nil
+}
+
+// SaveProposals stores the proposals of the transaction, invoices that were proposed for it before are skipped so
+// that rejected proposals are not made again. Returns the number of proposals stored
+func (m *Manager) SaveProposals(transactionID uint, proposals []model.MatchProposal) (int, error) {
+	saved := 0
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var proposed []string
+		if err := tx.Model(&model.MatchProposal{}).Where("transaction_id = ?", transactionID).Pluck("invoice_hash", &proposed).Error; err != nil {
+			return err
+		}
+		skip := make(map[string]struct{}, len(proposed))
+		for _, hash := range proposed {
+			skip[hash] = struct{}{}
+		}
+
+		for _, proposal := range proposals {
+			if _, ok := skip[proposal.InvoiceHash]; ok {
+				continue
+			}
+			proposal.TransactionID = transactionID
+			proposal.Status = model.ProposalOpen
+			if err := tx.Create(&proposal).Error; err != nil {
+				return err
+			}
+			saved++
+		}
+
+		if saved == 0 {
+			return nil
+		}
+		return tx.Model(&model.BankTransaction{}).Where("id = ? AND status = ?", transactionID, model.TransactionUnmatched).
+			Update("status", model.TransactionProposed).Error
+	})
+	if err != nil {
+		m.logger.Error("Failed to save match proposals", zap.Uint("transaction", transactionID), zap.Error(err))
+		return 0, err
+	}
+
+	return saved, nil
+}
+
+// GetProposals returns a page of the proposals in the status, or of all if it is empty, best first. Along with their
+// transaction, their invoice without its text and the total number of such proposals
+func (m *Manager) GetProposals(status string, offset int, limit int) ([]*model.MatchProposal, int64, error) {
+	var total int64
+	if err := withStatus(m.DB.Model(&model.MatchProposal{}), status).Count(&total).Error; err != nil {
+		m.logger.Error("Failed to count match proposals", zap.Error(err))
+		return nil, 0, err
+	}
+
+	proposals := make([]*model.MatchProposal, 0)
+	result := preloadProposal(withStatus(m.DB, status)).Order(proposalsOrder).Offset(offset).Limit(limit).Find(&proposals)
+	if result.Error != nil {
+		m.logger.Error("Failed to retrieve match proposals", zap.Error(result.Error))
+		return nil, 0, result.Error
+	}
+
+	return proposals, total, nil
+}
+
+// GetProposal returns the proposal along with its transaction and invoice, nil if there is no such proposal
+func (m *Manager) GetProposal(id uint) (*model.MatchProposal, error) {
+	var proposal model.MatchProposal
+	result := preloadProposal(m.DB).First(&proposal, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		m.logger.Error("Failed to retrieve match proposal", zap.Uint("id", id), zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return &proposal, nil
+}
+
+// withStatus filters by the status, unless it is empty
+func withStatus(query *gorm.DB, status string) *gorm.DB {
+	if status == "" {
+		return query
+	}
+	return query.Where("status = ?", status)
+}
+
+func preloadProposal(query *gorm.DB) *gorm.DB {
+	return query.Preload("Transaction").Preload("Invoice", func(tx *gorm.DB) *gorm.DB {
+		return tx.Omit("raw_text")
+	}).Preload("Invoice.Vendor")
+}
+
+// ConfirmProposal records the payment of the proposed invoice and reconciles the transaction with it, the other open
+// proposals of the transaction are rejected. Returns ErrProposalNotOpen if the proposal was confirmed or rejected
+// in the meantime
+func (m *Manager) ConfirmProposal(proposal *model.MatchProposal, payment *model.Payment) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.MatchProposal{}).Where("id = ? AND status = ?", proposal.ID, model.ProposalOpen).
+			Update("status", model.ProposalConfirmed)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrProposalNotOpen
+		}
+
+		if err := tx.Create(payment).Error; err != nil {
+			return err
+		}
+		if err := refreshPaid(tx, payment.InvoiceHash); err != nil {
+			return err
+		}
+
+		result = tx.Model(&model.MatchProposal{}).Where("transaction_id = ? AND status = ?", proposal.TransactionID, model.ProposalOpen).
+			Update("status", model.ProposalRejected)
+		if result.Error != nil {
+			return result.Error
+		}
+		return tx.Model(&model.BankTransaction{}).Where("id = ?", proposal.TransactionID).Updates(map[string]interface{}{
+			"status":     model.TransactionReconciled,
+			"payment_id": payment.ID,
+		}).Error
+	})
+	if err != nil {
+		if !errors.Is(err, ErrProposalNotOpen) {
+			m.logger.Error("Failed to confirm match proposal", zap.Uint("id", proposal.ID), zap.Error(err))
+		}
+		return err
+	}
+
+	proposal.Status = model.ProposalConfirmed
+	m.logger.Info("Confirmed match proposal", zap.Uint("id", proposal.ID), zap.String("hash", proposal.InvoiceHash),
+		zap.Uint("payment", payment.ID))
+	return nil
+}
+
+// RejectProposal rejects the proposal, the transaction is unmatched again once it has no open proposals left.
+// Returns ErrProposalNotOpen if the proposal was confirmed or rejected in the meantime
+func (m *Manager) RejectProposal(proposal *model.MatchProposal) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.MatchProposal{}).Where("id = ? AND status = ?", proposal.ID, model.ProposalOpen).
+			Update("status", model.ProposalRejected)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrProposalNotOpen
+		}
+
+		var open int64
+		if err := tx.Model(&model.MatchProposal{}).Where("transaction_id = ? AND status = ?", proposal.TransactionID, model.ProposalOpen).
+			Count(&open).Error; err != nil {
+			return err
+		}
+		if open > 0 {
+			return nil
+		}
+		return tx.Model(&model.BankTransaction{}).Where("id = ? AND status = ?", proposal.TransactionID, model.TransactionProposed).
+			Update("status", model.TransactionUnmatched).Error
+	})
+	if err != nil {
+		if !errors.Is(err, ErrProposalNotOpen) {
+			m.logger.Error("Failed to reject match proposal", zap.Uint("id", proposal.ID), zap.Error(err))
+		}
+		return err
+	}
+
+	proposal.Status = model.ProposalRejected
+	return nil
+}
+
+// unreconcile undoes the confirmation of a proposal after its payment was deleted. The proposal is rejected, so that
+// it is not made again, and the transaction is unmatched
+func unreconcile(tx *gorm.DB, paymentID uint) error {
+	var transactionIDs []uint
+	if err := tx.Model(&model.BankTransaction{}).Where("payment_id = ?", paymentID).Pluck("id", &transactionIDs).Error; err != nil {
+		return err
+	}
+	if len(transactionIDs) == 0 {
+		return nil
+	}
+
+	result := tx.Model(&model.MatchProposal{}).Where("transaction_id IN ? AND status = ?", transactionIDs, model.ProposalConfirmed).
+		Update("status", model.ProposalRejected)
+	if result.Error != nil {
+		return result.Error
+	}
+	return tx.Model(&model.BankTransaction{}).Where("id IN ?", transactionIDs).Updates(map[string]interface{}{
+		"status":     model.TransactionUnmatched,
+		"payment_id": nil,
+	}).Error
+}
@@ -8,9 +8,18 @@ import (
 	"gorm.io/gorm/clause"
 )
 
+// fileExistsBatchSize is the number of hashes updated by a single statement in UpdateInvoiceFileExists
+const fileExistsBatchSize = 500
+
 func (m *Manager) GetInvoiceByHash(hash string) (*model.Invoice, error) {
 	var invoice model.Invoice
-	result := m.DB.First(&invoice, "file_hash = ?", hash)
+	result := m.DB.Preload("Vendor").Preload("LineItems", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	}).Preload("TaxBreakdown", func(db *gorm.DB) *gorm.DB {
+		return db.Order("rate")
+	}).Preload("Payments", func(db *gorm.DB) *gorm.DB {
+		return db.Order(paymentsOrder)
+	}).First(&invoice, "file_hash = ?", hash)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			return nil, nil
@@ -38,19 +47,150 @@ func (m *Manager) GetAllInvoices() ([]*model.Invoice, error) {
 	return m.GetInvoices(0, -1)
 }
 
-func (m *Manager) UpsertInvoice(invoice *model.Invoice) error {
-	result := m.DB.Save(invoice)
+// QueryInvoices returns a page of invoices matching the filter along with the total number of matching invoices.
+// Raw text is not loaded, it is never served in listings
+func (m *Manager) QueryInvoices(filter InvoiceFilter) ([]*model.Invoice, int64, error) {
+	var total int64
+	result := filter.where(m.DB.Model(&model.Invoice{})).Count(&total)
 	if result.Error != nil {
-		m.logger.Error("Failed to upsert invoice", zap.Error(result.Error), zap.Any("invoice", invoice))
-		return result.Error
+		m.logger.Error("Failed to count invoices", zap.Error(result.Error), zap.Any("filter", filter))
+		return nil, 0, result.Error
+	}
+
+	invoices := make([]*model.Invoice, 0)
+	result = filter.page(filter.where(m.DB.Omit("raw_text").Preload("Vendor"))).Find(&invoices)
+	if result.Error != nil {
+		m.logger.Error("Failed to query invoices", zap.Error(result.Error), zap.Any("filter", filter))
+		return nil, 0, result.Error
+	}
+
+	return invoices, total, nil
+}
+
+func (m *Manager) UpsertInvoice(invoice *model.Invoice) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		return saveInvoice(tx, invoice)
+	})
+	if err != nil {
+		m.logger.Error("Failed to upsert invoice", zap.Error(err), zap.Any("invoice", invoice))
+		return err
 	}
 
 	m.logger.Info("Upserted invoice", zap.Any("invoice", invoice))
 	return nil
 }
 
+// SaveProcessingResult stores the fields found by processing an invoice file. The invoice is read again and locked in a
+// transaction and passed to apply, which fills in the fields that are still missing and returns the columns it set.
+// Only those columns are written, so that the changes made while the file was processed, such as edits, payments or
+// the review flag, are kept. Line items and the VAT breakdown set by apply are stored if the invoice had none.
+// Returns false if the invoice does not exist anymore
+func (m *Manager) SaveProcessingResult(hash string, apply func(invoice *model.Invoice) []string) (bool, error) {
+	found := false
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx
+		if m.isPostgres() {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		var invoice model.Invoice
+		result := query.Where("file_hash = ?", hash).Limit(1).Find(&invoice)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		found = true
+		if err := tx.Where("invoice_hash = ?", hash).Order("position").Find(&invoice.LineItems).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("invoice_hash = ?", hash).Order("rate").Find(&invoice.TaxBreakdown).Error; err != nil {
+			return err
+		}
+		hadLineItems := len(invoice.LineItems) > 0
+		hadTaxBreakdown := len(invoice.TaxBreakdown) > 0
+
+		columns := apply(&invoice)
+		invoice.RawText = searchableText(invoice.RawText)
+		if !hadLineItems && len(invoice.LineItems) > 0 {
+			if err := createLineItems(tx, hash, invoice.LineItems); err != nil {
+				return err
+			}
+		}
+		if !hadTaxBreakdown && len(invoice.TaxBreakdown) > 0 {
+			if err := createTaxLines(tx, hash, invoice.TaxBreakdown); err != nil {
+				return err
+			}
+		}
+		if len(columns) == 0 {
+			return nil
+		}
+		return tx.Model(&invoice).Omit(clause.Associations).Select(columns).Updates(&invoice).Error
+	})
+	if err != nil {
+		m.logger.Error("Failed to save processing result", zap.String("hash", hash), zap.Error(err))
+		return false, err
+	}
+
+	return found, nil
+}
+
+// UpdateInvoice applies the update to the invoice along with everything derived from it, such as payments, checks and
+// the due date, in one transaction. With returning, the updated invoice is returned
 func (m *Manager) UpdateInvoice(invoice *model.Invoice, returning bool) (*model.Invoice, error) {
-	result := m.DB.Model(&invoice)
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		return m.updateInvoice(tx, invoice, returning)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if returning {
+		return invoice, nil
+	}
+
+	return nil, nil
+}
+
+func (m *Manager) updateInvoice(tx *gorm.DB, invoice *model.Invoice, returning bool) error {
+	// Updates skips zero fields, zero amounts and payment terms due on receipt are set explicitly. This comes first,
+	// so that they are part of the returned invoice
+	amounts := make(map[string]interface{})
+	for prefix, amount := range map[string]*model.Money{
+		"amount_":     invoice.Amount,
+		"net_amount_": invoice.NetAmount,
+		"tax_amount_": invoice.TaxAmount,
+	} {
+		if amount != nil {
+			amounts[prefix+"minor"] = amount.Minor
+			amounts[prefix+"currency"] = amount.Currency
+		}
+	}
+	amountsChanged := len(amounts) > 0
+	if terms := invoice.PaymentTerms; terms != nil {
+		amounts["payment_terms_net_days"] = terms.NetDays
+		amounts["payment_terms_discount_percent"] = terms.DiscountPercent
+		amounts["payment_terms_discount_days"] = terms.DiscountDays
+	}
+	if len(amounts) > 0 {
+		result := tx.Model(&model.Invoice{}).Where("file_hash = ?", invoice.FileHash).Updates(amounts)
+		if result.Error != nil {
+			m.logger.Error("Failed to update invoice amounts", zap.Error(result.Error), zap.String("hash", invoice.FileHash))
+			return result.Error
+		}
+	}
+
+	// marking an invoice as paid records a payment, the flag written below matches the result
+	if invoice.IsPaid != nil {
+		if err := markPaid(tx, invoice.FileHash, *invoice.IsPaid); err != nil {
+			m.logger.Error("Failed to mark invoice as paid", zap.String("hash", invoice.FileHash), zap.Error(err))
+			return err
+		}
+	}
+	amountChanged := invoice.Amount != nil && invoice.IsPaid == nil
+
+	// the returned row fills in the fields that were not updated
+	datesChanged := !invoice.Date.IsZero() || !invoice.DueDate.IsZero() || invoice.PaymentTerms != nil
+	dueDateEntered := !invoice.DueDate.IsZero()
+
+	result := tx.Model(&invoice).Omit(clause.Associations)
 
 	if returning {
 		result = result.Clauses(clause.Returning{})
@@ -59,28 +199,75 @@ func (m *Manager) UpdateInvoice(invoice *model.Invoice, returning bool) (*model.
 	result = result.Updates(invoice)
 	if result.Error != nil {
 		m.logger.Error("Failed to update invoice", zap.Error(result.Error), zap.String("hash", invoice.FileHash), zap.Any("invoice update", &invoice))
-		return nil, result.Error
+		return result.Error
 	}
 
-	if returning {
-		return invoice, nil
+	if invoice.Amount != nil {
+		mismatch, err := refreshTotalsMismatch(tx, invoice.FileHash)
+		if err != nil {
+			m.logger.Error("Failed to check invoice totals", zap.String("hash", invoice.FileHash), zap.Error(err))
+			return err
+		}
+		invoice.TotalsMismatch = mismatch
 	}
 
-	return nil, nil
+	if invoice.TaxBreakdown != nil {
+		if _, err := replaceTaxBreakdown(tx, invoice.FileHash, invoice.TaxBreakdown, nil); err != nil {
+			m.logger.Error("Failed to replace tax breakdown", zap.String("hash", invoice.FileHash), zap.Error(err))
+			return err
+		}
+	}
+	if amountsChanged || invoice.TaxBreakdown != nil {
+		mismatch, err := refreshTaxMismatch(tx, invoice.FileHash)
+		if err != nil {
+			m.logger.Error("Failed to check invoice taxes", zap.String("hash", invoice.FileHash), zap.Error(err))
+			return err
+		}
+		invoice.TaxMismatch = mismatch
+	}
+
+	if amountChanged {
+		if err := refreshInvoicePaid(tx, invoice); err != nil {
+			m.logger.Error("Failed to update invoice payments", zap.String("hash", invoice.FileHash), zap.Error(err))
+			return err
+		}
+	}
+
+	if datesChanged {
+		dueDate, sources, err := refreshDueDate(tx, invoice.FileHash, dueDateEntered)
+		if err != nil {
+			m.logger.Error("Failed to derive invoice due date", zap.String("hash", invoice.FileHash), zap.Error(err))
+			return err
+		}
+		invoice.DueDate = dueDate
+		invoice.FieldSources = sources
+	}
+
+	return nil
 }
 
+// UpdateInvoiceFileExists marks the invoices with the given hashes as stored in filestore and all others as missing
 func (m *Manager) UpdateInvoiceFileExists(existingHashes []string) error {
-	result := m.DB.Exec(`
-		UPDATE invoices
-		SET file_exists = CASE
-			WHEN file_hash IN ? THEN true
-			ELSE false
-		END
-	`, existingHashes)
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Invoice{}).Where("file_exists = ?", true).Update("file_exists", false)
+		if result.Error != nil {
+			return result.Error
+		}
 
-	if result.Error != nil {
-		m.logger.Error("Failed to update invoice file exists", zap.Error(result.Error))
-		return result.Error
+		// the hashes are bound as parameters, both engines limit how many a single statement can have
+		for start := 0; start < len(existingHashes); start += fileExistsBatchSize {
+			batch := existingHashes[start:min(start+fileExistsBatchSize, len(existingHashes))]
+			result = tx.Model(&model.Invoice{}).Where("file_hash IN ?", batch).Update("file_exists", true)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		m.logger.Error("Failed to update invoice file exists", zap.Error(err))
+		return err
 	}
 
 	return nil
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// refreshDueDate derives the due date of the invoice again, after its date or payment terms changed. A due date given
+// with the update is kept for good instead. Returns the due date and the field sources of the invoice
+func refreshDueDate(tx *gorm.DB, hash string, entered bool) (model.FormDate, model.FieldSources, error) {
+	var invoice model.Invoice
+	result := tx.Select("file_hash", "date", "due_date", "payment_terms_net_days", "payment_terms_discount_percent",
+		"payment_terms_discount_days", "field_sources").Where("file_hash = ?", hash).Limit(1).Find(&invoice)
+	if result.Error != nil {
+		return model.FormDate{}, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return model.FormDate{}, nil, errors.New("invoice " + hash + " does not exist")
+	}
+
+	if entered {
+		invoice.MarkDueDateEntered()
+	} else if !invoice.DeriveDueDate() {
+		return invoice.DueDate, invoice.FieldSources, nil
+	}
+
+	result = tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Updates(map[string]interface{}{
+		"due_date":      invoice.DueDate,
+		"field_sources": invoice.FieldSources,
+	})
+	return invoice.DueDate, invoice.FieldSources, result.Error
+}
+
+// GetUnpaidInvoices returns the invoices that are not paid along with their vendor, without their text. For
+// model.AgeInvoices and reconciliation
+func (m *Manager) GetUnpaidInvoices() ([]*model.Invoice, error) {
+	invoices := make([]*model.Invoice, 0)
+	result := m.DB.Omit("raw_text").Preload("Vendor").Where("COALESCE(is_paid, ?) = ?", false, false).
+		Order(clause.OrderByColumn{Column: clause.Column{Name: "due_date"}}).Find(&invoices)
+	if result.Error != nil {
+		m.logger.Error("Failed to retrieve unpaid invoices", zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return invoices, nil
+}
+
+// statusCondition matches the invoices with the payment status on the day, see model.Invoice.PaymentStatus
+func statusCondition(status string, today time.Time) clause.Expression {
+	if status == model.StatusPaid {
+		return clause.Expr{SQL: "COALESCE(is_paid, ?) = ?", Vars: []interface{}{false, true}}
+	}
+
+	if status == model.StatusScheduled {
+		return clause.Expr{SQL: "COALESCE(is_paid, ?) = ? AND payment_scheduled IS NOT NULL", Vars: []interface{}{false, false}}
+	}
+
+	unpaid := clause.Expr{SQL: "COALESCE(is_paid, ?) = ? AND payment_scheduled IS NULL", Vars: []interface{}{false, false}}
+	dueSoon := today.AddDate(0, 0, model.DueSoonDays)
+	switch status {
+	case model.StatusOverdue:
+		return clause.And(unpaid, clause.Expr{SQL: "due_date < ?", Vars: []interface{}{today}})
+	case model.StatusDueSoon:
+		return clause.And(unpaid, clause.Expr{SQL: "due_date >= ? AND due_date <= ?", Vars: []interface{}{today, dueSoon}})
+	case model.StatusUpcoming:
+		return clause.And(unpaid, clause.Expr{SQL: "due_date > ?", Vars: []interface{}{dueSoon}})
+	default:
+		return clause.And(unpaid, clause.Expr{SQL: "due_date IS NULL"})
+	}
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// gorm saves a nil embedded struct as its zero value, which reads back as a zero amount rather than nil. The columns of
+// nil embedded structs are left out of inserts and set to NULL on saves instead. gorm also allocates the nil embedded
+// structs of the saved model, so copies are saved to leave them nil for the caller
+
+var (
+	moneyColumns        = []string{"minor", "currency"}
+	priceColumns        = []string{"units", "scale", "currency"}
+	paymentTermsColumns = []string{"net_days", "discount_percent", "discount_days"}
+	emailColumns        = []string{"from", "subject", "message_id", "date"}
+)
+
+// embedded is an embedded struct of a model, its columns are prefixed
+type embedded struct {
+	prefix  string
+	columns []string
+	isNil   bool
+}
+
+// nullColumns returns the columns of the nil embedded structs
+func nullColumns(structs ...embedded) []string {
+	var columns []string
+	for _, s := range structs {
+		if !s.isNil {
+			continue
+		}
+		for _, column := range s.columns {
+			columns = append(columns, s.prefix+column)
+		}
+	}
+
+	return columns
+}
+
+func invoiceNullColumns(invoice *model.Invoice) []string {
+	return nullColumns(
+		embedded{"amount_", moneyColumns, invoice.Amount == nil},
+		embedded{"net_amount_", moneyColumns, invoice.NetAmount == nil},
+		embedded{"tax_amount_", moneyColumns, invoice.TaxAmount == nil},
+		embedded{"payment_terms_", paymentTermsColumns, invoice.PaymentTerms == nil},
+		embedded{"paid_amount_", moneyColumns, invoice.PaidAmount == nil},
+		embedded{"email_", emailColumns, invoice.Email == nil},
+	)
+}
+
+func lineItemNullColumns(item *model.LineItem) []string {
+	return nullColumns(
+		embedded{"unit_price_", priceColumns, item.UnitPrice == nil},
+		embedded{"total_", moneyColumns, item.Total == nil},
+	)
+}
+
+func taxLineNullColumns(line *model.TaxLine) []string {
+	return nullColumns(
+		embedded{"net_", moneyColumns, line.Net == nil},
+		embedded{"tax_", moneyColumns, line.Tax == nil},
+	)
+}
+
+// saveInvoice inserts or updates the invoice without its associations
+func saveInvoice(tx *gorm.DB, invoice *model.Invoice) error {
+	saved := *invoice
+	saved.RawText = searchableText(saved.RawText)
+	if err := tx.Omit(clause.Associations).Save(&saved).Error; err != nil {
+		return err
+	}
+
+	columns := invoiceNullColumns(invoice)
+	if len(columns) == 0 {
+		return nil
+	}
+	nulls := make(map[string]interface{}, len(columns))
+	for _, column := range columns {
+		nulls[column] = nil
+	}
+	return tx.Model(&model.Invoice{}).Where("file_hash = ?", invoice.FileHash).Updates(nulls).Error
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"fmt"
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// The manager tests run against both engines. PostgreSQL is taken from TEST_POSTGRES_DSN, a key=value DSN of a user
+// that may create databases, e.g. "host=localhost user=postgres password=postgres sslmode=disable". Without it an
+// embedded server is started, the tests against PostgreSQL are skipped if that is not possible, e.g. offline or as root
+
+var (
+	postgresOnce   sync.Once
+	postgresServer *embeddedpostgres.EmbeddedPostgres
+	postgresBase   string
+	postgresErr    error
+
+	databaseCounter atomic.Int64
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if postgresServer != nil {
+		_ = postgresServer.Stop()
+	}
+	os.Exit(code)
+}
+
+// startPostgres returns the DSN of the PostgreSQL server to create test databases on, without a database name
+func startPostgres() (string, error) {
+	postgresOnce.Do(func() {
+		if dsn := os.Getenv("TEST_POSTGRES_DSN"); dsn != "" {
+			postgresBase = dsn
+			return
+		}
+
+		listener, err := net.Listen("tcp", "localhost:0")
+		if err != nil {
+			postgresErr = err
+			return
+		}
+		port := uint32(listener.Addr().(*net.TCPAddr).Port)
+		_ = listener.Close()
+
+		dir, err := os.MkdirTemp("", "invoices-postgres")
+		if err != nil {
+			postgresErr = err
+			return
+		}
+		server := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+			Port(port).
+			RuntimePath(filepath.Join(dir, "runtime")).
+			Logger(nil))
+		if err = server.Start(); err != nil {
+			postgresErr = fmt.Errorf("failed to start embedded PostgreSQL: %w", err)
+			return
+		}
+		postgresServer = server
+		postgresBase = fmt.Sprintf("host=localhost port=%d user=postgres password=postgres sslmode=disable", port)
+	})
+
+	return postgresBase, postgresErr
+}
+
+// newTestDatabase creates an empty database of the engine and returns the arguments of NewManagerOfType for it.
+// The database is removed when the test is done
+func newTestDatabase(t *testing.T, managerType string) string {
+	t.Helper()
+
+	if managerType == "sqlite" {
+		return filepath.Join(t.TempDir(), "invoices.db")
+	}
+
+	base, err := startPostgres()
+	if err != nil {
+		t.Skipf("PostgreSQL is not available: %v", err)
+	}
+	admin, err := gorm.Open(postgres.Open(base), &gorm.Config{})
+	if err != nil {
+		t.Skipf("PostgreSQL is not available: %v", err)
+	}
+	name := fmt.Sprintf("invoices_test_%d_%d", os.Getpid(), databaseCounter.Add(1))
+	if err = admin.Exec("CREATE DATABASE " + name).Error; err != nil {
+		t.Fatalf("failed to create database %s: %v", name, err)
+	}
+	t.Cleanup(func() {
+		// the connections of the manager are still open, FORCE closes them
+		_ = admin.Exec("DROP DATABASE IF EXISTS " + name + " WITH (FORCE)").Error
+		if sqlDB, err := admin.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	return strings.TrimSpace(base) + " dbname=" + name
+}
+
+// newTestManager creates a manager of the engine on an empty, migrated database
+func newTestManager(t *testing.T, managerType string) *Manager {
+	t.Helper()
+
+	manager, err := NewManagerOfType(managerType, zap.NewNop(), newTestDatabase(t, managerType))
+	if err != nil {
+		t.Fatalf("failed to create %s manager: %v", managerType, err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := manager.DB.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	return manager
+}
+
+// forEachEngine runs the test as a subtest for every database engine
+func forEachEngine(t *testing.T, test func(t *testing.T, managerType string)) {
+	for _, managerType := range []string{"sqlite", "postgres"} {
+		t.Run(managerType, func(t *testing.T) {
+			test(t, managerType)
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package db
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math/big"
+	"time"
+)
+
+// InvoiceSortColumns maps the sort keys accepted by QueryInvoices to database columns
+var InvoiceSortColumns = map[string]string{
+	"date":    "date",
+	"amount":  "amount_minor", // amounts in different currencies are not converted
+	"id":      "id",
+	"dueDate": "due_date",
+}
+
+// InvoiceFilter describes a single page of invoices: which rows to include, in what order and which slice of them
+// Nil fields are not applied
+type InvoiceFilter struct {
+	Offset   int
+	Limit    int
+	SortBy   string // one of the InvoiceSortColumns keys, defaults to the file hash
+	SortDesc bool
+
+	IsPaid         *bool
+	IsReviewed     *bool
+	FileExists     *bool
+	TotalsMismatch *bool      // line items plus tax do not add up to the amount
+	TaxMismatch    *bool      // net, tax and gross amounts do not add up
+	DateFrom       *time.Time // inclusive
+	DateTo         *time.Time // inclusive
+	Currency       *string    // ISO 4217 code
+	AmountMin      *big.Rat   // in the major unit of each currency, inclusive
+	AmountMax      *big.Rat   // in the major unit of each currency, inclusive
+	VendorID       *uint
+	Status         *string   // one of the payment statuses of model.Invoice.PaymentStatus
+	Today          time.Time // the day the status is computed for
+}
+
+// where applies the row filters, but not ordering or pagination, so the same query can be used for counting
+func (f *InvoiceFilter) where(query *gorm.DB) *gorm.DB {
+	// unset flags are treated as false, the frontend shows them that way
+	if f.IsPaid != nil {
+		query = query.Where("COALESCE(is_paid, ?) = ?", false, *f.IsPaid)
+	}
+	if f.IsReviewed != nil {
+		query = query.Where("COALESCE(is_reviewed, ?) = ?", false, *f.IsReviewed)
+	}
+	if f.FileExists != nil {
+		query = query.Where("file_exists = ?", *f.FileExists)
+	}
+	if f.TotalsMismatch != nil {
+		query = query.Where("totals_mismatch = ?", *f.TotalsMismatch)
+	}
+	if f.TaxMismatch != nil {
+		query = query.Where("tax_mismatch = ?", *f.TaxMismatch)
+	}
+	if f.DateFrom != nil {
+		query = query.Where("date >= ?", *f.DateFrom)
+	}
+	if f.DateTo != nil {
+		query = query.Where("date <= ?", *f.DateTo)
+	}
+	if f.Currency != nil {
+		query = query.Where("amount_currency = ?", *f.Currency)
+	}
+	if f.AmountMin != nil {
+		query = query.Where(amountCondition(">=", f.AmountMin, f.Currency))
+	}
+	if f.AmountMax != nil {
+		query = query.Where(amountCondition("<=", f.AmountMax, f.Currency))
+	}
+	if f.VendorID != nil {
+		query = query.Where("vendor_id = ?", *f.VendorID)
+	}
+	if f.Status != nil {
+		query = query.Where(statusCondition(*f.Status, f.Today))
+	}
+
+	return query
+}
+
+// amountExponents are the minor units of the currencies other than the usual two decimals
+var amountExponents = []int{0, 3, 4}
+
+// amountCondition compares the stored minor units to an amount in the major unit. Unless the currency is known,
+// the amount is converted for every group of currencies with the same minor unit. Amounts without a currency have two
+// decimals
+func amountCondition(operator string, amount *big.Rat, currency *string) clause.Expression {
+	if currency != nil {
+		exponent, _ := model.CurrencyExponent(*currency)
+		return clause.Expr{SQL: "amount_minor " + operator + " ?", Vars: []interface{}{minorBound(amount, exponent, operator == ">=")}}
+	}
+
+	var conditions []clause.Expression
+	var others []string
+	for _, exponent := range amountExponents {
+		codes := model.CurrenciesWithExponent(exponent)
+		others = append(others, codes...)
+		conditions = append(conditions, clause.Expr{
+			SQL:  "(amount_currency IN ? AND amount_minor " + operator + " ?)",
+			Vars: []interface{}{codes, minorBound(amount, exponent, operator == ">=")},
+		})
+	}
+	conditions = append(conditions, clause.Expr{
+		SQL:  "(COALESCE(amount_currency, '') NOT IN ? AND amount_minor " + operator + " ?)",
+		Vars: []interface{}{others, minorBound(amount, 2, operator == ">=")},
+	})
+
+	return clause.Or(conditions...)
+}
+
+// minorBound converts an amount to minor units, rounding up for lower bounds and down for upper bounds so that
+// the comparison stays exact
+func minorBound(amount *big.Rat, exponent int, lower bool) int64 {
+	scaled := new(big.Rat).Mul(amount, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)))
+	quotient, remainder := new(big.Int).QuoRem(scaled.Num(), scaled.Denom(), new(big.Int))
+	// QuoRem truncates towards zero
+	if remainder.Sign() > 0 && lower {
+		quotient.Add(quotient, big.NewInt(1))
+	} else if remainder.Sign() < 0 && !lower {
+		quotient.Sub(quotient, big.NewInt(1))
+	}
+
+	return quotient.Int64()
+}
+
+// page applies ordering and pagination. file_hash is always used as the last sort key to keep pages stable
+func (f *InvoiceFilter) page(query *gorm.DB) *gorm.DB {
+	if column, ok := InvoiceSortColumns[f.SortBy]; ok {
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: column}, Desc: f.SortDesc})
+	}
+	query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "file_hash"}, Desc: f.SortDesc})
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = -1
+	}
+
+	return query.Offset(f.Offset).Limit(limit)
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// CreateInvoiceWithJob stores a new invoice together with the job that will process it
+func (m *Manager) CreateInvoiceWithJob(invoice *model.Invoice, job *model.Job) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveInvoice(tx, invoice); err != nil {
+			return err
+		}
+
+		job.FileHash = invoice.FileHash
+		return tx.Create(job).Error
+	})
+	if err != nil {
+		m.logger.Error("Failed to create invoice with processing job", zap.String("hash", invoice.FileHash), zap.Error(err))
+		return err
+	}
+
+	m.logger.Info("Created invoice with processing job", zap.String("hash", invoice.FileHash), zap.Uint("job", job.ID))
+	return nil
+}
+
+func (m *Manager) GetJob(id uint) (*model.Job, error) {
+	var job model.Job
+	result := m.DB.First(&job, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		m.logger.Error("Failed to retrieve job", zap.Uint("id", id), zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return &job, nil
+}
+
+const (
+	// JobHeartbeatInterval is how often the worker running a job marks it as alive, see HeartbeatJob
+	JobHeartbeatInterval = time.Minute
+	// staleJobTimeout is how long a job may stay running without a heartbeat. After that its worker is assumed to be
+	// gone, e.g. with a crashed instance sharing the database, and the job is claimed again
+	staleJobTimeout = 5 * JobHeartbeatInterval
+)
+
+// ErrJobReclaimed is returned when a job is finished by a worker that lost it, the job was taken for stale and claimed
+// again by another worker
+var ErrJobReclaimed = errors.New("job was claimed by another worker")
+
+// ClaimJob marks the next due pending or stale running job as running and returns it, nil if there is no job to run.
+// A job is only ever claimed by a single caller
+func (m *Manager) ClaimJob() (*model.Job, error) {
+	for {
+		var job model.Job
+		claimed := false
+		claim := func(tx *gorm.DB) error {
+			now := time.Now()
+			query := tx.Where("(status = ? AND run_at <= ?) OR (status = ? AND updated_at < ?)",
+				model.JobPending, now, model.JobRunning, now.Add(-staleJobTimeout))
+			if m.isPostgres() {
+				// other instances skip the rows locked here instead of waiting for them
+				query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+			}
+			result := query.Order("run_at, id").Limit(1).Find(&job)
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+
+			// attempts only grow, so the condition makes the claim fail if another worker got to the job first
+			result = tx.Model(&job).Where("attempts = ?", job.Attempts).Updates(map[string]interface{}{
+				"status":   model.JobRunning,
+				"attempts": gorm.Expr("attempts + 1"),
+			})
+			claimed = result.RowsAffected > 0
+			return result.Error
+		}
+
+		// the row lock only lasts until the end of a transaction. SQLite has no row locks, the condition on the attempts
+		// keeps a job from being claimed twice there
+		var err error
+		if m.isPostgres() {
+			err = m.DB.Transaction(claim)
+		} else {
+			err = claim(m.DB)
+		}
+		if err != nil {
+			m.logger.Error("Failed to claim job", zap.Error(err))
+			return nil, err
+		}
+		if job.ID == 0 {
+			return nil, nil
+		}
+		if !claimed {
+			continue
+		}
+
+		job.Status = model.JobRunning
+		job.Attempts++
+		return &job, nil
+	}
+}
+
+// HeartbeatJob marks a running job as alive, so that it is not taken for stale while it takes long. Returns
+// ErrJobReclaimed if the job was claimed by another worker meanwhile
+func (m *Manager) HeartbeatJob(job *model.Job) error {
+	result := m.DB.Model(&model.Job{}).Where("id = ? AND status = ? AND attempts = ?", job.ID, model.JobRunning, job.Attempts).
+		Update("updated_at", time.Now())
+	if result.Error != nil {
+		m.logger.Error("Failed to update job heartbeat", zap.Uint("id", job.ID), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrJobReclaimed
+	}
+
+	return nil
+}
+
+func (m *Manager) CompleteJob(job *model.Job) error {
+	now := time.Now()
+	job.Status = model.JobDone
+	job.LastError = ""
+	job.Failure = ""
+	job.FinishedAt = &now
+
+	return m.saveJob(job)
+}
+
+// RetryJob records the failure of a job attempt. The job is run again at retryAt, unless it has no attempts left
+func (m *Manager) RetryJob(job *model.Job, jobErr error, failure model.JobFailure, retryAt time.Time) error {
+	job.LastError = jobErr.Error()
+	job.Failure = failure
+	if job.Attempts >= job.MaxAttempts {
+		now := time.Now()
+		job.Status = model.JobFailed
+		job.FinishedAt = &now
+	} else {
+		job.Status = model.JobPending
+		job.RunAt = retryAt
+	}
+
+	return m.saveJob(job)
+}
+
+// ResetRunningJobs puts the jobs interrupted by a shutdown back in the queue. A PostgreSQL database may be shared with
+// other instances that are running jobs, so only stale jobs are reset there
+func (m *Manager) ResetRunningJobs() error {
+	query := m.DB.Model(&model.Job{}).Where("status = ?", model.JobRunning)
+	if m.isPostgres() {
+		query = query.Where("updated_at < ?", time.Now().Add(-staleJobTimeout))
+	}
+	result := query.Update("status", model.JobPending)
+	if result.Error != nil {
+		m.logger.Error("Failed to reset running jobs", zap.Error(result.Error))
+		return result.Error
+	}
+
+	if result.RowsAffected > 0 {
+		m.logger.Info("Reset interrupted jobs", zap.Int64("count", result.RowsAffected))
+	}
+	return nil
+}
+
+// saveJob stores the outcome of the attempt of a running job. The attempt is the claim of the worker, the job is not
+// saved and ErrJobReclaimed is returned if another worker claimed it again
+func (m *Manager) saveJob(job *model.Job) error {
+	result := m.DB.Model(job).Where("status = ? AND attempts = ?", model.JobRunning, job.Attempts).Select("*").Updates(job)
+	if result.Error != nil {
+		m.logger.Error("Failed to save job", zap.Uint("id", job.ID), zap.String("status", string(job.Status)), zap.Error(result.Error))
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		m.logger.Warn("Job was claimed by another worker, its outcome is dropped", zap.Uint("id", job.ID), zap.Int("attempt", job.Attempts))
+		return ErrJobReclaimed
+	}
+
+	return nil
+}
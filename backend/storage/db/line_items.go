@@ -0,0 +1,85 @@
+package db
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// ReplaceLineItems replaces all line items of the invoice. The sources are merged into the field sources of the invoice,
+// empty ones are removed. The totals check of the invoice is updated along with them.
+// Returns false if the invoice does not exist
+func (m *Manager) ReplaceLineItems(hash string, items []model.LineItem, sources model.FieldSources) (bool, error) {
+	found := false
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var invoice model.Invoice
+		result := tx.Select("file_hash", "amount_minor", "amount_currency", "field_sources").Where("file_hash = ?", hash).Limit(1).Find(&invoice)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		found = true
+
+		if err := tx.Where("invoice_hash = ?", hash).Delete(&model.LineItem{}).Error; err != nil {
+			return err
+		}
+		if err := createLineItems(tx, hash, items); err != nil {
+			return err
+		}
+
+		if invoice.FieldSources == nil {
+			invoice.FieldSources = make(model.FieldSources)
+		}
+		for field, source := range sources {
+			if source == "" {
+				delete(invoice.FieldSources, field)
+			} else {
+				invoice.FieldSources[field] = source
+			}
+		}
+
+		return tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Updates(map[string]interface{}{
+			"field_sources":   invoice.FieldSources,
+			"totals_mismatch": model.TotalsMismatch(invoice.Amount, items),
+		}).Error
+	})
+	if err != nil {
+		m.logger.Error("Failed to replace line items", zap.String("hash", hash), zap.Error(err))
+		return false, err
+	}
+
+	return found, nil
+}
+
+// createLineItems inserts the line items of the invoice, numbered in order
+func createLineItems(tx *gorm.DB, hash string, items []model.LineItem) error {
+	for i := range items {
+		items[i].ID = 0
+		items[i].InvoiceHash = hash
+		items[i].Position = i + 1
+	}
+	for i := range items {
+		item := items[i]
+		if err := tx.Omit(lineItemNullColumns(&item)...).Create(&item).Error; err != nil {
+			return err
+		}
+		items[i].ID = item.ID
+	}
+	return nil
+}
+
+// refreshTotalsMismatch checks the totals of the invoice again, after its amount or line items changed
+func refreshTotalsMismatch(tx *gorm.DB, hash string) (bool, error) {
+	var invoice model.Invoice
+	result := tx.Preload("LineItems").Select("file_hash", "amount_minor", "amount_currency").Where("file_hash = ?", hash).Limit(1).Find(&invoice)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, errors.New("invoice " + hash + " does not exist")
+	}
+
+	mismatch := model.TotalsMismatch(invoice.Amount, invoice.LineItems)
+	result = tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Update("totals_mismatch", mismatch)
+	return mismatch, result.Error
+}
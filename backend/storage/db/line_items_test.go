@@ -0,0 +1,74 @@
+package db
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"testing"
+)
+
+func TestTotalsMismatchFlag(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		if err := m.UpsertInvoice(newTestInvoice("h1", "INV-1", 11900, "")); err != nil {
+			t.Fatal(err)
+		}
+		taxRate := 19.0
+		lines := func(totals ...int64) []model.LineItem {
+			var items []model.LineItem
+			for _, total := range totals {
+				items = append(items, model.LineItem{Total: &model.Money{Minor: total, Currency: "EUR"}, TaxRate: &taxRate})
+			}
+			return items
+		}
+		check := func(step string, want bool) {
+			t.Helper()
+			invoice, err := m.GetInvoiceByHash("h1")
+			if err != nil || invoice == nil {
+				t.Fatalf("%s: GetInvoiceByHash = %v, %v", step, invoice, err)
+			}
+			if invoice.TotalsMismatch != want {
+				t.Errorf("%s: totals mismatch = %v, want %v", step, invoice.TotalsMismatch, want)
+			}
+			mismatched, total, err := m.QueryInvoices(InvoiceFilter{TotalsMismatch: &want, Limit: 10})
+			if err != nil || total != 1 || mismatched[0].FileHash != "h1" {
+				t.Errorf("%s: QueryInvoices(totals mismatch %v) = %d invoices, %v, want h1", step, want, total, err)
+			}
+		}
+
+		check("without line items", false)
+
+		if _, err := m.ReplaceLineItems("h1", lines(6000, 4000), nil); err != nil {
+			t.Fatal(err)
+		}
+		check("line items adding up", false)
+
+		if _, err := m.ReplaceLineItems("h1", lines(6000), nil); err != nil {
+			t.Fatal(err)
+		}
+		check("line item missing", true)
+
+		if _, err := m.ReplaceLineItems("h1", lines(6000, 4000), nil); err != nil {
+			t.Fatal(err)
+		}
+		check("line items corrected", false)
+
+		// a changed amount is checked against the stored line items
+		updated, err := m.UpdateInvoice(&model.Invoice{FileHash: "h1", Amount: &model.Money{Minor: 12000, Currency: "EUR"}}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !updated.TotalsMismatch {
+			t.Errorf("UpdateInvoice() to another amount = no mismatch, want the invoice flagged")
+		}
+		check("amount changed", true)
+
+		if _, err = m.UpdateInvoice(&model.Invoice{FileHash: "h1", Amount: &model.Money{Minor: 11901, Currency: "EUR"}}, true); err != nil {
+			t.Fatal(err)
+		}
+		check("amount off by rounding", false)
+
+		if _, err = m.UpdateInvoice(&model.Invoice{FileHash: "h1", Amount: &model.Money{Minor: 11900, Currency: "USD"}}, true); err != nil {
+			t.Fatal(err)
+		}
+		check("amount in another currency", true)
+	})
+}
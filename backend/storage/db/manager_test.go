@@ -0,0 +1,634 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"math/big"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestInvoice(hash string, id string, amount int64, rawText string) *model.Invoice {
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	return &model.Invoice{
+		FileHash:         hash,
+		OriginalFileName: hash + ".pdf",
+		ID:               &id,
+		Date:             model.NewFormDate(date),
+		Amount:           &model.Money{Minor: amount, Currency: "EUR"},
+		RawText:          rawText,
+		FileExists:       true,
+	}
+}
+
+func TestInvoiceRoundTrip(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+
+		invoice := newTestInvoice("a1", "INV-1", 12345, "")
+		invoice.NetAmount = &model.Money{Minor: 10374, Currency: "EUR"}
+		if err := m.UpsertInvoice(invoice); err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := m.GetInvoiceByHash("a1")
+		if err != nil || stored == nil {
+			t.Fatalf("GetInvoiceByHash = %v, %v", stored, err)
+		}
+		if *stored.Amount != *invoice.Amount || *stored.NetAmount != *invoice.NetAmount {
+			t.Errorf("amounts = %v, %v, want %v, %v", stored.Amount, stored.NetAmount, invoice.Amount, invoice.NetAmount)
+		}
+		// nil embedded structs stay nil
+		if stored.TaxAmount != nil || stored.PaymentTerms != nil || stored.Email != nil {
+			t.Errorf("nil fields were stored as zero values: %v, %v, %v", stored.TaxAmount, stored.PaymentTerms, stored.Email)
+		}
+		if !stored.Date.Time().Equal(*invoice.Date.Time()) {
+			t.Errorf("date = %v, want %v", stored.Date.Time(), invoice.Date.Time())
+		}
+
+		missing, err := m.GetInvoiceByHash("missing")
+		if err != nil || missing != nil {
+			t.Errorf("GetInvoiceByHash of a missing invoice = %v, %v, want nil, nil", missing, err)
+		}
+	})
+}
+
+func TestQueryInvoices(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+
+		paid := true
+		for i, amount := range []int64{500, 1500, 2500, 3500, 4500} {
+			invoice := newTestInvoice(fmt.Sprintf("h%d", i), fmt.Sprintf("INV-%d", i), amount, "")
+			if i%2 == 0 {
+				invoice.IsPaid = &paid
+			}
+			if err := m.UpsertInvoice(invoice); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := m.UpsertInvoice(&model.Invoice{FileHash: "h9", Amount: &model.Money{Minor: 1500, Currency: "JPY"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		unpaid := false
+		currency := "EUR"
+		tests := []struct {
+			name   string
+			filter InvoiceFilter
+			want   []string
+			total  int64
+		}{
+			{"all", InvoiceFilter{}, []string{"h0", "h1", "h2", "h3", "h4", "h9"}, 6},
+			{"page", InvoiceFilter{Offset: 2, Limit: 2}, []string{"h2", "h3"}, 6},
+			{"unpaid", InvoiceFilter{IsPaid: &unpaid}, []string{"h1", "h3", "h9"}, 3},
+			{"sorted", InvoiceFilter{SortBy: "amount", SortDesc: true, Currency: &currency, Limit: 2}, []string{"h4", "h3"}, 5},
+			{"amount range", InvoiceFilter{AmountMin: mustRat(t, "15"), AmountMax: mustRat(t, "25")}, []string{"h1", "h2"}, 2},
+			// 1500 yen is in range, JPY has no minor unit
+			{"amount range without decimals", InvoiceFilter{AmountMin: mustRat(t, "1000"), AmountMax: mustRat(t, "2000")}, []string{"h9"}, 1},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				invoices, total, err := m.QueryInvoices(test.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if total != test.total {
+					t.Errorf("total = %d, want %d", total, test.total)
+				}
+				if got := invoiceHashes(invoices); got != strings.Join(test.want, ",") {
+					t.Errorf("invoices = %s, want %s", got, strings.Join(test.want, ","))
+				}
+			})
+		}
+	})
+}
+
+func mustRat(t *testing.T, value string) *big.Rat {
+	t.Helper()
+
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		t.Fatalf("invalid number %q", value)
+	}
+	return rat
+}
+
+func invoiceHashes(invoices []*model.Invoice) string {
+	hashes := make([]string, 0, len(invoices))
+	for _, invoice := range invoices {
+		hashes = append(hashes, invoice.FileHash)
+	}
+	return strings.Join(hashes, ",")
+}
+
+func createTestJobs(t *testing.T, m *Manager, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		job := &model.Job{Status: model.JobPending, MaxAttempts: 3, RunAt: time.Now().Add(-time.Minute)}
+		if err := m.CreateInvoiceWithJob(&model.Invoice{FileHash: fmt.Sprintf("job%d", i)}, job); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestClaimJobConcurrently(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		const jobs = 20
+		createTestJobs(t, m, jobs)
+
+		var mu sync.Mutex
+		claimed := make(map[uint]int)
+		var wg sync.WaitGroup
+		for worker := 0; worker < 4; worker++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					job, err := m.ClaimJob()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if job == nil {
+						return
+					}
+					mu.Lock()
+					claimed[job.ID]++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(claimed) != jobs {
+			t.Errorf("claimed %d jobs, want %d", len(claimed), jobs)
+		}
+		for id, count := range claimed {
+			if count != 1 {
+				t.Errorf("job %d was claimed %d times", id, count)
+			}
+		}
+	})
+}
+
+func TestClaimJobRetries(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		createTestJobs(t, m, 1)
+
+		job, err := m.ClaimJob()
+		if err != nil || job == nil {
+			t.Fatalf("ClaimJob = %v, %v", job, err)
+		}
+		if again, err := m.ClaimJob(); err != nil || again != nil {
+			t.Fatalf("ClaimJob of a running job = %v, %v, want nil", again, err)
+		}
+
+		// a retry that is not due yet is not claimed
+		if err = m.RetryJob(job, fmt.Errorf("unavailable"), model.JobFailureLLM, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if again, err := m.ClaimJob(); err != nil || again != nil {
+			t.Fatalf("ClaimJob before the retry is due = %v, %v, want nil", again, err)
+		}
+
+		if err = m.DB.Model(job).Update("run_at", time.Now().Add(-time.Second)).Error; err != nil {
+			t.Fatal(err)
+		}
+		retried, err := m.ClaimJob()
+		if err != nil || retried == nil || retried.ID != job.ID || retried.Attempts != 2 {
+			t.Fatalf("ClaimJob of a due retry = %+v, %v, want job %d at attempt 2", retried, err, job.ID)
+		}
+		if err = m.CompleteJob(retried); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := m.GetJob(job.ID)
+		if err != nil || stored.Status != model.JobDone || stored.LastError != "" {
+			t.Errorf("completed job = %+v, %v", stored, err)
+		}
+	})
+}
+
+// TestClaimJobSkipLocked checks that a job locked by another instance is skipped rather than waited for
+func TestClaimJobSkipLocked(t *testing.T) {
+	m := newTestManager(t, "postgres")
+	createTestJobs(t, m, 2)
+
+	tx := m.DB.Begin()
+	defer tx.Rollback()
+	var locked model.Job
+	if err := tx.Raw(`SELECT * FROM jobs ORDER BY run_at, id LIMIT 1 FOR UPDATE`).Scan(&locked).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan *model.Job, 1)
+	go func() {
+		job, err := m.ClaimJob()
+		if err != nil {
+			t.Error(err)
+		}
+		done <- job
+	}()
+	select {
+	case job := <-done:
+		if job == nil || job.ID == locked.ID {
+			t.Errorf("ClaimJob = %+v, want the job that is not locked", job)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ClaimJob waited for the locked job")
+	}
+}
+
+// TestMigrationLock checks that migrations wait for the advisory lock held by another instance
+func TestMigrationLock(t *testing.T) {
+	dsn := newTestDatabase(t, "postgres")
+	migrator, err := NewMigratorOfType("postgres", zap.NewNop(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx := migrator.db.Begin()
+	defer tx.Rollback()
+	if err = tx.Exec(`SELECT pg_advisory_xact_lock(?)`, migrationLockID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- migrator.Down()
+	}()
+	select {
+	case err = <-done:
+		t.Fatalf("Down did not wait for the migration lock: %v", err)
+	case <-time.After(500 * time.Millisecond):
+	}
+
+	tx.Rollback()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	status, err := migrator.Status()
+	if err != nil || status.Current != status.Latest-1 {
+		t.Errorf("Status = %+v, %v, want one migration rolled back", status, err)
+	}
+}
+
+// TestMigrateConcurrently starts several instances on an empty database at once, as several backends sharing a
+// PostgreSQL database do. SQLite databases are not shared
+func TestMigrateConcurrently(t *testing.T) {
+	dsn := newTestDatabase(t, "postgres")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			migrator, err := NewMigratorOfType("postgres", zap.NewNop(), dsn)
+			if err == nil {
+				err = migrator.Up()
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrator, err := NewMigratorOfType("postgres", zap.NewNop(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []SchemaVersion
+	if err = migrator.db.Order("version").Find(&versions).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != migrator.latest() {
+		t.Errorf("%d versions recorded, want %d", len(versions), migrator.latest())
+	}
+}
+
+func TestMigrateDownAndUp(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		dsn := newTestDatabase(t, managerType)
+		migrator, err := NewMigratorOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+
+		// every down migration has to undo its up migration, so that the next up migration succeeds again
+		for version := migrator.latest() - 1; version >= 0; version-- {
+			if err = migrator.To(version); err != nil {
+				t.Fatal(err)
+			}
+			if err = migrator.Up(); err != nil {
+				t.Fatal(err)
+			}
+			if err = migrator.To(version); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if migrator.db.Migrator().HasTable("invoices") {
+			t.Error("invoices table is left after rolling back all migrations")
+		}
+
+		status, err := migrator.Status()
+		if err != nil || status.Current != 0 || len(status.Pending) != migrator.latest() {
+			t.Fatalf("Status = %+v, %v, want all migrations pending", status, err)
+		}
+
+		// the full-text search schema is set up again on top of the migrated schema
+		m, err := NewManagerOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = m.UpsertInvoice(newTestInvoice("a1", "INV-1", 100, "Rechnung")); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestSearchInvoices(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		if !m.fullTextSearch {
+			t.Skip("SQLite is built without FTS5, run the tests with -tags sqlite_fts5")
+		}
+
+		for _, invoice := range []*model.Invoice{
+			newTestInvoice("a1", "RE-2024-001", 100, "Stadtwerke Musterstadt Stromlieferung März"),
+			newTestInvoice("a2", "RE-2024-002", 200, "Hosting <script> monthly server rental"),
+			newTestInvoice("a3", "INV-77", 300, "Office chairs and a standing desk"),
+			newTestInvoice("a4", "INV-78", 400, "Wartung\x02 der \x03Heizung"),
+		} {
+			if err := m.UpsertInvoice(invoice); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// updates are indexed as well
+		if err := m.DB.Model(&model.Invoice{}).Where("file_hash = ?", "a3").Update("raw_text", "Office chairs").Error; err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{"strom*", []string{"a1"}},
+			{"musterstadt stromlieferung", []string{"a1"}},
+			{`"server rental"`, []string{"a2"}},
+			{`"rental server"`, nil},
+			{"2024", []string{"a1", "a2"}},
+			{"desk", nil},
+			{"chairs", []string{"a3"}},
+			{"chair *", nil},
+			{`AND OR NOT ( ) : ^ "`, nil},
+		}
+		for _, test := range tests {
+			t.Run(test.query, func(t *testing.T) {
+				results, total, err := m.SearchInvoices(test.query, 0, 10)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := make([]string, 0, len(results))
+				for _, result := range results {
+					got = append(got, result.FileHash)
+				}
+				if strings.Join(slices.Sorted(slices.Values(got)), ",") != strings.Join(test.want, ",") || total != int64(len(test.want)) {
+					t.Errorf("results = %v (total %d), want %v", got, total, test.want)
+				}
+			})
+		}
+
+		results, _, err := m.SearchInvoices("hosting", 0, 10)
+		if err != nil || len(results) != 1 {
+			t.Fatalf("SearchInvoices = %v, %v", results, err)
+		}
+		if snippet := results[0].Snippet; !strings.Contains(snippet, "<mark>Hosting</mark>") || strings.Contains(snippet, "<script>") {
+			t.Errorf("snippet = %q, want the match highlighted and the text escaped", snippet)
+		}
+
+		results, _, err = m.SearchInvoices("heizung", 0, 10)
+		if err != nil || len(results) != 1 {
+			t.Fatalf("SearchInvoices = %v, %v", results, err)
+		}
+		if snippet := results[0].Snippet; snippet != "Wartung der <mark>Heizung</mark>" {
+			t.Errorf("snippet = %q, want only the match highlighted", snippet)
+		}
+	})
+}
+
+func TestUpdateInvoiceFileExists(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		for i := 0; i < 3; i++ {
+			if err := m.UpsertInvoice(newTestInvoice(fmt.Sprintf("h%d", i), "", 100, "")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := m.UpdateInvoiceFileExists([]string{"h1", "unknown"}); err != nil {
+			t.Fatal(err)
+		}
+		var existing []string
+		err := m.DB.Model(&model.Invoice{}).Where("file_exists = ?", true).Order("file_hash").Pluck("file_hash", &existing).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(existing, ",") != "h1" {
+			t.Errorf("existing files = %v, want [h1]", existing)
+		}
+	})
+}
+
+func TestSaveProcessingResult(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		if err := m.UpsertInvoice(&model.Invoice{FileHash: "h1", OriginalFileName: "h1.pdf", FileExists: true}); err != nil {
+			t.Fatal(err)
+		}
+
+		// edited while the file was processed
+		scheduled := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+		err := m.DB.Model(&model.Invoice{}).Where("file_hash = ?", "h1").
+			Updates(map[string]interface{}{"id": "EDITED", "is_reviewed": true, "payment_scheduled": scheduled}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		quantity := 2.0
+		found, err := m.SaveProcessingResult("h1", func(invoice *model.Invoice) []string {
+			if invoice.ID == nil || *invoice.ID != "EDITED" || invoice.IsReviewed == nil || !*invoice.IsReviewed {
+				t.Errorf("apply got %+v, want the edited invoice", invoice)
+			}
+			// only the listed columns are written
+			id, reviewed := "INV-1", false
+			invoice.ID = &id
+			invoice.IsReviewed = &reviewed
+			invoice.Amount = &model.Money{Minor: 3980, Currency: "EUR"}
+			invoice.LineItems = []model.LineItem{{Position: 1, Description: "Hosting", Quantity: &quantity,
+				UnitPrice: &model.Price{Units: 1990, Scale: 2, Currency: "EUR"}}}
+			return []string{"amount_minor", "amount_currency"}
+		})
+		if err != nil || !found {
+			t.Fatalf("SaveProcessingResult = %v, %v", found, err)
+		}
+
+		invoice, err := m.GetInvoiceByHash("h1")
+		if err != nil || invoice == nil {
+			t.Fatalf("GetInvoiceByHash = %v, %v", invoice, err)
+		}
+		if invoice.Amount == nil || *invoice.Amount != (model.Money{Minor: 3980, Currency: "EUR"}) {
+			t.Errorf("amount = %v, want 39.80 EUR", invoice.Amount)
+		}
+		if invoice.ID == nil || *invoice.ID != "EDITED" || invoice.IsReviewed == nil || !*invoice.IsReviewed ||
+			!invoice.PaymentScheduled.Time().Equal(scheduled) {
+			t.Errorf("invoice = %+v, want the edits kept", invoice)
+		}
+		if len(invoice.LineItems) != 1 || invoice.LineItems[0].Description != "Hosting" {
+			t.Errorf("line items = %+v, want the found line item", invoice.LineItems)
+		}
+
+		if found, err = m.SaveProcessingResult("unknown", func(*model.Invoice) []string { return nil }); err != nil || found {
+			t.Errorf("SaveProcessingResult of an unknown invoice = %v, %v, want false", found, err)
+		}
+	})
+}
+
+func TestStaleJobReclaimed(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		createTestJobs(t, m, 1)
+
+		job, err := m.ClaimJob()
+		if err != nil || job == nil {
+			t.Fatalf("ClaimJob = %v, %v", job, err)
+		}
+		if err = m.HeartbeatJob(job); err != nil {
+			t.Fatalf("HeartbeatJob = %v", err)
+		}
+		if again, err := m.ClaimJob(); err != nil || again != nil {
+			t.Fatalf("ClaimJob of a job with a heartbeat = %v, %v, want nil", again, err)
+		}
+
+		// the worker stops sending heartbeats
+		err = m.DB.Model(&model.Job{}).Where("id = ?", job.ID).UpdateColumn("updated_at", time.Now().Add(-2*staleJobTimeout)).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		reclaimed, err := m.ClaimJob()
+		if err != nil || reclaimed == nil || reclaimed.ID != job.ID || reclaimed.Attempts != 2 {
+			t.Fatalf("ClaimJob of a stale job = %+v, %v, want job %d at attempt 2", reclaimed, err, job.ID)
+		}
+
+		// the first worker lost the job, its outcome does not overwrite the new attempt
+		if err = m.HeartbeatJob(job); !errors.Is(err, ErrJobReclaimed) {
+			t.Errorf("HeartbeatJob of a reclaimed job = %v, want ErrJobReclaimed", err)
+		}
+		if err = m.CompleteJob(job); !errors.Is(err, ErrJobReclaimed) {
+			t.Errorf("CompleteJob of a reclaimed job = %v, want ErrJobReclaimed", err)
+		}
+		stored, err := m.GetJob(job.ID)
+		if err != nil || stored.Status != model.JobRunning || stored.Attempts != 2 {
+			t.Fatalf("reclaimed job = %+v, %v, want running at attempt 2", stored, err)
+		}
+
+		if err = m.RetryJob(reclaimed, errors.New("unavailable"), model.JobFailureLLM, time.Now()); err != nil {
+			t.Errorf("RetryJob of the new attempt = %v", err)
+		}
+	})
+}
+
+func TestSchedulePayments(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		for _, hash := range []string{"h1", "h2", "h3"} {
+			if err := m.UpsertInvoice(newTestInvoice(hash, hash, 100, "")); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		date := time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+		if err := m.SchedulePayments([]string{"h1", "h2"}, date); err != nil {
+			t.Fatal(err)
+		}
+		// an export checked before h2 was scheduled fails as a whole
+		if err := m.SchedulePayments([]string{"h2", "h3"}, date); !errors.Is(err, ErrPaymentScheduled) {
+			t.Errorf("SchedulePayments of a scheduled invoice = %v, want ErrPaymentScheduled", err)
+		}
+		if err := m.SchedulePayments([]string{"h3", "unknown"}, date); !errors.Is(err, ErrPaymentScheduled) {
+			t.Errorf("SchedulePayments of an unknown invoice = %v, want ErrPaymentScheduled", err)
+		}
+
+		var scheduled []string
+		err := m.DB.Model(&model.Invoice{}).Where("payment_scheduled IS NOT NULL").Order("file_hash").Pluck("file_hash", &scheduled).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(scheduled, ",") != "h1,h2" {
+			t.Errorf("scheduled invoices = %v, want [h1 h2]", scheduled)
+		}
+	})
+}
+
+func TestUpdateInvoiceRollsBack(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		if err := m.UpsertInvoice(newTestInvoice("h1", "INV-1", 10000, "")); err != nil {
+			t.Fatal(err)
+		}
+
+		// the VAT breakdown is stored after the amount, the payment and the invoice columns
+		err := m.DB.Callback().Create().Before("gorm:create").Register("test:fail_tax_lines", func(tx *gorm.DB) {
+			if tx.Statement.Table == "tax_lines" {
+				_ = tx.AddError(errors.New("tax lines are unavailable"))
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paid, id := true, "INV-2"
+		update := &model.Invoice{
+			FileHash:     "h1",
+			ID:           &id,
+			Amount:       &model.Money{Minor: 11900, Currency: "EUR"},
+			IsPaid:       &paid,
+			TaxBreakdown: []model.TaxLine{{Rate: 19, Net: &model.Money{Minor: 10000, Currency: "EUR"}, Tax: &model.Money{Minor: 1900, Currency: "EUR"}}},
+		}
+		if _, err = m.UpdateInvoice(update, true); err == nil {
+			t.Fatal("UpdateInvoice succeeded, want the failing VAT breakdown to fail it")
+		}
+
+		invoice, err := m.GetInvoiceByHash("h1")
+		if err != nil || invoice == nil {
+			t.Fatalf("GetInvoiceByHash = %v, %v", invoice, err)
+		}
+		if *invoice.ID != "INV-1" || invoice.Amount.Minor != 10000 || invoice.IsPaid != nil || invoice.PaidAmount != nil {
+			t.Errorf("invoice = %+v, want it unchanged", invoice)
+		}
+		payments, err := m.GetPayments("h1")
+		if err != nil || len(payments) != 0 {
+			t.Errorf("payments = %+v, %v, want none", payments, err)
+		}
+	})
+}
@@ -2,46 +2,81 @@ package db
 
 import (
 	"errors"
-	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
 	"go.uber.org/zap"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"strings"
 )
 
 type Manager struct {
-	DB     *gorm.DB
-	logger *zap.Logger
+	DB             *gorm.DB
+	fullTextSearch bool
+	logger         *zap.Logger
 }
 
+// newSQLiteManager opens the database file. Transactions take the write lock as they begin: one that reads first
+// cannot wait for a concurrent write to finish, such as the heartbeat of a job, and fails with a locked database
 func newSQLiteManager(file string) (*gorm.DB, error) {
-	db, err := gorm.Open(sqlite.Open(file), &gorm.Config{})
-	if err != nil {
-		return nil, err
-	}
-
-	err = db.AutoMigrate(&model.Invoice{})
-	if err != nil {
-		return nil, err
+	separator := "?"
+	if strings.Contains(file, "?") {
+		separator = "&"
 	}
+	return gorm.Open(sqlite.Open(file+separator+"_txlock=immediate"), &gorm.Config{})
+}
 
-	return db, nil
+// newPostgresManager connects to a PostgreSQL database, e.g. "host=localhost user=invoices dbname=invoices" or
+// "postgres://invoices@localhost/invoices". Several backend instances may share the database
+func newPostgresManager(dsn string) (*gorm.DB, error) {
+	return gorm.Open(postgres.Open(dsn), &gorm.Config{})
 }
 
-func NewManagerOfType(managerType string, logger *zap.Logger, args ...string) (*Manager, error) {
-	var db *gorm.DB
-	var err error
+// openDatabase connects to the database of the given manager type: "sqlite" takes the database file,
+// "postgres" takes the DSN
+func openDatabase(managerType string, args ...string) (*gorm.DB, error) {
 	switch managerType {
 	case "sqlite":
 		if len(args) != 1 {
 			return nil, errors.New("sqlite storage manager requires exactly one argument")
 		}
-		db, err = newSQLiteManager(args[0])
-		if err != nil {
-			return nil, err
+		return newSQLiteManager(args[0])
+	case "postgres":
+		if len(args) != 1 {
+			return nil, errors.New("postgres storage manager requires exactly one argument")
 		}
+		return newPostgresManager(args[0])
 	default:
 		return nil, errors.New("unknown storage manager type")
 	}
+}
+
+// NewManagerOfType creates a manager of the given type, see openDatabase for the arguments.
+// Pending migrations are applied, a database migrated by a newer binary is rejected with ErrSchemaTooNew
+func NewManagerOfType(managerType string, logger *zap.Logger, args ...string) (*Manager, error) {
+	db, err := openDatabase(managerType, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := newMigrator(db, logger)
+	if err != nil {
+		return nil, err
+	}
+	if err = migrator.Up(); err != nil {
+		return nil, err
+	}
+
+	manager := &Manager{DB: db, logger: logger}
+	if manager.isPostgres() {
+		manager.fullTextSearch = setupPostgresFullTextSearch(db, logger)
+	} else {
+		manager.fullTextSearch = setupSQLiteFullTextSearch(db, logger)
+	}
+
+	return manager, nil
+}
 
-	return &Manager{DB: db, logger: logger}, nil
+// isPostgres reports whether the manager is backed by PostgreSQL, for the queries that differ between the dialects
+func (m *Manager) isPostgres() bool {
+	return m.DB.Dialector.Name() == "postgres"
 }
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Migrations are SQL files named <version>_<name>.up.sql and <version>_<name>.down.sql, one directory per dialect.
+// Versions start at 1 and have no gaps. Every migration runs in a transaction
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockID identifies the PostgreSQL advisory lock held while migrating, so that instances starting at the same
+// time do not apply the same migration twice
+const migrationLockID = 7483920115
+
+// ErrSchemaTooNew is returned when the database has been migrated by a newer binary
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// SchemaVersion is a row of the schema_version table, one per applied migration
+type SchemaVersion struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// MigrationStatus describes the schema of a database relative to the migrations known to the binary
+type MigrationStatus struct {
+	Current int          // version of the database, 0 if no migrations are applied
+	Latest  int          // latest version known to the binary
+	Pending []*Migration // known migrations not applied yet, in order
+}
+
+// Migrator applies and rolls back the schema migrations of a database
+type Migrator struct {
+	db         *gorm.DB
+	migrations []*Migration
+
+	logger *zap.Logger
+}
+
+func newMigrator(db *gorm.DB, logger *zap.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version integer PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp NOT NULL
+	)`).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	return &Migrator{db: db, migrations: migrations, logger: logger}, nil
+}
+
+// NewMigratorOfType connects to a database the same way as NewManagerOfType, but does not touch the schema
+func NewMigratorOfType(managerType string, logger *zap.Logger, args ...string) (*Migrator, error) {
+	db, err := openDatabase(managerType, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return newMigrator(db, logger)
+}
+
+func loadMigrations(dialect string) ([]*Migration, error) {
+	dir := path.Join("migrations", dialect)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s", entry.Name())
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if match[3] == "up" {
+			migration.up = string(content)
+		} else {
+			migration.down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down files", migration.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+func (m *Migrator) latest() int {
+	return len(m.migrations)
+}
+
+func currentVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Raw(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version).Error
+	return version, err
+}
+
+func (m *Migrator) Status() (*MigrationStatus, error) {
+	current, err := currentVersion(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &MigrationStatus{Current: current, Latest: m.latest()}
+	for _, migration := range m.migrations {
+		if migration.Version > current {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status, nil
+}
+
+// CheckVersion returns ErrSchemaTooNew if the database has migrations the binary does not know about
+func (m *Migrator) CheckVersion() error {
+	current, err := currentVersion(m.db)
+	if err != nil {
+		return err
+	}
+	if current > m.latest() {
+		return fmt.Errorf("%w: database is at version %d, latest known version is %d", ErrSchemaTooNew, current, m.latest())
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations
+func (m *Migrator) Up() error {
+	return m.To(m.latest())
+}
+
+// Down rolls back the last applied migration
+func (m *Migrator) Down() error {
+	current, err := currentVersion(m.db)
+	if err != nil {
+		return err
+	}
+	if current == 0 {
+		return nil
+	}
+
+	return m.To(current - 1)
+}
+
+// To applies or rolls back migrations until the database is at the given version, 0 rolls back everything
+func (m *Migrator) To(version int) error {
+	if version < 0 || version > m.latest() {
+		return fmt.Errorf("unknown schema version %d, latest known version is %d", version, m.latest())
+	}
+	if err := m.CheckVersion(); err != nil {
+		return err
+	}
+
+	for {
+		current, err := currentVersion(m.db)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case current < version:
+			err = m.apply(m.migrations[current], true)
+		case current > version:
+			err = m.apply(m.migrations[current-1], false)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (m *Migrator) apply(migration *Migration, up bool) error {
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	logger := m.logger.With(zap.Int("version", migration.Version), zap.String("name", migration.Name), zap.String("direction", direction))
+
+	err := m.db.Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, migrationLockID).Error; err != nil {
+				return err
+			}
+		}
+
+		// another instance may have applied the migration while waiting for the lock
+		current, err := currentVersion(tx)
+		if err != nil {
+			return err
+		}
+		if up && current != migration.Version-1 || !up && current != migration.Version {
+			return nil
+		}
+
+		if up {
+			if err = tx.Exec(migration.up).Error; err != nil {
+				return err
+			}
+			return tx.Create(&SchemaVersion{Version: migration.Version, Name: migration.Name, AppliedAt: time.Now()}).Error
+		}
+
+		if err = tx.Exec(migration.down).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&SchemaVersion{}, migration.Version).Error
+	})
+	if err != nil {
+		logger.Error("Migration failed", zap.Error(err))
+		return fmt.Errorf("migration %d_%s %s failed: %w", migration.Version, migration.Name, direction, err)
+	}
+
+	logger.Info("Applied migration")
+	return nil
+}
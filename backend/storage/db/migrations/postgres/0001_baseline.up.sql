@@ -0,0 +1,13 @@
+-- The schema created by GORM AutoMigrate before versioned migrations, existing databases are adopted as is
+CREATE TABLE IF NOT EXISTS invoices (
+    file_hash text,
+    original_file_name text,
+    id text,
+    date timestamptz,
+    amount decimal,
+    is_paid boolean,
+    is_reviewed boolean,
+    raw_text text,
+    file_exists boolean,
+    PRIMARY KEY (file_hash)
+);
@@ -0,0 +1,2 @@
+-- Which extractor found each of the extracted fields, as a JSON object
+ALTER TABLE invoices ADD COLUMN field_sources text;
@@ -0,0 +1,18 @@
+-- The queue of the background processing of uploaded invoice files
+CREATE TABLE jobs (
+    id bigserial PRIMARY KEY,
+    file_hash text,
+    status text,
+    attempts bigint,
+    max_attempts bigint,
+    last_error text,
+    failure text,
+    run_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz,
+    finished_at timestamptz
+);
+
+CREATE INDEX idx_jobs_file_hash ON jobs (file_hash);
+CREATE INDEX idx_jobs_run_at ON jobs (run_at);
+CREATE INDEX idx_jobs_status ON jobs (status);
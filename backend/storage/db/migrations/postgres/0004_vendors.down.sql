@@ -0,0 +1,2 @@
+ALTER TABLE invoices DROP COLUMN vendor_id;
+DROP TABLE vendors;
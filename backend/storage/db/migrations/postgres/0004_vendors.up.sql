@@ -0,0 +1,17 @@
+CREATE TABLE vendors (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL DEFAULT '',
+    address text NOT NULL DEFAULT '',
+    vat_id text NOT NULL DEFAULT '',
+    iban text NOT NULL DEFAULT '',
+    email text NOT NULL DEFAULT '',
+    aliases text,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE INDEX idx_vendors_vat_id ON vendors (vat_id);
+CREATE INDEX idx_vendors_iban ON vendors (iban);
+
+ALTER TABLE invoices ADD COLUMN vendor_id bigint REFERENCES vendors (id) ON DELETE SET NULL;
+CREATE INDEX idx_invoices_vendor_id ON invoices (vendor_id);
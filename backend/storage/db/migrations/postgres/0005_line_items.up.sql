@@ -0,0 +1,14 @@
+CREATE TABLE line_items (
+    id bigserial PRIMARY KEY,
+    invoice_hash text NOT NULL REFERENCES invoices (file_hash) ON DELETE CASCADE,
+    position bigint NOT NULL DEFAULT 0,
+    description text NOT NULL DEFAULT '',
+    quantity decimal,
+    unit_price decimal,
+    tax_rate decimal,
+    total decimal
+);
+
+CREATE INDEX idx_line_items_invoice_hash ON line_items (invoice_hash);
+
+ALTER TABLE invoices ADD COLUMN totals_mismatch boolean NOT NULL DEFAULT false;
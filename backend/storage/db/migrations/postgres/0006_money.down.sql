@@ -0,0 +1,26 @@
+-- Amounts are converted back to the major unit of their currency, the currencies are lost
+ALTER TABLE invoices ADD COLUMN amount decimal;
+UPDATE invoices SET amount = CASE
+    WHEN amount_currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN amount_minor
+    WHEN amount_currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN amount_minor / 1000.0
+    WHEN amount_currency IN ('CLF', 'UYW') THEN amount_minor / 10000.0
+    ELSE amount_minor / 100.0
+END;
+ALTER TABLE invoices DROP COLUMN amount_minor;
+ALTER TABLE invoices DROP COLUMN amount_currency;
+
+ALTER TABLE line_items ADD COLUMN unit_price decimal;
+ALTER TABLE line_items ADD COLUMN total decimal;
+-- prices are converted with their own decimals, whatever their currency
+UPDATE line_items SET unit_price = unit_price_units / power(10::numeric, unit_price_scale);
+UPDATE line_items SET total = CASE
+    WHEN total_currency IN ('BIF', 'CLP', 'DJF', 'GNF', 'ISK', 'JPY', 'KMF', 'KRW', 'PYG', 'RWF', 'UGX', 'UYI', 'VND', 'VUV', 'XAF', 'XOF', 'XPF') THEN total_minor
+    WHEN total_currency IN ('BHD', 'IQD', 'JOD', 'KWD', 'LYD', 'OMR', 'TND') THEN total_minor / 1000.0
+    WHEN total_currency IN ('CLF', 'UYW') THEN total_minor / 10000.0
+    ELSE total_minor / 100.0
+END;
+ALTER TABLE line_items DROP COLUMN unit_price_units;
+ALTER TABLE line_items DROP COLUMN unit_price_scale;
+ALTER TABLE line_items DROP COLUMN unit_price_currency;
+ALTER TABLE line_items DROP COLUMN total_minor;
+ALTER TABLE line_items DROP COLUMN total_currency;
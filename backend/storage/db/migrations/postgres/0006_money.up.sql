@@ -0,0 +1,35 @@
+-- Amounts are stored as exact minor units along with their currency, unit prices with their own number of decimals.
+-- Existing amounts have no currency recorded, they are converted to hundredths and keep an empty currency until it is
+-- set. The ones with more than two decimals, or unit prices with more than nine, cannot be converted exactly and fail
+-- the migration with the hashes of their invoices
+DO $$
+DECLARE
+    inexact text;
+BEGIN
+    SELECT string_agg(DISTINCT file_hash, ', ') INTO inexact FROM (
+        SELECT file_hash FROM invoices WHERE amount <> round(amount, 2)
+        UNION
+        SELECT invoice_hash FROM line_items WHERE unit_price <> round(unit_price, 9) OR total <> round(total, 2)
+    ) AS hashes;
+    IF inexact IS NOT NULL THEN
+        RAISE EXCEPTION 'amounts with more than two decimals or unit prices with more than nine cannot be converted exactly, correct them first: %', inexact;
+    END IF;
+END
+$$;
+
+ALTER TABLE invoices ADD COLUMN amount_minor bigint;
+ALTER TABLE invoices ADD COLUMN amount_currency text;
+UPDATE invoices SET amount_minor = (amount * 100)::bigint;
+ALTER TABLE invoices DROP COLUMN amount;
+
+ALTER TABLE line_items ADD COLUMN unit_price_units bigint;
+ALTER TABLE line_items ADD COLUMN unit_price_scale bigint;
+ALTER TABLE line_items ADD COLUMN unit_price_currency text;
+ALTER TABLE line_items ADD COLUMN total_minor bigint;
+ALTER TABLE line_items ADD COLUMN total_currency text;
+-- the fewest decimals that hold the unit price, at least two. Unlike min_scale() this works before PostgreSQL 13
+UPDATE line_items SET unit_price_scale = coalesce(
+    (SELECT min(decimals) FROM generate_series(2, 9) AS decimals WHERE unit_price = round(unit_price, decimals)), 2);
+UPDATE line_items SET unit_price_units = (unit_price * power(10::numeric, unit_price_scale))::bigint, total_minor = (total * 100)::bigint;
+ALTER TABLE line_items DROP COLUMN unit_price;
+ALTER TABLE line_items DROP COLUMN total;
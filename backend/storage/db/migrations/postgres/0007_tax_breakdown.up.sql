@@ -0,0 +1,17 @@
+ALTER TABLE invoices ADD COLUMN net_amount_minor bigint;
+ALTER TABLE invoices ADD COLUMN net_amount_currency text;
+ALTER TABLE invoices ADD COLUMN tax_amount_minor bigint;
+ALTER TABLE invoices ADD COLUMN tax_amount_currency text;
+ALTER TABLE invoices ADD COLUMN tax_mismatch boolean NOT NULL DEFAULT false;
+
+CREATE TABLE tax_lines (
+    id bigserial PRIMARY KEY,
+    invoice_hash text NOT NULL REFERENCES invoices (file_hash) ON DELETE CASCADE,
+    rate decimal NOT NULL DEFAULT 0,
+    net_minor bigint,
+    net_currency text,
+    tax_minor bigint,
+    tax_currency text
+);
+
+CREATE INDEX idx_tax_lines_invoice_hash ON tax_lines (invoice_hash);
@@ -0,0 +1,6 @@
+ALTER TABLE invoices ADD COLUMN due_date timestamptz;
+ALTER TABLE invoices ADD COLUMN payment_terms_net_days bigint;
+ALTER TABLE invoices ADD COLUMN payment_terms_discount_percent decimal;
+ALTER TABLE invoices ADD COLUMN payment_terms_discount_days bigint;
+
+CREATE INDEX idx_invoices_due_date ON invoices (due_date);
@@ -0,0 +1,26 @@
+CREATE TABLE payments (
+    id bigserial PRIMARY KEY,
+    invoice_hash text NOT NULL REFERENCES invoices (file_hash) ON DELETE CASCADE,
+    date timestamptz,
+    amount_minor bigint NOT NULL DEFAULT 0,
+    amount_currency text NOT NULL DEFAULT '',
+    method text NOT NULL DEFAULT '',
+    reference text NOT NULL DEFAULT '',
+    note text NOT NULL DEFAULT '',
+    voided_at timestamptz,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE INDEX idx_payments_invoice_hash ON payments (invoice_hash);
+
+ALTER TABLE invoices ADD COLUMN paid_amount_minor bigint;
+ALTER TABLE invoices ADD COLUMN paid_amount_currency text;
+
+-- invoices marked as paid are paid in full, on an unknown date
+INSERT INTO payments (invoice_hash, amount_minor, amount_currency, note, created_at, updated_at)
+SELECT file_hash, amount_minor, COALESCE(amount_currency, ''), 'Marked as paid', now(), now()
+FROM invoices WHERE is_paid AND amount_minor IS NOT NULL;
+
+UPDATE invoices SET paid_amount_minor = amount_minor, paid_amount_currency = COALESCE(amount_currency, '')
+WHERE is_paid AND amount_minor IS NOT NULL;
@@ -0,0 +1,3 @@
+DROP TABLE match_proposals;
+DROP TABLE bank_transactions;
+DROP TABLE bank_imports;
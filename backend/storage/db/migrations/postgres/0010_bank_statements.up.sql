@@ -0,0 +1,47 @@
+CREATE TABLE bank_imports (
+    id bigserial PRIMARY KEY,
+    filename text NOT NULL DEFAULT '',
+    format text NOT NULL DEFAULT '',
+    account text NOT NULL DEFAULT '',
+    imported bigint NOT NULL DEFAULT 0,
+    duplicates bigint NOT NULL DEFAULT 0,
+    created_at timestamptz
+);
+
+CREATE TABLE bank_transactions (
+    id bigserial PRIMARY KEY,
+    import_id bigint NOT NULL REFERENCES bank_imports (id) ON DELETE CASCADE,
+    account text NOT NULL DEFAULT '',
+    booking_date timestamptz,
+    value_date timestamptz,
+    amount_minor bigint NOT NULL DEFAULT 0,
+    amount_currency text NOT NULL DEFAULT '',
+    counterparty text NOT NULL DEFAULT '',
+    counterparty_iban text NOT NULL DEFAULT '',
+    remittance_info text NOT NULL DEFAULT '',
+    reference text NOT NULL DEFAULT '',
+    fingerprint text NOT NULL,
+    status text NOT NULL DEFAULT 'unmatched',
+    payment_id bigint REFERENCES payments (id) ON DELETE SET NULL,
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE INDEX idx_bank_transactions_import_id ON bank_transactions (import_id);
+CREATE UNIQUE INDEX idx_bank_transactions_fingerprint ON bank_transactions (fingerprint);
+CREATE INDEX idx_bank_transactions_status ON bank_transactions (status);
+
+CREATE TABLE match_proposals (
+    id bigserial PRIMARY KEY,
+    transaction_id bigint NOT NULL REFERENCES bank_transactions (id) ON DELETE CASCADE,
+    invoice_hash text NOT NULL REFERENCES invoices (file_hash) ON DELETE CASCADE,
+    confidence decimal NOT NULL DEFAULT 0,
+    reasons text,
+    status text NOT NULL DEFAULT 'open',
+    created_at timestamptz,
+    updated_at timestamptz
+);
+
+CREATE INDEX idx_match_proposals_transaction_id ON match_proposals (transaction_id);
+CREATE INDEX idx_match_proposals_invoice_hash ON match_proposals (invoice_hash);
+CREATE INDEX idx_match_proposals_status ON match_proposals (status);
@@ -0,0 +1,4 @@
+ALTER TABLE invoices DROP COLUMN email_date;
+ALTER TABLE invoices DROP COLUMN email_message_id;
+ALTER TABLE invoices DROP COLUMN email_subject;
+ALTER TABLE invoices DROP COLUMN email_from;
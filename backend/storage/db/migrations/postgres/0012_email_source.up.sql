@@ -0,0 +1,4 @@
+ALTER TABLE invoices ADD COLUMN email_from text;
+ALTER TABLE invoices ADD COLUMN email_subject text;
+ALTER TABLE invoices ADD COLUMN email_message_id text;
+ALTER TABLE invoices ADD COLUMN email_date timestamptz;
@@ -0,0 +1,2 @@
+-- the removed control characters are not restored
+SELECT 1;
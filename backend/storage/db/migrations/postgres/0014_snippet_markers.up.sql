@@ -0,0 +1,4 @@
+-- the control characters delimit the matches in search snippets, text stored before they were removed on save would
+-- break the highlighting
+UPDATE invoices SET raw_text = translate(raw_text, chr(2) || chr(3), '')
+WHERE strpos(raw_text, chr(2)) > 0 OR strpos(raw_text, chr(3)) > 0;
@@ -0,0 +1,3 @@
+-- The full-text search table is left behind, dropping it requires the FTS5 module. Its triggers go with invoices,
+-- see setupSQLiteFullTextSearch
+DROP TABLE IF EXISTS `invoices`;
@@ -0,0 +1,13 @@
+-- The schema created by GORM AutoMigrate before versioned migrations, existing databases are adopted as is
+CREATE TABLE IF NOT EXISTS `invoices` (
+    `file_hash` text,
+    `original_file_name` text,
+    `id` text,
+    `date` datetime,
+    `amount` real,
+    `is_paid` numeric,
+    `is_reviewed` numeric,
+    `raw_text` text,
+    `file_exists` numeric,
+    PRIMARY KEY (`file_hash`)
+);
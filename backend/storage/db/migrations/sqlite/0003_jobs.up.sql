@@ -0,0 +1,18 @@
+-- The queue of the background processing of uploaded invoice files
+CREATE TABLE `jobs` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `file_hash` text,
+    `status` text,
+    `attempts` integer,
+    `max_attempts` integer,
+    `last_error` text,
+    `failure` text,
+    `run_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime,
+    `finished_at` datetime
+);
+
+CREATE INDEX `idx_jobs_file_hash` ON `jobs`(`file_hash`);
+CREATE INDEX `idx_jobs_run_at` ON `jobs`(`run_at`);
+CREATE INDEX `idx_jobs_status` ON `jobs`(`status`);
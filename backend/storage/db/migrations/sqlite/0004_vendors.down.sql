@@ -0,0 +1,3 @@
+DROP INDEX `idx_invoices_vendor_id`;
+ALTER TABLE `invoices` DROP COLUMN `vendor_id`;
+DROP TABLE `vendors`;
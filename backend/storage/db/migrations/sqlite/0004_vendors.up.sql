@@ -0,0 +1,18 @@
+CREATE TABLE `vendors` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `name` text NOT NULL DEFAULT '',
+    `address` text NOT NULL DEFAULT '',
+    `vat_id` text NOT NULL DEFAULT '',
+    `iban` text NOT NULL DEFAULT '',
+    `email` text NOT NULL DEFAULT '',
+    `aliases` text,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+
+CREATE INDEX `idx_vendors_vat_id` ON `vendors`(`vat_id`);
+CREATE INDEX `idx_vendors_iban` ON `vendors`(`iban`);
+
+-- no foreign key, SQLite cannot drop a column that is part of one. Vendors are detached from invoices on delete
+ALTER TABLE `invoices` ADD COLUMN `vendor_id` integer;
+CREATE INDEX `idx_invoices_vendor_id` ON `invoices`(`vendor_id`);
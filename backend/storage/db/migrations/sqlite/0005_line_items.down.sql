@@ -0,0 +1,2 @@
+ALTER TABLE `invoices` DROP COLUMN `totals_mismatch`;
+DROP TABLE `line_items`;
@@ -0,0 +1,14 @@
+CREATE TABLE `line_items` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `invoice_hash` text NOT NULL,
+    `position` integer NOT NULL DEFAULT 0,
+    `description` text NOT NULL DEFAULT '',
+    `quantity` real,
+    `unit_price` real,
+    `tax_rate` real,
+    `total` real
+);
+
+CREATE INDEX `idx_line_items_invoice_hash` ON `line_items`(`invoice_hash`);
+
+ALTER TABLE `invoices` ADD COLUMN `totals_mismatch` numeric NOT NULL DEFAULT false;
@@ -0,0 +1,34 @@
+-- Amounts are stored as exact minor units along with their currency, unit prices with their own number of decimals.
+-- Existing amounts have no currency recorded, they are converted to hundredths and keep an empty currency until it is
+-- set. They were stored as floating point numbers, the ones with more than two decimals, or unit prices with more than
+-- nine, cannot be converted exactly and fail the migration. They are found with
+--   SELECT file_hash, amount FROM invoices WHERE CAST(printf('%.2f', amount) AS real) <> amount;
+--   SELECT invoice_hash, unit_price, total FROM line_items
+--   WHERE CAST(printf('%.9f', unit_price) AS real) <> unit_price OR CAST(printf('%.2f', total) AS real) <> total;
+CREATE TEMP TABLE `inexact_amounts` (`file_hash` text);
+CREATE TEMP TRIGGER `inexact_amounts_abort` BEFORE INSERT ON `inexact_amounts` BEGIN
+    SELECT RAISE(ABORT, 'amounts with more than two decimals or unit prices with more than nine cannot be converted exactly, correct them first, see migration 0006_money');
+END;
+INSERT INTO `inexact_amounts` SELECT `file_hash` FROM `invoices` WHERE CAST(printf('%.2f', `amount`) AS real) <> `amount`;
+INSERT INTO `inexact_amounts` SELECT `invoice_hash` FROM `line_items`
+    WHERE CAST(printf('%.9f', `unit_price`) AS real) <> `unit_price` OR CAST(printf('%.2f', `total`) AS real) <> `total`;
+DROP TABLE `inexact_amounts`;
+
+ALTER TABLE `invoices` ADD COLUMN `amount_minor` integer;
+ALTER TABLE `invoices` ADD COLUMN `amount_currency` text;
+UPDATE `invoices` SET `amount_minor` = CAST(replace(printf('%.2f', `amount`), '.', '') AS integer) WHERE `amount` IS NOT NULL;
+ALTER TABLE `invoices` DROP COLUMN `amount`;
+
+ALTER TABLE `line_items` ADD COLUMN `unit_price_units` integer;
+ALTER TABLE `line_items` ADD COLUMN `unit_price_scale` integer;
+ALTER TABLE `line_items` ADD COLUMN `unit_price_currency` text;
+ALTER TABLE `line_items` ADD COLUMN `total_minor` integer;
+ALTER TABLE `line_items` ADD COLUMN `total_currency` text;
+-- the decimals of a price are the ones left when it is printed with nine and the trailing zeros are trimmed
+UPDATE `line_items` SET `unit_price_scale` = max(2, length(rtrim(printf('%.9f', `unit_price`), '0')) - instr(printf('%.9f', `unit_price`), '.'))
+    WHERE `unit_price` IS NOT NULL;
+UPDATE `line_items` SET `unit_price_units` = CAST(replace(printf('%.' || `unit_price_scale` || 'f', `unit_price`), '.', '') AS integer)
+    WHERE `unit_price` IS NOT NULL;
+UPDATE `line_items` SET `total_minor` = CAST(replace(printf('%.2f', `total`), '.', '') AS integer) WHERE `total` IS NOT NULL;
+ALTER TABLE `line_items` DROP COLUMN `unit_price`;
+ALTER TABLE `line_items` DROP COLUMN `total`;
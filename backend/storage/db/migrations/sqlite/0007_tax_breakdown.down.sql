@@ -0,0 +1,6 @@
+DROP TABLE `tax_lines`;
+ALTER TABLE `invoices` DROP COLUMN `tax_mismatch`;
+ALTER TABLE `invoices` DROP COLUMN `tax_amount_currency`;
+ALTER TABLE `invoices` DROP COLUMN `tax_amount_minor`;
+ALTER TABLE `invoices` DROP COLUMN `net_amount_currency`;
+ALTER TABLE `invoices` DROP COLUMN `net_amount_minor`;
@@ -0,0 +1,17 @@
+ALTER TABLE `invoices` ADD COLUMN `net_amount_minor` integer;
+ALTER TABLE `invoices` ADD COLUMN `net_amount_currency` text;
+ALTER TABLE `invoices` ADD COLUMN `tax_amount_minor` integer;
+ALTER TABLE `invoices` ADD COLUMN `tax_amount_currency` text;
+ALTER TABLE `invoices` ADD COLUMN `tax_mismatch` numeric NOT NULL DEFAULT false;
+
+CREATE TABLE `tax_lines` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `invoice_hash` text NOT NULL,
+    `rate` real NOT NULL DEFAULT 0,
+    `net_minor` integer,
+    `net_currency` text,
+    `tax_minor` integer,
+    `tax_currency` text
+);
+
+CREATE INDEX `idx_tax_lines_invoice_hash` ON `tax_lines`(`invoice_hash`);
@@ -0,0 +1,5 @@
+DROP INDEX `idx_invoices_due_date`;
+ALTER TABLE `invoices` DROP COLUMN `payment_terms_discount_days`;
+ALTER TABLE `invoices` DROP COLUMN `payment_terms_discount_percent`;
+ALTER TABLE `invoices` DROP COLUMN `payment_terms_net_days`;
+ALTER TABLE `invoices` DROP COLUMN `due_date`;
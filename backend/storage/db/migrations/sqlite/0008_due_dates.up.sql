@@ -0,0 +1,6 @@
+ALTER TABLE `invoices` ADD COLUMN `due_date` datetime;
+ALTER TABLE `invoices` ADD COLUMN `payment_terms_net_days` integer;
+ALTER TABLE `invoices` ADD COLUMN `payment_terms_discount_percent` real;
+ALTER TABLE `invoices` ADD COLUMN `payment_terms_discount_days` integer;
+
+CREATE INDEX `idx_invoices_due_date` ON `invoices`(`due_date`);
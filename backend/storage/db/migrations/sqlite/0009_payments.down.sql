@@ -0,0 +1,3 @@
+DROP TABLE `payments`;
+ALTER TABLE `invoices` DROP COLUMN `paid_amount_currency`;
+ALTER TABLE `invoices` DROP COLUMN `paid_amount_minor`;
@@ -0,0 +1,26 @@
+CREATE TABLE `payments` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `invoice_hash` text NOT NULL,
+    `date` datetime,
+    `amount_minor` integer NOT NULL DEFAULT 0,
+    `amount_currency` text NOT NULL DEFAULT '',
+    `method` text NOT NULL DEFAULT '',
+    `reference` text NOT NULL DEFAULT '',
+    `note` text NOT NULL DEFAULT '',
+    `voided_at` datetime,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+
+CREATE INDEX `idx_payments_invoice_hash` ON `payments`(`invoice_hash`);
+
+ALTER TABLE `invoices` ADD COLUMN `paid_amount_minor` integer;
+ALTER TABLE `invoices` ADD COLUMN `paid_amount_currency` text;
+
+-- invoices marked as paid are paid in full, on an unknown date
+INSERT INTO `payments` (`invoice_hash`, `amount_minor`, `amount_currency`, `note`, `created_at`, `updated_at`)
+SELECT `file_hash`, `amount_minor`, COALESCE(`amount_currency`, ''), 'Marked as paid', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM `invoices` WHERE `is_paid` AND `amount_minor` IS NOT NULL;
+
+UPDATE `invoices` SET `paid_amount_minor` = `amount_minor`, `paid_amount_currency` = COALESCE(`amount_currency`, '')
+WHERE `is_paid` AND `amount_minor` IS NOT NULL;
@@ -0,0 +1,47 @@
+CREATE TABLE `bank_imports` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `filename` text NOT NULL DEFAULT '',
+    `format` text NOT NULL DEFAULT '',
+    `account` text NOT NULL DEFAULT '',
+    `imported` integer NOT NULL DEFAULT 0,
+    `duplicates` integer NOT NULL DEFAULT 0,
+    `created_at` datetime
+);
+
+CREATE TABLE `bank_transactions` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `import_id` integer NOT NULL,
+    `account` text NOT NULL DEFAULT '',
+    `booking_date` datetime,
+    `value_date` datetime,
+    `amount_minor` integer NOT NULL DEFAULT 0,
+    `amount_currency` text NOT NULL DEFAULT '',
+    `counterparty` text NOT NULL DEFAULT '',
+    `counterparty_iban` text NOT NULL DEFAULT '',
+    `remittance_info` text NOT NULL DEFAULT '',
+    `reference` text NOT NULL DEFAULT '',
+    `fingerprint` text NOT NULL,
+    `status` text NOT NULL DEFAULT 'unmatched',
+    `payment_id` integer,
+    `created_at` datetime,
+    `updated_at` datetime
+);
+
+CREATE INDEX `idx_bank_transactions_import_id` ON `bank_transactions`(`import_id`);
+CREATE UNIQUE INDEX `idx_bank_transactions_fingerprint` ON `bank_transactions`(`fingerprint`);
+CREATE INDEX `idx_bank_transactions_status` ON `bank_transactions`(`status`);
+
+CREATE TABLE `match_proposals` (
+    `id` integer PRIMARY KEY AUTOINCREMENT,
+    `transaction_id` integer NOT NULL,
+    `invoice_hash` text NOT NULL,
+    `confidence` real NOT NULL DEFAULT 0,
+    `reasons` text,
+    `status` text NOT NULL DEFAULT 'open',
+    `created_at` datetime,
+    `updated_at` datetime
+);
+
+CREATE INDEX `idx_match_proposals_transaction_id` ON `match_proposals`(`transaction_id`);
+CREATE INDEX `idx_match_proposals_invoice_hash` ON `match_proposals`(`invoice_hash`);
+CREATE INDEX `idx_match_proposals_status` ON `match_proposals`(`status`);
@@ -0,0 +1,4 @@
+DROP INDEX `idx_invoices_payment_scheduled`;
+ALTER TABLE `invoices` DROP COLUMN `payment_scheduled`;
+
+ALTER TABLE `vendors` DROP COLUMN `bic`;
@@ -0,0 +1,4 @@
+ALTER TABLE `vendors` ADD COLUMN `bic` text NOT NULL DEFAULT '';
+
+ALTER TABLE `invoices` ADD COLUMN `payment_scheduled` datetime;
+CREATE INDEX `idx_invoices_payment_scheduled` ON `invoices`(`payment_scheduled`);
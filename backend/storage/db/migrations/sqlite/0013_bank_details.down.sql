@@ -0,0 +1,5 @@
+UPDATE `vendors` SET `iban` = `suggested_iban`, `bic` = `suggested_bic` WHERE `iban` = '';
+
+DROP INDEX `idx_vendors_suggested_iban`;
+ALTER TABLE `vendors` DROP COLUMN `suggested_bic`;
+ALTER TABLE `vendors` DROP COLUMN `suggested_iban`;
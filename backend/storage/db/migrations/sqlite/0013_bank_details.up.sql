@@ -0,0 +1,7 @@
+-- bank details found in invoice text are suggestions until the user confirms them. Where the stored ones came from is
+-- not known, they become suggestions and have to be confirmed before they are paid to
+ALTER TABLE `vendors` ADD COLUMN `suggested_iban` text NOT NULL DEFAULT '';
+ALTER TABLE `vendors` ADD COLUMN `suggested_bic` text NOT NULL DEFAULT '';
+CREATE INDEX `idx_vendors_suggested_iban` ON `vendors`(`suggested_iban`);
+
+UPDATE `vendors` SET `suggested_iban` = `iban`, `suggested_bic` = `bic`, `iban` = '', `bic` = '';
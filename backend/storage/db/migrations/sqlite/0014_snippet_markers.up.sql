@@ -0,0 +1,4 @@
+-- the control characters delimit the matches in search snippets, text stored before they were removed on save would
+-- break the highlighting
+UPDATE `invoices` SET `raw_text` = replace(replace(`raw_text`, char(2), ''), char(3), '')
+WHERE instr(`raw_text`, char(2)) > 0 OR instr(`raw_text`, char(3)) > 0;
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+	"time"
+)
+
+// baselineInvoice is the invoice model before versioned migrations, databases of that time were created by GORM
+// AutoMigrate from it
+type baselineInvoice struct {
+	FileHash         string `gorm:"primaryKey"`
+	OriginalFileName string
+	ID               *string
+	Date             *time.Time
+	Amount           *float64
+	IsPaid           *bool
+	IsReviewed       *bool
+	RawText          string
+	FileExists       bool
+}
+
+func (baselineInvoice) TableName() string {
+	return "invoices"
+}
+
+// newBaselineDatabase creates a database of the engine with the schema before versioned migrations and the invoices
+func newBaselineDatabase(t *testing.T, managerType string, invoices ...*baselineInvoice) string {
+	t.Helper()
+
+	dsn := newTestDatabase(t, managerType)
+	baseline, err := openDatabase(managerType, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if sqlDB, err := baseline.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	}()
+
+	if err = baseline.AutoMigrate(&baselineInvoice{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, invoice := range invoices {
+		if err = baseline.Create(invoice).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dsn
+}
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		id := "INV-1"
+		date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		amount := 12.34
+		paid := true
+		dsn := newBaselineDatabase(t, managerType, &baselineInvoice{
+			FileHash:         "a1",
+			OriginalFileName: "invoice.pdf",
+			ID:               &id,
+			Date:             &date,
+			Amount:           &amount,
+			IsPaid:           &paid,
+			RawText:          "Rechnung",
+			FileExists:       true,
+		})
+
+		m, err := NewManagerOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatalf("failed to migrate a baseline database: %v", err)
+		}
+		t.Cleanup(func() {
+			if sqlDB, err := m.DB.DB(); err == nil {
+				_ = sqlDB.Close()
+			}
+		})
+
+		invoices, total, err := m.QueryInvoices(InvoiceFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 || len(invoices) != 1 {
+			t.Fatalf("QueryInvoices = %d invoices, total %d, want the baseline invoice", len(invoices), total)
+		}
+
+		invoice, err := m.GetInvoiceByHash("a1")
+		if err != nil || invoice == nil {
+			t.Fatalf("GetInvoiceByHash = %v, %v", invoice, err)
+		}
+		if invoice.Amount == nil || invoice.Amount.Minor != 1234 {
+			t.Errorf("amount = %v, want 12.34", invoice.Amount)
+		}
+		if invoice.ID == nil || *invoice.ID != id || !invoice.Date.Time().Equal(date) || invoice.IsPaid == nil || !*invoice.IsPaid {
+			t.Errorf("invoice = %+v, want the fields of the baseline invoice", invoice)
+		}
+
+		// new invoices are processed by jobs, which did not exist in the baseline
+		createTestJobs(t, m, 1)
+		if job, err := m.ClaimJob(); err != nil || job == nil {
+			t.Errorf("ClaimJob = %v, %v", job, err)
+		}
+	})
+}
+
+func TestMigrateMoneyExactly(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		amounts := []float64{12.34, -0.5, 1e9 + 0.01, 0.07}
+		invoices := make([]*baselineInvoice, 0, len(amounts))
+		for i := range amounts {
+			invoices = append(invoices, &baselineInvoice{FileHash: fmt.Sprintf("h%d", i), Amount: &amounts[i]})
+		}
+		dsn := newBaselineDatabase(t, managerType, invoices...)
+
+		migrator, err := NewMigratorOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// line items are added before amounts are converted to minor units
+		if err = migrator.To(5); err != nil {
+			t.Fatal(err)
+		}
+		prices := []struct {
+			unitPrice float64
+			total     float64
+			want      model.Price
+		}{
+			{0.2345, 23.45, model.Price{Units: 2345, Scale: 4}},
+			{19.9, 39.8, model.Price{Units: 1990, Scale: 2}},
+			{0.000000001, 0, model.Price{Units: 1, Scale: 9}},
+			{1000, 1000, model.Price{Units: 100000, Scale: 2}},
+		}
+		for i, price := range prices {
+			err = migrator.db.Exec(`INSERT INTO line_items (invoice_hash, position, description, quantity, unit_price, total) VALUES (?, ?, '', 1, ?, ?)`,
+				"h0", i+1, price.unitPrice, price.total).Error
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+
+		m, err := NewManagerOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, amount := range []int64{1234, -50, 100000000001, 7} {
+			invoice, err := m.GetInvoiceByHash(fmt.Sprintf("h%d", i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if invoice.Amount == nil || *invoice.Amount != (model.Money{Minor: amount}) {
+				t.Errorf("amount of h%d = %v, want %d hundredths", i, invoice.Amount, amount)
+			}
+		}
+		invoice, err := m.GetInvoiceByHash("h0")
+		if err != nil || len(invoice.LineItems) != len(prices) {
+			t.Fatalf("GetInvoiceByHash = %+v, %v, want %d line items", invoice, err, len(prices))
+		}
+		for i, price := range prices {
+			if item := invoice.LineItems[i]; item.UnitPrice == nil || *item.UnitPrice != price.want {
+				t.Errorf("unit price %v = %+v, want %+v", price.unitPrice, item.UnitPrice, price.want)
+			}
+		}
+
+		// rolling back restores the prices
+		if err = migrator.To(5); err != nil {
+			t.Fatal(err)
+		}
+		var unitPrices []float64
+		if err = migrator.db.Table("line_items").Order("position").Pluck("unit_price", &unitPrices).Error; err != nil {
+			t.Fatal(err)
+		}
+		for i, price := range prices {
+			if unitPrices[i] != price.unitPrice {
+				t.Errorf("unit price after rolling back = %v, want %v", unitPrices[i], price.unitPrice)
+			}
+		}
+	})
+}
+
+func TestMigrateInexactMoney(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		exact, inexact := 12.34, 12.345
+		dsn := newBaselineDatabase(t, managerType,
+			&baselineInvoice{FileHash: "exact", Amount: &exact},
+			&baselineInvoice{FileHash: "inexact", Amount: &inexact})
+
+		_, err := NewManagerOfType(managerType, zap.NewNop(), dsn)
+		if err == nil || !strings.Contains(err.Error(), "cannot be converted exactly") {
+			t.Fatalf("NewManagerOfType = %v, want the inexact amount to fail the migration", err)
+		}
+
+		// the amounts are left as they are to be corrected
+		migrator, err := NewMigratorOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, err := migrator.Status()
+		if err != nil || status.Current != 5 {
+			t.Fatalf("Status = %+v, %v, want the money migration pending", status, err)
+		}
+		var amount float64
+		if err = migrator.db.Table("invoices").Where("file_hash = ?", "inexact").Pluck("amount", &amount).Error; err != nil || amount != inexact {
+			t.Errorf("amount = %v, %v, want %v", amount, err, inexact)
+		}
+	})
+}
+
+func TestMigrateSnippetMarkers(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		dsn := newTestDatabase(t, managerType)
+		migrator, err := NewMigratorOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = migrator.To(13); err != nil {
+			t.Fatal(err)
+		}
+		err = migrator.db.Exec(`INSERT INTO invoices (file_hash, original_file_name, raw_text, file_exists) VALUES (?, ?, ?, ?)`,
+			"a1", "invoice.pdf", "Wartung\x02 der \x03Heizung", true).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+		var text string
+		if err = migrator.db.Table("invoices").Pluck("raw_text", &text).Error; err != nil || text != "Wartung der Heizung" {
+			t.Errorf("raw_text = %q, %v, want the snippet delimiters removed", text, err)
+		}
+
+		if err = migrator.To(13); err != nil {
+			t.Errorf("rolling back = %v", err)
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// paymentsOrder lists payments in the order they were made, those without a date first
+const paymentsOrder = "date, id"
+
+// GetPayments returns the payments of the invoice including the voided ones, nil if the invoice does not exist
+func (m *Manager) GetPayments(hash string) ([]model.Payment, error) {
+	var count int64
+	if err := m.DB.Model(&model.Invoice{}).Where("file_hash = ?", hash).Count(&count).Error; err != nil {
+		m.logger.Error("Failed to retrieve invoice", zap.String("hash", hash), zap.Error(err))
+		return nil, err
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	payments := make([]model.Payment, 0)
+	if err := m.DB.Where("invoice_hash = ?", hash).Order(paymentsOrder).Find(&payments).Error; err != nil {
+		m.logger.Error("Failed to retrieve payments", zap.String("hash", hash), zap.Error(err))
+		return nil, err
+	}
+
+	return payments, nil
+}
+
+// GetPayment returns a payment of the invoice, nil if there is no such payment
+func (m *Manager) GetPayment(hash string, id uint) (*model.Payment, error) {
+	var payment model.Payment
+	result := m.DB.Where("invoice_hash = ?", hash).First(&payment, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		m.logger.Error("Failed to retrieve payment", zap.String("hash", hash), zap.Uint("id", id), zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return &payment, nil
+}
+
+// SavePayment records a new payment of the invoice or updates an existing one, the paid amount of the invoice is
+// updated along with it
+func (m *Manager) SavePayment(payment *model.Payment) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(payment).Error; err != nil {
+			return err
+		}
+		return refreshPaid(tx, payment.InvoiceHash)
+	})
+	if err != nil {
+		m.logger.Error("Failed to save payment", zap.String("hash", payment.InvoiceHash), zap.Error(err))
+		return err
+	}
+
+	m.logger.Info("Saved payment", zap.String("hash", payment.InvoiceHash), zap.Uint("id", payment.ID))
+	return nil
+}
+
+// DeletePayment removes a payment of the invoice, the paid amount of the invoice is updated along with it. A bank
+// transaction reconciled with the payment is unmatched again. Returns false if there is no such payment
+func (m *Manager) DeletePayment(hash string, id uint) (bool, error) {
+	deleted := false
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("invoice_hash = ?", hash).Delete(&model.Payment{}, id)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		deleted = true
+		if err := unreconcile(tx, id); err != nil {
+			return err
+		}
+		return refreshPaid(tx, hash)
+	})
+	if err != nil {
+		m.logger.Error("Failed to delete payment", zap.String("hash", hash), zap.Uint("id", id), zap.Error(err))
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// markPaid keeps isPaid updates working: marking an invoice as paid records a payment of its balance, marking it as
+// not paid voids its payments. An invoice without an amount or payments is only flagged
+func markPaid(tx *gorm.DB, hash string, paid bool) error {
+	var invoice model.Invoice
+	result := tx.Select("file_hash", "amount_minor", "amount_currency", "is_paid", "paid_amount_minor", "paid_amount_currency").
+		Where("file_hash = ?", hash).Limit(1).Find(&invoice)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("invoice " + hash + " does not exist")
+	}
+
+	if !paid {
+		result = tx.Model(&model.Payment{}).Where("invoice_hash = ? AND voided_at IS NULL", hash).Update("voided_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			return refreshPaid(tx, hash)
+		}
+		return tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Update("is_paid", false).Error
+	}
+
+	balance := invoice.Balance()
+	if (invoice.IsPaid != nil && *invoice.IsPaid) || balance == nil || balance.Minor <= 0 {
+		return tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Update("is_paid", true).Error
+	}
+
+	payment := model.Payment{
+		InvoiceHash: hash,
+		Date:        model.NewFormDate(model.Today()),
+		Amount:      *balance,
+		Note:        "Marked as paid",
+	}
+	if err := tx.Create(&payment).Error; err != nil {
+		return err
+	}
+	return refreshPaid(tx, hash)
+}
+
+// refreshInvoicePaid derives whether the invoice is paid again after its amount changed, the paid state of the invoice
+// is updated to match
+func refreshInvoicePaid(tx *gorm.DB, invoice *model.Invoice) error {
+	if err := refreshPaid(tx, invoice.FileHash); err != nil {
+		return err
+	}
+
+	var paid model.Invoice
+	result := tx.Select("file_hash", "is_paid", "paid_amount_minor", "paid_amount_currency").
+		Where("file_hash = ?", invoice.FileHash).Limit(1).Find(&paid)
+	invoice.IsPaid, invoice.PaidAmount = paid.IsPaid, paid.PaidAmount
+	return result.Error
+}
+
+// refreshPaid sums up the payments of the invoice again and derives whether it is paid. The paid flag of an invoice
+// that never had any payments is left as is
+func refreshPaid(tx *gorm.DB, hash string) error {
+	var payments []model.Payment
+	if err := tx.Where("invoice_hash = ?", hash).Find(&payments).Error; err != nil {
+		return err
+	}
+	if len(payments) == 0 {
+		return tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Updates(map[string]interface{}{
+			"paid_amount_minor":    nil,
+			"paid_amount_currency": nil,
+		}).Error
+	}
+
+	var invoice model.Invoice
+	if err := tx.Select("file_hash", "amount_minor", "amount_currency").Where("file_hash = ?", hash).Limit(1).Find(&invoice).Error; err != nil {
+		return err
+	}
+
+	paid := model.PaymentsTotal(payments)
+	columns := map[string]interface{}{
+		"is_paid":              model.Settled(invoice.Amount, paid),
+		"paid_amount_minor":    nil,
+		"paid_amount_currency": nil,
+	}
+	if paid != nil {
+		columns["paid_amount_minor"] = paid.Minor
+		columns["paid_amount_currency"] = paid.Currency
+	}
+	return tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Updates(columns).Error
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// checkPaid compares the paid flag and the balance of the stored invoice, a nil balance is one that is not known
+func checkPaid(t *testing.T, m *Manager, step string, hash string, wantPaid bool, wantBalance *int64) {
+	t.Helper()
+	invoice, err := m.GetInvoiceByHash(hash)
+	if err != nil || invoice == nil {
+		t.Fatalf("%s: GetInvoiceByHash = %v, %v", step, invoice, err)
+	}
+
+	paid := invoice.IsPaid != nil && *invoice.IsPaid
+	balance, want := invoice.Balance(), "unknown"
+	if wantBalance != nil {
+		want = strconv.FormatInt(*wantBalance, 10)
+	}
+	if paid != wantPaid || (balance == nil) != (wantBalance == nil) || balance != nil && balance.Minor != *wantBalance {
+		t.Errorf("%s: paid = %v, balance = %v, want %v, %s", step, paid, balance, wantPaid, want)
+	}
+}
+
+func minor(value int64) *int64 {
+	return &value
+}
+
+func TestPayments(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		if err := m.UpsertInvoice(newTestInvoice("h1", "INV-1", 10000, "")); err != nil {
+			t.Fatal(err)
+		}
+		date := model.NewFormDate(time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC))
+		pay := func(amount int64) *model.Payment {
+			payment := &model.Payment{InvoiceHash: "h1", Date: date, Amount: model.Money{Minor: amount, Currency: "EUR"}}
+			if err := m.SavePayment(payment); err != nil {
+				t.Fatal(err)
+			}
+			return payment
+		}
+
+		checkPaid(t, m, "unpaid", "h1", false, minor(10000))
+
+		pay(4000)
+		checkPaid(t, m, "partial payment", "h1", false, minor(6000))
+
+		second := pay(7000)
+		checkPaid(t, m, "overpayment", "h1", true, minor(-1000))
+
+		refund := pay(-1000)
+		checkPaid(t, m, "refund of the overpayment", "h1", true, minor(0))
+
+		voidedAt := time.Now()
+		second.VoidedAt = &voidedAt
+		if err := m.SavePayment(second); err != nil {
+			t.Fatal(err)
+		}
+		checkPaid(t, m, "voided payment", "h1", false, minor(7000))
+
+		if deleted, err := m.DeletePayment("h1", refund.ID); err != nil || !deleted {
+			t.Fatalf("DeletePayment = %v, %v", deleted, err)
+		}
+		checkPaid(t, m, "deleted payment", "h1", false, minor(6000))
+
+		// marking the invoice as paid records a payment of the balance
+		paid := true
+		if _, err := m.UpdateInvoice(&model.Invoice{FileHash: "h1", IsPaid: &paid}, true); err != nil {
+			t.Fatal(err)
+		}
+		checkPaid(t, m, "marked as paid", "h1", true, minor(0))
+		payments, err := m.GetPayments("h1")
+		if err != nil || len(payments) != 3 || payments[2].Amount.Minor != 6000 || payments[2].VoidedAt != nil {
+			t.Errorf("payments after marking as paid = %+v, %v, want a third payment of 6000", payments, err)
+		}
+
+		// a lower amount keeps the invoice paid, a higher one leaves a balance
+		if _, err = m.UpdateInvoice(&model.Invoice{FileHash: "h1", Amount: &model.Money{Minor: 9000, Currency: "EUR"}}, true); err != nil {
+			t.Fatal(err)
+		}
+		checkPaid(t, m, "lower amount", "h1", true, minor(-1000))
+		if _, err = m.UpdateInvoice(&model.Invoice{FileHash: "h1", Amount: &model.Money{Minor: 12000, Currency: "EUR"}}, true); err != nil {
+			t.Fatal(err)
+		}
+		checkPaid(t, m, "higher amount", "h1", false, minor(2000))
+
+		// marking it as not paid voids all of its payments, they are kept for the record
+		notPaid := false
+		if _, err = m.UpdateInvoice(&model.Invoice{FileHash: "h1", IsPaid: &notPaid}, true); err != nil {
+			t.Fatal(err)
+		}
+		checkPaid(t, m, "marked as not paid", "h1", false, minor(12000))
+		payments, err = m.GetPayments("h1")
+		if err != nil || len(payments) != 3 {
+			t.Fatalf("payments after marking as not paid = %+v, %v, want 3", payments, err)
+		}
+		for _, payment := range payments {
+			if payment.VoidedAt == nil {
+				t.Errorf("payment %d of %v was not voided", payment.ID, payment.Amount)
+			}
+		}
+	})
+}
+
+func TestMarkPaidWithoutAmount(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+		invoice := newTestInvoice("h1", "INV-1", 0, "")
+		invoice.Amount = nil
+		if err := m.UpsertInvoice(invoice); err != nil {
+			t.Fatal(err)
+		}
+
+		// without an amount the invoice is only flagged, no payment is made up
+		paid, notPaid := true, false
+		if _, err := m.UpdateInvoice(&model.Invoice{FileHash: "h1", IsPaid: &paid}, true); err != nil {
+			t.Fatal(err)
+		}
+		checkPaid(t, m, "marked as paid", "h1", true, nil)
+		if payments, err := m.GetPayments("h1"); err != nil || len(payments) != 0 {
+			t.Errorf("payments = %+v, %v, want none", payments, err)
+		}
+
+		if _, err := m.UpdateInvoice(&model.Invoice{FileHash: "h1", IsPaid: &notPaid}, true); err != nil {
+			t.Fatal(err)
+		}
+		checkPaid(t, m, "marked as not paid", "h1", false, nil)
+	})
+}
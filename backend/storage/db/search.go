@@ -0,0 +1,281 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// ErrSearchUnavailable is returned by SearchInvoices when the database does not support full-text search.
+// For SQLite, the binary has to be built with the sqlite_fts5 tag. PostgreSQL always supports it
+var ErrSearchUnavailable = errors.New("full-text search is not available")
+
+const (
+	// Snippet highlight delimiters. They are removed from the text of invoices when it is stored, see searchableText,
+	// so the text can be escaped safely before they are replaced with markup
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+	snippetTokens     = 16
+)
+
+// The FTS5 index is an external content table over invoices, the triggers keep it in sync.
+// It is not managed by migrations, the FTS5 module depends on the build
+var sqliteFullTextSearchSchema = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS invoices_fts USING fts5(id, original_file_name, raw_text, content='invoices', content_rowid='rowid')`,
+	`CREATE TRIGGER IF NOT EXISTS invoices_fts_insert AFTER INSERT ON invoices BEGIN
+		INSERT INTO invoices_fts(rowid, id, original_file_name, raw_text) VALUES (new.rowid, new.id, new.original_file_name, new.raw_text);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS invoices_fts_delete AFTER DELETE ON invoices BEGIN
+		INSERT INTO invoices_fts(invoices_fts, rowid, id, original_file_name, raw_text) VALUES ('delete', old.rowid, old.id, old.original_file_name, old.raw_text);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS invoices_fts_update AFTER UPDATE ON invoices BEGIN
+		INSERT INTO invoices_fts(invoices_fts, rowid, id, original_file_name, raw_text) VALUES ('delete', old.rowid, old.id, old.original_file_name, old.raw_text);
+		INSERT INTO invoices_fts(rowid, id, original_file_name, raw_text) VALUES (new.rowid, new.id, new.original_file_name, new.raw_text);
+	END`,
+	// index the invoices that existed before the search table or its triggers were created
+	`INSERT INTO invoices_fts(invoices_fts) VALUES ('rebuild')`,
+}
+
+// setupSQLiteFullTextSearch creates the search index if it does not exist yet. The triggers are dropped along with
+// the invoices table when migrations are rolled back, so they are checked as well.
+// Returns false if SQLite was compiled without FTS5
+func setupSQLiteFullTextSearch(db *gorm.DB, logger *zap.Logger) bool {
+	var existing int64
+	err := db.Raw(`SELECT count(*) FROM sqlite_master WHERE name IN ?`,
+		[]string{"invoices_fts", "invoices_fts_insert", "invoices_fts_delete", "invoices_fts_update"}).Scan(&existing).Error
+	if err == nil && existing == 4 {
+		return true
+	}
+
+	// a missing FTS5 module is expected and reported below, keep GORM from logging it as an error
+	quiet := db.Session(&gorm.Session{Logger: db.Logger.LogMode(gormlogger.Silent)})
+	err = quiet.Transaction(func(tx *gorm.DB) error {
+		for _, statement := range sqliteFullTextSearchSchema {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warn("Failed to set up full-text search, invoice search is disabled. Build with -tags sqlite_fts5 to enable it", zap.Error(err))
+		return false
+	}
+
+	logger.Info("Created full-text search index")
+	return true
+}
+
+// postgresSearchDocument is the text search document of an invoice. The GIN index is built over the same expression,
+// so queries have to use it verbatim. Punctuation is replaced in identifiers, so that e.g. file names are split into words
+const postgresSearchDocument = `(
+	setweight(to_tsvector('simple', regexp_replace(coalesce(id, ''), '[^[:alnum:]]+', ' ', 'g')), 'A') ||
+	setweight(to_tsvector('simple', regexp_replace(coalesce(original_file_name, ''), '[^[:alnum:]]+', ' ', 'g')), 'B') ||
+	to_tsvector('simple', coalesce(raw_text, ''))
+)`
+
+// setupPostgresFullTextSearch creates the search index if it does not exist yet. The index is optional for correctness,
+// so search stays enabled if it cannot be created
+func setupPostgresFullTextSearch(db *gorm.DB, logger *zap.Logger) bool {
+	err := db.Exec(`CREATE INDEX IF NOT EXISTS invoices_search ON invoices USING GIN (` + postgresSearchDocument + `)`).Error
+	if err != nil {
+		logger.Warn("Failed to create full-text search index, invoice search will be slow", zap.Error(err))
+	}
+
+	return true
+}
+
+// SearchInvoices returns a page of invoices matching the query, best matches first, along with the total number of matches.
+// See parseSearchQuery for the supported query syntax
+func (m *Manager) SearchInvoices(query string, offset, limit int) ([]*model.InvoiceSearchResult, int64, error) {
+	if !m.fullTextSearch {
+		return nil, 0, ErrSearchUnavailable
+	}
+
+	terms := parseSearchQuery(query)
+	if len(terms) == 0 {
+		return make([]*model.InvoiceSearchResult, 0), 0, nil
+	}
+
+	if m.isPostgres() {
+		return m.searchPostgres(postgresQuery(terms), offset, limit)
+	}
+	return m.searchSQLite(sqliteMatch(terms), offset, limit)
+}
+
+func (m *Manager) searchSQLite(match string, offset, limit int) ([]*model.InvoiceSearchResult, int64, error) {
+	var total int64
+	result := m.DB.Raw(`SELECT count(*) FROM invoices_fts WHERE invoices_fts MATCH ?`, match).Scan(&total)
+	if result.Error != nil {
+		m.logger.Error("Failed to count search results", zap.String("query", match), zap.Error(result.Error))
+		return nil, 0, result.Error
+	}
+
+	results := make([]*model.InvoiceSearchResult, 0)
+	result = m.DB.Raw(`
+		SELECT invoices.*,
+			snippet(invoices_fts, -1, ?, ?, '…', ?) AS snippet,
+			bm25(invoices_fts) AS rank
+		FROM invoices_fts
+		JOIN invoices ON invoices.rowid = invoices_fts.rowid
+		WHERE invoices_fts MATCH ?
+		ORDER BY rank
+		LIMIT ? OFFSET ?
+	`, snippetMatchStart, snippetMatchEnd, snippetTokens, match, limit, offset).Scan(&results)
+	if result.Error != nil {
+		m.logger.Error("Failed to search invoices", zap.String("query", match), zap.Error(result.Error))
+		return nil, 0, result.Error
+	}
+
+	for _, r := range results {
+		r.Snippet = highlightSnippet(r.Snippet)
+		// bm25 is negative, more negative is better. Flip it so that clients can treat it as a score
+		r.Rank = -r.Rank
+	}
+
+	return results, total, nil
+}
+
+func (m *Manager) searchPostgres(tsQuery string, offset, limit int) ([]*model.InvoiceSearchResult, int64, error) {
+	var total int64
+	result := m.DB.Raw(`SELECT count(*) FROM invoices WHERE `+postgresSearchDocument+` @@ to_tsquery('simple', ?)`, tsQuery).Scan(&total)
+	if result.Error != nil {
+		m.logger.Error("Failed to count search results", zap.String("query", tsQuery), zap.Error(result.Error))
+		return nil, 0, result.Error
+	}
+
+	headlineOptions := fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d",
+		snippetMatchStart, snippetMatchEnd, snippetTokens, snippetTokens/2)
+	results := make([]*model.InvoiceSearchResult, 0)
+	result = m.DB.Raw(`
+		SELECT invoices.*,
+			ts_headline('simple', coalesce(raw_text, ''), query, ?) AS snippet,
+			ts_rank(`+postgresSearchDocument+`, query) AS rank
+		FROM invoices, to_tsquery('simple', ?) AS query
+		WHERE `+postgresSearchDocument+` @@ query
+		ORDER BY rank DESC, file_hash
+		LIMIT ? OFFSET ?
+	`, headlineOptions, tsQuery, limit, offset).Scan(&results)
+	if result.Error != nil {
+		m.logger.Error("Failed to search invoices", zap.String("query", tsQuery), zap.Error(result.Error))
+		return nil, 0, result.Error
+	}
+
+	for _, r := range results {
+		r.Snippet = highlightSnippet(r.Snippet)
+	}
+
+	return results, total, nil
+}
+
+// searchTerm is a word or a phrase that has to appear in matching invoices
+type searchTerm struct {
+	words  []string
+	prefix bool // the last word may be the beginning of a longer word
+}
+
+// parseSearchQuery splits user input into search terms, dropping the characters that are operators in the database
+// query syntax, so that user input cannot produce syntax errors.
+// Supported syntax:
+//
+//	"exact phrase"   words in this order
+//	pref*            words starting with "pref"
+//	word             any other word
+//
+// All terms have to match
+func parseSearchQuery(input string) []searchTerm {
+	var terms []searchTerm
+	for len(input) > 0 {
+		input = strings.TrimLeftFunc(input, unicode.IsSpace)
+		if input == "" {
+			break
+		}
+
+		if input[0] == '"' {
+			end := strings.IndexByte(input[1:], '"')
+			if end < 0 {
+				end = len(input) - 1
+			}
+			if words := searchWords(input[1 : end+1]); len(words) > 0 {
+				terms = append(terms, searchTerm{words: words})
+			}
+			input = input[min(end+2, len(input)):]
+			continue
+		}
+
+		end := strings.IndexFunc(input, unicode.IsSpace)
+		if end < 0 {
+			end = len(input)
+		}
+		token := input[:end]
+		input = input[end:]
+
+		// operators without a word, such as a lone "*", are dropped
+		words := searchWords(token)
+		for _, word := range words {
+			terms = append(terms, searchTerm{words: []string{word}})
+		}
+		if strings.HasSuffix(token, "*") && len(words) > 0 {
+			terms[len(terms)-1].prefix = true
+		}
+	}
+
+	return terms
+}
+
+// searchWords splits text into words the same way the FTS5 unicode61 tokenizer does
+func searchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// sqliteMatch renders the terms as an FTS5 query
+func sqliteMatch(terms []searchTerm) string {
+	match := make([]string, 0, len(terms))
+	for _, term := range terms {
+		phrase := `"` + strings.Join(term.words, " ") + `"`
+		if term.prefix {
+			phrase += "*"
+		}
+		match = append(match, phrase)
+	}
+
+	return strings.Join(match, " ")
+}
+
+// postgresQuery renders the terms as a tsquery
+func postgresQuery(terms []searchTerm) string {
+	query := make([]string, 0, len(terms))
+	for _, term := range terms {
+		words := make([]string, 0, len(term.words))
+		for _, word := range term.words {
+			words = append(words, "'"+word+"'")
+		}
+		if term.prefix {
+			words[len(words)-1] += ":*"
+		}
+		query = append(query, "("+strings.Join(words, " <-> ")+")")
+	}
+
+	return strings.Join(query, " & ")
+}
+
+// searchableText removes the snippet highlight delimiters from the text of an invoice, so that a snippet only contains
+// the ones the database inserted
+func searchableText(text string) string {
+	return strings.NewReplacer(snippetMatchStart, "", snippetMatchEnd, "").Replace(text)
+}
+
+// highlightSnippet escapes the snippet for embedding in HTML and wraps the matched terms with <mark>
+func highlightSnippet(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, snippetMatchStart, "<mark>")
+	return strings.ReplaceAll(snippet, snippetMatchEnd, "</mark>")
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		input    string
+		want     []searchTerm
+		sqlite   string
+		postgres string
+	}{
+		{"strom*", []searchTerm{{words: []string{"strom"}, prefix: true}}, `"strom"*`, `('strom':*)`},
+		{"RE-2024*", []searchTerm{{words: []string{"RE"}}, {words: []string{"2024"}, prefix: true}},
+			`"RE" "2024"*`, `('RE') & ('2024':*)`},
+		{`"server rental" desk`, []searchTerm{{words: []string{"server", "rental"}}, {words: []string{"desk"}}},
+			`"server rental" "desk"`, `('server' <-> 'rental') & ('desk')`},
+		{`"unterminated phrase`, []searchTerm{{words: []string{"unterminated", "phrase"}}},
+			`"unterminated phrase"`, `('unterminated' <-> 'phrase')`},
+		// operators without a word do not apply to the term before them
+		{"invoice *", []searchTerm{{words: []string{"invoice"}}}, `"invoice"`, `('invoice')`},
+		{"invoice -*", []searchTerm{{words: []string{"invoice"}}}, `"invoice"`, `('invoice')`},
+		{`"server rental" *`, []searchTerm{{words: []string{"server", "rental"}}}, `"server rental"`, `('server' <-> 'rental')`},
+		{"( ) : ^ - * \"*", nil, "", ""},
+		{"", nil, "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			terms := parseSearchQuery(test.input)
+			if !reflect.DeepEqual(terms, test.want) {
+				t.Fatalf("parseSearchQuery = %+v, want %+v", terms, test.want)
+			}
+			if match := sqliteMatch(terms); match != test.sqlite {
+				t.Errorf("sqliteMatch = %q, want %q", match, test.sqlite)
+			}
+			if query := postgresQuery(terms); query != test.postgres {
+				t.Errorf("postgresQuery = %q, want %q", query, test.postgres)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		before, match, after string // stored text around the match the database delimits
+		want                 string
+	}{
+		{"the ", "hosting", " plan", "the <mark>hosting</mark> plan"},
+		{"<script>", "Hosting", "&", "&lt;script&gt;<mark>Hosting</mark>&amp;"},
+		// delimiters in the stored text are removed, only the ones inserted by the database become markup
+		{"a\x03b ", "c\x02d\x03e", " \x02f", "ab <mark>cde</mark> f"},
+	}
+	for _, test := range tests {
+		t.Run(test.want, func(t *testing.T) {
+			snippet := searchableText(test.before) + snippetMatchStart + searchableText(test.match) + snippetMatchEnd +
+				searchableText(test.after)
+			if got := highlightSnippet(snippet); got != test.want {
+				t.Errorf("highlightSnippet = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
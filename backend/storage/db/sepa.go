@@ -0,0 +1,64 @@
+package db
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// GetInvoicesForTransfer returns the invoices of the hashes along with their vendor, without their text. Hashes of
+// invoices that do not exist are left out
+func (m *Manager) GetInvoicesForTransfer(hashes []string) ([]*model.Invoice, error) {
+	invoices := make([]*model.Invoice, 0, len(hashes))
+	result := m.DB.Omit("raw_text").Preload("Vendor").Where("file_hash IN ?", hashes).Find(&invoices)
+	if result.Error != nil {
+		m.logger.Error("Failed to retrieve invoices for transfer", zap.Strings("hashes", hashes), zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return invoices, nil
+}
+
+// ErrPaymentScheduled is returned by SchedulePayments if a transfer of one of the invoices was scheduled meanwhile,
+// e.g. by a concurrent export
+var ErrPaymentScheduled = errors.New("transfer is scheduled already")
+
+// SchedulePayments marks the invoices as paid by a transfer executed on the date. Either all invoices are marked or,
+// if one of them is scheduled already or does not exist anymore, none is and ErrPaymentScheduled is returned
+func (m *Manager) SchedulePayments(hashes []string, date time.Time) error {
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Invoice{}).Where("file_hash IN ? AND payment_scheduled IS NULL", hashes).
+			Update("payment_scheduled", model.NewFormDate(date))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != int64(len(hashes)) {
+			return ErrPaymentScheduled
+		}
+		return nil
+	})
+	if errors.Is(err, ErrPaymentScheduled) {
+		return err
+	}
+	if err != nil {
+		m.logger.Error("Failed to schedule payments", zap.Strings("hashes", hashes), zap.Error(err))
+		return err
+	}
+
+	m.logger.Info("Scheduled payments", zap.Strings("hashes", hashes), zap.Time("date", date))
+	return nil
+}
+
+// UnschedulePayment clears the scheduled transfer of the invoice, e.g. after the bank rejected it. Returns false if
+// the invoice does not exist
+func (m *Manager) UnschedulePayment(hash string) (bool, error) {
+	result := m.DB.Model(&model.Invoice{}).Where("file_hash = ?", hash).Update("payment_scheduled", nil)
+	if result.Error != nil {
+		m.logger.Error("Failed to unschedule payment", zap.String("hash", hash), zap.Error(result.Error))
+		return false, result.Error
+	}
+
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+// taxColumns are the invoice columns needed to check the taxes, see model.TaxMismatch
+var taxColumns = []string{
+	"file_hash", "amount_minor", "amount_currency", "net_amount_minor", "net_amount_currency", "tax_amount_minor",
+	"tax_amount_currency",
+}
+
+// ReplaceTaxBreakdown replaces the VAT breakdown of the invoice. The sources are merged into the field sources of the
+// invoice, empty ones are removed. The tax check of the invoice is updated along with it.
+// Returns false if the invoice does not exist
+func (m *Manager) ReplaceTaxBreakdown(hash string, lines []model.TaxLine, sources model.FieldSources) (bool, error) {
+	found := false
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		found, err = replaceTaxBreakdown(tx, hash, lines, sources)
+		return err
+	})
+	if err != nil {
+		m.logger.Error("Failed to replace tax breakdown", zap.String("hash", hash), zap.Error(err))
+		return false, err
+	}
+
+	return found, nil
+}
+
+func replaceTaxBreakdown(tx *gorm.DB, hash string, lines []model.TaxLine, sources model.FieldSources) (bool, error) {
+	var invoice model.Invoice
+	result := tx.Select(append(taxColumns, "field_sources")).Where("file_hash = ?", hash).Limit(1).Find(&invoice)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+
+	if err := tx.Where("invoice_hash = ?", hash).Delete(&model.TaxLine{}).Error; err != nil {
+		return true, err
+	}
+	if err := createTaxLines(tx, hash, lines); err != nil {
+		return true, err
+	}
+
+	if invoice.FieldSources == nil {
+		invoice.FieldSources = make(model.FieldSources)
+	}
+	for field, source := range sources {
+		if source == "" {
+			delete(invoice.FieldSources, field)
+		} else {
+			invoice.FieldSources[field] = source
+		}
+	}
+
+	invoice.TaxBreakdown = lines
+	return true, tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Updates(map[string]interface{}{
+		"field_sources": invoice.FieldSources,
+		"tax_mismatch":  model.TaxMismatch(&invoice),
+	}).Error
+}
+
+// createTaxLines inserts the VAT breakdown of the invoice
+func createTaxLines(tx *gorm.DB, hash string, lines []model.TaxLine) error {
+	for i := range lines {
+		lines[i].ID = 0
+		lines[i].InvoiceHash = hash
+	}
+	for i := range lines {
+		line := lines[i]
+		if err := tx.Omit(taxLineNullColumns(&line)...).Create(&line).Error; err != nil {
+			return err
+		}
+		lines[i].ID = line.ID
+	}
+	return nil
+}
+
+// refreshTaxMismatch checks the taxes of the invoice again, after its amounts or its breakdown changed
+func refreshTaxMismatch(tx *gorm.DB, hash string) (bool, error) {
+	var invoice model.Invoice
+	result := tx.Preload("TaxBreakdown").Select(taxColumns).Where("file_hash = ?", hash).Limit(1).Find(&invoice)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, errors.New("invoice " + hash + " does not exist")
+	}
+
+	mismatch := model.TaxMismatch(&invoice)
+	result = tx.Model(&model.Invoice{}).Where("file_hash = ?", hash).Update("tax_mismatch", mismatch)
+	return mismatch, result.Error
+}
+
+// GetInvoicesForVAT returns the invoices dated within the range along with their VAT breakdown, for
+// model.SummarizeVAT. Nil bounds are not applied, invoices without a date are not included
+func (m *Manager) GetInvoicesForVAT(from, to *time.Time) ([]*model.Invoice, error) {
+	query := m.DB.Omit("raw_text").Preload("TaxBreakdown").Where("date IS NOT NULL")
+	if from != nil {
+		query = query.Where("date >= ?", *from)
+	}
+	if to != nil {
+		query = query.Where("date <= ?", *to)
+	}
+
+	invoices := make([]*model.Invoice, 0)
+	if result := query.Order("date").Find(&invoices); result.Error != nil {
+		m.logger.Error("Failed to retrieve invoices for VAT", zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return invoices, nil
+}
@@ -0,0 +1,269 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/banking"
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"strings"
+	"unicode"
+)
+
+// vendorNameThreshold is the minimal similarity of normalized names for a vendor to match, see nameSimilarity
+const vendorNameThreshold = 0.85
+
+// legalForms are dropped from vendor names before comparing them, "ACME GmbH" and "Acme" are the same vendor
+var legalForms = map[string]struct{}{
+	"ag": {}, "bv": {}, "co": {}, "corp": {}, "corporation": {}, "eg": {}, "ev": {}, "gbr": {}, "gmbh": {}, "inc": {},
+	"kg": {}, "limited": {}, "llc": {}, "llp": {}, "ltd": {}, "mbh": {}, "nv": {}, "ohg": {}, "plc": {}, "sa": {},
+	"sarl": {}, "sas": {}, "se": {}, "srl": {}, "ug": {},
+}
+
+func (m *Manager) GetVendors() ([]*model.Vendor, error) {
+	vendors := make([]*model.Vendor, 0)
+	result := m.DB.Order("name, id").Find(&vendors)
+	if result.Error != nil {
+		m.logger.Error("Failed to retrieve vendors", zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return vendors, nil
+}
+
+func (m *Manager) GetVendor(id uint) (*model.Vendor, error) {
+	var vendor model.Vendor
+	result := m.DB.First(&vendor, id)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		m.logger.Error("Failed to retrieve vendor", zap.Uint("id", id), zap.Error(result.Error))
+		return nil, result.Error
+	}
+
+	return &vendor, nil
+}
+
+func (m *Manager) CreateVendor(vendor *model.Vendor) error {
+	normalizeVendor(vendor)
+	result := m.DB.Create(vendor)
+	if result.Error != nil {
+		m.logger.Error("Failed to create vendor", zap.String("name", vendor.Name), zap.Error(result.Error))
+		return result.Error
+	}
+
+	m.logger.Info("Created vendor", zap.Uint("id", vendor.ID), zap.String("name", vendor.Name))
+	return nil
+}
+
+func (m *Manager) SaveVendor(vendor *model.Vendor) error {
+	normalizeVendor(vendor)
+	result := m.DB.Save(vendor)
+	if result.Error != nil {
+		m.logger.Error("Failed to save vendor", zap.Uint("id", vendor.ID), zap.Error(result.Error))
+		return result.Error
+	}
+
+	return nil
+}
+
+// DeleteVendor deletes a vendor and detaches it from its invoices. Returns false if the vendor does not exist
+func (m *Manager) DeleteVendor(id uint) (bool, error) {
+	deleted := false
+	err := m.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Invoice{}).Where("vendor_id = ?", id).Update("vendor_id", nil).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&model.Vendor{}, id)
+		deleted = result.RowsAffected > 0
+		return result.Error
+	})
+	if err != nil {
+		m.logger.Error("Failed to delete vendor", zap.Uint("id", id), zap.Error(err))
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// MatchVendor finds the known vendor the candidate describes, by VAT ID, IBAN and finally by a similar name or alias.
+// Suggested IBANs are matched as well, they identify the vendor even if they are not confirmed for payments.
+// Returns nil if there is no such vendor
+func (m *Manager) MatchVendor(candidate *model.Vendor) (*model.Vendor, error) {
+	normalizeVendor(candidate)
+
+	iban := candidate.IBAN
+	if iban == "" {
+		iban = candidate.SuggestedIBAN
+	}
+	for _, identifier := range []struct{ name, condition, value string }{
+		{"vat_id", "vat_id = @value", candidate.VATID},
+		{"iban", "iban = @value OR suggested_iban = @value", iban},
+	} {
+		if identifier.value == "" {
+			continue
+		}
+
+		var vendor model.Vendor
+		result := m.DB.Where(identifier.condition, sql.Named("value", identifier.value)).Order("id").Limit(1).Find(&vendor)
+		if result.Error != nil {
+			m.logger.Error("Failed to match vendor", zap.String("by", identifier.name), zap.Error(result.Error))
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 {
+			return &vendor, nil
+		}
+	}
+
+	key := vendorNameKey(candidate.Name)
+	if key == "" {
+		return nil, nil
+	}
+
+	vendors, err := m.GetVendors()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *model.Vendor
+	bestSimilarity := vendorNameThreshold
+	for _, vendor := range vendors {
+		for _, name := range append([]string{vendor.Name}, vendor.Aliases...) {
+			if similarity := nameSimilarity(key, vendorNameKey(name)); similarity >= bestSimilarity {
+				best, bestSimilarity = vendor, similarity
+			}
+		}
+	}
+
+	return best, nil
+}
+
+// MatchOrCreateVendor returns the known vendor the candidate describes, filling in the details it is missing,
+// or creates a new vendor. Candidates without a name are only matched. Returns nil if there is no vendor.
+// Only bank details of electronic invoices are set as the IBAN and BIC of the candidate, those found in the text are
+// its suggested ones and never become the bank details payments are made to
+func (m *Manager) MatchOrCreateVendor(candidate *model.Vendor) (*model.Vendor, error) {
+	vendor, err := m.MatchVendor(candidate)
+	if err != nil {
+		return nil, err
+	}
+
+	if vendor == nil {
+		if candidate.Name == "" {
+			return nil, nil
+		}
+		if err = m.CreateVendor(candidate); err != nil {
+			return nil, err
+		}
+		return candidate, nil
+	}
+
+	// master data entered by the user is never overwritten, only completed
+	updated := false
+	for _, field := range []struct {
+		target *string
+		value  string
+	}{
+		{&vendor.Address, candidate.Address},
+		{&vendor.VATID, candidate.VATID},
+		{&vendor.IBAN, candidate.IBAN},
+		{&vendor.BIC, candidate.BIC},
+		{&vendor.SuggestedIBAN, candidate.SuggestedIBAN},
+		{&vendor.SuggestedBIC, candidate.SuggestedBIC},
+		{&vendor.Email, candidate.Email},
+	} {
+		if *field.target == "" && field.value != "" {
+			*field.target = field.value
+			updated = true
+		}
+	}
+	if updated {
+		if err = m.SaveVendor(vendor); err != nil {
+			return nil, err
+		}
+	}
+
+	return vendor, nil
+}
+
+func normalizeVendor(vendor *model.Vendor) {
+	vendor.Name = strings.TrimSpace(vendor.Name)
+	vendor.Address = strings.TrimSpace(vendor.Address)
+	vendor.Email = strings.ToLower(strings.TrimSpace(vendor.Email))
+	vendor.IBAN = banking.NormalizeIBAN(vendor.IBAN)
+	vendor.BIC = banking.NormalizeBIC(vendor.BIC)
+	vendor.VATID = normalizeVATID(vendor.VATID)
+	vendor.SuggestedIBAN = banking.NormalizeIBAN(vendor.SuggestedIBAN)
+	vendor.SuggestedBIC = banking.NormalizeBIC(vendor.SuggestedBIC)
+	// a suggestion that was confirmed is not suggested anymore
+	if vendor.SuggestedIBAN == vendor.IBAN {
+		vendor.SuggestedIBAN = ""
+	}
+	if vendor.SuggestedBIC == vendor.BIC {
+		vendor.SuggestedBIC = ""
+	}
+}
+
+// normalizeVATID removes separators and upper-cases the VAT ID, "DE 123.456.789" becomes "DE123456789"
+func normalizeVATID(vatID string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, vatID)
+}
+
+// vendorNameKey lower-cases the name and drops punctuation and legal forms
+func vendorNameKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '.'
+	})
+
+	key := make([]string, 0, len(words))
+	for _, word := range words {
+		// "S.A." and "SA" are the same legal form
+		word = strings.ReplaceAll(word, ".", "")
+		if _, ok := legalForms[word]; ok || word == "" {
+			continue
+		}
+		key = append(key, word)
+	}
+
+	return strings.Join(key, " ")
+}
+
+// nameSimilarity is 1 minus the Levenshtein distance relative to the length of the longer name
+func nameSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	ar, br := []rune(a), []rune(b)
+	if len(ar) == 0 || len(br) == 0 {
+		return 0
+	}
+
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return 1 - float64(previous[len(br)])/float64(max(len(ar), len(br)))
+}
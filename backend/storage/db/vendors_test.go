@@ -0,0 +1,78 @@
+package db
+
+import (
+	"github.com/Wiblz/Fun-Invoice-Manager/backend/model"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestMatchOrCreateVendorBankDetails(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		m := newTestManager(t, managerType)
+
+		// bank details found in the text are only suggested
+		vendor, err := m.MatchOrCreateVendor(&model.Vendor{Name: "ACME GmbH", SuggestedIBAN: "DE89 3704 0044 0532 0130 00"})
+		if err != nil || vendor == nil {
+			t.Fatalf("MatchOrCreateVendor = %v, %v", vendor, err)
+		}
+		if vendor.IBAN != "" || vendor.SuggestedIBAN != "DE89370400440532013000" {
+			t.Errorf("vendor = %+v, want the IBAN suggested", vendor)
+		}
+
+		// the suggested IBAN identifies the vendor, an electronic invoice confirms it
+		matched, err := m.MatchOrCreateVendor(&model.Vendor{IBAN: "DE89370400440532013000", BIC: "COBADEFFXXX"})
+		if err != nil || matched == nil || matched.ID != vendor.ID {
+			t.Fatalf("MatchOrCreateVendor by IBAN = %+v, %v, want vendor %d", matched, err, vendor.ID)
+		}
+		if matched.IBAN != "DE89370400440532013000" || matched.BIC != "COBADEFFXXX" || matched.SuggestedIBAN != "" {
+			t.Errorf("vendor = %+v, want the IBAN of the electronic invoice confirmed", matched)
+		}
+
+		// confirmed bank details are not changed by later suggestions
+		matched, err = m.MatchOrCreateVendor(&model.Vendor{Name: "Acme", SuggestedIBAN: "GB82WEST12345698765432"})
+		if err != nil || matched == nil || matched.ID != vendor.ID {
+			t.Fatalf("MatchOrCreateVendor by name = %+v, %v, want vendor %d", matched, err, vendor.ID)
+		}
+		stored, err := m.GetVendor(vendor.ID)
+		if err != nil || stored.IBAN != "DE89370400440532013000" || stored.SuggestedIBAN != "GB82WEST12345698765432" {
+			t.Errorf("vendor = %+v, %v, want the confirmed IBAN kept and the other one suggested", stored, err)
+		}
+	})
+}
+
+func TestMigrateBankDetails(t *testing.T) {
+	forEachEngine(t, func(t *testing.T, managerType string) {
+		dsn := newTestDatabase(t, managerType)
+		migrator, err := NewMigratorOfType(managerType, zap.NewNop(), dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = migrator.To(12); err != nil {
+			t.Fatal(err)
+		}
+		err = migrator.db.Exec(`INSERT INTO vendors (name, iban, bic) VALUES ('ACME', 'DE89370400440532013000', 'COBADEFFXXX')`).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// where the stored bank details came from is not known, they have to be confirmed
+		if err = migrator.Up(); err != nil {
+			t.Fatal(err)
+		}
+		var vendor model.Vendor
+		if err = migrator.db.First(&vendor).Error; err != nil {
+			t.Fatal(err)
+		}
+		if vendor.IBAN != "" || vendor.BIC != "" || vendor.SuggestedIBAN != "DE89370400440532013000" || vendor.SuggestedBIC != "COBADEFFXXX" {
+			t.Errorf("vendor = %+v, want the bank details suggested", vendor)
+		}
+
+		if err = migrator.To(12); err != nil {
+			t.Fatal(err)
+		}
+		var iban string
+		if err = migrator.db.Table("vendors").Pluck("iban", &iban).Error; err != nil || iban != "DE89370400440532013000" {
+			t.Errorf("IBAN after rolling back = %q, %v", iban, err)
+		}
+	})
+}
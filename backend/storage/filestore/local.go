@@ -0,0 +1,176 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultLocalDir = "files"
+	// partial files being written, never listed
+	tempFilePattern = ".upload-*"
+)
+
+// LocalStore keeps files in a local directory. Links point to the backend, see SignedLinks
+type LocalStore struct {
+	dir    string
+	signer *URLSigner
+
+	logger *zap.Logger
+}
+
+// NewLocalStore creates a store in the directory, defaults to "files" in the working directory. Without a signer it
+// issues no links and rejects all of them
+func NewLocalStore(dir string, signer *URLSigner, logger *zap.Logger) (*LocalStore, error) {
+	if dir == "" {
+		dir = defaultLocalDir
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		logger.Error("failed to create filestore directory", zap.String("dir", dir), zap.Error(err))
+		return nil, err
+	}
+
+	logger.Info("using local filestore", zap.String("dir", dir))
+	return &LocalStore{dir: dir, signer: signer, logger: logger}, nil
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// Put writes the file atomically, readers never see a partially written file.
+// The content type is derived from the key extension when the file is served
+func (s *LocalStore) Put(_ context.Context, key string, reader io.Reader, _ string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(target), tempFilePattern)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(file.Name(), target); err != nil {
+		return err
+	}
+
+	s.logger.Info("file uploaded to file storage", zap.String("object", key))
+	return nil
+}
+
+func (s *LocalStore) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (s *LocalStore) Stat(_ context.Context, key string) (*ObjectInfo, error) {
+	target, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && info.IsDir()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  contentTypeOf(key),
+		LastModified: info.ModTime(),
+	}, nil
+}
+
+func (s *LocalStore) List(_ context.Context) (map[string]struct{}, error) {
+	keys := make(map[string]struct{})
+	err := filepath.WalkDir(s.dir, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+
+		relative, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		keys[filepath.ToSlash(relative)] = struct{}{}
+		return nil
+	})
+
+	return keys, err
+}
+
+func (s *LocalStore) Delete(_ context.Context, key string) error {
+	target, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *LocalStore) Link(_ context.Context, key string) (*url.URL, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+
+	return s.signer.link(key)
+}
+
+func (s *LocalStore) VerifyLink(key string, query url.Values) error {
+	return s.signer.verify(key, query)
+}
+
+// contentTypeOf guesses the content type of a file from its extension
+func contentTypeOf(key string) string {
+	if contentType := mime.TypeByExtension(path.Ext(key)); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
@@ -0,0 +1,156 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// failingReader returns some content and then fails, like an upload that is cut off
+type failingReader struct {
+	content io.Reader
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	n, err := r.content.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func newTestLocalStore(t *testing.T) (*LocalStore, string) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(dir, nil, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+	return store, dir
+}
+
+// tempFiles returns the partial files left in the directory
+func tempFiles(t *testing.T, dir string) []string {
+	matches, err := filepath.Glob(filepath.Join(dir, tempFilePattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return matches
+}
+
+func TestLocalStorePut(t *testing.T) {
+	ctx := context.Background()
+	store, dir := newTestLocalStore(t)
+
+	if err := store.Put(ctx, "invoices/a.pdf", strings.NewReader("first"), ""); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := store.Put(ctx, "invoices/a.pdf", strings.NewReader("second"), ""); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	// a failed upload leaves the stored file as it was, not partially overwritten
+	if err := store.Put(ctx, "invoices/a.pdf", &failingReader{strings.NewReader("third")}, ""); err == nil {
+		t.Errorf("Put() of a failing reader error = nil, want error")
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "invoices", "a.pdf"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if string(content) != "second" {
+		t.Errorf("stored content = %q, want %q", content, "second")
+	}
+	if leftover := tempFiles(t, filepath.Join(dir, "invoices")); len(leftover) > 0 {
+		t.Errorf("Put() left partial files %v", leftover)
+	}
+
+	for _, key := range []string{"../a.pdf", "/tmp/a.pdf", "invoices/../../a.pdf"} {
+		if err = store.Put(ctx, key, strings.NewReader("escaped"), ""); err == nil {
+			t.Errorf("Put(%q) error = nil, want error", key)
+		}
+	}
+	if _, err = os.Stat(filepath.Join(filepath.Dir(dir), "a.pdf")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Put() wrote outside the store directory")
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	store, dir := newTestLocalStore(t)
+
+	for _, key := range []string{"a.pdf", "invoices/b.png"} {
+		if err := store.Put(ctx, key, strings.NewReader(key), ""); err != nil {
+			t.Fatalf("Put(%q) error = %v", key, err)
+		}
+	}
+	// partial files of uploads in progress are not listed
+	if err := os.WriteFile(filepath.Join(dir, ".upload-123"), []byte("partial"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if want := map[string]struct{}{"a.pdf": {}, "invoices/b.png": {}}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List() = %v, want %v", keys, want)
+	}
+
+	info, err := store.Stat(ctx, "invoices/b.png")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Key != "invoices/b.png" || info.Size != int64(len("invoices/b.png")) || info.ContentType != "image/png" {
+		t.Errorf("Stat() = %+v", info)
+	}
+	reader, err := store.Get(ctx, "invoices/b.png")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != "invoices/b.png" {
+		t.Errorf("Get() = %q, want %q", content, "invoices/b.png")
+	}
+
+	tests := []struct {
+		key     string
+		want    bool
+		wantErr bool
+	}{
+		{"a.pdf", true, false},
+		{"invoices/b.png", true, false},
+		{"missing.pdf", false, false},
+		// directories are not objects
+		{"invoices", false, false},
+		{"../a.pdf", false, true},
+	}
+	for _, test := range tests {
+		got, err := Exists(ctx, store, test.key)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("Exists(%q) = %v, %v, want %v, error %v", test.key, got, err, test.want, test.wantErr)
+		}
+	}
+
+	if err = store.Delete(ctx, "a.pdf"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	// deleting is idempotent
+	if err = store.Delete(ctx, "a.pdf"); err != nil {
+		t.Errorf("Delete() of a deleted key error = %v", err)
+	}
+	if err = store.Delete(ctx, "../a.pdf"); err == nil {
+		t.Errorf("Delete(../a.pdf) error = nil, want error")
+	}
+	if exists, _ := Exists(ctx, store, "a.pdf"); exists {
+		t.Errorf("Exists() after Delete() = true, want false")
+	}
+	if _, err = store.Get(ctx, "a.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,84 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestMemoryStoreLinks(t *testing.T) {
+	config := viper.New()
+	config.Set("FILESTORE_URL", "https://invoices.example/")
+	config.Set("FILESTORE_SECRET", "secret")
+	signer, err := NewURLSigner(config, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewURLSigner() error = %v", err)
+	}
+
+	ctx := context.Background()
+	store := NewMemoryStore(signer, zap.NewNop())
+	link, err := store.Link(ctx, "invoices/a.pdf")
+	if err != nil {
+		t.Fatalf("Link() error = %v", err)
+	}
+	if want := "https://invoices.example" + FilesPath + "invoices/a.pdf"; link.Scheme+"://"+link.Host+link.Path != want {
+		t.Errorf("Link() = %s, want %s with a signature", link, want)
+	}
+	if err = store.VerifyLink("invoices/a.pdf", link.Query()); err != nil {
+		t.Errorf("VerifyLink() error = %v", err)
+	}
+	if _, err = store.Link(ctx, "../a.pdf"); err == nil {
+		t.Errorf("Link(../a.pdf) error = nil, want error")
+	}
+
+	// stores without a signer, as in tests, issue no links instead of panicking
+	unsigned := NewMemoryStore(nil, zap.NewNop())
+	if _, err = unsigned.Link(ctx, "invoices/a.pdf"); !errors.Is(err, ErrNoSigner) {
+		t.Errorf("Link() without a signer error = %v, want %v", err, ErrNoSigner)
+	}
+	if err = unsigned.VerifyLink("invoices/a.pdf", link.Query()); !errors.Is(err, ErrInvalidLink) {
+		t.Errorf("VerifyLink() without a signer error = %v, want %v", err, ErrInvalidLink)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore(nil, zap.NewNop())
+
+	if err := store.Put(ctx, "invoices/a.pdf", strings.NewReader("%PDF-1.7"), ""); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := store.Put(ctx, "/etc/passwd", strings.NewReader("root"), ""); err == nil {
+		t.Errorf("Put(/etc/passwd) error = nil, want error")
+	}
+
+	info, err := store.Stat(ctx, "invoices/a.pdf")
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if info.Size != 8 || info.ContentType != "application/pdf" {
+		t.Errorf("Stat() = %+v, want 8 bytes of application/pdf", info)
+	}
+	reader, err := store.Get(ctx, "invoices/a.pdf")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	content, _ := io.ReadAll(reader)
+	if string(content) != "%PDF-1.7" {
+		t.Errorf("Get() = %q, want %q", content, "%PDF-1.7")
+	}
+
+	if err = store.Delete(ctx, "invoices/a.pdf"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err = store.Get(ctx, "invoices/a.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err = store.Stat(ctx, "invoices/a.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat() after Delete() error = %v, want %v", err, ErrNotFound)
+	}
+}
@@ -0,0 +1,125 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+)
+
+const (
+	defaultBucket = "invoices"
+)
+
+// MinIOStore keeps files in a MinIO (or S3) bucket. Links are presigned bucket URLs
+type MinIOStore struct {
+	minioClient *minio.Client
+	bucket      string
+
+	logger *zap.Logger
+}
+
+func NewMinIOStore(config *viper.Viper, logger *zap.Logger) (*MinIOStore, error) {
+	var err error
+	var requiredConfig = []string{"MINIO_ENDPOINT", "MINIO_ACCESS_KEY", "MINIO_SECRET_KEY"}
+	for _, key := range requiredConfig {
+		if !config.IsSet(key) {
+			logger.Error("missing required config for filestore client", zap.String("config", key))
+			err = errors.New("missing required config for filestore client")
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	minioClient, err := minio.New(config.GetString("MINIO_ENDPOINT"), &minio.Options{
+		Creds:  credentials.NewStaticV4(config.GetString("MINIO_ACCESS_KEY"), config.GetString("MINIO_SECRET_KEY"), ""),
+		Secure: false,
+	})
+	if err != nil {
+		logger.Error("failed to create minio client", zap.Error(err))
+		return nil, err
+	}
+
+	bucket := config.GetString("MINIO_BUCKET")
+	if bucket == "" {
+		bucket = defaultBucket
+	}
+
+	return &MinIOStore{
+		minioClient: minioClient,
+		bucket:      bucket,
+		logger:      logger,
+	}, nil
+}
+
+func (s *MinIOStore) Link(ctx context.Context, key string) (*url.URL, error) {
+	return s.minioClient.PresignedGetObject(ctx, s.bucket, key, linkExpiry, nil)
+}
+
+// Put stores the file with its content type, which MinIO serves the file with. Without it, browsers would not
+// embed PDFs, see docs/README.md
+func (s *MinIOStore) Put(ctx context.Context, key string, reader io.Reader, contentType string) error {
+	_, err := s.minioClient.PutObject(ctx, s.bucket, key, reader, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+
+	if err == nil {
+		s.logger.Info("file uploaded to file storage", zap.String("object", key))
+	}
+
+	return err
+}
+
+func (s *MinIOStore) List(ctx context.Context) (keys map[string]struct{}, err error) {
+	objectsChannel := s.minioClient.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Recursive: true})
+	keys = make(map[string]struct{})
+	for object := range objectsChannel {
+		if object.Err != nil {
+			err = object.Err
+			continue
+		}
+		keys[object.Key] = struct{}{}
+	}
+	return
+}
+
+func (s *MinIOStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// GetObject does not fail for missing objects until the first read, stat first to report them properly
+	if _, err := s.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+
+	return s.minioClient.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+}
+
+func (s *MinIOStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	info, err := s.minioClient.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}, nil
+}
+
+func (s *MinIOStore) Delete(ctx context.Context, key string) error {
+	err := s.minioClient.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err == nil {
+		s.logger.Info("file removed from file storage", zap.String("object", key))
+	}
+
+	return err
+}
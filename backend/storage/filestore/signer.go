@@ -0,0 +1,111 @@
+package filestore
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPublicURL = "http://localhost:8080"
+	// FilesPath is where the backend serves the files of the stores implementing SignedLinks
+	FilesPath = "/api/v1/files/"
+)
+
+var (
+	// ErrInvalidLink is returned when a link is forged, malformed or expired
+	ErrInvalidLink = errors.New("invalid file link")
+	// ErrNoSigner is returned for links of stores created without a URLSigner
+	ErrNoSigner = errors.New("file links are not configured")
+)
+
+// SignedLinks is implemented by the stores that cannot serve files themselves. Their links point to FilesPath
+// of the backend, which has to verify them before serving the file
+type SignedLinks interface {
+	// VerifyLink checks the query parameters of a link to the key
+	VerifyLink(key string, query url.Values) error
+}
+
+// URLSigner issues and verifies expiring links for the stores that are served by the backend itself. Stores
+// without one cannot issue links and reject all of them
+type URLSigner struct {
+	baseURL *url.URL
+	secret  []byte
+}
+
+// NewURLSigner reads the backend public URL and the signing secret from FILESTORE_URL and FILESTORE_SECRET.
+// Without a secret a random one is generated, links issued before a restart become invalid then
+func NewURLSigner(config *viper.Viper, logger *zap.Logger) (*URLSigner, error) {
+	publicURL := config.GetString("FILESTORE_URL")
+	if publicURL == "" {
+		publicURL = defaultPublicURL
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(publicURL, "/") + FilesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := []byte(config.GetString("FILESTORE_SECRET"))
+	if len(secret) == 0 {
+		logger.Warn("FILESTORE_SECRET not set, file links will not survive a restart")
+		secret = make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &URLSigner{baseURL: baseURL, secret: secret}, nil
+}
+
+func (s *URLSigner) link(key string) (*url.URL, error) {
+	if s == nil {
+		return nil, ErrNoSigner
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(linkExpiry).Unix(), 10)
+
+	link := s.baseURL.JoinPath(key)
+	link.RawQuery = url.Values{
+		"expires":   {expires},
+		"signature": {s.signature(key, expires)},
+	}.Encode()
+	return link, nil
+}
+
+// verify checks the signature of a link to the key
+func (s *URLSigner) verify(key string, query url.Values) error {
+	if s == nil {
+		return fmt.Errorf("%w: %w", ErrInvalidLink, ErrNoSigner)
+	}
+
+	expires := query.Get("expires")
+	signature := query.Get("signature")
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed link", ErrInvalidLink)
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.signature(key, expires))) {
+		return fmt.Errorf("%w: invalid signature", ErrInvalidLink)
+	}
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("%w: link expired", ErrInvalidLink)
+	}
+
+	return nil
+}
+
+func (s *URLSigner) signature(key string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,46 @@
+package filestore
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestURLSignerVerify(t *testing.T) {
+	signer := &URLSigner{baseURL: &url.URL{Scheme: "http", Host: "localhost:8080", Path: FilesPath}, secret: []byte("secret")}
+	link, err := signer.link("invoices/a.pdf")
+	if err != nil {
+		t.Fatalf("link() error = %v", err)
+	}
+	valid := link.Query()
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name    string
+		key     string
+		query   url.Values
+		wantErr bool
+	}{
+		{"valid", "invoices/a.pdf", valid, false},
+		{"other key", "invoices/b.pdf", valid, true},
+		{"tampered signature", "invoices/a.pdf", url.Values{"expires": {valid.Get("expires")}, "signature": {signer.signature("invoices/b.pdf", valid.Get("expires"))}}, true},
+		{"extended expiry", "invoices/a.pdf", url.Values{"expires": {later}, "signature": {valid.Get("signature")}}, true},
+		{"expired", "invoices/a.pdf", url.Values{"expires": {expired}, "signature": {signer.signature("invoices/a.pdf", expired)}}, true},
+		{"other secret", "invoices/a.pdf", url.Values{"expires": {later}, "signature": {(&URLSigner{secret: []byte("other")}).signature("invoices/a.pdf", later)}}, true},
+		{"no signature", "invoices/a.pdf", url.Values{"expires": {later}}, true},
+		{"malformed expiry", "invoices/a.pdf", url.Values{"expires": {"soon"}, "signature": {signer.signature("invoices/a.pdf", "soon")}}, true},
+		{"empty", "invoices/a.pdf", url.Values{}, true},
+	}
+	for _, test := range tests {
+		err := signer.verify(test.key, test.query)
+		if (err != nil) != test.wantErr {
+			t.Errorf("verify(%s) error = %v, want error %v", test.name, err, test.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidLink) {
+			t.Errorf("verify(%s) error = %v, want %v", test.name, err, ErrInvalidLink)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+// Package filestore stores invoice files. The backend is selected by config:
+// MinIO (or any S3 compatible storage), a local directory or memory
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	TypeMinIO  = "minio"
+	TypeLocal  = "local"
+	TypeMemory = "memory"
+
+	// linkExpiry is how long the links returned by Store.Link stay valid
+	linkExpiry = 10 * time.Minute
+)
+
+// ErrNotFound is returned when the requested object is not stored
+var ErrNotFound = errors.New("object does not exist")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
+}
+
+// Store is a flat key-value storage of files. Keys may contain slashes
+type Store interface {
+	Put(ctx context.Context, key string, reader io.Reader, contentType string) error
+	// Get returns the contents of a stored object, the caller is responsible for closing the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	// List returns the keys of all stored objects
+	List(ctx context.Context) (map[string]struct{}, error)
+	Delete(ctx context.Context, key string) error
+	// Link returns a temporary URL the object can be downloaded from without further authorization
+	Link(ctx context.Context, key string) (*url.URL, error)
+}
+
+// New creates the store selected by FILESTORE_TYPE, defaults to MinIO
+func New(config *viper.Viper, logger *zap.Logger) (Store, error) {
+	storeType := config.GetString("FILESTORE_TYPE")
+	if storeType == "" {
+		storeType = TypeMinIO
+	}
+
+	switch storeType {
+	case TypeMinIO:
+		return NewMinIOStore(config, logger)
+	case TypeLocal:
+		signer, err := NewURLSigner(config, logger)
+		if err != nil {
+			return nil, err
+		}
+		return NewLocalStore(config.GetString("FILESTORE_DIR"), signer, logger)
+	case TypeMemory:
+		signer, err := NewURLSigner(config, logger)
+		if err != nil {
+			return nil, err
+		}
+		return NewMemoryStore(signer, logger), nil
+	default:
+		return nil, fmt.Errorf("unknown filestore type %q", storeType)
+	}
+}
+
+// Exists checks whether an object is stored
+func Exists(ctx context.Context, store Store, key string) (bool, error) {
+	_, err := store.Stat(ctx, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// validateKey rejects keys that could escape the storage root of the local store
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid object key %q", key)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package filestore
+
+import (
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		wantErr bool
+	}{
+		{"a.pdf", false},
+		{"invoices/2024/a.pdf", false},
+		{"..a.pdf", false},
+		{"", true},
+		{"/etc/passwd", true},
+		{"..", true},
+		{"../a.pdf", true},
+		{"invoices/../../a.pdf", true},
+		{"invoices/../a.pdf", true},
+		{"./a.pdf", true},
+		{"invoices//a.pdf", true},
+		{"invoices/", true},
+	}
+	for _, test := range tests {
+		if err := validateKey(test.key); (err != nil) != test.wantErr {
+			t.Errorf("validateKey(%q) error = %v, want error %v", test.key, err, test.wantErr)
+		}
+	}
+}
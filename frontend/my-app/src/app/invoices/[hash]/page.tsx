@@ -1,12 +1,21 @@
 import type Invoice from "@/app/models/invoice";
+import type { InvoicePage } from "@/app/models/invoice";
 import EditForm from "@/components/editForm";
+import { invoicesUrl, pageUrl } from "@/lib/urls";
 
+// generateStaticParams lists the invoices page by page, following the next links until the last page
 export async function generateStaticParams() {
-  const invoices = await fetch("http://localhost:8080/api/v1/invoices").then(
-    (res) => res.json(),
-  );
+  const hashes: { hash: string }[] = [];
+  let url: string | null = invoicesUrl();
+  while (url) {
+    const page: InvoicePage = await fetch(url).then((res) => res.json());
+    hashes.push(
+      ...page.invoices.map((invoice: Invoice) => ({ hash: invoice.fileHash })),
+    );
+    url = page.next && pageUrl(page.next);
+  }
 
-  return invoices.map((invoice: Invoice) => ({ hash: invoice.fileHash }));
+  return hashes;
 }
 
 export default async function InvoiceDetailedView({
@@ -12,18 +12,36 @@ import { Check, Clock, Euro, Eye, MoreHorizontal, Undo2 } from "lucide-react";
 import { mutate } from "swr";
 import Link from "next/link";
 import { updateInvoice } from "@/lib/api";
+import { invoiceUrl } from "@/lib/urls";
+import { formatMoney } from "@/lib/utils";
+
+// Money is an exact decimal amount, the value is a string to keep its precision
+export interface Money {
+  value: string;
+  currency: string; // ISO 4217 code, empty if not known
+}
 
 export default interface Invoice {
   fileHash: string;
   originalFileName: string;
   id: string;
   date: string;
-  amount: number;
+  amount: Money | null;
   isPaid: boolean;
   isReviewed: boolean;
   fileExists: boolean;
 }
 
+// InvoicePage is a page of the invoice listing, next and previous link the neighbouring pages and are null at the ends
+export interface InvoicePage {
+  invoices: Invoice[];
+  total: number;
+  offset: number;
+  limit: number;
+  next: string | null;
+  previous: string | null;
+}
+
 export const columns: ColumnDef<Invoice>[] = [
   {
     id: "select",
@@ -86,11 +104,7 @@ export const columns: ColumnDef<Invoice>[] = [
           href={`/invoices/${fileHash}`}
           className="hover:underline"
           onClick={() => {
-            mutate(
-              `http://localhost:8080/api/v1/invoices/${fileHash}`,
-              row.original,
-              false,
-            );
+            mutate(invoiceUrl(fileHash), row.original, false);
           }}
         >
           {originalFileName}
@@ -111,7 +125,7 @@ export const columns: ColumnDef<Invoice>[] = [
   {
     accessorKey: "amount",
     header: "Amount",
-    cell: ({ row }) => `$${row.original.amount.toFixed(2)}`,
+    cell: ({ row }) => formatMoney(row.original.amount),
   },
   {
     accessorKey: "isPaid",
@@ -137,9 +151,8 @@ export const columns: ColumnDef<Invoice>[] = [
   },
   {
     id: "actions",
-    cell: ({ row, table }) => {
+    cell: ({ row }) => {
       const invoice = row.original;
-      const mutateInvoices = table.options.meta?.mutateInvoices;
 
       return (
         <DropdownMenu>
@@ -158,8 +171,7 @@ export const columns: ColumnDef<Invoice>[] = [
             <DropdownMenuSeparator />
             <DropdownMenuItem
               onClick={() => {
-                if (!mutateInvoices) return;
-                updateInvoice(mutateInvoices, {
+                updateInvoice({
                   fileHash: invoice.fileHash,
                   isPaid: !invoice.isPaid,
                 });
@@ -179,8 +191,7 @@ export const columns: ColumnDef<Invoice>[] = [
             </DropdownMenuItem>
             <DropdownMenuItem
               onClick={() => {
-                if (!mutateInvoices) return;
-                updateInvoice(mutateInvoices, {
+                updateInvoice({
                   fileHash: invoice.fileHash,
                   isReviewed: !invoice.isReviewed,
                 });
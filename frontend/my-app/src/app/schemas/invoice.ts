@@ -5,7 +5,16 @@ import { fileSchema } from "@/app/schemas/file";
 const baseInvoiceSchema = z.object({
   id: z.string().optional(),
   date: z.string().optional(),
-  amount: z.number().optional(),
+  amount: z
+    .string()
+    .regex(/^-?\d+(\.\d+)?$/, "Amount must be a decimal number")
+    .or(z.literal(""))
+    .optional(),
+  currency: z
+    .string()
+    .regex(/^[A-Za-z]{3}$/, "Currency must be an ISO 4217 code")
+    .or(z.literal(""))
+    .optional(),
   isPaid: z.boolean().optional(),
   isReviewed: z.boolean().optional(),
 });
@@ -26,17 +26,27 @@ interface InvoiceFormProps<T extends BaseInvoiceFormData> {
   onFileChange?: (file: File | undefined) => Promise<boolean>;
 }
 
-const placeholderInvoice: Invoice = {
+const placeholderValues: BaseInvoiceFormData = {
   id: "",
   date: new Date().toISOString().split("T")[0],
-  amount: 0,
+  amount: "",
+  currency: "EUR",
   isPaid: false,
   isReviewed: false,
-  fileHash: "",
-  originalFileName: "",
-  fileExists: false,
 };
 
+// the amount of an invoice is edited as two fields, its value and its currency
+function toFormValues(invoice: Invoice): BaseInvoiceFormData {
+  return {
+    id: invoice.id,
+    date: invoice.date,
+    amount: invoice.amount?.value,
+    currency: invoice.amount?.currency,
+    isPaid: invoice.isPaid,
+    isReviewed: invoice.isReviewed,
+  };
+}
+
 export default function InvoiceForm<T extends BaseInvoiceFormData>({
   schema,
   onSubmit,
@@ -45,7 +55,7 @@ export default function InvoiceForm<T extends BaseInvoiceFormData>({
 }: InvoiceFormProps<T>) {
   const form = useForm<T>({
     resolver: zodResolver(schema),
-    defaultValues: invoice ?? placeholderInvoice,
+    defaultValues: invoice ? toFormValues(invoice) : placeholderValues,
   });
 
   const { control, reset, handleSubmit } = form;
@@ -54,10 +64,11 @@ export default function InvoiceForm<T extends BaseInvoiceFormData>({
 
   useEffect(() => {
     // iterate over the keys of T and reset them individually, except for the file field
+    const values = invoice ? toFormValues(invoice) : null;
     for (const key in form.getValues()) {
       if (key === "invoice") continue;
-      if (invoice?.[key as keyof Invoice]) {
-        form.setValue(key as keyof T, invoice[key as keyof Invoice]);
+      if (values?.[key as keyof BaseInvoiceFormData]) {
+        form.setValue(key as keyof T, values[key as keyof BaseInvoiceFormData]);
       } else {
         form.resetField(key as keyof T);
       }
@@ -98,7 +109,7 @@ export default function InvoiceForm<T extends BaseInvoiceFormData>({
                       <Input
                         ref={fileInputRef}
                         type="file"
-                        accept="application/pdf"
+                        accept="application/pdf,application/xml,text/xml,.xml,image/jpeg,image/png,image/heic,image/heif,.heic,.heif"
                         className="hidden"
                         onChange={(e) => {
                           if (!onFileChange) return;
@@ -176,11 +187,25 @@ export default function InvoiceForm<T extends BaseInvoiceFormData>({
             render={({ field }) => (
               <FormItem>
                 <FormLabel>Amount</FormLabel>
+                <FormControl>
+                  <Input inputMode="decimal" {...field} />
+                </FormControl>
+                <FormMessage />
+              </FormItem>
+            )}
+          />
+
+          <FormField
+            name="currency"
+            control={control}
+            render={({ field }) => (
+              <FormItem>
+                <FormLabel>Currency</FormLabel>
                 <FormControl>
                   <Input
-                    type="number"
+                    maxLength={3}
                     {...field}
-                    onChange={(e) => field.onChange(parseFloat(e.target.value))}
+                    onChange={(e) => field.onChange(e.target.value.toUpperCase())}
                   />
                 </FormControl>
                 <FormMessage />
@@ -188,9 +213,6 @@ export default function InvoiceForm<T extends BaseInvoiceFormData>({
             )}
           />
 
-          <div />
-          {/* Dummy */}
-
           <div className="flex flex-col space-y-2">
             <FormField
               name="isPaid"
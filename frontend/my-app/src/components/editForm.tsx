@@ -1,6 +1,6 @@
 "use client";
 
-import { useInvoice, useInvoices } from "@/hooks/use-invoices";
+import { useInvoice } from "@/hooks/use-invoices";
 import { EditInvoiceFormData, editInvoiceSchema } from "@/app/schemas/invoice";
 import InvoiceForm from "@/components/InvoiceForm";
 import { updateInvoice } from "@/lib/api";
@@ -16,14 +16,15 @@ import { useState } from "react";
 
 export default function EditForm({ hash }: { hash: string }) {
   const { data: invoice } = useInvoice(hash);
-  const { mutate } = useInvoices();
   const [previewActive, setPreviewActive] = useState(false);
   const fileHash = invoice?.fileHash;
 
   const onSubmit = async (data: EditInvoiceFormData) => {
     try {
-      updateInvoice(mutate, {
-        ...data,
+      const { amount, currency, ...fields } = data;
+      await updateInvoice({
+        ...fields,
+        ...(amount && currency ? { amount: { value: amount, currency } } : {}),
         fileHash: hash,
       });
     } catch {
@@ -4,10 +4,11 @@ import type Invoice from "@/app/models/invoice";
 import { Card, CardContent, CardHeader } from "@/components/ui/card";
 import Link from "next/link";
 import { Button } from "@/components/ui/button";
-import { Upload } from "lucide-react";
+import { ChevronLeft, ChevronRight, Upload } from "lucide-react";
 import PdfViewer from "@/components/pdf-viewer";
 import { useState } from "react";
 import { useInvoices } from "@/hooks/use-invoices";
+import { invoicesUrl, pageUrl } from "@/lib/urls";
 import InvoiceTable from "@/components/invoiceTable";
 import {
   ResizableHandle,
@@ -17,8 +18,9 @@ import {
 
 export default function InvoiceList() {
   const [selectedInvoice, setSelectedInvoice] = useState<Invoice | null>(null);
-  const { data } = useInvoices();
-  const invoices: Invoice[] = data ?? [];
+  const [url, setUrl] = useState(invoicesUrl());
+  const { data: page } = useInvoices(url);
+  const invoices: Invoice[] = page?.invoices ?? [];
 
   return (
     <div className="container h-screen p-4 flex mx-auto">
@@ -52,6 +54,32 @@ export default function InvoiceList() {
                     }
                   }}
                 />
+                {page && page.total > 0 && (
+                  <div className="flex items-center justify-end gap-4 mt-4">
+                    <span className="text-sm text-zinc-600">
+                      {page.offset + 1}–{page.offset + invoices.length} of{" "}
+                      {page.total}
+                    </span>
+                    <Button
+                      variant="outline"
+                      title="Previous page"
+                      disabled={!page.previous}
+                      onClick={() =>
+                        page.previous && setUrl(pageUrl(page.previous))
+                      }
+                    >
+                      <ChevronLeft />
+                    </Button>
+                    <Button
+                      variant="outline"
+                      title="Next page"
+                      disabled={!page.next}
+                      onClick={() => page.next && setUrl(pageUrl(page.next))}
+                    >
+                      <ChevronRight />
+                    </Button>
+                  </div>
+                )}
               </CardContent>
             </Card>
           </div>
@@ -2,29 +2,28 @@ import {TableCell, TableRow} from "@/components/ui/table";
 import {Button} from "@/components/ui/button";
 import Invoice from "@/app/models/invoice";
 import {Checkbox} from "@/components/ui/checkbox";
-import {useInvoices} from "@/hooks/use-invoices";
+import {invoiceUrl} from "@/lib/urls";
 import {updateInvoice} from "@/lib/api";
 import {CircleAlert} from "lucide-react";
 import Link from "next/link";
 import {mutate} from "swr";
+import {formatMoney} from "@/lib/utils";
 
 export default function InvoiceRow({invoice, onView}: {
   invoice: Invoice,
   onView: () => void
 }) {
-  const {mutate: mutateInvoices} = useInvoices();
-
   return (
     <TableRow className={invoice.isReviewed ? '' : 'bg-zinc-200'}>
       <TableCell>
         <Checkbox checked={invoice.isReviewed} onCheckedChange={async () => {
-          updateInvoice(mutateInvoices, {fileHash: invoice.fileHash, isReviewed: !invoice.isReviewed});
+          updateInvoice({fileHash: invoice.fileHash, isReviewed: !invoice.isReviewed});
         }}/>
       </TableCell>
       <TableCell>
         <Link href={`/invoices/${invoice.fileHash}`}
               onClick={() => {
-                mutate(`http://localhost:8080/api/v1/invoices/${invoice.fileHash}`, invoice, false);
+                mutate(invoiceUrl(invoice.fileHash), invoice, false);
               }}>
           {invoice.id || <span className="text-zinc-600">unknown</span>}
         </Link>
@@ -42,12 +41,12 @@ export default function InvoiceRow({invoice, onView}: {
           </span>
         )}
       </TableCell>
-      <TableCell>{invoice.amount}</TableCell>
+      <TableCell>{formatMoney(invoice.amount)}</TableCell>
       <TableCell
         className={invoice.isPaid ? 'text-green-700' : 'text-amber-500'}
       >
         <Button variant="outline" title={invoice.isPaid ? 'Set as pending' : 'Set as paid'} onClick={async () => {
-          updateInvoice(mutateInvoices, {fileHash: invoice.fileHash, isPaid: !invoice.isPaid});
+          updateInvoice({fileHash: invoice.fileHash, isPaid: !invoice.isPaid});
         }}>
           {invoice.isPaid ? 'Paid' : 'Pending'}
         </Button>
@@ -12,7 +12,6 @@ import {
   TableHeader,
   TableRow,
 } from "@/components/ui/table";
-import { useInvoices } from "@/hooks/use-invoices";
 
 export default function InvoiceTable({
   invoices,
@@ -21,14 +20,11 @@ export default function InvoiceTable({
   invoices: Invoice[];
   onPreview: (invoice: Invoice) => void;
 }) {
-  const { mutate } = useInvoices();
-
   const table = useReactTable({
     data: invoices,
     columns,
     getCoreRowModel: getCoreRowModel(),
     meta: {
-      mutateInvoices: mutate,
       selectPreviewedInvoice: onPreview,
     },
   });
@@ -1,11 +1,15 @@
 import useSWR from "swr";
+import type Invoice from "@/app/models/invoice";
+import type { InvoicePage } from "@/app/models/invoice";
+import { invoicesUrl, invoiceUrl } from "@/lib/urls";
 
 const fetcher = (url: string) => fetch(url).then((res) => res.json());
 
-export function useInvoices() {
-  return useSWR("http://localhost:8080/api/v1/invoices", fetcher);
+// useInvoices loads a page of the listing, url is the first page or a resolved next or previous link
+export function useInvoices(url: string = invoicesUrl()) {
+  return useSWR<InvoicePage>(url, fetcher);
 }
 
 export function useInvoice(hash: string) {
-  return useSWR(`http://localhost:8080/api/v1/invoice/${hash}`, fetcher);
+  return useSWR<Invoice>(invoiceUrl(hash), fetcher);
 }
@@ -1,8 +1,20 @@
 import type Invoice from "@/app/models/invoice";
-import {KeyedMutator} from "swr";
+import type {InvoicePage} from "@/app/models/invoice";
+import {mutate} from "swr";
+import {invoiceUrl, isInvoicesUrl} from "@/lib/urls";
 
 export enum ErrorCode {
   INVOICE_ALREADY_EXISTS = 'INVOICE_ALREADY_EXISTS',
+  INVALID_FILE_TYPE = 'INVALID_FILE_TYPE',
+  FILE_TOO_LARGE = 'FILE_TOO_LARGE',
+  ENCRYPTED_PDF = 'ENCRYPTED_PDF',
+  PDF_JAVASCRIPT = 'PDF_JAVASCRIPT',
+  TOO_MANY_PAGES = 'TOO_MANY_PAGES',
+  NOT_FOUND = 'NOT_FOUND',
+  VALIDATION_FAILED = 'VALIDATION_FAILED',
+  STORAGE_UNAVAILABLE = 'STORAGE_UNAVAILABLE',
+  LLM_FAILURE = 'LLM_FAILURE',
+  SERVICE_UNAVAILABLE = 'SERVICE_UNAVAILABLE',
   SERVER_ERROR = 'SERVER_ERROR'
 }
 
@@ -15,6 +27,26 @@ export interface APIResponse<T> {
   };
 }
 
+type APIError = NonNullable<APIResponse<unknown>['error']>;
+
+// readError reads the error envelope of a failed response, falling back to a generic error for non-JSON bodies
+async function readError(response: Response, message: string): Promise<APIError> {
+  try {
+    const body = await response.json();
+    if (body?.error?.code) {
+      return body.error;
+    }
+  } catch {
+    // not an error envelope
+  }
+
+  return {
+    code: ErrorCode.SERVER_ERROR,
+    message,
+    details: response.statusText
+  };
+}
+
 async function sendRequest(url: string, {arg}: { arg: Record<string, unknown> }) {
   return fetch(url, {
     method: 'PATCH',
@@ -37,17 +69,17 @@ export const updateMultipleInvoiceFields = (filename: string, updates: Partial<I
   return () => sendRequest(`http://localhost:8080/api/v1/invoice/${filename}`, {arg: updates});
 }
 
-export const updateInvoice = (mutate: KeyedMutator<Invoice[]>, update: Partial<Invoice>) => {
+// updateInvoice saves the update and replaces the invoice in the cached listing pages and its detail view
+export const updateInvoice = async (update: Partial<Invoice>) => {
   if (!update.fileHash) return;
   const filename = update.fileHash;
 
-  mutate(updateMultipleInvoiceFields(filename, update), {
-    populateCache: (updatedInvoice: Invoice, invoices: Invoice[] | undefined): Invoice[] => {
-      if (!invoices) return [];
-      return invoices.map((invoice: Invoice) => invoice.fileHash === updatedInvoice.fileHash ? updatedInvoice : invoice);
-    },
-    revalidate: false
-  });
+  const updatedInvoice: Invoice = await updateMultipleInvoiceFields(filename, update)();
+  await mutate(isInvoicesUrl, (page?: InvoicePage) => page && {
+    ...page,
+    invoices: page.invoices.map((invoice: Invoice) => invoice.fileHash === updatedInvoice.fileHash ? updatedInvoice : invoice)
+  }, {revalidate: false});
+  await mutate(invoiceUrl(filename), updatedInvoice, {revalidate: false});
 }
 
 export async function uploadInvoice(formData: FormData): Promise<APIResponse<null>> {
@@ -58,24 +90,7 @@ export async function uploadInvoice(formData: FormData): Promise<APIResponse<nul
     })
 
     if (!response.ok) {
-      switch (response.status) {
-        case 409:
-          return {
-            error: {
-              code: ErrorCode.INVOICE_ALREADY_EXISTS,
-              message: "Upload failed",
-              details: "Invoice already exists"
-            }
-          };
-        default:
-          return {
-            error: {
-              code: ErrorCode.SERVER_ERROR,
-              message: "Upload failed",
-              details: await response.text()
-            }
-          };
-      }
+      return {error: await readError(response, "Upload failed")};
     }
 
     return {data: null};
@@ -95,13 +110,7 @@ export async function checkFileExists(hash: string): Promise<APIResponse<{invoic
     const response = await fetch(`http://localhost:8080/api/v1/invoice/${hash}/exists`);
 
     if (!response.ok) {
-      return {
-        error: {
-          code: ErrorCode.SERVER_ERROR,
-          message: "Check file exists failed",
-          details: await response.text()
-        }
-      };
+      return {error: await readError(response, "Check file exists failed")};
     }
 
     return {data: await response.json()};
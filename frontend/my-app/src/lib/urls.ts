@@ -0,0 +1,16 @@
+export const API_URL = "http://localhost:8080/api/v1";
+
+// INVOICES_PAGE_SIZE is the number of invoices shown per page of the listing
+export const INVOICES_PAGE_SIZE = 50;
+
+export const invoicesUrl = (offset = 0) =>
+  `${API_URL}/invoices?offset=${offset}&limit=${INVOICES_PAGE_SIZE}`;
+
+export const invoiceUrl = (hash: string) => `${API_URL}/invoice/${hash}`;
+
+// isInvoicesUrl matches the cache keys of all pages of the listing
+export const isInvoicesUrl = (key: unknown) =>
+  typeof key === "string" && key.startsWith(`${API_URL}/invoices?`);
+
+// pageUrl resolves a next or previous link of a listing page, the links are relative to the server
+export const pageUrl = (link: string) => new URL(link, API_URL).toString();
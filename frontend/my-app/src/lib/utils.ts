@@ -1,5 +1,6 @@
 import { type ClassValue, clsx } from "clsx";
 import { twMerge } from "tailwind-merge";
+import type { Money } from "@/app/models/invoice";
 
 export type SingleFieldUpdate<T> = {
   [K in keyof T]: Required<Pick<T, K>> &
@@ -20,6 +21,20 @@ export async function calculateFileHash(file: File): Promise<string> {
   return hashHex;
 }
 
+// formatMoney formats an amount in its currency, amounts without a known currency are shown as plain numbers
+export function formatMoney(money: Money | null | undefined): string {
+  if (!money) return "";
+  if (!money.currency) return money.value;
+
+  const fractionDigits = money.value.split(".")[1]?.length ?? 0;
+  return new Intl.NumberFormat(undefined, {
+    style: "currency",
+    currency: money.currency,
+    minimumFractionDigits: fractionDigits,
+    maximumFractionDigits: fractionDigits,
+  }).format(Number(money.value));
+}
+
 export function cn(...inputs: ClassValue[]) {
   return twMerge(clsx(inputs));
 }